@@ -0,0 +1,133 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build js && wasm
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"syscall/js"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/converter/modsecurity"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+)
+
+// jsOption returns the string value of an option from a JS object
+func jsOption(opts js.Value, name, def string) string {
+	if opts.Type() != js.TypeObject {
+		return def
+	}
+	v := opts.Get(name)
+	if v.Type() != js.TypeString {
+		return def
+	}
+	return v.String()
+}
+
+// jsBoolOption returns the boolean value of an option from a JS object
+func jsBoolOption(opts js.Value, name string, def bool) bool {
+	if opts.Type() != js.TypeObject {
+		return def
+	}
+	v := opts.Get(name)
+	if v.Type() != js.TypeBoolean {
+		return def
+	}
+	return v.Bool()
+}
+
+// jsIntOption returns the integer value of an option from a JS object
+func jsIntOption(opts js.Value, name string, def int) int {
+	if opts.Type() != js.TypeObject {
+		return def
+	}
+	v := opts.Get(name)
+	if v.Type() != js.TypeNumber {
+		return def
+	}
+	return v.Int()
+}
+
+// convertJS is the JS binding for modsecurity.Convert.
+// It takes the ModSecurity rules content and an optional options object
+// and returns {files: {filename: yaml}} or {error: message}.
+func convertJS(_ js.Value, args []js.Value) any {
+	result := map[string]any{}
+	if len(args) < 1 || args[0].Type() != js.TypeString {
+		result["error"] = "expected ModSecurity rules content as first argument"
+		return js.ValueOf(result)
+	}
+	var opts js.Value
+	if len(args) > 1 {
+		opts = args[1]
+	}
+
+	files, err := convertToFiles(args[0].String(), opts)
+	if err != nil {
+		result["error"] = err.Error()
+		return js.ValueOf(result)
+	}
+	result["files"] = files
+	return js.ValueOf(result)
+}
+
+// convertToFiles converts the source and encodes each ruleset to YAML,
+// indexed by output file name.
+func convertToFiles(source string, opts js.Value) (map[string]any, error) {
+	namespace := jsOption(opts, "namespace", "")
+	if !crowler.ValidNamespace(namespace) {
+		return nil, fmt.Errorf("invalid namespace %q", namespace)
+	}
+	validFrom, err := validity.Normalize(jsOption(opts, "validFrom", ""))
+	if err != nil {
+		return nil, err
+	}
+	expires, err := validity.Normalize(jsOption(opts, "expires", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	rulesets, err := modsecurity.Convert(strings.NewReader(source), modsecurity.Options{
+		Options: converter.Options{
+			SourceLicense: jsOption(opts, "sourceLicense", modsecurity.DefaultSourceLicense),
+			ValidFrom:     validFrom,
+			Expires:       expires,
+			Namespace:     namespace,
+			Normalize:     jsBoolOption(opts, "normalize", true),
+		},
+		ParanoiaLevel: jsIntOption(opts, "paranoiaLevel", 0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]any{}
+	for _, ruleset := range rulesets {
+		data, err := crowler.Marshal(ruleset)
+		if err != nil {
+			return nil, err
+		}
+		files[ruleset.FileName] = string(data)
+	}
+	return files, nil
+}
+
+func main() {
+	js.Global().Set("crowlerConvertModSecurity", js.FuncOf(convertJS))
+	select {} // keep the Go runtime alive for JS callers
+}
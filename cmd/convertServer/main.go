@@ -0,0 +1,70 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command convertServer serves the converters over gRPC (see
+// pkg/service), for the pipelines regenerating rulesets continuously.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/service"
+	"gotests/thecrowler-rules-converters/pkg/service/convertpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+func main() {
+	listen := flag.String("listen", ":50051", "Address to listen on for the gRPC connections")
+	withReflection := flag.Bool("reflection", false, "Also serve the gRPC reflection service, for the clients without the .proto file (e.g. grpcurl)")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logging.Fatalf("Error listening on %s: %v", *listen, err)
+	}
+	server := grpc.NewServer()
+	convertpb.RegisterConverterServer(server, service.NewServer())
+	if *withReflection {
+		reflection.Register(server)
+	}
+
+	// On SIGINT or SIGTERM the server stops accepting conversions and
+	// waits for the running ones
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	fmt.Fprintf(status, "Serving the converters on %s...\n", listener.Addr())
+	if err := server.Serve(listener); err != nil {
+		logging.Fatalf("Error serving on %s: %v", *listen, err)
+	}
+	fmt.Fprintln(status, "Server stopped.")
+}
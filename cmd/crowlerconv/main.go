@@ -0,0 +1,71 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/cli"
+	"gotests/thecrowler-rules-converters/pkg/converter"
+)
+
+func usage() {
+	var b strings.Builder
+	b.WriteString("Usage: crowlerconv <converter> [flags]\n       crowlerconv --auto [flags]\n       crowlerconv diff [flags] <old rulesets> <new rulesets>\n       crowlerconv validate <rulesets>\n       crowlerconv lint [flags] <rulesets>\n\nConverters:\n")
+	for _, c := range converter.All() {
+		fmt.Fprintf(&b, "  %-11s %s\n", c.Name(), c.Info().Summary)
+	}
+	b.WriteString("\nWith --auto the converter is chosen by sniffing the input file.\n")
+	b.WriteString("With diff the detection rules of two rulesets are compared, with validate\n")
+	b.WriteString("rulesets are checked against the ruleset schema, with lint their rules are\n")
+	b.WriteString("checked for empty rules, broad patterns and other likely mistakes.\n")
+	b.WriteString("Run crowlerconv <converter> -h for the converter flags.\n")
+	fmt.Fprint(os.Stderr, b.String())
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "-help" || os.Args[1] == "--help" {
+		usage()
+		os.Exit(2)
+	}
+
+	if os.Args[1] == "-auto" || os.Args[1] == "--auto" {
+		cli.Run(nil, "crowlerconv --auto", os.Args[2:])
+		return
+	}
+
+	if os.Args[1] == "diff" {
+		cli.Diff("crowlerconv diff", os.Args[2:])
+		return
+	}
+	if os.Args[1] == "validate" {
+		cli.Validate("crowlerconv validate", os.Args[2:])
+		return
+	}
+	if os.Args[1] == "lint" {
+		cli.Lint("crowlerconv lint", os.Args[2:])
+		return
+	}
+
+	c, ok := cli.Find(os.Args[1])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown converter %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	cli.Run(c, "crowlerconv "+c.Name(), os.Args[2:])
+}
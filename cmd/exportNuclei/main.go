@@ -0,0 +1,101 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command exportNuclei exports the detection rules of CROWler rulesets as
+// Nuclei templates, one per rule, for ad-hoc scanning with Nuclei.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter/nuclei"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+func main() {
+	inpPath := flag.String("i", "", "Path to a ruleset file or to a directory of rulesets")
+	outPath := flag.String("o", "./", "Path to the output directory")
+	author := flag.String("author", "", "Author of the templates (default the ruleset author)")
+	severity := flag.String("severity", "", "Severity of the templates (default the rule severity, or info)")
+	condition := flag.String("matchers-condition", "or", "Match the templates when any signature matches (or) or all of them do (and)")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	if *condition != "or" && *condition != "and" {
+		logging.Fatalf("Invalid -matchers-condition %q, use or or and", *condition)
+	}
+	if *severity != "" && !slices.Contains(nuclei.Severities, *severity) {
+		logging.Fatalf("Invalid -severity %q, use one of %s", *severity, strings.Join(nuclei.Severities, ", "))
+	}
+
+	// Collect the ruleset files to export
+	files, err := rulesetfiles.List(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+	if err := os.MkdirAll(*outPath, 0o755); err != nil {
+		logging.Fatalf("Error creating the output directory %s: %v", *outPath, err)
+	}
+
+	ids := slug.NewNamer()
+	total, exported := 0, 0
+	for _, path := range files {
+		ruleset, err := crowler.ReadFile(path)
+		if err != nil {
+			logging.Fatalf("Error reading ruleset %s: %v", path, err)
+		}
+		opts := nuclei.ExportOptions{
+			Author:            *author,
+			Severity:          *severity,
+			MatchersCondition: *condition,
+		}
+		if opts.Author == "" {
+			opts.Author = ruleset.Author
+		}
+
+		for _, group := range ruleset.RuleGroups {
+			for _, rule := range group.DetectionRules {
+				total++
+				template, ok := nuclei.Export(rule, opts)
+				if !ok {
+					continue
+				}
+				template.ID = ids.Unique(template.ID)
+				data, err := nuclei.MarshalTemplate(template)
+				if err != nil {
+					logging.Fatalf("Error encoding template %s: %v", template.ID, err)
+				}
+				filename := filepath.Join(*outPath, template.ID+".yaml")
+				if err := os.WriteFile(filename, data, 0o644); err != nil {
+					logging.Fatalf("Error writing YAML to file %s: %v", filename, err)
+				}
+				exported++
+			}
+		}
+	}
+
+	fmt.Fprintf(status, "Exported %d of %d rules as Nuclei templates, the others have no signature Nuclei can match.\n", exported, total)
+}
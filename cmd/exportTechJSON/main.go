@@ -0,0 +1,79 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command exportTechJSON exports the detection rules of CROWler rulesets
+// as a Wappalyzer technologies.json file, to round-trip the rules or
+// share them with the tools reading the Wappalyzer format.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gotests/thecrowler-rules-converters/pkg/converter/techjson"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+)
+
+func main() {
+	inpPath := flag.String("i", "", "Path to a ruleset file or to a directory of rulesets")
+	outPath := flag.String("o", "./technologies.json", "Path to the output technologies.json file")
+	categoriesPath := flag.String("categories", "", "Path to a Wappalyzer categories.json file, to keep the IDs of the known categories")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	var opts techjson.ExportOptions
+	if *categoriesPath != "" {
+		categories, err := techjson.LoadCategories(*categoriesPath)
+		if err != nil {
+			logging.Fatalf("Error reading categories: %v", err)
+		}
+		opts.Categories = categories
+	}
+
+	// Collect the ruleset files to export
+	files, err := rulesetfiles.List(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+
+	exporter := techjson.NewExporter(opts)
+	rules, technologies := 0, 0
+	for _, path := range files {
+		ruleset, err := crowler.ReadFile(path)
+		if err != nil {
+			logging.Fatalf("Error reading ruleset %s: %v", path, err)
+		}
+		for _, group := range ruleset.RuleGroups {
+			rules += len(group.DetectionRules)
+		}
+		technologies += exporter.Add(ruleset)
+	}
+
+	data, err := exporter.Marshal()
+	if err != nil {
+		logging.Fatalf("Error encoding technologies: %v", err)
+	}
+	if err := os.WriteFile(*outPath, data, 0o644); err != nil {
+		logging.Fatalf("Error writing JSON to file %s: %v", *outPath, err)
+	}
+
+	fmt.Fprintf(status, "Exported %d rules as %d technologies to %s.\n", rules, technologies, *outPath)
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/favicon"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+)
+
+const sourceName = "favicongen"
+
+// maxFaviconSize limits the size of the downloaded favicons
+const maxFaviconSize = 1 << 20
+
+// iconLinkRe matches the <link> tags of an HTML page
+var iconLinkRe = regexp.MustCompile(`(?is)<link\b[^>]*>`)
+
+// attrRe matches an attribute of a tag
+var attrRe = regexp.MustCompile(`(?is)\b(rel|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// fetcher downloads the favicons of the listed sites
+type fetcher struct {
+	client    *http.Client
+	userAgent string
+}
+
+func (f *fetcher) get(u string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, u)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// faviconURLs returns the candidate favicon URLs of a site: the icons
+// declared in its home page first, then the conventional /favicon.ico
+func (f *fetcher) faviconURLs(base *url.URL) []string {
+	var urls []string
+	if page, err := f.get(base.String(), maxFaviconSize); err == nil {
+		for _, link := range iconLinkRe.FindAllString(string(page), -1) {
+			var rel, href string
+			for _, m := range attrRe.FindAllStringSubmatch(link, -1) {
+				value := m[2] + m[3] + m[4]
+				if strings.EqualFold(m[1], "rel") {
+					rel = strings.ToLower(value)
+				} else {
+					href = value
+				}
+			}
+			if href == "" || !strings.Contains(rel, "icon") || strings.Contains(rel, "mask-icon") {
+				continue
+			}
+			if ref, err := base.Parse(strings.TrimSpace(href)); err == nil {
+				urls = append(urls, ref.String())
+			}
+		}
+	}
+	ico, _ := base.Parse("/favicon.ico")
+	return append(urls, ico.String())
+}
+
+// fetchFavicon returns the first favicon found for domain
+func (f *fetcher) fetchFavicon(domain string) ([]byte, string, error) {
+	site := domain
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	base, err := url.Parse(site)
+	if err != nil || base.Host == "" {
+		return nil, "", fmt.Errorf("invalid domain %q", domain)
+	}
+	if base.Path == "" {
+		base.Path = "/"
+	}
+
+	var errs []error
+	for _, u := range f.faviconURLs(base) {
+		data, err := f.get(u, maxFaviconSize)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(data) == 0 {
+			errs = append(errs, fmt.Errorf("empty favicon at %s", u))
+			continue
+		}
+		return data, u, nil
+	}
+	return nil, "", errors.Join(errs...)
+}
+
+// createFaviconRule creates a detection rule matching the hashes of a
+// favicon
+func createFaviconRule(technology string, hashes favicon.Hashes) crowler.DetectionRule {
+	return crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(technology),
+		ObjectName: technology,
+		PageContentPatterns: []crowler.PageContentSignature{
+			{
+				MD5Hash:    []string{hashes.MD5},
+				SHA256Hash: []string{hashes.SHA256},
+				MMH3Hash:   []string{hashes.MMH3},
+				Confidence: crowler.DefaultConfidence,
+			},
+		},
+	}
+}
+
+// loadRuleset reads the ruleset to append the rules to, or returns a new
+// one if path doesn't exist
+func loadRuleset(path string) (crowler.Ruleset, error) {
+	ruleset, err := crowler.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		ruleset = crowler.NewRuleset("detect_favicon_custom", "Ruleset to detect technologies using favicon hashes.")
+		ruleset.Source = sourceName
+		ruleset.RuleGroups = []crowler.RuleGroup{
+			{
+				GroupName:      "detect_favicon_technologies",
+				IsEnabled:      true,
+				DetectionRules: []crowler.DetectionRule{},
+			},
+		}
+		return ruleset, nil
+	}
+	if err != nil {
+		return crowler.Ruleset{}, err
+	}
+
+	if len(ruleset.RuleGroups) == 0 {
+		ruleset.RuleGroups = []crowler.RuleGroup{{GroupName: "detect_favicon_technologies", IsEnabled: true}}
+	}
+	return ruleset, nil
+}
+
+// knownHashes returns the MD5 hashes already present in ruleset
+func knownHashes(ruleset crowler.Ruleset) map[string]bool {
+	known := make(map[string]bool)
+	for _, group := range ruleset.RuleGroups {
+		for _, rule := range group.DetectionRules {
+			for _, p := range rule.PageContentPatterns {
+				for _, h := range p.MD5Hash {
+					known[strings.ToLower(h)] = true
+				}
+			}
+		}
+	}
+	return known
+}
+
+func main() {
+	inpPath := flag.String("i", "", "Path to a CSV file of domain,technology pairs")
+	outPath := flag.String("o", "./detect-favicon-custom-ruleset.yaml", "Path to the ruleset file to append the rules to (created if missing)")
+	timeout := flag.Duration("timeout", 15*time.Second, "Timeout for each HTTP request")
+	userAgent := flag.String("user-agent", "Mozilla/5.0 (compatible; favicongen)", "User-Agent sent when fetching the sites")
+	validFrom := flag.String("valid-from", "", "Date from which the generated rules are valid (RFC3339 or YYYY-MM-DD)")
+	expires := flag.String("expires", "", "Date after which the generated rules expire (RFC3339 or YYYY-MM-DD)")
+	namespace := flag.String("namespace", "", "Prefix for the new rule names (e.g. acme)")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	if !crowler.ValidNamespace(*namespace) {
+		logging.Fatalf("Invalid namespace %q, only letters, digits, '-' and '_' are allowed", *namespace)
+	}
+
+	ruleValidFrom, err := validity.Normalize(*validFrom)
+	if err != nil {
+		logging.Fatalf("Error parsing -valid-from: %v", err)
+	}
+	ruleExpires, err := validity.Normalize(*expires)
+	if err != nil {
+		logging.Fatalf("Error parsing -expires: %v", err)
+	}
+
+	// Read the domain list
+	file, err := os.Open(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading domain list: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		logging.Fatalf("Error parsing domain list: %v", err)
+	}
+
+	ruleset, err := loadRuleset(*outPath)
+	if err != nil {
+		logging.Fatalf("Error reading ruleset: %v", err)
+	}
+	known := knownHashes(ruleset)
+	ruleNames := slug.NewNamer()
+	for _, group := range ruleset.RuleGroups {
+		for _, rule := range group.DetectionRules {
+			ruleNames.Unique(rule.RuleName)
+		}
+	}
+
+	prefix := ""
+	if *namespace != "" {
+		prefix = *namespace + "_"
+	}
+
+	f := &fetcher{client: &http.Client{Timeout: *timeout}, userAgent: *userAgent}
+	added := 0
+	for i, record := range records {
+		if len(record) < 2 {
+			slog.Warn("Skipping invalid line", "line", i+1, "record", record)
+			continue
+		}
+		domain := strings.TrimSpace(record[0])
+		technology := strings.TrimSpace(record[1])
+		if i == 0 && strings.EqualFold(domain, "domain") {
+			continue // header line
+		}
+		if domain == "" || technology == "" {
+			slog.Warn("Skipping invalid line", "line", i+1, "record", record)
+			continue
+		}
+
+		data, iconURL, err := f.fetchFavicon(domain)
+		if err != nil {
+			slog.Warn("Skipping domain, no favicon found", "domain", domain, "error", err)
+			continue
+		}
+		hashes := favicon.Compute(data)
+		if known[hashes.MD5] {
+			fmt.Fprintf(status, "Favicon of %s already known (%s), skipping...\n", domain, hashes.MD5)
+			continue
+		}
+		known[hashes.MD5] = true
+
+		rule := createFaviconRule(technology, hashes)
+		rule.RuleName = ruleNames.Unique(prefix + rule.RuleName)
+		rule.ValidFrom = ruleValidFrom
+		rule.Expires = ruleExpires
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+		fmt.Fprintf(status, "Added %s from %s (md5 %s, mmh3 %s)\n", technology, iconURL, hashes.MD5, hashes.MMH3)
+		added++
+	}
+
+	// Write the ruleset back
+	if err := crowler.WriteFile(*outPath, ruleset); err != nil {
+		logging.Fatalf("Error writing YAML to file %s: %v", *outPath, err)
+	}
+
+	fmt.Fprintf(status, "%d favicon rules added to %s.\n", added, *outPath)
+}
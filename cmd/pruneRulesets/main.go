@@ -0,0 +1,169 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mappingValue returns the value node for key in a YAML mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// pruneDocument removes expired detection rules from a ruleset document
+// and returns the number of rules removed.
+// The YAML tree is edited in place, so fields unknown to this tool and
+// comments are preserved.
+func pruneDocument(doc *yaml.Node, now time.Time) int {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return 0
+	}
+
+	removed := 0
+	groups := mappingValue(doc.Content[0], "rule_groups")
+	if groups == nil || groups.Kind != yaml.SequenceNode {
+		return 0
+	}
+	for _, group := range groups.Content {
+		rules := mappingValue(group, "detection_rules")
+		if rules == nil || rules.Kind != yaml.SequenceNode {
+			continue
+		}
+		kept := rules.Content[:0]
+		for _, rule := range rules.Content {
+			expires := mappingValue(rule, "expires")
+			if expires != nil && validity.IsExpired(expires.Value, now) {
+				removed++
+				continue
+			}
+			kept = append(kept, rule)
+		}
+		rules.Content = kept
+	}
+
+	return removed
+}
+
+// pruneFile removes expired rules from a ruleset file, rewriting it only
+// if something was removed.
+func pruneFile(path string, now time.Time, dryRun bool) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("error parsing YAML: %v", err)
+	}
+
+	removed := pruneDocument(&doc, now)
+	if removed == 0 || dryRun {
+		return removed, nil
+	}
+
+	// The JSON rulesets are written back in JSON, as crowlerconv -format
+	// json writes them
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var ruleset crowler.Ruleset
+		if err := doc.Decode(&ruleset); err != nil {
+			return 0, fmt.Errorf("error parsing JSON: %v", err)
+		}
+		data, err := crowler.MarshalJSON(ruleset)
+		if err != nil {
+			return 0, fmt.Errorf("error encoding JSON: %v", err)
+		}
+		return removed, os.WriteFile(path, data, 0644)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return 0, fmt.Errorf("error encoding YAML: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, fmt.Errorf("error encoding YAML: %v", err)
+	}
+
+	return removed, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func main() {
+	inpPath := flag.String("i", "", "Path to a ruleset file or to a directory of rulesets")
+	at := flag.String("at", "", "Prune rules expired at this date instead of now (RFC3339 or YYYY-MM-DD)")
+	dryRun := flag.Bool("dry-run", false, "Report expired rules without modifying any file")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	now := time.Now()
+	if *at != "" {
+		t, err := validity.Parse(*at)
+		if err != nil {
+			logging.Fatalf("Error parsing -at: %v", err)
+		}
+		now = t
+	}
+
+	// Collect the ruleset files to prune
+	files, err := rulesetfiles.List(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+
+	total := 0
+	for _, path := range files {
+		removed, err := pruneFile(path, now, *dryRun)
+		if err != nil {
+			logging.Fatalf("Error pruning %s: %v", path, err)
+		}
+		if removed > 0 {
+			fmt.Fprintf(status, "%s: %d expired rules removed\n", path, removed)
+		}
+		total += removed
+	}
+
+	if *dryRun {
+		fmt.Fprintf(status, "Dry run: %d expired rules found in %d files.\n", total, len(files))
+		return
+	}
+	fmt.Fprintf(status, "Pruned %d expired rules from %d files.\n", total, len(files))
+}
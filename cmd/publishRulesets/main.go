@@ -0,0 +1,256 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Message is a single message to publish on the bus
+type Message struct {
+	Key     string
+	Headers map[string]string
+	Payload []byte
+}
+
+// rulesetInfo holds the ruleset fields used as provenance headers
+type rulesetInfo struct {
+	RulesetName   string `yaml:"ruleset_name"`
+	FormatVersion string `yaml:"format_version"`
+	CreatedAt     string `yaml:"created_at"`
+	Source        string `yaml:"source"`
+	SourceLicense string `yaml:"source_license"`
+}
+
+// mappingValue returns the value node for key in a YAML mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// encodeNode encodes a YAML node the same way the converters do
+func encodeNode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeRule encodes the node of a detection rule in YAML, or in JSON
+// for the rules of a JSON ruleset
+func encodeRule(node *yaml.Node, asJSON bool) ([]byte, error) {
+	if !asJSON {
+		return encodeNode(node)
+	}
+	var rule crowler.DetectionRule
+	if err := node.Decode(&rule); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(rule); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isJSON reports whether the ruleset file at path is in JSON (see
+// crowlerconv -format json)
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// provenanceHeaders returns the headers describing where a ruleset
+// (and the rules in it) comes from
+func provenanceHeaders(path string, info rulesetInfo) map[string]string {
+	contentType := "application/yaml"
+	if isJSON(path) {
+		contentType = "application/json"
+	}
+	headers := map[string]string{
+		"content-type":   contentType,
+		"ruleset-name":   info.RulesetName,
+		"format-version": info.FormatVersion,
+		"created-at":     info.CreatedAt,
+		"source":         info.Source,
+		"source-license": info.SourceLicense,
+		"source-file":    filepath.Base(path),
+	}
+	for k, v := range headers {
+		if v == "" {
+			delete(headers, k)
+		}
+	}
+	return headers
+}
+
+// buildMessages reads a ruleset file and returns the messages to publish,
+// either one for the whole ruleset or one per detection rule
+func buildMessages(path string, perRule bool) ([]Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var info rulesetInfo
+	if err := yaml.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %v", err)
+	}
+	if info.RulesetName == "" {
+		return nil, fmt.Errorf("missing ruleset_name")
+	}
+
+	if !perRule {
+		headers := provenanceHeaders(path, info)
+		headers["payload-sha256"] = sha256Hex(data)
+		return []Message{{Key: info.RulesetName, Headers: headers, Payload: data}}, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing YAML: %v", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	var messages []Message
+	groups := mappingValue(doc.Content[0], "rule_groups")
+	if groups == nil {
+		return nil, nil
+	}
+	for _, group := range groups.Content {
+		groupName := ""
+		if n := mappingValue(group, "group_name"); n != nil {
+			groupName = n.Value
+		}
+		rules := mappingValue(group, "detection_rules")
+		if rules == nil {
+			continue
+		}
+		for _, rule := range rules.Content {
+			ruleName := ""
+			if n := mappingValue(rule, "rule_name"); n != nil {
+				ruleName = n.Value
+			}
+			payload, err := encodeRule(rule, isJSON(path))
+			if err != nil {
+				return nil, fmt.Errorf("error encoding rule %s: %v", ruleName, err)
+			}
+			headers := provenanceHeaders(path, info)
+			headers["group-name"] = groupName
+			headers["rule-name"] = ruleName
+			headers["payload-sha256"] = sha256Hex(payload)
+			messages = append(messages, Message{
+				Key:     info.RulesetName + "/" + ruleName,
+				Headers: headers,
+				Payload: payload,
+			})
+		}
+	}
+
+	return messages, nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func main() {
+	inpPath := flag.String("i", "", "Path to a ruleset file or to a directory of rulesets")
+	bus := flag.String("bus", "nats", "Message bus to publish to (nats, kafka)")
+	url := flag.String("url", "", "NATS server URL or comma separated list of Kafka brokers")
+	topic := flag.String("topic", "crowler.rulesets", "NATS subject or Kafka topic to publish to")
+	mode := flag.String("mode", "ruleset", "Publish one message per ruleset or per rule (ruleset, rule)")
+	dryRun := flag.Bool("dry-run", false, "Print the messages instead of publishing them")
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status := logFlags.Status(os.Stdout)
+
+	if *mode != "ruleset" && *mode != "rule" {
+		logging.Fatalf("Invalid -mode %q, expected ruleset or rule", *mode)
+	}
+
+	files, err := rulesetfiles.List(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+
+	var pub Publisher
+	if *dryRun {
+		pub = &printPublisher{topic: *topic}
+	} else {
+		pub, err = newPublisher(*bus, *url, *topic)
+		if err != nil {
+			logging.Fatalf("Error connecting to %s: %v", *bus, err)
+		}
+	}
+
+	total := 0
+	for _, path := range files {
+		messages, err := buildMessages(path, *mode == "rule")
+		if err != nil {
+			logging.Fatalf("Error reading ruleset %s: %v", path, err)
+		}
+		for _, msg := range messages {
+			if err := pub.Publish(msg); err != nil {
+				logging.Fatalf("Error publishing %s: %v", msg.Key, err)
+			}
+		}
+		total += len(messages)
+	}
+
+	if err := pub.Close(); err != nil {
+		logging.Fatalf("Error publishing messages: %v", err)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(status, "Dry run: %d messages from %d rulesets.\n", total, len(files))
+		return
+	}
+	fmt.Fprintf(status, "Published %d messages from %d rulesets to %s.\n", total, len(files), *topic)
+}
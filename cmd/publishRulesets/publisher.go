@@ -0,0 +1,126 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher publishes messages on a message bus
+type Publisher interface {
+	Publish(msg Message) error
+	Close() error
+}
+
+// newPublisher returns a Publisher for the requested bus
+func newPublisher(bus, url, topic string) (Publisher, error) {
+	switch bus {
+	case "nats":
+		if url == "" {
+			url = nats.DefaultURL
+		}
+		conn, err := nats.Connect(url, nats.Name("crowler-rules-converters"))
+		if err != nil {
+			return nil, err
+		}
+		return &natsPublisher{conn: conn, subject: topic}, nil
+	case "kafka":
+		if url == "" {
+			url = "localhost:9092"
+		}
+		writer := &kafka.Writer{
+			Addr:     kafka.TCP(strings.Split(url, ",")...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		}
+		return &kafkaPublisher{writer: writer}, nil
+	default:
+		return nil, fmt.Errorf("unsupported message bus %q", bus)
+	}
+}
+
+// natsPublisher publishes messages on a NATS subject
+type natsPublisher struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (p *natsPublisher) Publish(msg Message) error {
+	m := nats.NewMsg(p.subject)
+	m.Data = msg.Payload
+	m.Header.Set("key", msg.Key)
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	return p.conn.PublishMsg(m)
+}
+
+func (p *natsPublisher) Close() error {
+	defer p.conn.Close()
+	return p.conn.Flush()
+}
+
+// kafkaPublisher publishes messages on a Kafka topic.
+// Messages are buffered and written in a single batch on Close.
+type kafkaPublisher struct {
+	writer   *kafka.Writer
+	messages []kafka.Message
+}
+
+func (p *kafkaPublisher) Publish(msg Message) error {
+	m := kafka.Message{Key: []byte(msg.Key), Value: msg.Payload}
+	for k, v := range msg.Headers {
+		m.Headers = append(m.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+func (p *kafkaPublisher) Close() error {
+	defer p.writer.Close()
+	if len(p.messages) == 0 {
+		return nil
+	}
+	return p.writer.WriteMessages(context.Background(), p.messages...)
+}
+
+// printPublisher prints the messages instead of publishing them
+type printPublisher struct {
+	topic string
+}
+
+func (p *printPublisher) Publish(msg Message) error {
+	keys := make([]string, 0, len(msg.Headers))
+	for k := range msg.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fmt.Printf("%s %s (%d bytes)\n", p.topic, msg.Key, len(msg.Payload))
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, msg.Headers[k])
+	}
+	return nil
+}
+
+func (p *printPublisher) Close() error {
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/store"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+)
+
+const usage = `Usage: rulestore <command> [flags]
+
+Commands:
+  import   Import ruleset files generated by the converters
+  query    List the stored rules matching the filters
+  export   Write the stored rules matching the filters to YAML rulesets
+
+Run rulestore <command> -h for the command flags.
+`
+
+// filterFlags registers the rule filters on fs
+func filterFlags(fs *flag.FlagSet) (*store.Filter, *string) {
+	f := &store.Filter{}
+	fs.StringVar(&f.Source, "source", "", "Only rules from this source (* is a wildcard)")
+	fs.StringVar(&f.Ruleset, "ruleset", "", "Only rules from this ruleset (* is a wildcard)")
+	fs.StringVar(&f.Group, "group", "", "Only rules from this rule group (* is a wildcard)")
+	fs.StringVar(&f.Kind, "kind", "", "Only rules of this kind, e.g. detection_rules (* is a wildcard)")
+	fs.StringVar(&f.Rule, "rule", "", "Only rules with this name (* is a wildcard)")
+	fs.StringVar(&f.Object, "object", "", "Only rules detecting this object (* is a wildcard)")
+	fs.StringVar(&f.Tag, "tag", "", "Only rules with this tag (* is a wildcard)")
+	validAt := fs.String("valid-at", "", "Only rules valid at this date (RFC3339, YYYY-MM-DD or now)")
+	return f, validAt
+}
+
+// parseValidAt sets the validity filter from the -valid-at flag
+func parseValidAt(f *store.Filter, value string) {
+	switch value {
+	case "":
+	case "now":
+		f.ValidAt = time.Now()
+	default:
+		t, err := validity.Parse(value)
+		if err != nil {
+			logging.Fatalf("Error parsing -valid-at: %v", err)
+		}
+		f.ValidAt = t
+	}
+}
+
+func importCmd(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbPath := fs.String("db", "rules.db", "Path to the SQLite database")
+	inpPath := fs.String("i", "", "Path to a ruleset file or to a directory of rulesets")
+	_ = fs.Parse(args)
+
+	files, err := rulesetfiles.List(*inpPath)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		logging.Fatalf("Error opening database %s: %v", *dbPath, err)
+	}
+	defer db.Close()
+
+	total := 0
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logging.Fatalf("Error reading ruleset %s: %v", path, err)
+		}
+		n, err := db.Import(data, filepath.Base(path))
+		if err != nil {
+			slog.Warn("Skipping file", "path", path, "error", err)
+			continue
+		}
+		total += n
+	}
+
+	fmt.Fprintf(status, "Imported %d rules from %d files into %s.\n", total, len(files), *dbPath)
+}
+
+func queryCmd(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := fs.String("db", "rules.db", "Path to the SQLite database")
+	showBody := fs.Bool("body", false, "Print the YAML of each rule")
+	filter, validAt := filterFlags(fs)
+	_ = fs.Parse(args)
+	parseValidAt(filter, *validAt)
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		logging.Fatalf("Error opening database %s: %v", *dbPath, err)
+	}
+	defer db.Close()
+
+	rules, err := db.Query(*filter)
+	if err != nil {
+		logging.Fatalf("Error querying rules: %v", err)
+	}
+
+	if *showBody {
+		for _, r := range rules {
+			fmt.Printf("# %s / %s / %s (%s)\n%s\n", r.Source, r.Ruleset, r.Group, r.Kind, r.Body)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tRULESET\tGROUP\tRULE\tOBJECT\tEXPIRES")
+	for _, r := range rules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Source, r.Ruleset, r.Group, r.Name, r.Object, r.Expires)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "%d rules\n", len(rules))
+}
+
+func exportCmd(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dbPath := fs.String("db", "rules.db", "Path to the SQLite database")
+	outPath := fs.String("o", "./", "Path to the output directory")
+	filter, validAt := filterFlags(fs)
+	_ = fs.Parse(args)
+	parseValidAt(filter, *validAt)
+
+	db, err := store.Open(*dbPath)
+	if err != nil {
+		logging.Fatalf("Error opening database %s: %v", *dbPath, err)
+	}
+	defer db.Close()
+
+	docs, err := db.Export(*filter)
+	if err != nil {
+		logging.Fatalf("Error exporting rules: %v", err)
+	}
+
+	// Rulesets with the same name from different sources get a suffix
+	fileNames := slug.NewFileNamer()
+	for _, doc := range docs {
+		filename := filepath.Join(*outPath, fileNames.Unique(slug.File(doc.Ruleset))+".yaml")
+		fmt.Fprintf(status, "Writing ruleset %s...\n", doc.Ruleset)
+		if err := os.WriteFile(filename, doc.Data, 0o644); err != nil {
+			logging.Fatalf("Error writing YAML to file %s: %v", filename, err)
+		}
+	}
+
+	fmt.Fprintf(status, "%d rulesets exported.\n", len(docs))
+}
+
+// status is the writer of the progress messages, discarded with -quiet
+var status = io.Writer(os.Stdout)
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	logFlags := logging.AddFlags(flag.CommandLine)
+	flag.Parse()
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	status = logFlags.Status(os.Stdout)
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	args := flag.Args()[1:]
+	switch flag.Arg(0) {
+	case "import":
+		importCmd(args)
+	case "query":
+		queryCmd(args)
+	case "export":
+		exportCmd(args)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package archive bundles the files of a conversion (the rulesets, the
+// reports and the manifest) into a zip or tar.gz file, to attach to a
+// release or upload to an object storage. The archives are reproducible:
+// the files are sorted and dated with the creation time of the rulesets.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format is the format of an archive
+type Format string
+
+const (
+	// Zip is a zip file
+	Zip Format = "zip"
+	// TarGz is a gzip compressed tar file
+	TarGz Format = "tar.gz"
+)
+
+// FormatOf returns the format of the archive at path, from its extension:
+// .zip, .tar.gz or .tgz
+func FormatOf(path string) (Format, error) {
+	name := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return Zip, nil
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return TarGz, nil
+	}
+	return "", fmt.Errorf("unknown archive format of %s, expected a .zip, .tar.gz or .tgz file", path)
+}
+
+// Write writes to path the archive of the files of dir, given by their
+// path relative to dir, dated modTime
+func Write(path, dir string, files []string, modTime time.Time) (err error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	files = append([]string(nil), files...)
+	sort.Strings(files)
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if format == Zip {
+		return writeZip(out, dir, files, modTime)
+	}
+	return writeTarGz(out, dir, files, modTime)
+}
+
+func writeZip(w io.Writer, dir string, files []string, modTime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: filepath.ToSlash(file), Method: zip.Deflate, Modified: modTime}
+		header.SetMode(0o644)
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, dir string, files []string, modTime time.Time) error {
+	gw := gzip.NewWriter(w)
+	gw.ModTime = modTime
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(file),
+			Mode:     0o644,
+			Size:     int64(len(data)),
+			ModTime:  modTime,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package banner adds the version captures of the product banners to the
+// detection rules. The Server and X-Powered-By headers name the product
+// and its version (nginx/1.25.3, PHP/8.2.1), but the header patterns of
+// most sources only match the product name, so the rules detect the
+// product without its version.
+package banner
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// Headers are the header fields whose value is a product banner
+var Headers = []string{"server", "x-powered-by"}
+
+// productRe matches the product names of a banner
+var productRe = regexp.MustCompile(`^[A-Za-z][\w.+-]*$`)
+
+// Versions adds to the rules of rulesets the version captures of their
+// banner header patterns, see Rule. It returns the number of rules given
+// a version capture.
+func Versions(rulesets []crowler.Ruleset) int {
+	n := 0
+	for i := range rulesets {
+		for j := range rulesets[i].RuleGroups {
+			group := &rulesets[i].RuleGroups[j]
+			for k := range group.DetectionRules {
+				if Rule(&group.DetectionRules[k]) > 0 {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// Rule adds to the banner header fields (see Headers) of rule, for each
+// pattern matching a product name only (nginx, ^Apache-Coyote$), the
+// pattern capturing the version following the name in the banner
+// (nginx/([\d.]+)) and its version signature. The header fields rule
+// already gets the version of are left as they are. The slices of rule
+// aren't modified, as the copies of a rule in several rulesets share
+// them. It returns the number of patterns added.
+func Rule(rule *crowler.DetectionRule) int {
+	n := 0
+	headers := slices.Clone(rule.HTTPHeaderFields)
+	versions := slices.Clip(rule.Version)
+	for i := range headers {
+		h := &headers[i]
+		if !isBanner(h.Key) || hasVersion(rule, h.Key) {
+			continue
+		}
+		var added []string
+		for _, p := range h.Value {
+			pattern, ok := versionPattern(p)
+			if !ok || slices.Contains(h.Value, pattern) || slices.Contains(added, pattern) {
+				continue
+			}
+			added = append(added, pattern)
+			versions = append(versions, crowler.VersionSignature{
+				Section: "http_header_fields",
+				Key:     h.Key,
+				Pattern: pattern,
+				Version: `\1`,
+			})
+		}
+		h.Value = append(slices.Clip(h.Value), added...)
+		n += len(added)
+	}
+	if n > 0 {
+		rule.HTTPHeaderFields, rule.Version = headers, versions
+	}
+	return n
+}
+
+// versionPattern returns the pattern capturing the version of the banner
+// of the product pattern matches, keeping its anchor at the start and its
+// case insensitivity. It returns false if pattern doesn't match a product
+// name only.
+func versionPattern(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	parts := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		parts = re.Sub
+	}
+
+	// The name can be anchored at the start, kept, and at the end,
+	// dropped as the version follows it
+	var prefix string
+	switch parts[0].Op {
+	case syntax.OpBeginText:
+		prefix, parts = "^", parts[1:]
+	case syntax.OpWordBoundary:
+		prefix, parts = `\b`, parts[1:]
+	}
+	if len(parts) == 2 && (parts[1].Op == syntax.OpEndText || parts[1].Op == syntax.OpWordBoundary) {
+		parts = parts[:1]
+	}
+	if len(parts) != 1 || parts[0].Op != syntax.OpLiteral {
+		return "", false
+	}
+	literal := parts[0]
+	name := strings.TrimSuffix(string(literal.Rune), "/")
+	if len(name) < 2 || !productRe.MatchString(name) {
+		return "", false
+	}
+	if literal.Flags&syntax.FoldCase != 0 {
+		prefix = "(?i)" + prefix
+	}
+	return prefix + regexp.QuoteMeta(name) + `/([\d.]+)`, true
+}
+
+// isBanner tells if the header field key is a banner
+func isBanner(key string) bool {
+	for _, h := range Headers {
+		if strings.EqualFold(strings.TrimSpace(key), h) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasVersion tells if rule has a version signature of the header key
+func hasVersion(rule *crowler.DetectionRule, key string) bool {
+	for _, v := range rule.Version {
+		if v.Section == "http_header_fields" && strings.EqualFold(v.Key, key) {
+			return true
+		}
+	}
+	return false
+}
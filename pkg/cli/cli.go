@@ -0,0 +1,729 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cli implements the command line of the converters: the flags
+// they share, the converter specific ones and the writing of the
+// generated rulesets. It's used by crowlerconv and by the single source
+// converter commands.
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/archive"
+	"gotests/thecrowler-rules-converters/pkg/banner"
+	"gotests/thecrowler-rules-converters/pkg/confidence"
+	"gotests/thecrowler-rules-converters/pkg/convert"
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/duplicates"
+	"gotests/thecrowler-rules-converters/pkg/errreport"
+	"gotests/thecrowler-rules-converters/pkg/fetch"
+	"gotests/thecrowler-rules-converters/pkg/filter"
+	"gotests/thecrowler-rules-converters/pkg/implies"
+	"gotests/thecrowler-rules-converters/pkg/license"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/manifest"
+	"gotests/thecrowler-rules-converters/pkg/progress"
+	"gotests/thecrowler-rules-converters/pkg/push"
+	"gotests/thecrowler-rules-converters/pkg/quarantine"
+	"gotests/thecrowler-rules-converters/pkg/rulename"
+	"gotests/thecrowler-rules-converters/pkg/split"
+	"gotests/thecrowler-rules-converters/pkg/store"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+)
+
+// Find returns the converter called name
+func Find(name string) (converter.Converter, bool) {
+	return converter.Get(name)
+}
+
+// Run parses args with the shared and the converter specific flags, runs
+// the conversion and writes the rulesets. name is the program name shown
+// in the usage. If c is nil the converter is picked by sniffing the input.
+func Run(c converter.Converter, name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	inpHelp := "Path to the source file (its format is detected)"
+	licenseHelp := "License of the source rules (SPDX identifier, default the license of the detected source)"
+	defaultLicense := ""
+	if c != nil {
+		inpHelp = c.Info().Input
+		licenseHelp = "License of the source rules (SPDX identifier)"
+		defaultLicense = c.Info().DefaultLicense
+	}
+	inpPath := fs.String("i", "", inpHelp+", or its http(s) URL")
+	github := fs.String("github", "", "Read the source from GitHub instead of -i (owner/repo@ref:path, path can be a file or a directory)")
+	outPath := fs.String("o", "./", "Path to the output directory")
+	sourceLicense := fs.String("source-license", defaultLicense, licenseHelp)
+	allowLicenses := fs.String("allow-licenses", "", "Comma separated list of allowed source licenses (empty allows all)")
+	validFrom := fs.String("valid-from", "", "Date from which the generated rules are valid (RFC3339 or YYYY-MM-DD)")
+	expires := fs.String("expires", "", "Date after which the generated rules expire (RFC3339 or YYYY-MM-DD)")
+	namespace := fs.String("namespace", "", "Prefix for ruleset, group and rule names (e.g. acme)")
+	include := fs.String("include", "", "Only write the rules whose object or rule name matches this regex")
+	exclude := fs.String("exclude", "", "Don't write the rules whose object or rule name matches this regex")
+	categories := fs.String("category", "", "Comma separated list of the categories to write the rules of (e.g. cms,web-servers)")
+	taxonomyPath := fs.String("taxonomy", "", "Path to a YAML file mapping source categories to CROWler tags")
+	confidenceFlag := fs.Float64("confidence", crowler.DefaultConfidence, "Confidence of the signatures without a confidence in the source")
+	heuristicConfidence := fs.Bool("heuristic-confidence", false, "Score the signatures by their type (headers above scripts above page text above website links) instead of -confidence")
+	confidenceProfile := fs.String("confidence-profile", "", "Path to a YAML file with the confidence of each signature type, implies -heuristic-confidence")
+	workers := fs.Int("workers", 1, "Number of goroutines converting the technologies, templates or rules of the source, the output doesn't depend on it")
+	normalizePatterns := fs.Bool("normalize", true, "Normalize header keys and patterns (set to false to keep them as in the source)")
+	var literals converter.LiteralMode
+	fs.Var(&literals, "literals", converter.LiteralModeUsage)
+	impliesIndex := fs.Bool("implies-index", false, "Also write an index of the implies relations between the detected objects")
+	duplicatesReport := fs.Bool("duplicates-report", false, "Also write a report of the signatures shared by several rules")
+	dbPath := fs.String("db", "", "Also import the generated rulesets into this SQLite rule store")
+	validate := fs.Bool("validate", false, "Check the generated rulesets against the ruleset schema before writing them")
+	invalidPatterns := quarantine.PolicyQuarantine
+	fs.Var(&invalidPatterns, "invalid-patterns", quarantine.PolicyUsage)
+	targetVersion := fs.String("target-version", "", "Format version of the CROWler to write the rulesets for ("+strings.Join(crowler.TargetVersions(), ", ")+" or later), removing the fields it doesn't support")
+	format := OutputYAML
+	fs.Var(&format, "format", outputFormatUsage)
+	outTemplate := fs.String("out-template", "", outTemplateUsage)
+	ruleNameTemplate := fs.String("rule-name-template", "", rulename.Usage)
+	expandImplies := fs.Bool("expand-implies", false, "Also tag the rules with the categories of the objects they imply, for the CROWler deployments ignoring implies")
+	impliedRules := fs.Bool("implied-rules", false, "Also add to the rulesets a copy of each rule detecting each object it implies, its confidences scaled by the confidence of the implication (unchanged for the implications without a confidence tag), implies -expand-implies")
+	bannerVersions := fs.Bool("banner-versions", false, "Also capture the version following the product names the Server and X-Powered-By header patterns match, e.g. nginx/([\\d.]+)")
+	splitBy := fs.String("split-by", split.ByCategory, "Write a ruleset per category of the source (category) or per detected technology (technology)")
+	force := fs.Bool("force", false, "Overwrite the files of -o that aren't a previous version of the ruleset written to them")
+	progressInterval := fs.Duration("progress", 5*time.Second, "Interval of the progress log of the long conversion steps (0 disables it)")
+	summary := fs.Bool("summary", true, "Print a summary of the generated rules per category at the end")
+	writeManifest := fs.Bool("manifest", true, "Also write "+manifest.FileName+" with the provenance of the rulesets and the checksums of the written files")
+	update := fs.Bool("update", false, "Only rewrite the rulesets of -o whose content changed, keeping their rules marked managed: false")
+	watch := fs.Bool("watch", false, "Watch the input file or directory and convert it again each time it changes")
+	watchInterval := fs.Duration("watch-interval", 2*time.Second, "Interval at which -watch checks the input for changes")
+	pushURL := fs.String("push", "", "Also upload the written rulesets to the ruleset API of the CROWler engine at this URL (e.g. https://crowler-api:8080)")
+	pushToken := fs.String("token", os.Getenv(push.TokenEnv), "API token of the -push engine (default $"+push.TokenEnv+")")
+	pushDryRun := fs.Bool("push-dry-run", false, "Print the requests -push would send instead of sending them")
+	archivePath := fs.String("archive", "", "Also bundle the written rulesets, reports and manifest into this .zip or .tar.gz file")
+	dryRun := fs.Bool("dry-run", false, "Convert the source and print the summary and the warnings, without writing, importing or pushing the rulesets and the reports")
+	strict := fs.Bool("strict", false, "Stop at the first source entry that can't be read, instead of skipping it and reporting it in "+errreport.FileName)
+	verifyRoundTrip := fs.Bool("verify-roundtrip", false, "Convert the rules back to the source format and report the lost values, instead of writing the rulesets")
+	configPath := fs.String("config", ConfigFileName, "Path to a YAML file with the values of the flags, the command line flags override them (empty disables it)")
+	info := RulesetInfoFlags(fs)
+	logFlags := logging.AddFlags(fs)
+	if setter, ok := c.(converter.FlagSetter); ok {
+		setter.SetFlags(fs)
+	}
+	_ = fs.Parse(args)
+	// The config file can set the log flags too
+	configErr := applyConfig(fs, *configPath, c)
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	if configErr != nil {
+		logging.Fatalf("Error reading the config file: %v", configErr)
+	}
+	if lister, ok := c.(converter.Lister); ok {
+		if listed, err := lister.List(os.Stdout); err != nil {
+			logging.Fatalf("%v", err)
+		} else if listed {
+			return
+		}
+	}
+
+	// With ndjson the standard output is the rulesets, the progress goes
+	// to the standard error. With -quiet it's discarded.
+	status := io.Writer(os.Stdout)
+	if format == OutputNDJSON {
+		status = os.Stderr
+	}
+	status = logFlags.Status(status)
+
+	if *watch {
+		switch {
+		case *github != "" || *inpPath == "" || fetch.IsURL(*inpPath):
+			logging.Fatalf("-watch needs a local input file or directory (-i)")
+		case *watchInterval <= 0:
+			logging.Fatalf("Invalid -watch-interval %v", *watchInterval)
+		}
+		if *pushURL != "" {
+			if _, err := push.New(*pushURL, *pushToken); err != nil {
+				logging.Fatalf("Error in -push: %v", err)
+			}
+		}
+		fmt.Fprintf(status, "Watching %s for changes...\n", *inpPath)
+		w := watcher{path: *inpPath, interval: *watchInterval, status: status, args: childArgs(args, fs.NArg())}
+		w.watch()
+		return
+	}
+
+	// Download the remote sources in the cache and convert the local copy
+	var err error
+	sourceURL := ""
+	switch {
+	case *github != "":
+		fmt.Fprintf(status, "Fetching %s from GitHub...\n", *github)
+		if *inpPath, err = fetch.GitHub(*github); err != nil {
+			logging.Fatalf("Error fetching %s: %v", *github, err)
+		}
+	case fetch.IsURL(*inpPath):
+		fmt.Fprintf(status, "Fetching %s...\n", *inpPath)
+		url := *inpPath
+		sourceURL = url
+		if *inpPath, err = fetch.URL(url); err != nil {
+			logging.Fatalf("Error fetching %s: %v", url, err)
+		}
+	}
+
+	// source names the input in the messages, the generators have none
+	detect := c == nil
+	source := *inpPath
+	var input io.ReadCloser
+	if generator, ok := c.(converter.Generator); ok && *inpPath == "" && generator.Generates() {
+		source = "the " + c.Name() + " flags"
+		input = io.NopCloser(strings.NewReader(""))
+	} else if *inpPath == "" {
+		logging.Fatalf("No input given, use -i")
+	} else if c, input, err = convert.Open(c, *inpPath); err != nil {
+		logging.Fatalf("Error reading %s: %v", *inpPath, err)
+	}
+	defer input.Close()
+	if detect {
+		fmt.Fprintf(status, "Detected %s input.\n", c.Name())
+		if *sourceLicense == "" {
+			*sourceLicense = c.Info().DefaultLicense
+		}
+	}
+
+	if *workers < 1 {
+		logging.Fatalf("Invalid -workers %d, at least 1 is needed", *workers)
+	}
+	if !crowler.ValidNamespace(*namespace) {
+		logging.Fatalf("Invalid namespace %q, only letters, digits, '-' and '_' are allowed", *namespace)
+	}
+
+	if err := info.Validate(); err != nil {
+		logging.Fatalf("Error in the ruleset flags: %v", err)
+	}
+	if *update && format == OutputNDJSON {
+		logging.Fatalf("-update needs the rulesets written to files, it can't be used with -format ndjson")
+	}
+	if *archivePath != "" {
+		if format == OutputNDJSON {
+			logging.Fatalf("-archive needs the rulesets written to files, it can't be used with -format ndjson")
+		}
+		if _, err := archive.FormatOf(*archivePath); err != nil {
+			logging.Fatalf("Error in -archive: %v", err)
+		}
+	}
+	selection, err := filter.New(*include, *exclude, *categories)
+	if err != nil {
+		logging.Fatalf("Error in the filter flags: %v", err)
+	}
+	if err := split.Valid(*splitBy); err != nil {
+		logging.Fatalf("Error in -split-by: %v", err)
+	}
+	namer, err := rulename.New(*ruleNameTemplate, c.Info().Source, *namespace)
+	if err != nil {
+		logging.Fatalf("Error in -rule-name-template: %v", err)
+	}
+	out, err := newLayout(*outTemplate, c, format)
+	if err != nil {
+		logging.Fatalf("%v", err)
+	}
+	var pusher *push.Client
+	if *pushURL != "" {
+		if pusher, err = push.New(*pushURL, *pushToken); err != nil {
+			logging.Fatalf("Error in -push: %v", err)
+		}
+	}
+	if *targetVersion != "" {
+		if err := crowler.ValidTargetVersion(*targetVersion); err != nil {
+			logging.Fatalf("Error parsing -target-version: %v", err)
+		}
+	}
+
+	var m *manifest.Manifest
+	if *writeManifest && !*dryRun {
+		m = manifest.New(c.Name(), manifest.Source{
+			Name:    c.Info().Source,
+			Path:    *inpPath,
+			URL:     sourceURL,
+			GitHub:  *github,
+			License: *sourceLicense,
+		}, info.Timestamp())
+	}
+	outputs := &outputFiles{dir: *outPath, manifest: m}
+
+	// Without a source license the converter reports it in the rulesets
+	// (the plugins), they are checked after the conversion
+	allowedLicenses := license.ParseList(*allowLicenses)
+	if *sourceLicense != "" && !license.IsAllowed(*sourceLicense, allowedLicenses) {
+		logging.Fatalf("Source license %s is not in the allowed licenses list (%s), no rules generated", *sourceLicense, *allowLicenses)
+	}
+
+	ruleValidFrom, err := validity.Normalize(*validFrom)
+	if err != nil {
+		logging.Fatalf("Error parsing -valid-from: %v", err)
+	}
+	ruleExpires, err := validity.Normalize(*expires)
+	if err != nil {
+		logging.Fatalf("Error parsing -expires: %v", err)
+	}
+
+	var tax taxonomy.Taxonomy
+	if *taxonomyPath != "" {
+		if tax, err = taxonomy.Load(*taxonomyPath); err != nil {
+			logging.Fatalf("Error reading taxonomy: %v", err)
+		}
+	}
+
+	var profile confidence.Profile
+	switch {
+	case *confidenceProfile != "":
+		if profile, err = confidence.Load(*confidenceProfile); err != nil {
+			logging.Fatalf("Error reading confidence profile: %v", err)
+		}
+	case *heuristicConfidence:
+		profile = confidence.Heuristic
+	}
+
+	opts := converter.Options{
+		SourceLicense:     *sourceLicense,
+		ValidFrom:         ruleValidFrom,
+		Expires:           ruleExpires,
+		Namespace:         *namespace,
+		Normalize:         *normalizePatterns,
+		Literals:          literals,
+		Confidence:        float32(*confidenceFlag),
+		ConfidenceProfile: profile,
+		Taxonomy:          tax,
+		FileName:          filepath.Base(*inpPath),
+		Dir:               filepath.Dir(*inpPath),
+		Workers:           *workers,
+	}
+	// The source entries that can't be read are skipped and reported at
+	// the end, unless -strict
+	invalidEntries := errreport.NewReport(c.Info().Source)
+	if !*strict {
+		opts.Invalid = func(entry string, err error) {
+			slog.Warn("Skipping invalid entry", "entry", entry, "error", err)
+			invalidEntries.Add(entry, err)
+		}
+	}
+	reporter := progress.New(status, *progressInterval)
+	var processed atomic.Int64
+	opts.Progress = func(n int) {
+		processed.Add(int64(n))
+		reporter.Add(n)
+	}
+
+	// The input is hashed for the manifest, and kept for the round trip,
+	// while the converter reads it
+	checksum := sha256.New()
+	var data bytes.Buffer
+	reader := io.TeeReader(input, checksum)
+	if *verifyRoundTrip {
+		reader = io.TeeReader(reader, &data)
+	}
+	reporter.Start("Converting "+source, 0)
+	rulesets, err := c.Convert(reader, opts)
+	reporter.Stop()
+	if err != nil {
+		logging.Fatalf("Error converting %s: %v", source, err)
+	}
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		logging.Fatalf("Error reading %s: %v", source, err)
+	}
+	for _, ruleset := range rulesets {
+		if !license.IsAllowed(ruleset.SourceLicense, allowedLicenses) {
+			logging.Fatalf("Source license %s of ruleset %s is not in the allowed licenses list (%s), no rules generated", ruleset.SourceLicense, ruleset.RulesetName, *allowLicenses)
+		}
+	}
+	if m != nil {
+		m.Source.SHA256 = hex.EncodeToString(checksum.Sum(nil))
+	}
+	// Resolve the implies relations over the whole source, before the
+	// rules are filtered
+	impliesReport := implies.Resolve(rulesets, c.Info().Source)
+
+	if *verifyRoundTrip {
+		roundTripper, ok := c.(converter.RoundTripper)
+		if !ok {
+			logging.Fatalf("The %s converter can't convert the rules back to its source format", c.Name())
+		}
+		report, err := roundTripper.RoundTrip(data.Bytes(), rulesets, opts)
+		if err != nil {
+			logging.Fatalf("Error verifying the round trip of %s: %v", source, err)
+		}
+		if err := report.Write(os.Stdout); err != nil {
+			logging.Fatalf("Error writing the round trip report: %v", err)
+		}
+		return
+	}
+
+	if *expandImplies || *impliedRules {
+		expanded, cloned := implies.Expand(rulesets, *impliedRules)
+		fmt.Fprintf(status, "Expanded the implies of %d rules", expanded)
+		if *impliedRules {
+			fmt.Fprintf(status, ", added %d rules detecting the implied objects", cloned)
+		}
+		fmt.Fprintln(status)
+	}
+	if *bannerVersions {
+		fmt.Fprintf(status, "Added the banner version captures of %d rules\n", banner.Versions(rulesets))
+	}
+
+	if !selection.IsEmpty() {
+		rulesets = selection.Apply(rulesets)
+		for _, category := range selection.Unmatched() {
+			slog.Warn("No rules of the category", "category", category, "source", source)
+		}
+		if len(rulesets) == 0 {
+			logging.Fatalf("No rules of %s match -include, -exclude and -category, no rules written", source)
+		}
+	}
+
+	if *splitBy == split.ByTechnology {
+		rulesets = split.ByObject(rulesets, *namespace)
+	}
+	renamed, err := namer.Apply(rulesets)
+	if err != nil {
+		logging.Fatalf("Error in -rule-name-template: %v", err)
+	}
+
+	removed := make(map[string]int)
+	for i := range rulesets {
+		crowler.SortRuleset(&rulesets[i])
+		info.Apply(&rulesets[i])
+		if *targetVersion == "" {
+			continue
+		}
+		counts, err := crowler.TargetVersion(&rulesets[i], *targetVersion)
+		if err != nil {
+			logging.Fatalf("Error targeting format version %s: %v", *targetVersion, err)
+		}
+		for field, n := range counts {
+			removed[field] += n
+		}
+	}
+	if len(removed) > 0 {
+		fmt.Fprintf(status, "Removed the fields format %s doesn't support: %s\n", *targetVersion, crowler.FormatRemoved(removed))
+	}
+
+	paths, err := out.paths(rulesets)
+	if err != nil {
+		logging.Fatalf("Error in the ruleset file paths, no rules written: %v", err)
+	}
+	if !*force && format != OutputNDJSON {
+		files, err := overwritten(*outPath, rulesets, paths)
+		if err != nil {
+			logging.Fatalf("Error reading the files of %s: %v", *outPath, err)
+		}
+		for _, file := range files {
+			slog.Error("File exists and isn't a previous version of its ruleset", "file", filepath.Join(*outPath, file))
+		}
+		if len(files) > 0 {
+			logging.Fatalf("%d files of %s would be overwritten, no rules written (use -force to overwrite them)", len(files), *outPath)
+		}
+	}
+	if !*dryRun {
+		if err := os.MkdirAll(*outPath, 0o755); err != nil {
+			logging.Fatalf("Error creating the output directory %s: %v", *outPath, err)
+		}
+	}
+
+	// Translate the PCRE patterns the CROWler can't compile, and remove
+	// the untranslatable ones
+	patterns := quarantine.NewReport(c.Info().Source, invalidPatterns)
+	reporter.Start("Checking the patterns of the rulesets", len(rulesets))
+	for i := range rulesets {
+		if err := patterns.Check(&rulesets[i]); err != nil {
+			logging.Fatalf("Invalid pattern in ruleset %s: %v", rulesets[i].RulesetName, err)
+		}
+		reporter.Add(1)
+	}
+	reporter.Stop()
+	if translated, quarantined := patterns.Count(); translated+quarantined > 0 {
+		fmt.Fprintf(status, "Translated %d patterns to RE2, %d patterns without a translation (%s)",
+			translated, quarantined, invalidPatterns.String())
+		if *dryRun {
+			fmt.Fprintln(status)
+		} else {
+			filename := filepath.Join(*outPath, quarantine.FileName)
+			fmt.Fprintf(status, ", see %s\n", filename)
+			if err := patterns.Write(filename); err != nil {
+				logging.Fatalf("Error writing quarantine report %s: %v", filename, err)
+			}
+			outputs.addReport(quarantine.FileName)
+		}
+	}
+
+	if n := renamed.Count(); n > 0 {
+		fmt.Fprintf(status, "Renamed %d rules whose name a different rule has", n)
+		if *dryRun {
+			fmt.Fprintln(status)
+		} else {
+			filename := filepath.Join(*outPath, rulename.FileName)
+			fmt.Fprintf(status, ", see %s\n", filename)
+			if err := renamed.Write(filename); err != nil {
+				logging.Fatalf("Error writing rule name report %s: %v", filename, err)
+			}
+			outputs.addReport(rulename.FileName)
+		}
+	}
+
+	if cycles, missing := impliesReport.Count(); cycles+missing > 0 {
+		fmt.Fprintf(status, "Found %d implies cycles and %d implied objects no rule detects", cycles, missing)
+		if *dryRun {
+			fmt.Fprintln(status)
+		} else {
+			filename := filepath.Join(*outPath, implies.ReportFileName)
+			fmt.Fprintf(status, ", see %s\n", filename)
+			if err := impliesReport.Write(filename); err != nil {
+				logging.Fatalf("Error writing implies report %s: %v", filename, err)
+			}
+			outputs.addReport(implies.ReportFileName)
+		}
+	}
+
+	if *validate {
+		var problems []string
+		for _, ruleset := range rulesets {
+			data, err := crowler.Marshal(ruleset)
+			if err != nil {
+				logging.Fatalf("Error encoding ruleset %s: %v", ruleset.RulesetName, err)
+			}
+			problems = append(problems, validateRuleset(ruleset.FileName, data)...)
+		}
+		for _, problem := range problems {
+			slog.Error(problem)
+		}
+		if len(problems) > 0 {
+			logging.Fatalf("The generated rulesets don't match the ruleset schema, no rules written")
+		}
+	}
+
+	var db *store.Store
+	if *dbPath != "" && !*dryRun {
+		if db, err = store.Open(*dbPath); err != nil {
+			logging.Fatalf("Error opening database %s: %v", *dbPath, err)
+		}
+		defer db.Close()
+	}
+
+	var index *implies.Index
+	if *impliesIndex && !*dryRun {
+		index = implies.NewIndex(c.Info().Source)
+	}
+
+	var shared *duplicates.Report
+	if *duplicatesReport && !*dryRun {
+		shared = duplicates.NewReport(c.Info().Source)
+	}
+
+	stats := progress.NewSummary()
+	stats.DryRun = *dryRun
+	stats.Processed = int(processed.Load())
+	stats.Translated, stats.Dropped = patterns.Count()
+	if invalidPatterns != quarantine.PolicyQuarantine {
+		stats.Dropped = 0
+	}
+
+	unmanaged, pushed, pushFailed := 0, 0, 0
+	reporter.Start("Writing the rulesets", len(rulesets))
+	for i, ruleset := range rulesets {
+		fileName := paths[i]
+		filename := filepath.Join(*outPath, fileName)
+		var data []byte
+		changed := true
+		if *update {
+			var kept int
+			data, changed, kept, err = format.update(filename, ruleset)
+			unmanaged += kept
+		} else {
+			data, err = format.encode(ruleset)
+		}
+		if err != nil {
+			logging.Fatalf("Error encoding ruleset %s: %v", ruleset.RulesetName, err)
+		}
+		switch {
+		case *dryRun && changed:
+			stats.Written++
+		case *dryRun:
+			stats.Unchanged++
+		case format == OutputNDJSON:
+			fmt.Fprintf(status, "Writing ruleset %s...\n", ruleset.RulesetName)
+			if _, err := os.Stdout.Write(data); err != nil {
+				logging.Fatalf("Error writing ruleset %s: %v", ruleset.RulesetName, err)
+			}
+		case changed:
+			fmt.Fprintf(status, "Writing ruleset %s...\n", ruleset.RulesetName)
+			if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+				logging.Fatalf("Error creating directory %s: %v", filepath.Dir(filename), err)
+			}
+			if err := os.WriteFile(filename, data, 0o644); err != nil {
+				logging.Fatalf("Error writing %s to file %s: %v", strings.ToUpper(format.String()), filename, err)
+			}
+			stats.Written++
+		default:
+			stats.Unchanged++
+		}
+		// With -update only the changed rulesets are pushed again
+		if pusher != nil && changed && !*dryRun {
+			if *pushDryRun {
+				err = pusher.Preview(status, ruleset.RulesetName, data, format.contentType())
+			} else {
+				err = pusher.Push(data, format.contentType())
+			}
+			if err != nil {
+				slog.Error("Error pushing the ruleset", "ruleset", ruleset.RulesetName, "url", pusher.URL, "error", err)
+				pushFailed++
+			} else {
+				pushed++
+			}
+		}
+		stats.Add(ruleset)
+		reporter.Add(1)
+		if format != OutputNDJSON {
+			outputs.addRuleset(fileName, data, ruleset.RulesetName)
+		}
+		if db != nil {
+			if _, err := db.Import(data, fileName); err != nil {
+				logging.Fatalf("Error importing ruleset %s into %s: %v", ruleset.RulesetName, *dbPath, err)
+			}
+		}
+		if index != nil {
+			addToImpliesIndex(index, ruleset)
+		}
+		if shared != nil {
+			for _, group := range ruleset.RuleGroups {
+				for _, rule := range group.DetectionRules {
+					shared.Add(rule)
+				}
+			}
+		}
+	}
+	reporter.Stop()
+
+	if index != nil {
+		filename := filepath.Join(*outPath, implies.FileName)
+		fmt.Fprintln(status, "Writing implies index...")
+		if err := index.Write(filename); err != nil {
+			logging.Fatalf("Error writing implies index %s: %v", filename, err)
+		}
+		outputs.addReport(implies.FileName)
+	}
+
+	if shared != nil {
+		filename := filepath.Join(*outPath, duplicates.FileName)
+		fmt.Fprintf(status, "Writing duplicates report, %d signatures shared by several rules...\n", shared.Count())
+		if err := shared.Write(filename); err != nil {
+			logging.Fatalf("Error writing duplicates report %s: %v", filename, err)
+		}
+		outputs.addReport(duplicates.FileName)
+	}
+
+	skipped := invalidEntries.Count()
+	if skipped > 0 && !*dryRun {
+		filename := filepath.Join(*outPath, errreport.FileName)
+		fmt.Fprintf(status, "Writing error report, %d source entries skipped...\n", skipped)
+		if err := invalidEntries.Write(filename); err != nil {
+			logging.Fatalf("Error writing error report %s: %v", filename, err)
+		}
+		outputs.addReport(errreport.FileName)
+	}
+
+	if m != nil {
+		filename := filepath.Join(*outPath, manifest.FileName)
+		fmt.Fprintln(status, "Writing manifest...")
+		if err := m.Write(filename); err != nil {
+			logging.Fatalf("Error writing manifest %s: %v", filename, err)
+		}
+		outputs.files = append(outputs.files, manifest.FileName)
+	}
+
+	if *archivePath != "" && !*dryRun {
+		fmt.Fprintf(status, "Writing archive %s, %d files...\n", *archivePath, len(outputs.files))
+		createdAt, _ := time.Parse(time.RFC3339, info.Timestamp())
+		if err := archive.Write(*archivePath, *outPath, outputs.files, createdAt); err != nil {
+			logging.Fatalf("Error writing archive %s: %v", *archivePath, err)
+		}
+	}
+
+	if *update {
+		fmt.Fprintf(status, "%d rulesets unchanged, %d rules marked managed: false kept.\n", stats.Unchanged, unmanaged)
+	}
+	if *summary || *dryRun {
+		fmt.Fprintln(status)
+		if err := stats.Write(status); err != nil {
+			logging.Fatalf("Error writing the summary: %v", err)
+		}
+	}
+	if pusher != nil && !*pushDryRun && !*dryRun {
+		fmt.Fprintf(status, "Pushed %d rulesets to %s.\n", pushed, pusher.URL)
+		if pushFailed > 0 {
+			logging.Fatalf("Error pushing %d of %d rulesets to %s", pushFailed, pushed+pushFailed, pusher.URL)
+		}
+	}
+	switch {
+	case skipped > 0 && *dryRun:
+		logging.Fatalf("Skipped %d entries of %s that can't be read", skipped, source)
+	case skipped > 0:
+		logging.Fatalf("Skipped %d entries of %s that can't be read, see %s", skipped, source, filepath.Join(*outPath, errreport.FileName))
+	case *dryRun:
+		fmt.Fprintln(status, "Dry run, no files written.")
+	default:
+		fmt.Fprintln(status, "Ruleset files generated successfully.")
+	}
+}
+
+// outputFiles collects the files written to the output directory, for
+// the manifest (if not nil) and the archive
+type outputFiles struct {
+	dir      string
+	manifest *manifest.Manifest
+	files    []string
+}
+
+// addRuleset records the ruleset file at path, relative to the output
+// directory, with content data
+func (o *outputFiles) addRuleset(path string, data []byte, ruleset string) {
+	o.files = append(o.files, path)
+	if o.manifest != nil {
+		o.manifest.Add(path, data, ruleset)
+	}
+}
+
+// addReport records the report file name of the output directory
+func (o *outputFiles) addReport(name string) {
+	o.files = append(o.files, name)
+	if o.manifest == nil {
+		return
+	}
+	if err := o.manifest.AddFile(o.dir, name); err != nil {
+		logging.Fatalf("Error reading %s for the manifest: %v", name, err)
+	}
+}
+
+func addToImpliesIndex(index *implies.Index, ruleset crowler.Ruleset) {
+	for _, group := range ruleset.RuleGroups {
+		for _, rule := range group.DetectionRules {
+			index.Add(rule.ObjectName, rule.RuleName, rule.Implies)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the config file read from the current directory
+// when -config isn't given
+const ConfigFileName = "crowlerconv.yaml"
+
+// configFile is a config file: the values of the shared flags, by flag
+// name, and the values of the converter flags in a section per converter,
+// for example:
+//
+//	author: ACME Security
+//	heuristic-confidence: true
+//	category: [cms, web-servers]
+//	converters:
+//	  techjson:
+//	    categories: ./categories.json
+//	  modsec:
+//	    paranoia-level: 2
+type configFile struct {
+	Flags      map[string]yaml.Node            `yaml:",inline"`
+	Converters map[string]map[string]yaml.Node `yaml:"converters"`
+}
+
+// applyConfig sets the flags of flags from the config file at path, and
+// from its section of the converter c if c isn't nil. The flags given on
+// the command line keep their value, and the converter section overrides
+// the shared values. An empty path reads no file, and a missing file is
+// an error only if given with -config.
+func applyConfig(flags *flag.FlagSet, path string, c converter.Converter) error {
+	if path == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !set["config"] {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var config configFile
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	for name := range config.Converters {
+		if _, ok := converter.Get(name); !ok {
+			return fmt.Errorf("unknown converter %q in %s", name, path)
+		}
+	}
+
+	if c != nil {
+		where := fmt.Sprintf("%s, section %s", path, c.Name())
+		if err := setFlags(flags, config.Converters[c.Name()], set, where); err != nil {
+			return err
+		}
+	}
+	return setFlags(flags, config.Flags, set, path)
+}
+
+// setFlags sets the flags of values that aren't in set, and adds them to
+// set. where locates the values in the errors.
+func setFlags(flags *flag.FlagSet, values map[string]yaml.Node, set map[string]bool, where string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil || name == "config" {
+			return fmt.Errorf("unknown flag %q in %s", name, where)
+		}
+		if set[name] {
+			continue
+		}
+		node := values[name]
+		value, err := configValue(&node)
+		if err != nil {
+			return fmt.Errorf("flag %s in %s: %v", name, where, err)
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("flag %s in %s: %v", name, where, err)
+		}
+		set[name] = true
+	}
+	return nil
+}
+
+// configValue returns the flag value of a config value: a scalar as is,
+// a list of scalars joined with commas
+func configValue(node *yaml.Node) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+	case yaml.SequenceNode:
+		values := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return "", fmt.Errorf("line %d: expected a list of values", item.Line)
+			}
+			values[i] = item.Value
+		}
+		return strings.Join(values, ","), nil
+	}
+	return "", fmt.Errorf("line %d: expected a value or a list of values", node.Line)
+}
@@ -0,0 +1,114 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gotests/thecrowler-rules-converters/pkg/convert"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulediff"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+)
+
+// Diff compares the detection rules of two rulesets (files or
+// directories) and prints the rules added, removed and changed. With
+// -convert the new rulesets are converted from a source instead. The exit
+// status is 1 if the rules differ.
+func Diff(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] <old rulesets> <new rulesets or source>\n", name)
+		fs.PrintDefaults()
+	}
+	jsonOutput := fs.Bool("json", false, "Write the changes as JSON")
+	convertWith := fs.String("convert", "", "Convert the new rulesets from a source with this converter (auto to detect it)")
+	namespace := fs.String("namespace", "", "Namespace of the converted rulesets, to compare them with namespaced ones")
+	logFlags := logging.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	before, err := readRulesets(fs.Arg(0))
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", fs.Arg(0), err)
+	}
+	var after []crowler.Ruleset
+	if *convertWith != "" {
+		if !crowler.ValidNamespace(*namespace) {
+			logging.Fatalf("Invalid namespace %q, only letters, digits, '-' and '_' are allowed", *namespace)
+		}
+		after, err = convertSource(*convertWith, fs.Arg(1), *namespace)
+	} else {
+		after, err = readRulesets(fs.Arg(1))
+	}
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", fs.Arg(1), err)
+	}
+
+	diff, err := rulediff.Compare(before, after)
+	if err != nil {
+		logging.Fatalf("Error comparing the rulesets: %v", err)
+	}
+	if *jsonOutput {
+		err = diff.WriteJSON(os.Stdout)
+	} else {
+		err = diff.Write(os.Stdout)
+	}
+	if err != nil {
+		logging.Fatalf("Error writing the changes: %v", err)
+	}
+	if diff.Added+diff.Removed+diff.Changed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readRulesets reads a ruleset file, or the YAML rulesets of a directory
+func readRulesets(path string) ([]crowler.Ruleset, error) {
+	files, err := rulesetfiles.List(path)
+	if err != nil {
+		return nil, err
+	}
+	var rulesets []crowler.Ruleset
+	for _, file := range files {
+		ruleset, err := crowler.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ruleset %s: %v", file, err)
+		}
+		rulesets = append(rulesets, ruleset)
+	}
+	return rulesets, nil
+}
+
+// convertSource converts the source at path (a file, a directory or an
+// http(s) URL) with the converter called name, or the detected one if
+// name is auto, and the default options
+func convertSource(name, path, namespace string) ([]crowler.Ruleset, error) {
+	if name == "auto" {
+		name = ""
+	}
+	opts := convert.Options{Converter: name}
+	opts.Namespace = namespace
+	opts.Normalize = true
+	return convert.File(path, opts)
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// OutputFormat is the format the rulesets are written in. It's a
+// flag.Value, the zero value is OutputYAML.
+type OutputFormat string
+
+const (
+	// OutputYAML writes a YAML file per ruleset
+	OutputYAML OutputFormat = "yaml"
+	// OutputJSON writes an indented JSON file per ruleset
+	OutputJSON OutputFormat = "json"
+	// OutputNDJSON writes the rulesets to the standard output, one JSON
+	// document per line
+	OutputNDJSON OutputFormat = "ndjson"
+)
+
+// outputFormatUsage is the usage of the -format flag
+const outputFormatUsage = "Format of the rulesets: yaml, json or ndjson (one ruleset per line on the standard output), default yaml"
+
+func (f *OutputFormat) String() string {
+	if f == nil || *f == "" {
+		return string(OutputYAML)
+	}
+	return string(*f)
+}
+
+func (f *OutputFormat) Set(value string) error {
+	switch format := OutputFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case OutputYAML, OutputJSON, OutputNDJSON:
+		*f = format
+		return nil
+	}
+	return fmt.Errorf("invalid format %q, expected yaml, json or ndjson", value)
+}
+
+// encode returns the encoding of ruleset in the format, ending with a
+// newline
+func (f OutputFormat) encode(ruleset crowler.Ruleset) ([]byte, error) {
+	switch f {
+	case OutputJSON:
+		return crowler.MarshalJSON(ruleset)
+	case OutputNDJSON:
+		return crowler.MarshalJSONLine(ruleset)
+	}
+	return crowler.Marshal(ruleset)
+}
+
+// contentType returns the media type of the rulesets encoded in the
+// format
+func (f OutputFormat) contentType() string {
+	if f == OutputJSON || f == OutputNDJSON {
+		return "application/json"
+	}
+	return "application/yaml"
+}
+
+// fileName returns the name of the file of a ruleset the converter
+// suggests to write to name, with the extension of the format
+func (f OutputFormat) fileName(name string) string {
+	if f != OutputJSON {
+		return name
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".json"
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// RulesetInfoFlags adds the flags setting the descriptive fields of the
+// generated rulesets to fs: -author, -created-at, -description,
+// -format-version, -license and -ruleset-name-prefix. Their defaults come
+// from the CROWLER_AUTHOR, SOURCE_DATE_EPOCH, CROWLER_DESCRIPTION,
+// CROWLER_FORMAT_VERSION, CROWLER_LICENSE and CROWLER_RULESET_NAME_PREFIX
+// environment variables.
+func RulesetInfoFlags(fs *flag.FlagSet) *crowler.RulesetInfo {
+	info := &crowler.RulesetInfo{}
+	fs.StringVar(&info.Author, "author", envOr("CROWLER_AUTHOR", crowler.DefaultAuthor),
+		"Author of the generated rulesets (env CROWLER_AUTHOR)")
+	fs.StringVar(&info.CreatedAt, "created-at", sourceDateEpoch(),
+		"Creation time of the generated rulesets, RFC 3339 time or YYYY-MM-DD date (default now, env SOURCE_DATE_EPOCH)")
+	fs.StringVar(&info.Description, "description", os.Getenv("CROWLER_DESCRIPTION"),
+		"Description of the generated rulesets, replacing the generated one (env CROWLER_DESCRIPTION)")
+	fs.StringVar(&info.FormatVersion, "format-version", envOr("CROWLER_FORMAT_VERSION", crowler.FormatVersion),
+		"Format version of the generated rulesets (env CROWLER_FORMAT_VERSION)")
+	fs.StringVar(&info.License, "license", os.Getenv("CROWLER_LICENSE"),
+		"License of the generated rulesets, SPDX identifier (env CROWLER_LICENSE)")
+	fs.StringVar(&info.NamePrefix, "ruleset-name-prefix", os.Getenv("CROWLER_RULESET_NAME_PREFIX"),
+		"Prefix for the ruleset names only (env CROWLER_RULESET_NAME_PREFIX)")
+	return info
+}
+
+// envOr returns the value of the environment variable key, or def if
+// it's not set
+func envOr(key, def string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return def
+}
+
+// sourceDateEpoch returns the time set by the SOURCE_DATE_EPOCH
+// environment variable (seconds since the Unix epoch, see
+// https://reproducible-builds.org/specs/source-date-epoch/) in RFC 3339
+// format. An invalid value is returned as is, for Validate to report it.
+func sourceDateEpoch() string {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return ""
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
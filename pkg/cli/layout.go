@@ -0,0 +1,211 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// outTemplateUsage is the usage of the -out-template flag
+const outTemplateUsage = "Template of the path of the ruleset files in -o, e.g. '{{.Source}}/{{.Category}}.{{.Ext}}' (fields Source, Converter, Category, Ruleset, Name and Ext, default the file name the converter gives)"
+
+// windowsReserved are the device names Windows doesn't allow as file
+// names, whatever their extension
+var windowsReserved = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// outputPath holds the fields of the -out-template of a ruleset. They are
+// file name slugs, so they can't add directories or leave -o.
+type outputPath struct {
+	// Source is the name of the source, e.g. wappalyzer-technologies-json
+	Source string
+	// Converter is the name of the converter, e.g. techjson
+	Converter string
+	// Category is the category of the first rule group having one, or
+	// uncategorized
+	Category string
+	// Ruleset is the name of the ruleset
+	Ruleset string
+	// Name is the file name the converter gives, without its extension
+	Name string
+	// Ext is the extension of the format, yaml or json
+	Ext string
+}
+
+// layout gives the paths of the ruleset files in the output directory
+type layout struct {
+	template  *template.Template
+	source    string
+	converter string
+	format    OutputFormat
+}
+
+// newLayout returns the layout of the -out-template text, the file names
+// the converter gives if it's empty
+func newLayout(text string, c converter.Converter, format OutputFormat) (*layout, error) {
+	l := &layout{source: slug.File(c.Info().Source), converter: c.Name(), format: format}
+	if strings.TrimSpace(text) == "" {
+		return l, nil
+	}
+	if format == OutputNDJSON {
+		return nil, fmt.Errorf("-out-template needs the rulesets written to files, it can't be used with -format ndjson")
+	}
+	var err error
+	if l.template, err = template.New("out-template").Option("missingkey=error").Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid -out-template: %v", err)
+	}
+	return l, nil
+}
+
+// path returns the path of the file of ruleset, relative to the output
+// directory
+func (l *layout) path(ruleset crowler.Ruleset) (string, error) {
+	if l.template == nil {
+		return safePath(l.format.fileName(ruleset.FileName)), nil
+	}
+
+	category := "uncategorized"
+	for _, group := range ruleset.RuleGroups {
+		if group.Category != "" {
+			category = slug.File(group.Category)
+			break
+		}
+	}
+	fields := outputPath{
+		Source:    l.source,
+		Converter: l.converter,
+		Category:  category,
+		Ruleset:   slug.File(ruleset.RulesetName),
+		Name:      strings.TrimSuffix(ruleset.FileName, filepath.Ext(ruleset.FileName)),
+		Ext:       l.format.String(),
+	}
+
+	var b strings.Builder
+	if err := l.template.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("error in -out-template: %v", err)
+	}
+	path := safePath(strings.TrimSpace(b.String()))
+	if path == "" {
+		return "", fmt.Errorf("-out-template gives an empty path to ruleset %s", ruleset.RulesetName)
+	}
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("-out-template gives the path %q to ruleset %s, outside of the output directory", b.String(), ruleset.RulesetName)
+	}
+	return path, nil
+}
+
+// paths returns the paths of the files of rulesets. When two rulesets,
+// or a ruleset and a report, would be written to the same file, the
+// later ruleset gets a numeric suffix (-2, -3, ...). The paths are
+// compared regardless of case, for the case insensitive file systems.
+func (l *layout) paths(rulesets []crowler.Ruleset) ([]string, error) {
+	paths := make([]string, len(rulesets))
+	taken := make(map[string]bool, len(rulesets)+len(rulesetfiles.Reports))
+	for name := range rulesetfiles.Reports {
+		taken[name] = true
+	}
+	for i, ruleset := range rulesets {
+		path, err := l.path(ruleset)
+		if err != nil {
+			return nil, err
+		}
+		if l.format != OutputNDJSON {
+			unique := path
+			for n := 2; taken[strings.ToLower(unique)]; n++ {
+				ext := filepath.Ext(path)
+				unique = strings.TrimSuffix(path, ext) + "-" + strconv.Itoa(n) + ext
+			}
+			if unique != path {
+				slog.Warn("Ruleset file name already taken, adding a suffix", "ruleset", ruleset.RulesetName, "file", path, "renamed", unique)
+				path = unique
+			}
+			taken[strings.ToLower(path)] = true
+		}
+		paths[i] = path
+	}
+	return paths, nil
+}
+
+// overwritten returns the paths of the files of dir the rulesets would
+// overwrite and that aren't a previous version of their ruleset: they
+// aren't a ruleset, or a ruleset of another name
+func overwritten(dir string, rulesets []crowler.Ruleset, paths []string) ([]string, error) {
+	var out []string
+	for i, ruleset := range rulesets {
+		data, err := os.ReadFile(filepath.Join(dir, paths[i]))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if previous, err := crowler.Unmarshal(data); err != nil || previous.RulesetName != ruleset.RulesetName {
+			out = append(out, paths[i])
+		}
+	}
+	return out, nil
+}
+
+// safePath returns the slash separated path with names valid on Linux,
+// macOS and Windows, see safeName, in the system form
+func safePath(path string) string {
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		if name != "" && name != "." && name != ".." {
+			names[i] = safeName(name)
+		}
+	}
+	return filepath.Join(names...)
+}
+
+// safeName replaces the characters Windows doesn't allow in a file name
+// with dashes, removes the trailing dots and spaces Windows drops, and
+// suffixes the reserved device names (con, nul, ...) with a dash
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	name = strings.TrimRight(name, ". ")
+	base, ext, _ := strings.Cut(name, ".")
+	if windowsReserved[strings.ToLower(base)] {
+		name = base + "-"
+		if ext != "" {
+			name += "." + ext
+		}
+	}
+	if name == "" {
+		return "-"
+	}
+	return name
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/lint"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+)
+
+// Lint checks the detection rules of ruleset files (or directories of
+// rulesets) for empty rules, website only rules, broad patterns,
+// duplicate names and confidences out of range, and prints the problems
+// found. The exit status is 1 if there are problems.
+func Lint(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [flags] <ruleset files or directories>\n", name)
+		fs.PrintDefaults()
+	}
+	disable := fs.String("disable", "", "Comma separated list of checks to skip ("+strings.Join(lint.Checks, ", ")+")")
+	logFlags := logging.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	linter, err := lint.New(strings.Split(*disable, ","))
+	if err != nil {
+		logging.Fatalf("Error parsing -disable: %v", err)
+	}
+
+	checked, problems := 0, 0
+	for _, path := range fs.Args() {
+		files, err := rulesetfiles.List(path)
+		if err != nil {
+			logging.Fatalf("Error reading %s: %v", path, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logging.Fatalf("Error reading %s: %v", file, err)
+			}
+			ruleset, err := crowler.Unmarshal(data)
+			if err != nil {
+				logging.Fatalf("Error parsing %s: %v", file, err)
+			}
+			checked++
+			for _, problem := range linter.Check(file, ruleset) {
+				problems++
+				fmt.Println(problem)
+			}
+		}
+	}
+
+	fmt.Fprintf(logFlags.Status(os.Stdout), "%d problems in %d rulesets.\n", problems, checked)
+	if problems > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// update returns the encoding of ruleset to write to path with -update:
+// the unmanaged rules of the ruleset already at path are kept, and its
+// creation time too when nothing else changed. It also returns whether
+// the content differs from the file, and the number of rules kept.
+func (f OutputFormat) update(path string, ruleset crowler.Ruleset) (data []byte, changed bool, kept int, err error) {
+	old, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = f.encode(ruleset)
+		return data, true, 0, err
+	}
+	if err != nil {
+		return nil, false, 0, err
+	}
+	previous, err := crowler.Unmarshal(old)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	kept = crowler.KeepUnmanaged(&ruleset, previous)
+
+	createdAt := ruleset.CreatedAt
+	ruleset.CreatedAt = previous.CreatedAt
+	if data, err = f.encode(ruleset); err != nil || bytes.Equal(data, old) {
+		return data, false, kept, err
+	}
+	ruleset.CreatedAt = createdAt
+	data, err = f.encode(ruleset)
+	return data, true, kept, err
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/logging"
+	"gotests/thecrowler-rules-converters/pkg/rulesetfiles"
+)
+
+// validateRuleset checks an encoded ruleset against the ruleset schema
+// and the parent groups and action rules checks. It returns the
+// problems found, prefixed with name and their line.
+func validateRuleset(name string, data []byte) []string {
+	errs, err := crowler.ValidateSchema(data)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", name, err)}
+	}
+	var problems []string
+	for _, e := range errs {
+		problems = append(problems, fmt.Sprintf("%s:%d:%d: %s: %s", name, e.Line, e.Column, e.Path, e.Message))
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	ruleset, err := crowler.Unmarshal(data)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", name, err)}
+	}
+	for _, check := range []func(crowler.Ruleset) error{crowler.ValidateParentGroups, crowler.ValidateActionRules} {
+		if err := check(ruleset); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return problems
+}
+
+// Validate checks ruleset files (or directories of rulesets) against the
+// ruleset schema and prints the problems found. The exit status is 1 if
+// a ruleset is invalid.
+func Validate(name string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s <ruleset files or directories>\n", name)
+		fs.PrintDefaults()
+	}
+	printSchema := fs.Bool("schema", false, "Print the ruleset JSON schema and exit")
+	logFlags := logging.AddFlags(fs)
+	_ = fs.Parse(args)
+	if err := logFlags.Setup(); err != nil {
+		logging.Fatalf("Error parsing the log flags: %v", err)
+	}
+	if *printSchema {
+		os.Stdout.Write(crowler.Schema())
+		return
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	checked, invalid := 0, 0
+	for _, path := range fs.Args() {
+		files, err := rulesetfiles.List(path)
+		if err != nil {
+			logging.Fatalf("Error reading %s: %v", path, err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				logging.Fatalf("Error reading %s: %v", file, err)
+			}
+			checked++
+			if problems := validateRuleset(file, data); len(problems) > 0 {
+				invalid++
+				for _, problem := range problems {
+					fmt.Println(problem)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(logFlags.Status(os.Stdout), "%d of %d rulesets valid.\n", checked-invalid, checked)
+	if invalid > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/logging"
+)
+
+// watcher converts the input again each time it changes
+type watcher struct {
+	// path is the input file or directory, polled every interval
+	path     string
+	interval time.Duration
+	status   io.Writer
+	// args are the arguments of the child process converting path
+	args []string
+}
+
+// watch converts path now and each time it changes, until the process is
+// stopped. Each conversion runs the command again without -watch in a
+// child process, so a conversion failing (e.g. on a file half written by
+// the process syncing the source) doesn't stop the watch. The child
+// gets the arguments of the process, with -watch disabled.
+func (w *watcher) watch() {
+	last, err := snapshot(w.path)
+	if err != nil {
+		logging.Fatalf("Error reading %s: %v", w.path, err)
+	}
+	w.convert()
+
+	// A change is converted once the input stops changing for an
+	// interval, not while it's being written
+	pending := false
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		current, err := snapshot(w.path)
+		if err != nil {
+			slog.Warn("Error reading the watched input", "path", w.path, "error", err)
+			continue
+		}
+		if current != last {
+			last, pending = current, true
+			continue
+		}
+		if pending {
+			pending = false
+			fmt.Fprintf(w.status, "%s changed, converting it again...\n", w.path)
+			w.convert()
+		}
+	}
+}
+
+// convert runs the conversion in a child process
+func (w *watcher) convert() {
+	executable, err := os.Executable()
+	if err != nil {
+		logging.Fatalf("Error finding the command to run: %v", err)
+	}
+	cmd := exec.Command(executable, w.args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		slog.Error("Error converting the watched input, waiting for the next change", "path", w.path, "error", err)
+	}
+}
+
+// childArgs returns the arguments of the child processes of -watch: the
+// arguments of the process, args being the ones Run parsed and ending
+// with positional arguments, with -watch=false in place of the -watch
+// flags. It goes before the flags, as the flag package stops at the
+// first positional argument, and is given even without -watch on the
+// command line, as the config file can set it.
+func childArgs(args []string, positional int) []string {
+	n := max(len(os.Args)-len(args), 1)
+	out := append([]string(nil), os.Args[1:n]...)
+	out = append(out, "-watch=false")
+	flags := args[:len(args)-positional]
+	for _, arg := range flags {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "watch" {
+			continue
+		}
+		out = append(out, arg)
+	}
+	return append(out, args[len(flags):]...)
+}
+
+// snapshot returns a summary of the names, sizes and modification times
+// of the file path, or of the files of the directory path, which changes
+// when one of them does
+func snapshot(path string) (string, error) {
+	var b strings.Builder
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
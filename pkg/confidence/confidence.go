@@ -0,0 +1,206 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package confidence scores the signatures of the generated rules by
+// their type, so the signals that rarely match by chance (a header, a
+// script address) weigh more than the generic ones (a text in the page,
+// a link to the vendor website).
+package confidence
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The signature types of a profile
+const (
+	// Header is an HTTP header or cookie
+	Header = "header"
+	// Meta is a meta tag
+	Meta = "meta"
+	// Script is the address of a script (script src)
+	Script = "script"
+	// DOM is an element or attribute of the page, other than a script
+	// address
+	DOM = "dom"
+	// HTML is a text of the page
+	HTML = "html"
+	// Website is a link to the website of the detected object
+	Website = "website"
+	// Hash is the hash of a resource, e.g. the favicon
+	Hash = "hash"
+	// URL is a pattern of the page address
+	URL = "url"
+	// JS is a global JavaScript object
+	JS = "js"
+	// CSS is a stylesheet pattern
+	CSS = "css"
+	// Network is a request made by the page
+	Network = "network"
+	// DNS is a DNS record of the site
+	DNS = "dns"
+	// SSL is a field of the site certificate
+	SSL = "ssl"
+)
+
+// Profile maps the signature types to their confidence
+type Profile map[string]float32
+
+// Heuristic is the default profile: the headers and cookies first, then
+// the specific resources (scripts, JavaScript objects), the generic page
+// content and last the links to the vendor website
+var Heuristic = Profile{
+	Header:  10,
+	Hash:    10,
+	SSL:     9,
+	DNS:     9,
+	Meta:    8,
+	Script:  8,
+	JS:      8,
+	Network: 7,
+	DOM:     6,
+	CSS:     6,
+	URL:     5,
+	HTML:    4,
+	Website: 2,
+}
+
+// Types returns the signature types, sorted
+func Types() []string {
+	types := make([]string, 0, len(Heuristic))
+	for t := range Heuristic {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Load reads a profile file, a YAML object mapping signature types to
+// their confidence, for example:
+//
+//	header: 10
+//	html: 3
+//	website: 1
+//
+// The types missing from the file keep their Heuristic confidence.
+func Load(path string) (Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]float32
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing confidence profile %s: %v", path, err)
+	}
+
+	profile := make(Profile, len(Heuristic))
+	for t, c := range Heuristic {
+		profile[t] = c
+	}
+	for t, c := range raw {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if _, ok := Heuristic[t]; !ok {
+			return nil, fmt.Errorf("unknown signature type %q in %s, expected one of %s", t, path, strings.Join(Types(), ", "))
+		}
+		if c < 0 || c > crowler.MaxConfidence {
+			return nil, fmt.Errorf("confidence %g of %s in %s is out of 0..%d", c, t, path, crowler.MaxConfidence)
+		}
+		profile[t] = c
+	}
+	return profile, nil
+}
+
+// Apply sets the confidence of the signatures of rule from their type
+func (p Profile) Apply(rule *crowler.DetectionRule) {
+	website := ""
+	if rule.Metadata != nil {
+		website = rule.Metadata.Website
+	}
+
+	for i := range rule.HTTPHeaderFields {
+		rule.HTTPHeaderFields[i].Confidence = round(p[Header])
+	}
+	for i := range rule.Cookies {
+		rule.Cookies[i].Confidence = p[Header]
+	}
+	for i := range rule.MetaTags {
+		rule.MetaTags[i].Confidence = round(p[Meta])
+		rule.MetaTags[i].ContentConfidence = nil
+	}
+	for i := range rule.PageContentPatterns {
+		s := &rule.PageContentPatterns[i]
+		s.Confidence = p[pageContentType(s, website)]
+	}
+	for i := range rule.SSLSignatures {
+		rule.SSLSignatures[i].Confidence = p[SSL]
+	}
+	for i := range rule.DNSSignatures {
+		rule.DNSSignatures[i].Confidence = p[DNS]
+	}
+	for i := range rule.URLPatterns {
+		u := &rule.URLPatterns[i]
+		u.Confidence = p[URL]
+		if crowler.IsWebsitePattern(u.Signature, website) {
+			u.Confidence = p[Website]
+		}
+	}
+	for i := range rule.JSPatterns {
+		rule.JSPatterns[i].Confidence = p[JS]
+	}
+	for i := range rule.CSSPatterns {
+		rule.CSSPatterns[i].Confidence = p[CSS]
+	}
+	for i := range rule.NetworkPatterns {
+		rule.NetworkPatterns[i].Confidence = p[Network]
+	}
+}
+
+// pageContentType returns the signature type of a page content pattern
+func pageContentType(s *crowler.PageContentSignature, website string) string {
+	if len(s.MD5Hash)+len(s.SHA256Hash)+len(s.MMH3Hash) > 0 {
+		return Hash
+	}
+	if website != "" && len(s.Signature) > 0 {
+		all := true
+		for _, pattern := range s.Signature {
+			all = all && crowler.IsWebsitePattern(pattern, website)
+		}
+		if all {
+			return Website
+		}
+	}
+	switch {
+	case len(s.Text) > 0 && len(s.Signature) == 0:
+		return HTML
+	case strings.EqualFold(s.Key, "script") && strings.EqualFold(s.Attribute, "src"):
+		return Script
+	case strings.EqualFold(s.Key, "body") || strings.EqualFold(s.Key, "html"):
+		return HTML
+	}
+	return DOM
+}
+
+// round converts a confidence for the signatures with an integer
+// confidence
+func round(confidence float32) int {
+	return int(math.Round(float64(confidence)))
+}
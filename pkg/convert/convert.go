@@ -0,0 +1,238 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package convert runs the converters from Go, for the programs (the
+// CROWler itself, third-party tools) embedding them instead of running
+// crowlerconv. It picks the converter by name or by sniffing the source,
+// and applies to the rulesets the steps crowlerconv applies before
+// writing them: the implies relations are resolved, the signatures
+// sorted, the ruleset info set and the patterns translated to RE2.
+//
+// The converter packages can also be imported on their own, e.g.
+// wappalyzer.Convert, to convert a known format without these steps.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gotests/thecrowler-rules-converters/pkg/banner"
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/fetch"
+	"gotests/thecrowler-rules-converters/pkg/implies"
+	"gotests/thecrowler-rules-converters/pkg/quarantine"
+)
+
+// Options holds the settings of a conversion. The zero value converts
+// with the defaults of crowlerconv, but for the normalization which is
+// off.
+type Options struct {
+	converter.Options
+	// Converter is the name of the converter (see converter.All), empty
+	// detects the format of the source
+	Converter string
+	// Info sets the author, license, name prefix... of the rulesets, its
+	// empty fields keep the values of the converter
+	Info crowler.RulesetInfo
+	// TargetVersion, if set, removes the fields the format version of
+	// the CROWler doesn't support (see crowler.TargetVersion)
+	TargetVersion string
+	// Patterns, if set, collects the translated and the quarantined
+	// patterns and gives the policy for the patterns without an RE2
+	// translation (see quarantine.NewReport). Without it they are
+	// quarantined.
+	Patterns *quarantine.Report
+	// Implies, if set, gets the report of the implies cycles and of the
+	// implied objects no rule detects (see implies.Resolve)
+	Implies *implies.Report
+	// ExpandImplies tags the rules with the categories of the objects
+	// they imply, and ImpliedRules also adds the copies of the rules
+	// detecting them (see implies.Expand)
+	ExpandImplies bool
+	ImpliedRules  bool
+	// BannerVersions adds the version captures of the product names of
+	// the Server and X-Powered-By header patterns (see banner.Versions)
+	BannerVersions bool
+}
+
+// Convert converts the source read from r into rulesets. The source is
+// read in memory when its format is detected.
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	c, err := find(opts.Converter)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		if c, err = converter.Detect(data); err != nil {
+			return nil, fmt.Errorf("error detecting the format: %v", err)
+		}
+		r = bytes.NewReader(data)
+	}
+	return run(c, r, opts)
+}
+
+// File converts the source at path, a file, a directory for the
+// converters reading them, or an http(s) URL which is downloaded first
+// (see fetch.URL). The file name and directory of the options default
+// to those of path.
+func File(path string, opts Options) ([]crowler.Ruleset, error) {
+	c, err := find(opts.Converter)
+	if err != nil {
+		return nil, err
+	}
+	if fetch.IsURL(path) {
+		local, err := fetch.URL(path)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching %s: %v", path, err)
+		}
+		path = local
+	}
+	if opts.FileName == "" {
+		opts.FileName = filepath.Base(path)
+	}
+	if opts.Dir == "" {
+		opts.Dir = filepath.Dir(path)
+	}
+
+	c, input, err := Open(c, path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	return run(c, input, opts)
+}
+
+// Open opens the source at path. The file of a known converter is
+// streamed, the other sources are read in memory by Read.
+func Open(c converter.Converter, path string) (converter.Converter, io.ReadCloser, error) {
+	if c != nil {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			file, err := os.Open(path)
+			return c, file, err
+		}
+	}
+	c, data, err := Read(c, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Read reads the source at path, a file or, for the converters
+// supporting it, a directory. If c is nil the converter is detected.
+func Read(c converter.Converter, path string) (converter.Converter, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if c == nil {
+			if c, err = converter.Detect(data); err != nil {
+				return nil, nil, fmt.Errorf("error detecting the format: %v", err)
+			}
+		}
+		return c, data, nil
+	}
+
+	if c != nil {
+		dirReader, ok := c.(converter.DirReader)
+		if !ok {
+			return nil, nil, fmt.Errorf("the %s converter reads a file, not a directory", c.Name())
+		}
+		data, err := dirReader.ReadDir(path)
+		return c, data, err
+	}
+
+	// Detect the format of a directory with the converters reading them
+	for _, c := range converter.All() {
+		dirReader, ok := c.(converter.DirReader)
+		if !ok {
+			continue
+		}
+		if data, err := dirReader.ReadDir(path); err == nil && c.Detect(data) {
+			return c, data, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("error detecting the format: unknown directory layout")
+}
+
+// find returns the converter called name, nil if name is empty
+func find(name string) (converter.Converter, error) {
+	if name == "" {
+		return nil, nil
+	}
+	c, ok := converter.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown converter %q", name)
+	}
+	return c, nil
+}
+
+// run converts the source read from r with c and applies the steps of
+// crowlerconv to the rulesets
+func run(c converter.Converter, r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	if err := opts.Info.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.TargetVersion != "" {
+		if err := crowler.ValidTargetVersion(opts.TargetVersion); err != nil {
+			return nil, err
+		}
+	}
+
+	rulesets, err := c.Convert(r, opts.Options)
+	if err != nil {
+		return nil, err
+	}
+	if report := implies.Resolve(rulesets, c.Info().Source); opts.Implies != nil {
+		*opts.Implies = *report
+	}
+	if opts.ExpandImplies || opts.ImpliedRules {
+		implies.Expand(rulesets, opts.ImpliedRules)
+	}
+	if opts.BannerVersions {
+		banner.Versions(rulesets)
+	}
+
+	patterns := opts.Patterns
+	if patterns == nil {
+		patterns = quarantine.NewReport(c.Info().Source, quarantine.PolicyQuarantine)
+	}
+	for i := range rulesets {
+		crowler.SortRuleset(&rulesets[i])
+		opts.Info.Apply(&rulesets[i])
+		if opts.TargetVersion != "" {
+			if _, err := crowler.TargetVersion(&rulesets[i], opts.TargetVersion); err != nil {
+				return nil, err
+			}
+		}
+		if err := patterns.Check(&rulesets[i]); err != nil {
+			return nil, fmt.Errorf("invalid pattern in ruleset %s: %v", rulesets[i].RulesetName, err)
+		}
+	}
+	return rulesets, nil
+}
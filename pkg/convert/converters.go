@@ -0,0 +1,44 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package convert
+
+// The converters available to Convert and to the command line, they
+// register themselves with the converter package. Import a new converter
+// here to add it to crowlerconv.
+import (
+	_ "gotests/thecrowler-rules-converters/pkg/converter/arachni"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/builtwith"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/cmslist"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/favhash"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/fingerprinthub"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/modsecurity"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/nikto"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/nmap"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/nuclei"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/p0f"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/plugin"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/retirejs"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/robots"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/schemaorg"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/sitemap"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/suricata"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/techjson"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/tlsfp"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/urlfeed"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/wafw00f"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/wappalyzer"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/whatweb"
+	_ "gotests/thecrowler-rules-converters/pkg/converter/wpscan"
+)
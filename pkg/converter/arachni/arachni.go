@@ -0,0 +1,371 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package arachni converts the Arachni (and SCNR) platform fingerprinters
+// into CROWler rulesets, one per platform type: operating systems,
+// servers, languages and frameworks. The fingerprinters are Ruby code,
+// which isn't run: the converter reads the literal arguments of their
+// checks on the Server and X-Powered-By headers, the cookies, the headers,
+// the query parameters and the file extensions.
+package arachni
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Arachni platform fingerprinters"
+	// DefaultSourceLicense is used as Arachni has its own license (the
+	// Arachni Public Source License), with no SPDX identifier
+	DefaultSourceLicense = "NOASSERTION"
+)
+
+// The platform types, as named by Arachni. They're the taxonomy keys of
+// the rulesets.
+const (
+	TypeOS         = "os"
+	TypeServers    = "servers"
+	TypeLanguages  = "languages"
+	TypeFrameworks = "frameworks"
+	TypeOther      = "other"
+)
+
+// typeDescriptions describes the platform types in the ruleset
+// descriptions
+var typeDescriptions = map[string]string{
+	TypeOS:         "operating systems",
+	TypeServers:    "web servers",
+	TypeLanguages:  "programming languages",
+	TypeFrameworks: "web frameworks",
+	TypeOther:      "platforms",
+}
+
+// platform is a platform Arachni detects
+type platform struct {
+	name string
+	typ  string
+}
+
+// platforms maps the Arachni platform symbols to their name and type
+var platforms = map[string]platform{
+	"unix":        {"Unix", TypeOS},
+	"linux":       {"Linux", TypeOS},
+	"bsd":         {"BSD", TypeOS},
+	"aix":         {"AIX", TypeOS},
+	"solaris":     {"Solaris", TypeOS},
+	"windows":     {"Windows", TypeOS},
+	"apache":      {"Apache", TypeServers},
+	"iis":         {"IIS", TypeServers},
+	"jetty":       {"Jetty", TypeServers},
+	"nginx":       {"Nginx", TypeServers},
+	"tomcat":      {"Apache Tomcat", TypeServers},
+	"gunicorn":    {"Gunicorn", TypeServers},
+	"asp":         {"ASP", TypeLanguages},
+	"aspx":        {"ASP.NET", TypeLanguages},
+	"java":        {"Java", TypeLanguages},
+	"perl":        {"Perl", TypeLanguages},
+	"php":         {"PHP", TypeLanguages},
+	"python":      {"Python", TypeLanguages},
+	"ruby":        {"Ruby", TypeLanguages},
+	"nodejs":      {"Node.js", TypeLanguages},
+	"rack":        {"Rack", TypeFrameworks},
+	"rails":       {"Ruby on Rails", TypeFrameworks},
+	"cakephp":     {"CakePHP", TypeFrameworks},
+	"symfony":     {"Symfony", TypeFrameworks},
+	"nette":       {"Nette", TypeFrameworks},
+	"django":      {"Django", TypeFrameworks},
+	"aspx_mvc":    {"ASP.NET MVC", TypeFrameworks},
+	"jsf":         {"JavaServer Faces", TypeFrameworks},
+	"cherrypy":    {"CherryPy", TypeFrameworks},
+	"express":     {"Express", TypeFrameworks},
+	"sinatra":     {"Sinatra", TypeFrameworks},
+	"laravel":     {"Laravel", TypeFrameworks},
+	"codeigniter": {"CodeIgniter", TypeFrameworks},
+}
+
+// typeRanks orders the platform types from the most specific
+var typeRanks = map[string]int{
+	TypeFrameworks: 0,
+	TypeLanguages:  1,
+	TypeServers:    2,
+	TypeOther:      3,
+	TypeOS:         4,
+}
+
+// lookup returns the platform of a symbol, named after the symbol if it
+// isn't known
+func lookup(symbol string) platform {
+	if p, ok := platforms[symbol]; ok {
+		return p
+	}
+	return platform{name: symbol, typ: TypeOther}
+}
+
+// rubyRegexp converts a Ruby regexp to a Go one. It returns false if the
+// regexp uses extended mode or a construct Go doesn't support.
+func rubyRegexp(re *Regexp) (string, bool) {
+	if strings.Contains(re.Flags, "x") {
+		return "", false
+	}
+	pattern := strings.NewReplacer(`\h`, `[0-9A-Fa-f]`, `\Z`, `\n?\z`, `\/`, `/`).Replace(re.Source)
+	flags := ""
+	if strings.Contains(re.Flags, "i") {
+		flags += "i"
+	}
+	// The Ruby multiline mode is the Go s flag
+	if strings.Contains(re.Flags, "m") {
+		flags += "s"
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	pattern, err := normalize.Translate(pattern)
+	if err != nil {
+		return "", false
+	}
+	return pattern, true
+}
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			for _, v := range h.Value {
+				if v == pattern {
+					return
+				}
+			}
+			h.Value = append(h.Value, pattern)
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// appendURL adds a URL signature to rule, unless it's already there
+func appendURL(rule *crowler.DetectionRule, pattern string) {
+	for _, u := range rule.URLPatterns {
+		if u.Signature == pattern {
+			return
+		}
+	}
+	rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+		Signature:  pattern,
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addCheck adds the signature of a check to rule. Arachni lowercases the
+// headers, the cookies and the parameters, so the patterns are case
+// insensitive. It returns false if the check can't be converted.
+func addCheck(rule *crowler.DetectionRule, c Check) bool {
+	pattern := "(?i)" + regexp.QuoteMeta(c.Value)
+	if c.Regexp != nil {
+		p, ok := rubyRegexp(c.Regexp)
+		if !ok {
+			return false
+		}
+		pattern = p
+	}
+
+	switch c.Kind {
+	case CheckServerOrPoweredBy:
+		appendHeader(rule, "Server", pattern)
+		appendHeader(rule, "X-Powered-By", pattern)
+	case CheckServer:
+		appendHeader(rule, "Server", pattern)
+	case CheckPoweredBy:
+		appendHeader(rule, "X-Powered-By", pattern)
+	case CheckCookie:
+		if c.Regexp != nil {
+			return false
+		}
+		appendHeader(rule, "Set-Cookie", "(?i)(?:^|;\\s*)"+regexp.QuoteMeta(c.Value)+"=")
+	case CheckHeader:
+		if c.Regexp != nil {
+			return false
+		}
+		// An empty value matches the header being there
+		appendHeader(rule, c.Value, "")
+	case CheckParameter:
+		if c.Regexp != nil {
+			return false
+		}
+		appendURL(rule, "(?i)[?&]"+regexp.QuoteMeta(c.Value)+"=")
+	case CheckExtension:
+		ext := regexp.QuoteMeta(c.Value)
+		if c.Regexp != nil {
+			ext = "(?:" + strings.TrimPrefix(pattern, "(?i)") + ")"
+		}
+		appendURL(rule, `(?i)\.`+ext+`(?:[?#;]|$)`)
+	case CheckPath:
+		appendURL(rule, pattern)
+	default:
+		return false
+	}
+	return true
+}
+
+// primary returns the index of the platform a fingerprinter detects: the
+// one it's named after (ASPXMVC detects aspx_mvc), or else the most
+// specific one
+func primary(fp Fingerprinter) int {
+	name := strings.ToLower(fp.Name)
+	best := 0
+	for i, symbol := range fp.Platforms {
+		if strings.ReplaceAll(symbol, "_", "") == name {
+			return i
+		}
+		if typeRanks[lookup(symbol).typ] < typeRanks[lookup(fp.Platforms[best]).typ] {
+			best = i
+		}
+	}
+	return best
+}
+
+// convertFingerprinter converts a fingerprinter into a rule detecting its
+// platform and implying the others it adds (ASP implies Windows). It
+// returns false if none of its checks could be converted.
+func convertFingerprinter(fp Fingerprinter) (crowler.DetectionRule, string, bool) {
+	main := primary(fp)
+	p := lookup(fp.Platforms[main])
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(p.name),
+		ObjectName: p.name,
+	}
+	for i, symbol := range fp.Platforms {
+		if i != main {
+			rule.Implies = append(rule.Implies, lookup(symbol).name)
+		}
+	}
+
+	converted := false
+	for _, c := range fp.Checks {
+		if addCheck(&rule, c) {
+			converted = true
+		}
+	}
+	return rule, p.typ, converted
+}
+
+// Convert converts the Arachni fingerprinters read from r into a ruleset
+// per platform type, sorted by type
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	fingerprinters, err := ParseFingerprinters(r)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(fingerprinters, func(i, j int) bool { return fingerprinters[i].Name < fingerprinters[j].Name })
+
+	rulesets := make(map[string]crowler.Ruleset)
+	ruleNames := slug.NewNamer()
+	converted := 0
+	for _, fp := range fingerprinters {
+		rule, typ, ok := convertFingerprinter(fp)
+		if !ok {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = opts.Taxonomy.Tags(typ)
+
+		if _, ok := rulesets[typ]; !ok {
+			ruleset := crowler.NewRuleset(fmt.Sprintf("detect_arachni_%s", typ),
+				fmt.Sprintf("Ruleset to detect %s with the Arachni fingerprinters.", typeDescriptions[typ]))
+			ruleset.Source = SourceName
+			ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+			ruleset.FileName = fmt.Sprintf("detect-arachni-%s-ruleset.yaml", slug.File(typ))
+			ruleset.RuleGroups = []crowler.RuleGroup{
+				{
+					GroupName:      fmt.Sprintf("detect_%s", typ),
+					IsEnabled:      true,
+					Tags:           opts.Taxonomy.Tags(typ),
+					DetectionRules: []crowler.DetectionRule{},
+				},
+			}
+			rulesets[typ] = ruleset
+		}
+		ruleset := rulesets[typ]
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+		rulesets[typ] = ruleset
+	}
+
+	if converted < len(fingerprinters) {
+		slog.Info("Some fingerprinters only use checks with no literal argument or regexps Go can't compile",
+			"converted", converted, "total", len(fingerprinters))
+	}
+
+	types := make([]string, 0, len(rulesets))
+	for typ := range rulesets {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	out := make([]crowler.Ruleset, 0, len(types))
+	for _, typ := range types {
+		ruleset := rulesets[typ]
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		out = append(out, ruleset)
+	}
+	return out, nil
+}
+
+func init() {
+	converter.Register(arachniConverter{})
+}
+
+// arachniConverter is the registered Arachni converter
+type arachniConverter struct{}
+
+func (arachniConverter) Name() string { return "arachni" }
+
+func (arachniConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert Arachni platform fingerprinters",
+		Input:          "Path to an Arachni fingerprinter, or to the fingerprinters directory",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes an Arachni fingerprinter class
+func (arachniConverter) Detect(input []byte) bool {
+	return classRe.Match(input)
+}
+
+func (arachniConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (arachniConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,282 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package arachni
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The helpers of the fingerprinters whose arguments are read
+const (
+	// CheckServerOrPoweredBy matches the Server or X-Powered-By header
+	CheckServerOrPoweredBy = "server_or_powered_by"
+	CheckServer            = "server"
+	CheckPoweredBy         = "powered_by"
+	// CheckCookie matches the name of a cookie
+	CheckCookie = "cookie"
+	// CheckHeader matches the name of a header
+	CheckHeader = "header"
+	// CheckParameter matches the name of a query parameter
+	CheckParameter = "parameter"
+	// CheckExtension matches the extension of the path, CheckPath the
+	// path
+	CheckExtension = "extension"
+	CheckPath      = "path"
+)
+
+// Fingerprinter is the literal part of an Arachni platform fingerprinter:
+// its class name, the platforms it adds and the arguments of its checks
+type Fingerprinter struct {
+	Name string
+	// Platforms are the symbols of the platforms, in the order they're
+	// added (:asp, :windows)
+	Platforms []string
+	Checks    []Check
+}
+
+// Check is a check of a fingerprinter: Kind is one of the Check
+// constants, Value the (lowercase) string it looks for, or Regexp the
+// regexp it matches
+type Check struct {
+	Kind   string
+	Value  string
+	Regexp *Regexp
+}
+
+// Regexp is a Ruby regexp literal
+type Regexp struct {
+	Source string
+	Flags  string
+}
+
+var (
+	// classRe matches the class of a fingerprinter
+	classRe = regexp.MustCompile(`(?m)^\s*class\s+(\w+)\s*<\s*(?:Arachni::|SCNR::Engine::)?Platform::Fingerprinter\b`)
+	// constantRe matches the constants of a fingerprinter
+	constantRe = regexp.MustCompile(`(?m)^\s*([A-Z][A-Za-z0-9_]*)\s*=\s*(.+?)(?:\s+#.*)?$`)
+	// platformsRe matches the platforms added by a fingerprinter
+	// (platforms << :asp << :windows)
+	platformsRe = regexp.MustCompile(`platforms((?:\s*<<\s*:\w+)+)`)
+	// symbolRe matches a symbol
+	symbolRe = regexp.MustCompile(`:(\w+)`)
+	// checkRe matches the checks of a fingerprinter with their argument,
+	// a string, a regexp, a %w() list or a constant
+	checkRe = regexp.MustCompile(`(server_or_powered_by_include\?|powered_by\.include\?|server\.include\?|cookies\.include\?|headers\.include\?|parameters\.include\?|extension\s*(?:==|!=|=~)|uri\.path\s*=~|path\s*=~)\s*\(?\s*('[^']*'|"[^"]*"|/(?:\\.|[^/\n])+/[a-z]*|%[wr]?[({\[].*?[)}\]][a-z]*|[A-Z][A-Za-z0-9_]*)`)
+	// listIncludeRe matches the constant lists including the extension
+	// (EXTENSIONS.include?( extension ))
+	listIncludeRe = regexp.MustCompile(`([A-Z][A-Za-z0-9_]*)\.include\?\s*\(?\s*extension\b`)
+	// interpolationRe matches the constants interpolated in a regexp
+	interpolationRe = regexp.MustCompile(`#\{([A-Z][A-Za-z0-9_]*)\}`)
+)
+
+// checkKinds maps the helpers to the kinds of their checks
+var checkKinds = map[string]string{
+	"server_or_powered_by_include?": CheckServerOrPoweredBy,
+	"powered_by.include?":           CheckPoweredBy,
+	"server.include?":               CheckServer,
+	"cookies.include?":              CheckCookie,
+	"headers.include?":              CheckHeader,
+	"parameters.include?":           CheckParameter,
+	"extension":                     CheckExtension,
+	"uri.path":                      CheckPath,
+	"path":                          CheckPath,
+}
+
+// value is a Ruby literal: a string, a regexp or a list of strings
+type value struct {
+	str    string
+	re     *Regexp
+	list   []string
+	isList bool
+}
+
+// parseValue parses the literal s, resolving the constants. It returns
+// false if s isn't a literal.
+func parseValue(s string, constants map[string]value) (value, bool) {
+	switch {
+	case s == "":
+		return value{}, false
+	case s[0] == '\'' || s[0] == '"':
+		if len(s) < 2 || s[len(s)-1] != s[0] {
+			return value{}, false
+		}
+		return value{str: s[1 : len(s)-1]}, true
+	case s[0] == '/':
+		end := strings.LastIndexByte(s, '/')
+		if end == 0 {
+			return value{}, false
+		}
+		return value{re: &Regexp{Source: interpolate(s[1:end], constants), Flags: s[end+1:]}}, true
+	case strings.HasPrefix(s, "%w") || strings.HasPrefix(s, "%r") || s[0] == '%':
+		body := strings.TrimLeft(s[1:], "wr")
+		if len(body) < 2 {
+			return value{}, false
+		}
+		end := strings.LastIndexAny(body, ")}]")
+		if end <= 0 {
+			return value{}, false
+		}
+		if strings.HasPrefix(s, "%r") {
+			return value{re: &Regexp{Source: interpolate(body[1:end], constants), Flags: body[end+1:]}}, true
+		}
+		if strings.HasPrefix(s, "%w") {
+			return value{list: strings.Fields(body[1:end]), isList: true}, true
+		}
+		return value{str: body[1:end]}, true
+	case s[0] >= 'A' && s[0] <= 'Z':
+		v, ok := constants[s]
+		return v, ok
+	}
+	return value{}, false
+}
+
+// interpolate replaces the constants interpolated in a regexp source by
+// their value, the strings quoted
+func interpolate(source string, constants map[string]value) string {
+	return interpolationRe.ReplaceAllStringFunc(source, func(s string) string {
+		v, ok := constants[interpolationRe.FindStringSubmatch(s)[1]]
+		switch {
+		case !ok:
+			return s
+		case v.re != nil:
+			return "(?:" + v.re.Source + ")"
+		case v.isList:
+			quoted := make([]string, len(v.list))
+			for i, item := range v.list {
+				quoted[i] = regexp.QuoteMeta(item)
+			}
+			return "(?:" + strings.Join(quoted, "|") + ")"
+		}
+		return regexp.QuoteMeta(v.str)
+	})
+}
+
+// checks returns the checks of kind on the literal v, a list giving a
+// check per item
+func checks(kind string, v value) []Check {
+	switch {
+	case v.re != nil:
+		return []Check{{Kind: kind, Regexp: v.re}}
+	case v.isList:
+		list := make([]Check, 0, len(v.list))
+		for _, item := range v.list {
+			list = append(list, Check{Kind: kind, Value: strings.ToLower(item)})
+		}
+		return list
+	case v.str != "":
+		return []Check{{Kind: kind, Value: strings.ToLower(v.str)}}
+	}
+	return nil
+}
+
+// parseFingerprinter parses the source of a fingerprinter class
+func parseFingerprinter(name, source string) Fingerprinter {
+	fp := Fingerprinter{Name: name}
+
+	constants := make(map[string]value)
+	for _, m := range constantRe.FindAllStringSubmatch(source, -1) {
+		if v, ok := parseValue(m[2], constants); ok {
+			constants[m[1]] = v
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range platformsRe.FindAllStringSubmatch(source, -1) {
+		for _, s := range symbolRe.FindAllStringSubmatch(m[1], -1) {
+			if !seen[s[1]] {
+				seen[s[1]] = true
+				fp.Platforms = append(fp.Platforms, s[1])
+			}
+		}
+	}
+
+	for _, m := range checkRe.FindAllStringSubmatch(source, -1) {
+		helper := strings.TrimSpace(strings.TrimRight(m[1], "=!~"))
+		v, ok := parseValue(m[2], constants)
+		if !ok {
+			continue
+		}
+		fp.Checks = append(fp.Checks, checks(checkKinds[helper], v)...)
+	}
+	for _, m := range listIncludeRe.FindAllStringSubmatch(source, -1) {
+		if v, ok := constants[m[1]]; ok {
+			fp.Checks = append(fp.Checks, checks(CheckExtension, v)...)
+		}
+	}
+	return fp
+}
+
+// ParseFingerprinters reads the fingerprinter classes of r, a
+// fingerprinter file or the files of a fingerprinters directory. The
+// classes adding no platform are skipped.
+func ParseFingerprinters(r io.Reader) ([]Fingerprinter, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fingerprinters: %v", err)
+	}
+	source := string(data)
+
+	var fingerprinters []Fingerprinter
+	classes := classRe.FindAllStringSubmatchIndex(source, -1)
+	for i, loc := range classes {
+		end := len(source)
+		if i+1 < len(classes) {
+			end = classes[i+1][0]
+		}
+		fp := parseFingerprinter(source[loc[2]:loc[3]], source[loc[1]:end])
+		if len(fp.Platforms) > 0 {
+			fingerprinters = append(fingerprinters, fp)
+		}
+	}
+	return fingerprinters, nil
+}
+
+// ReadDir merges the fingerprinter files in dir (the
+// components/fingerprinters directory, with its os, languages, frameworks
+// and servers subdirectories) into a single stream
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".rb" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no fingerprinters found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
@@ -0,0 +1,437 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package builtwith converts the BuiltWith technologies JSON into CROWler
+// detection rulesets, one per mapped category.
+package builtwith
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "BuiltWith technologies.json"
+	// DefaultSourceLicense is the license of the BuiltWith data
+	DefaultSourceLicense = "LicenseRef-BuiltWith"
+)
+
+// Define the structure for the BuiltWith technologies JSON
+type BuiltWithTechnology struct {
+	Categories []int             `json:"categories"`
+	Patterns   BuiltWithPatterns `json:"patterns"`
+	Implies    []string          `json:"implies,omitempty"`
+}
+
+type BuiltWithPatterns struct {
+	URL     string            `json:"url,omitempty"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type BuiltWithTechnologies struct {
+	Technologies map[string]BuiltWithTechnology `json:"technologies"`
+}
+
+// DefaultCategories maps the BuiltWith category IDs to the generated
+// rulesets. It follows the Wappalyzer category IDs, except 2 which has
+// always been mapped to web_frameworks.
+var DefaultCategories = map[int]string{
+	1:   "cms",
+	2:   "web_frameworks",
+	3:   "database_managers",
+	4:   "documentation",
+	5:   "widgets",
+	6:   "ecommerce",
+	7:   "photo_galleries",
+	8:   "wikis",
+	9:   "hosting_panels",
+	10:  "analytics",
+	11:  "blogs",
+	12:  "javascript_frameworks",
+	13:  "issue_trackers",
+	14:  "video_players",
+	15:  "comment_systems",
+	16:  "security",
+	17:  "font_scripts",
+	18:  "web_frameworks",
+	19:  "miscellaneous",
+	20:  "editors",
+	21:  "lms",
+	22:  "web_servers",
+	23:  "caching",
+	24:  "rich_text_editors",
+	25:  "javascript_graphics",
+	26:  "mobile_frameworks",
+	27:  "programming_languages",
+	28:  "operating_systems",
+	29:  "search_engines",
+	30:  "webmail",
+	31:  "cdn",
+	32:  "marketing_automation",
+	33:  "web_server_extensions",
+	34:  "databases",
+	35:  "maps",
+	36:  "advertising",
+	37:  "network_devices",
+	38:  "media_servers",
+	39:  "webcams",
+	41:  "payment_processors",
+	42:  "tag_managers",
+	44:  "ci",
+	45:  "control_systems",
+	46:  "remote_access",
+	47:  "development",
+	48:  "network_storage",
+	49:  "feed_readers",
+	50:  "dms",
+	51:  "page_builders",
+	52:  "live_chat",
+	53:  "crm",
+	54:  "seo",
+	55:  "accounting",
+	56:  "cryptominers",
+	57:  "static_site_generator",
+	58:  "user_onboarding",
+	59:  "javascript_libraries",
+	60:  "containers",
+	62:  "paas",
+	63:  "iaas",
+	64:  "reverse_proxies",
+	65:  "load_balancers",
+	66:  "ui_frameworks",
+	67:  "cookie_compliance",
+	68:  "accessibility",
+	69:  "authentication",
+	70:  "ssl_tls_certificate_authorities",
+	71:  "affiliate_programs",
+	72:  "appointment_scheduling",
+	73:  "surveys",
+	74:  "a_b_testing",
+	75:  "email",
+	76:  "personalisation",
+	77:  "retargeting",
+	78:  "rum",
+	79:  "geolocation",
+	80:  "wordpress_themes",
+	81:  "shopify_themes",
+	82:  "drupal_themes",
+	83:  "browser_fingerprinting",
+	84:  "loyalty_and_rewards",
+	85:  "feature_management",
+	86:  "segmentation",
+	87:  "wordpress_plugins",
+	88:  "hosting",
+	89:  "translation",
+	90:  "reviews",
+	91:  "buy_now_pay_later",
+	92:  "performance",
+	93:  "reservations_and_delivery",
+	94:  "referral_marketing",
+	95:  "digital_asset_management",
+	96:  "content_curation",
+	97:  "customer_data_platform",
+	98:  "cart_abandonment",
+	99:  "shipping_carriers",
+	100: "shopify_apps",
+	101: "recruitment_and_staffing",
+	102: "returns",
+	103: "livestreaming",
+	104: "ticket_booking",
+	105: "augmented_reality",
+	106: "cross_border_ecommerce",
+	107: "fulfilment",
+	108: "ecommerce_frontends",
+	109: "domain_parking",
+	110: "form_builders",
+	111: "fundraising_and_donations",
+}
+
+// LoadCategories reads a category mapping file, a YAML map of category IDs
+// to ruleset category names:
+//
+//	1: cms
+//	18: web_frameworks
+func LoadCategories(path string) (map[int]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var categories map[int]string
+	if err := yaml.Unmarshal(data, &categories); err != nil {
+		return nil, fmt.Errorf("error parsing category map %s: %v", path, err)
+	}
+	for id, name := range categories {
+		if slug.Make(name) != name {
+			return nil, fmt.Errorf("invalid category name %q for %d in %s, use lowercase letters, digits and '_'", name, id, path)
+		}
+	}
+	return categories, nil
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Categories maps the category IDs to the generated rulesets,
+	// DefaultCategories if nil
+	Categories map[int]string
+	// Unmapped tells what to do with the technologies without a mapped
+	// category
+	Unmapped converter.UnmappedPolicy
+}
+
+// createRule returns the rule of the technology name. The BuiltWith
+// patterns are literal strings, written to the patterns after literals.
+func createRule(name string, details BuiltWithTechnology, literals converter.LiteralMode) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+		Implies:    details.Implies,
+	}
+
+	if details.Patterns.Headers != nil {
+		for k, v := range details.Patterns.Headers {
+			rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+				Key:        k,
+				Value:      []string{literals.Literal(v)},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	if details.Patterns.HTML != "" {
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Text:       []string{literals.Literal(details.Patterns.HTML)},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	if details.Patterns.URL != "" {
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  literals.Literal(details.Patterns.URL),
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	return rule
+}
+
+// decodeTechnologies reads a technologies JSON document. The technologies
+// that can't be read are skipped with opts.Skip.
+func decodeTechnologies(r io.Reader, opts converter.Options) (BuiltWithTechnologies, error) {
+	var doc struct {
+		Technologies map[string]json.RawMessage `json:"technologies"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return BuiltWithTechnologies{}, err
+	}
+
+	technologies := BuiltWithTechnologies{Technologies: make(map[string]BuiltWithTechnology, len(doc.Technologies))}
+	names := make([]string, 0, len(doc.Technologies))
+	for name := range doc.Technologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var technology BuiltWithTechnology
+		if err := json.Unmarshal(doc.Technologies[name], &technology); err != nil {
+			if err := opts.Skip("technology "+name, err); err != nil {
+				return BuiltWithTechnologies{}, fmt.Errorf("technology %s: %v", name, err)
+			}
+			continue
+		}
+		technologies.Technologies[name] = technology
+	}
+	return technologies, nil
+}
+
+// Convert converts a technologies JSON document into a ruleset per mapped
+// category, sorted by category
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	technologies, err := decodeTechnologies(r, opts.Options)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	categoryMappings := opts.Categories
+	if categoryMappings == nil {
+		categoryMappings = DefaultCategories
+	}
+
+	// Initialize category-based rulesets
+	rulesets := make(map[string]crowler.Ruleset)
+
+	// Process the technologies in a stable order, so the suffixes added to
+	// colliding rule names don't change between runs
+	names := make([]string, 0, len(technologies.Technologies))
+	for name := range technologies.Technologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ruleNames := slug.NewNamer()
+	skipped := make(converter.Skipped)
+
+	// Process each technology and categorize
+	for _, name := range names {
+		details := technologies.Technologies[name]
+
+		// The categories of the technology, each with the taxonomy keys of
+		// the category
+		var categories []string
+		categoryKeys := make(map[string][]string)
+		for _, cat := range details.Categories {
+			category, exists := categoryMappings[cat]
+			if !exists {
+				continue
+			}
+			if _, seen := categoryKeys[category]; !seen {
+				categories = append(categories, category)
+				categoryKeys[category] = []string{strconv.Itoa(cat), category}
+			}
+		}
+		if len(categories) == 0 {
+			reason := "with unmapped categories"
+			if len(details.Categories) == 0 {
+				reason = "without categories"
+			}
+			uncategorized, err := skipped.Unmapped(opts.Unmapped, name, reason)
+			if err != nil {
+				return nil, err
+			}
+			if !uncategorized {
+				continue
+			}
+			categories = []string{converter.UncategorizedCategory}
+			categoryKeys[converter.UncategorizedCategory] = []string{converter.UncategorizedCategory}
+		}
+
+		rule := createRule(name, details, opts.Literals)
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+
+		for _, category := range categories {
+			rule.Tags = taxonomy.Merge(rule.Tags, opts.Taxonomy.Tags(categoryKeys[category]...)...)
+		}
+		for _, category := range categories {
+			if _, ok := rulesets[category]; !ok {
+				ruleset := crowler.NewRuleset(fmt.Sprintf("detect_%s_ruleset", category),
+					fmt.Sprintf("Ruleset to detect %s technologies.", strings.ReplaceAll(category, "_", " ")))
+				ruleset.Source = SourceName
+				ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+				ruleset.FileName = fmt.Sprintf("detect-%s-ruleset.yaml", slug.File(category))
+				ruleset.RuleGroups = []crowler.RuleGroup{
+					{
+						GroupName:      "detect_web_technologies",
+						IsEnabled:      true,
+						Category:       category,
+						Tags:           opts.Taxonomy.Tags(categoryKeys[category]...),
+						DetectionRules: []crowler.DetectionRule{},
+					},
+				}
+				rulesets[category] = ruleset
+			}
+
+			ruleset := rulesets[category]
+			ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+			rulesets[category] = ruleset
+		}
+	}
+
+	skipped.Report()
+
+	categories := make([]string, 0, len(rulesets))
+	for category := range rulesets {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	out := make([]crowler.Ruleset, 0, len(categories))
+	for _, category := range categories {
+		ruleset := rulesets[category]
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		out = append(out, ruleset)
+	}
+	return out, nil
+}
+
+func init() {
+	converter.Register(&builtWithConverter{})
+}
+
+// builtWithConverter is the registered BuiltWith converter
+type builtWithConverter struct {
+	categoryMapPath string
+	unmapped        converter.UnmappedPolicy
+}
+
+func (*builtWithConverter) Name() string { return "builtwith" }
+
+func (*builtWithConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a BuiltWith technologies.json file",
+		Input:          "Path to the BuiltWith technologies.json file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a technologies document whose technologies have
+// "categories" and "patterns"
+func (*builtWithConverter) Detect(input []byte) bool {
+	var doc struct {
+		Technologies map[string]map[string]json.RawMessage `json:"technologies"`
+	}
+	if err := json.Unmarshal(input, &doc); err != nil {
+		return false
+	}
+	for _, tech := range doc.Technologies {
+		_, hasCategories := tech["categories"]
+		_, hasPatterns := tech["patterns"]
+		if hasCategories && hasPatterns {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *builtWithConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.categoryMapPath, "category-map", "", "Path to a YAML file mapping the category IDs to ruleset names (default the built-in mapping)")
+	fs.Var(&c.unmapped, "unmapped-policy", converter.UnmappedPolicyUsage)
+}
+
+func (c *builtWithConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	var categories map[int]string
+	if c.categoryMapPath != "" {
+		var err error
+		if categories, err = LoadCategories(c.categoryMapPath); err != nil {
+			return nil, err
+		}
+	}
+	return Convert(r, Options{Options: opts, Categories: categories, Unmapped: c.unmapped})
+}
@@ -0,0 +1,387 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cmslist converts the plain text and CSV lists mapping the
+// generator meta tag values and the HTML comment markers to products, as
+// published by the CMS detection projects, into a CROWler ruleset of meta
+// tag and page content signatures.
+package cmslist
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "CMS generator and comment list"
+	// DefaultSourceLicense is used when the license of the list isn't
+	// given, the lists come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+	// Category is the taxonomy key of the products
+	Category = "cms"
+)
+
+// The kinds of markers
+const (
+	// KindGenerator is the content of the generator meta tag
+	KindGenerator = "generator"
+	// KindComment is the text of an HTML comment
+	KindComment = "comment"
+)
+
+// Entry maps a marker of a kind to a product
+type Entry struct {
+	Product string
+	Kind    string
+	Marker  string
+}
+
+// The column names of the CSV lists with a header
+var (
+	productColumns   = []string{"product", "name", "cms", "technology", "app", "application"}
+	generatorColumns = []string{"generator", "meta_generator", "meta", "meta-generator"}
+	commentColumns   = []string{"comment", "html_comment", "comments", "html-comment"}
+	kindColumns      = []string{"type", "kind"}
+	markerColumns    = []string{"marker", "pattern", "value", "signature"}
+)
+
+// column returns the index of the first of names in header, or -1
+func column(header []string, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// kinds maps the kind names of the lists to the kinds
+var kinds = map[string]string{
+	"generator":      KindGenerator,
+	"meta":           KindGenerator,
+	"meta_generator": KindGenerator,
+	"comment":        KindComment,
+	"html_comment":   KindComment,
+}
+
+var (
+	// metaRe matches a generator meta tag, with its content
+	metaRe = regexp.MustCompile(`(?i)^<meta\s[^>]*\bcontent\s*=\s*["']([^"']*)["']`)
+	// commentRe matches an HTML comment, with its text
+	commentRe = regexp.MustCompile(`(?s)^<!--\s*(.*?)\s*(?:-->)?$`)
+)
+
+// parseMarker returns the kind and the marker of a marker written as
+// markup (<meta name="generator" content="Joomla!">, <!-- Drupal -->),
+// or kind and marker unchanged
+func parseMarker(kind, marker string) (string, string) {
+	marker = strings.TrimSpace(marker)
+	if m := metaRe.FindStringSubmatch(marker); m != nil {
+		return KindGenerator, strings.TrimSpace(m[1])
+	}
+	if m := commentRe.FindStringSubmatch(marker); m != nil {
+		return KindComment, m[1]
+	}
+	return kind, marker
+}
+
+// splitLine splits a line of a list without a header on its tabs, or
+// else as a CSV record
+func splitLine(line string) []string {
+	if strings.Contains(line, "\t") {
+		return strings.Split(line, "\t")
+	}
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.LazyQuotes = true
+	record, err := reader.Read()
+	if err != nil {
+		return []string{line}
+	}
+	return record
+}
+
+// parseLine parses a line of a list without a header: kind,marker,product
+// or product,marker, the kind of the marker told by its markup and
+// defaulting to the generator. It returns false for an invalid line.
+func parseLine(line string) (Entry, bool) {
+	fields := splitLine(line)
+	if len(fields) < 2 {
+		return Entry{}, false
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	var entry Entry
+	if kind, ok := kinds[strings.ToLower(fields[0])]; ok && len(fields) >= 3 {
+		entry.Kind, entry.Marker = parseMarker(kind, strings.Join(fields[1:len(fields)-1], ","))
+		entry.Product = fields[len(fields)-1]
+	} else {
+		entry.Product = fields[0]
+		entry.Kind, entry.Marker = parseMarker(KindGenerator, strings.Join(fields[1:], ","))
+	}
+	return entry, entry.Product != "" && entry.Marker != ""
+}
+
+// Parse reads a list of markers. The list is either a CSV file with a
+// header naming its columns (the product, and a generator and a comment
+// column or a type and a marker column), or a list of lines
+// product,marker or type,marker,product (tab separated or CSV records).
+// The markers can be written as markup. The empty lines and the lines
+// starting with # are skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no markers found")
+	}
+
+	if header := splitLine(lines[0]); column(header, productColumns) >= 0 {
+		return parseCSV(lines[1:], header)
+	}
+
+	entries := make([]Entry, 0, len(lines))
+	for _, line := range lines {
+		entry, ok := parseLine(line)
+		if !ok {
+			slog.Warn("Skipping invalid line", "line", line)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseCSV reads the records of a list with a header
+func parseCSV(lines []string, header []string) ([]Entry, error) {
+	product := column(header, productColumns)
+	generator := column(header, generatorColumns)
+	comment := column(header, commentColumns)
+	kind := column(header, kindColumns)
+	marker := column(header, markerColumns)
+	if generator < 0 && comment < 0 && marker < 0 {
+		return nil, fmt.Errorf("no generator, comment or marker column in header %q", strings.Join(header, ","))
+	}
+
+	var entries []Entry
+	for _, line := range lines {
+		record := splitLine(line)
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		add := func(k, m string) {
+			if m == "" {
+				return
+			}
+			k, m = parseMarker(k, m)
+			entries = append(entries, Entry{Product: field(product), Kind: k, Marker: m})
+		}
+
+		if field(product) == "" {
+			slog.Warn("Skipping record without a product", "record", line)
+			continue
+		}
+		add(KindGenerator, field(generator))
+		add(KindComment, field(comment))
+		if m := field(marker); m != "" {
+			k, ok := kinds[strings.ToLower(field(kind))]
+			if !ok {
+				k = KindGenerator
+			}
+			add(k, m)
+		}
+	}
+	return entries, nil
+}
+
+// versionExpr captures the version following a marker (WordPress 6.4.2,
+// Powered by Foo v1.2)
+const versionExpr = `\s*v?([0-9][0-9a-z.\-]*)`
+
+// addEntry adds the signature of a marker to rule, unless it's already
+// there. The markers are matched as substrings, case insensitively, with
+// the version following them.
+func addEntry(rule *crowler.DetectionRule, entry Entry) {
+	marker := regexp.QuoteMeta(entry.Marker)
+	switch entry.Kind {
+	case KindGenerator:
+		pattern := "(?i)" + marker
+		if len(rule.MetaTags) == 0 {
+			rule.MetaTags = []crowler.MetaTag{{Name: "generator", Confidence: crowler.DefaultConfidence}}
+		}
+		meta := &rule.MetaTags[0]
+		for _, c := range meta.Content {
+			if c == pattern {
+				return
+			}
+		}
+		meta.Content = append(meta.Content, pattern)
+		rule.Version = append(rule.Version, crowler.VersionSignature{
+			Section: "meta_tags",
+			Key:     "generator",
+			Pattern: pattern + versionExpr,
+			Version: `\1`,
+		})
+	case KindComment:
+		// The marker is in a comment, after anything but its end
+		pattern := "(?i)<!--(?:[^-]|-[^-])*?" + marker
+		if len(rule.PageContentPatterns) == 0 {
+			rule.PageContentPatterns = []crowler.PageContentSignature{{Key: "html", Confidence: crowler.DefaultConfidence}}
+		}
+		html := &rule.PageContentPatterns[0]
+		for _, s := range html.Signature {
+			if s == pattern {
+				return
+			}
+		}
+		html.Signature = append(html.Signature, pattern)
+		rule.Version = append(rule.Version, crowler.VersionSignature{
+			Section: "page_content_patterns",
+			Key:     "html",
+			Pattern: pattern + versionExpr,
+			Version: `\1`,
+		})
+	}
+}
+
+// Convert converts a list of markers into a ruleset with a rule per
+// product, matching all its markers
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	entries, err := Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the marker list: %v", err)
+	}
+
+	// Merge the markers of the same product
+	rules := make(map[string]*crowler.DetectionRule)
+	for _, entry := range entries {
+		rule, ok := rules[entry.Product]
+		if !ok {
+			rule = &crowler.DetectionRule{
+				RuleName:   "detect_" + slug.Make(entry.Product),
+				ObjectName: entry.Product,
+			}
+			rules[entry.Product] = rule
+		}
+		addEntry(rule, entry)
+	}
+
+	products := make([]string, 0, len(rules))
+	for product := range rules {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+
+	groupTags := opts.Taxonomy.Tags(Category)
+	ruleset := crowler.NewRuleset("detect_cms_markers", "Ruleset to detect CMS and web applications by their generator meta tag and HTML comments.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-cms-markers-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_cms_markers",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	for _, product := range products {
+		rule := *rules[product]
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(cmsListConverter{})
+}
+
+// cmsListConverter is the registered generator and comment list converter
+type cmsListConverter struct{}
+
+func (cmsListConverter) Name() string { return "cmslist" }
+
+func (cmsListConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a list of generator meta tag values and HTML comment markers",
+		Input:          "Path to the generator and comment list (CSV with a header, or product,marker lines)",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a list with a header naming a product column and a
+// generator, comment or marker column, or a list whose first entry has a
+// marker kind or a marker written as markup. The product,marker lists
+// without markup look like any other two column list, the converter has
+// to be named for them.
+func (cmsListConverter) Detect(input []byte) bool {
+	scanner := bufio.NewScanner(strings.NewReader(string(input)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := splitLine(line)
+		if column(fields, productColumns) >= 0 {
+			return column(fields, generatorColumns) >= 0 || column(fields, commentColumns) >= 0 ||
+				column(fields, markerColumns) >= 0 && column(fields, kindColumns) >= 0
+		}
+		if len(fields) < 2 {
+			return false
+		}
+		if _, ok := kinds[strings.ToLower(strings.TrimSpace(fields[0]))]; ok && len(fields) >= 3 {
+			return true
+		}
+		marker := strings.TrimSpace(strings.Join(fields[1:], ","))
+		return metaRe.MatchString(marker) || strings.HasPrefix(marker, "<!--")
+	}
+	return false
+}
+
+func (cmsListConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
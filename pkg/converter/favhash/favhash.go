@@ -0,0 +1,376 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package favhash converts the community favicon hash lists (the OWASP
+// favicon database, fav-up CSV files, Shodan mmh3 lists) into a CROWler
+// favicon detection ruleset, like the Nikto db_favicon converter.
+package favhash
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Favicon hash list"
+	// DefaultSourceLicense is used when the license of the list isn't
+	// given, the lists come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+	// Category is the taxonomy key of the favicons, as for Nikto
+	Category = "favicon"
+)
+
+// Entry is a favicon of a hash list, with at least one of its hashes
+type Entry struct {
+	Name   string
+	MD5    string
+	SHA256 string
+	// MMH3 is the Shodan style hash, as a signed 32-bit integer
+	MMH3 string
+	// Source is where the entry comes from, if the list tells
+	Source string
+}
+
+var (
+	md5Re    = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+	sha256Re = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+	mmh3Re   = regexp.MustCompile(`^[-+]?\d{1,10}$`)
+)
+
+// setHash sets the hash of entry its shape tells the kind of: 32 hex
+// digits are an MD5 hash, 64 a SHA-256 hash and an integer a mmh3 hash.
+// It returns false for anything else.
+func (e *Entry) setHash(hash string) bool {
+	hash = strings.TrimSpace(hash)
+	switch {
+	case md5Re.MatchString(hash):
+		e.MD5 = strings.ToLower(hash)
+	case sha256Re.MatchString(hash):
+		e.SHA256 = strings.ToLower(hash)
+	case mmh3Re.MatchString(hash):
+		n, err := strconv.ParseInt(hash, 10, 64)
+		if err != nil || n < -1<<31 || n >= 1<<32 {
+			return false
+		}
+		// Some lists have the hash as an unsigned integer
+		e.MMH3 = strconv.FormatInt(int64(int32(uint32(n))), 10)
+	default:
+		return false
+	}
+	return true
+}
+
+// The column names of the CSV lists with a header
+var (
+	hashColumns   = []string{"hash", "favhash", "favicon_hash", "http.favicon.hash", "md5", "sha256", "mmh3"}
+	nameColumns   = []string{"name", "technology", "product", "app", "application", "title", "description"}
+	domainColumns = []string{"domain", "host", "url"}
+	sourceColumns = []string{"source", "reference"}
+)
+
+// column returns the index of the first of names in header, or -1
+func column(header []string, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Parse reads a favicon hash list. The list is either a CSV file with a
+// header naming its columns (one or more hash columns, the name of the
+// product or else its domain, optionally the source), or a list of
+// hash:name or hash,name lines, as in the OWASP favicon database. The
+// empty lines and the lines starting with # are skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	return parse(r, converter.Options{})
+}
+
+// parse reads a favicon hash list like Parse, skipping the invalid
+// hash:name lines with opts.Skip
+func parse(r io.Reader, opts converter.Options) ([]Entry, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no favicons found")
+	}
+
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == nil && column(header, hashColumns) >= 0 {
+		return parseCSV(reader, header)
+	}
+
+	entries := make([]Entry, 0, len(lines))
+	for _, line := range lines {
+		entry, err := parseLine(line)
+		if err != nil {
+			if err := opts.Skip(fmt.Sprintf("line %q", line), err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// parseLine reads a hash:name or hash,name line
+func parseLine(line string) (Entry, error) {
+	var entry Entry
+	i := strings.IndexAny(line, ":,")
+	if i < 0 {
+		return entry, fmt.Errorf("invalid line %q, expected hash:name", line)
+	}
+	if !entry.setHash(line[:i]) {
+		return entry, fmt.Errorf("invalid hash in line %q", line)
+	}
+	entry.Name = strings.Trim(strings.TrimSpace(line[i+1:]), `"`)
+	if entry.Name == "" {
+		return entry, fmt.Errorf("missing name in line %q", line)
+	}
+	return entry, nil
+}
+
+// parseCSV reads the records of a CSV list with a header
+func parseCSV(reader *csv.Reader, header []string) ([]Entry, error) {
+	var hashes []int
+	for i, h := range header {
+		if slices.Contains(hashColumns, strings.ToLower(strings.TrimSpace(h))) {
+			hashes = append(hashes, i)
+		}
+	}
+	name := column(header, nameColumns)
+	if name < 0 {
+		name = column(header, domainColumns)
+	}
+	if name < 0 {
+		return nil, fmt.Errorf("no name column in header %q", strings.Join(header, ","))
+	}
+	source := column(header, sourceColumns)
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		entry := Entry{Name: field(name), Source: field(source)}
+		for _, i := range hashes {
+			if h := field(i); h != "" && !entry.setHash(h) {
+				slog.Warn("Skipping invalid hash", "hash", h, "name", entry.Name)
+			}
+		}
+		if entry.Name == "" || entry.MD5 == "" && entry.SHA256 == "" && entry.MMH3 == "" {
+			slog.Warn("Skipping record without a name or a hash", "record", strings.Join(record, ","))
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// appendUnique appends value to list, unless it's empty or in the list
+func appendUnique(list []string, value string) []string {
+	if value == "" || slices.Contains(list, value) {
+		return list
+	}
+	return append(list, value)
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// ListName is the source of the entries that don't tell theirs
+	// (empty uses the name of the input file)
+	ListName string
+}
+
+// Convert converts a favicon hash list into a ruleset with a rule per
+// product, matching all the hashes of its favicons
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	entries, err := parse(r, opts.Options)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the favicon list: %v", err)
+	}
+
+	listName := opts.ListName
+	if listName == "" {
+		listName = opts.FileName
+	}
+
+	// Merge the favicons of the same product
+	rules := make(map[string]*crowler.DetectionRule)
+	for _, entry := range entries {
+		rule, ok := rules[entry.Name]
+		if !ok {
+			rule = &crowler.DetectionRule{
+				RuleName:            "detect_" + slug.Make(entry.Name),
+				ObjectName:          entry.Name,
+				Metadata:            &crowler.RuleMetadata{},
+				PageContentPatterns: []crowler.PageContentSignature{{Confidence: crowler.DefaultConfidence}},
+			}
+			rules[entry.Name] = rule
+		}
+		p := &rule.PageContentPatterns[0]
+		p.MD5Hash = appendUnique(p.MD5Hash, entry.MD5)
+		p.SHA256Hash = appendUnique(p.SHA256Hash, entry.SHA256)
+		p.MMH3Hash = appendUnique(p.MMH3Hash, entry.MMH3)
+		source := entry.Source
+		if source == "" {
+			source = listName
+		}
+		rule.Metadata.Sources = appendUnique(rule.Metadata.Sources, source)
+	}
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groupTags := opts.Taxonomy.Tags(Category)
+	rulesetName := "detect_favicon_hash_list"
+	if opts.FileName != "" {
+		rulesetName = "detect_favicons_" + slug.Make(strings.TrimSuffix(opts.FileName, filepath.Ext(opts.FileName)))
+	}
+	ruleset := crowler.NewRuleset(rulesetName, "Ruleset to detect technologies using favicon hashes.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = slug.File(rulesetName) + "-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_favicon_technologies",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	for _, name := range names {
+		rule := *rules[name]
+		if len(rule.Metadata.Sources) == 0 {
+			rule.Metadata = nil
+		}
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(&favHashConverter{})
+}
+
+// favHashConverter is the registered favicon hash list converter
+type favHashConverter struct {
+	listName string
+}
+
+func (*favHashConverter) Name() string { return "favhash" }
+
+func (*favHashConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a favicon hash list (OWASP favicon database, fav-up CSV, Shodan mmh3 list)",
+		Input:          "Path to the favicon hash list",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// listLineRe matches a hash:name or hash,name line of a list without a
+// header
+var listLineRe = regexp.MustCompile(`^([0-9A-Fa-f]{32}|[0-9A-Fa-f]{64}|[-+]?\d{1,10})\s*[:,]\s*[^\s,:]`)
+
+// commentHeaderRe matches a commented CSV header (# ja3_md5,Firstseen)
+var commentHeaderRe = regexp.MustCompile(`^#\s*[A-Za-z_][\w.-]*(?:\s*,\s*[A-Za-z_][\w .-]*)+$`)
+
+// Detect recognizes a list whose first entry is a hash followed by a
+// name, or a CSV file with a hash column and a name column. A commented
+// header without a hash column names the columns of another kind of list
+// (e.g. the SSLBL JA3 list).
+func (*favHashConverter) Detect(input []byte) bool {
+	scanner := bufio.NewScanner(strings.NewReader(string(input)))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if commentHeaderRe.MatchString(line) {
+			header, err := csv.NewReader(strings.NewReader(strings.TrimLeft(line, "# "))).Read()
+			if err == nil && column(header, hashColumns) < 0 {
+				return false
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if listLineRe.MatchString(line) {
+			return true
+		}
+		header, err := csv.NewReader(strings.NewReader(line)).Read()
+		return err == nil && column(header, hashColumns) >= 0 &&
+			(column(header, nameColumns) >= 0 || column(header, domainColumns) >= 0)
+	}
+	return false
+}
+
+func (c *favHashConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.listName, "list-name", "", "Source recorded on the rules whose entries don't have one (default the input file name)")
+}
+
+func (c *favHashConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, ListName: c.listName})
+}
@@ -0,0 +1,393 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fingerprinthub converts the JSON fingerprints of FingerprintHub
+// (web_fingerprint_v3.json) and EHole (finger.json) into CROWler
+// detection rules: their keywords become page content signatures (on the
+// title for the title keywords), their headers header signatures and
+// their favicon hashes favicon signatures.
+package fingerprinthub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies FingerprintHub in the generated rulesets
+	SourceName = "FingerprintHub fingerprints"
+	// EHoleSourceName identifies EHole in the generated rulesets
+	EHoleSourceName = "EHole fingerprints"
+	// DefaultSourceLicense is used when the license of the fingerprints
+	// isn't given, the forks of both lists come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+)
+
+// Fingerprint is an entry of web_fingerprint_v3.json. All its keywords,
+// headers and favicon hashes must match the response to the request.
+type Fingerprint struct {
+	Name           string            `json:"name"`
+	Path           string            `json:"path"`
+	RequestMethod  string            `json:"request_method"`
+	RequestHeaders map[string]string `json:"request_headers"`
+	RequestData    string            `json:"request_data"`
+	StatusCode     int               `json:"status_code"`
+	Headers        map[string]string `json:"headers"`
+	Keyword        []string          `json:"keyword"`
+	FaviconHash    []string          `json:"favicon_hash"`
+	Priority       int               `json:"priority"`
+}
+
+// EHoleFingerprint is an entry of the EHole finger.json. Method is keyword
+// or faviconhash and Location body, header or title; all the keywords
+// must be found there.
+type EHoleFingerprint struct {
+	CMS      string   `json:"cms"`
+	Method   string   `json:"method"`
+	Location string   `json:"location"`
+	Keyword  []string `json:"keyword"`
+}
+
+// EHoleFingerprints is the EHole finger.json document
+type EHoleFingerprints struct {
+	Fingerprint []EHoleFingerprint `json:"fingerprint"`
+}
+
+var (
+	// titleKeywordRe matches the keywords on the page title
+	// (<title>Foo</title>)
+	titleKeywordRe = regexp.MustCompile(`(?i)^(<title>)?([^<>]+)(</title>)?$`)
+	// headerKeywordRe matches the header keywords naming the header
+	// (Server: Foo)
+	headerKeywordRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*):\s*(.+)$`)
+	md5Re           = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+	mmh3Re          = regexp.MustCompile(`^[-+]?\d{1,10}$`)
+)
+
+// addKeyword adds a keyword found in the page source: the title
+// keywords become patterns of the title text, the others body patterns
+func addKeyword(rule *crowler.DetectionRule, keyword string) {
+	if m := titleKeywordRe.FindStringSubmatch(keyword); m != nil && (m[1] != "" || m[3] != "") {
+		pattern := regexp.QuoteMeta(strings.TrimSpace(m[2]))
+		if m[1] != "" {
+			pattern = "^" + pattern
+		}
+		if m[3] != "" {
+			pattern += "$"
+		}
+		addTitle(rule, pattern)
+		return
+	}
+	rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+		Key:        "body",
+		Signature:  []string{regexp.QuoteMeta(keyword)},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addTitle adds a pattern of the page title
+func addTitle(rule *crowler.DetectionRule, pattern string) {
+	rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+		Key:        "title",
+		Text:       []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addHeader adds a pattern to the header field key, creating it if needed
+func addHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			if !slices.Contains(h.Value, pattern) {
+				h.Value = append(h.Value, pattern)
+			}
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addFaviconHash adds a favicon hash, an MD5 hash or a Shodan style mmh3
+// hash (possibly unsigned). It returns false for anything else.
+func addFaviconHash(rule *crowler.DetectionRule, hash string) bool {
+	var p crowler.PageContentSignature
+	hash = strings.TrimSpace(hash)
+	switch {
+	case md5Re.MatchString(hash):
+		p.MD5Hash = []string{strings.ToLower(hash)}
+	case mmh3Re.MatchString(hash):
+		n, err := strconv.ParseInt(hash, 10, 64)
+		if err != nil || n < -1<<31 || n >= 1<<32 {
+			return false
+		}
+		p.MMH3Hash = []string{strconv.FormatInt(int64(int32(uint32(n))), 10)}
+	default:
+		return false
+	}
+	p.Confidence = crowler.DefaultConfidence
+	rule.PageContentPatterns = append(rule.PageContentPatterns, p)
+	return true
+}
+
+// addPath adds the requested path, but the home page and the favicon, as
+// a URL signature
+func addPath(rule *crowler.DetectionRule, path string) {
+	if path == "" || path == "/" || path == "/favicon.ico" {
+		return
+	}
+	pattern := regexp.QuoteMeta(path)
+	if !slices.ContainsFunc(rule.URLPatterns, func(u crowler.URLMicroSignature) bool { return u.Signature == pattern }) {
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  pattern,
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+}
+
+// rules merges the fingerprints of the same product into a rule, the
+// CROWler signatures add up as the fingerprint matches do
+type rules struct {
+	names  []string
+	byName map[string]*crowler.DetectionRule
+}
+
+func (r *rules) get(name string) *crowler.DetectionRule {
+	if r.byName == nil {
+		r.byName = make(map[string]*crowler.DetectionRule)
+	}
+	rule, ok := r.byName[name]
+	if !ok {
+		rule = &crowler.DetectionRule{
+			RuleName:   "detect_" + slug.Make(name),
+			ObjectName: name,
+		}
+		r.byName[name] = rule
+		r.names = append(r.names, name)
+	}
+	return rule
+}
+
+// addFingerprint adds the signatures of a FingerprintHub fingerprint. It
+// returns false if the fingerprint has none or needs a request the
+// crawler doesn't send (a POST, custom headers).
+func (r *rules) addFingerprint(f Fingerprint) bool {
+	method := strings.ToUpper(f.RequestMethod)
+	if method != "" && method != "GET" || f.RequestData != "" || len(f.RequestHeaders) > 0 {
+		return false
+	}
+	var signatures crowler.DetectionRule
+	for _, keyword := range f.Keyword {
+		if keyword != "" {
+			addKeyword(&signatures, keyword)
+		}
+	}
+	keys := make([]string, 0, len(f.Headers))
+	for key := range f.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value := f.Headers[key]; value != "" && value != "*" {
+			addHeader(&signatures, key, regexp.QuoteMeta(value))
+		}
+	}
+	for _, hash := range f.FaviconHash {
+		addFaviconHash(&signatures, hash)
+	}
+	if len(signatures.PageContentPatterns) == 0 && len(signatures.HTTPHeaderFields) == 0 {
+		return false
+	}
+
+	rule := r.get(f.Name)
+	rule.PageContentPatterns = append(rule.PageContentPatterns, signatures.PageContentPatterns...)
+	for _, h := range signatures.HTTPHeaderFields {
+		for _, v := range h.Value {
+			addHeader(rule, h.Key, v)
+		}
+	}
+	addPath(rule, f.Path)
+	return true
+}
+
+// addEHoleFingerprint adds the signatures of an EHole fingerprint. It
+// returns false if it has none the CROWler rules can express.
+func (r *rules) addEHoleFingerprint(f EHoleFingerprint) bool {
+	var signatures crowler.DetectionRule
+	for _, keyword := range f.Keyword {
+		if keyword == "" {
+			continue
+		}
+		switch {
+		case strings.EqualFold(f.Method, "faviconhash"):
+			addFaviconHash(&signatures, keyword)
+		case strings.EqualFold(f.Location, "title"):
+			addTitle(&signatures, regexp.QuoteMeta(keyword))
+		case strings.EqualFold(f.Location, "header"):
+			// The keywords are searched in all the headers, only the ones
+			// naming the header can be converted
+			if m := headerKeywordRe.FindStringSubmatch(keyword); m != nil {
+				addHeader(&signatures, m[1], regexp.QuoteMeta(m[2]))
+			}
+		default:
+			addKeyword(&signatures, keyword)
+		}
+	}
+	if len(signatures.PageContentPatterns) == 0 && len(signatures.HTTPHeaderFields) == 0 {
+		return false
+	}
+
+	rule := r.get(f.CMS)
+	rule.PageContentPatterns = append(rule.PageContentPatterns, signatures.PageContentPatterns...)
+	for _, h := range signatures.HTTPHeaderFields {
+		for _, v := range h.Value {
+			addHeader(rule, h.Key, v)
+		}
+	}
+	return true
+}
+
+// Convert converts a FingerprintHub web_fingerprint_v3.json or an EHole
+// finger.json into a ruleset with a rule per product
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var all rules
+	total, converted := 0, 0
+	rulesetName, source := "detect_fingerprinthub_technologies", SourceName
+	if isEHole(data) {
+		var doc EHoleFingerprints
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+		}
+		rulesetName, source = "detect_ehole_technologies", EHoleSourceName
+		for _, f := range doc.Fingerprint {
+			total++
+			if f.CMS != "" && all.addEHoleFingerprint(f) {
+				converted++
+			}
+		}
+	} else {
+		var fingerprints []Fingerprint
+		if err := json.Unmarshal(data, &fingerprints); err != nil {
+			return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+		}
+		for _, f := range fingerprints {
+			total++
+			if f.Name != "" && all.addFingerprint(f) {
+				converted++
+			}
+		}
+	}
+	if converted < total {
+		slog.Info("Some fingerprints need requests the crawler doesn't send or have no signatures the CROWler rules can express",
+			"converted", converted, "total", total)
+	}
+
+	ruleset := crowler.NewRuleset(rulesetName, fmt.Sprintf("Ruleset to detect technologies with the %s.", source))
+	ruleset.Source = source
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = slug.File(rulesetName) + "-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      rulesetName,
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	sort.Strings(all.names)
+	ruleNames := slug.NewNamer()
+	for _, name := range all.names {
+		rule := *all.byName[name]
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+// isEHole tells an EHole document (an object with a fingerprint list)
+// from a FingerprintHub one (a list)
+func isEHole(input []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(input), []byte("{"))
+}
+
+func init() {
+	converter.Register(fingerprintHubConverter{})
+}
+
+// fingerprintHubConverter is the registered FingerprintHub and EHole
+// converter
+type fingerprintHubConverter struct{}
+
+func (fingerprintHubConverter) Name() string { return "fingerprinthub" }
+
+func (fingerprintHubConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert FingerprintHub web_fingerprint_v3.json or EHole finger.json fingerprints",
+		Input:          "Path to the web_fingerprint_v3.json or finger.json file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a list of fingerprints with a name and keywords, or
+// an EHole document whose fingerprints have a cms and a method
+func (fingerprintHubConverter) Detect(input []byte) bool {
+	if isEHole(input) {
+		var doc struct {
+			Fingerprint []map[string]json.RawMessage `json:"fingerprint"`
+		}
+		if err := json.Unmarshal(input, &doc); err != nil || len(doc.Fingerprint) == 0 {
+			return false
+		}
+		_, cms := doc.Fingerprint[0]["cms"]
+		_, method := doc.Fingerprint[0]["method"]
+		return cms && method
+	}
+	var fingerprints []map[string]json.RawMessage
+	if err := json.Unmarshal(input, &fingerprints); err != nil || len(fingerprints) == 0 {
+		return false
+	}
+	_, name := fingerprints[0]["name"]
+	_, keyword := fingerprints[0]["keyword"]
+	return name && keyword
+}
+
+func (fingerprintHubConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LiteralMode tells how the literal values of a source (the website of a
+// technology, the BuiltWith header values, ...) are written to the
+// patterns, which the CROWler matches as regular expressions. It's a
+// flag.Value, the zero value is LiteralEscape.
+type LiteralMode string
+
+const (
+	// LiteralEscape escapes the regular expression characters of the
+	// values, so a dot matches only a dot
+	LiteralEscape LiteralMode = "escape"
+	// LiteralRegex writes the values as they are, matching them as
+	// regular expressions
+	LiteralRegex LiteralMode = "regex"
+)
+
+// LiteralModeUsage is the usage of the -literals flag
+const LiteralModeUsage = "How the literal values of the source (website URLs, header values) are written to the patterns: escape matches them as they are, regex as regular expressions (default escape)"
+
+func (m *LiteralMode) String() string {
+	if m == nil || *m == "" {
+		return string(LiteralEscape)
+	}
+	return string(*m)
+}
+
+func (m *LiteralMode) Set(value string) error {
+	switch mode := LiteralMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case LiteralEscape, LiteralRegex:
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("invalid mode %q, expected escape or regex", value)
+}
+
+// Literal returns the pattern of the literal value of a source, escaped
+// unless the mode is LiteralRegex
+func (m LiteralMode) Literal(value string) string {
+	if m == LiteralRegex {
+		return value
+	}
+	return regexp.QuoteMeta(value)
+}
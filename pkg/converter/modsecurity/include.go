@@ -0,0 +1,174 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modsecurity
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+)
+
+// SourceFile holds the rules read from a ModSecurity configuration file
+type SourceFile struct {
+	// Name is the path of the file
+	Name string
+	// Dir is the directory the relative paths in the file (includes and
+	// @pmFromFile lists) are resolved from
+	Dir   string
+	Rules []*ModSecurityRule
+}
+
+// ParseFiles reads the rules of the ModSecurity configuration read from r
+// and of the files it includes with the Include and IncludeOptional
+// directives, which can use wildcards (e.g. Include rules/*.conf). name
+// and dir are the path of the configuration and its directory. The files
+// are returned in the order they're included, each after the file
+// including it.
+func ParseFiles(r io.Reader, name, dir string) ([]SourceFile, error) {
+	return parseFiles(r, name, dir, converter.Options{})
+}
+
+// parseFiles reads a configuration like ParseFiles, skipping the
+// directives that can't be parsed with opts.Skip
+func parseFiles(r io.Reader, name, dir string, opts converter.Options) ([]SourceFile, error) {
+	l := includeLoader{seen: make(map[string]bool), opts: opts}
+	// A configuration including *.conf from its own directory doesn't
+	// include itself
+	if name != "" {
+		if abs, err := filepath.Abs(filepath.Join(dir, filepath.Base(name))); err == nil {
+			l.seen[abs] = true
+		}
+	}
+	if err := l.load(r, name, dir); err != nil {
+		return nil, err
+	}
+	return l.files, nil
+}
+
+// includeLoader reads a configuration with the files it includes
+type includeLoader struct {
+	files []SourceFile
+	// seen holds the files already read, which aren't included again
+	seen map[string]bool
+	opts converter.Options
+}
+
+// invalid returns the invalidFunc of the directives of the file name,
+// skipping them with Skip
+func (l *includeLoader) invalid(name string) invalidFunc {
+	return func(line int, err error) error {
+		if err := l.opts.Skip(fmt.Sprintf("%s: line %d", name, line), err); err != nil {
+			return failInvalid(line, err)
+		}
+		return nil
+	}
+}
+
+func (l *includeLoader) load(r io.Reader, name, dir string) error {
+	directives, err := readDirectives(r, l.invalid(name))
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+
+	i := len(l.files)
+	l.files = append(l.files, SourceFile{Name: name, Dir: dir})
+	for _, d := range directives {
+		optional := strings.EqualFold(d.Name, "IncludeOptional")
+		if !optional && !strings.EqualFold(d.Name, "Include") {
+			continue
+		}
+		if len(d.Args) != 1 {
+			return fmt.Errorf("%s: line %d: %s expects a path, got %d arguments", name, d.Line, d.Name, len(d.Args))
+		}
+		if err := l.include(d.Args[0], dir, optional); err != nil {
+			return fmt.Errorf("%s: line %d: %v", name, d.Line, err)
+		}
+	}
+
+	rules, err := parseRules(directives, l.invalid(name))
+	if err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	l.files[i].Rules = rules
+	return nil
+}
+
+// include reads the files matching pattern, relative to dir. A pattern
+// without matches is an error, unless the include is optional.
+func (l *includeLoader) include(pattern, dir string, optional bool) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && !optional {
+		return fmt.Errorf("no files match %s", pattern)
+	}
+
+	for _, file := range files {
+		if abs, err := filepath.Abs(file); err == nil {
+			if l.seen[abs] {
+				slog.Warn("Skipping file, already included", "file", file)
+				continue
+			}
+			l.seen[abs] = true
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		err = l.load(f, file, filepath.Dir(file))
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadDir returns a configuration including the *.conf files of dir and
+// of its subdirectories, e.g. the rules directory of the OWASP CRS
+func ReadDir(dir string) ([]byte, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var config strings.Builder
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == ".conf" {
+			fmt.Fprintf(&config, "Include \"%s\"\n", strings.ReplaceAll(path, `"`, `\"`))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if config.Len() == 0 {
+		return nil, fmt.Errorf("no .conf files found in %s", dir)
+	}
+	return []byte(config.String()), nil
+}
@@ -0,0 +1,619 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package modsecurity converts ModSecurity rules matching the request and
+// response headers, the URL or the response body into CROWler detection
+// rules.
+package modsecurity
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "ModSecurity rules"
+	// DefaultSourceLicense is the license of the OWASP Core Rule Set
+	DefaultSourceLicense = "Apache-2.0"
+)
+
+// ModSecurityRule is a SecRule, with the rules chained to it
+type ModSecurityRule struct {
+	ID      string
+	Phase   string
+	Action  string
+	Status  string
+	Message string
+	// Severity is the severity name (e.g. CRITICAL), also when the rule
+	// gives its number
+	Severity string
+	// Version is the version of the rule set (e.g. OWASP_CRS/4.0.0)
+	Version string
+	// ParanoiaLevel is the CRS paranoia level of the rule, from its
+	// paranoia-level/N tag (0 when it has none)
+	ParanoiaLevel int
+	Tag           string
+	Tags          []string
+	Variables     []Variable
+	Operator      Operator
+	Actions       []Action
+	// Chain holds the rules chained to this one with the chain action,
+	// which must all match too
+	Chain []*ModSecurityRule
+	// Line is the line of the rule in the source
+	Line int
+}
+
+// disruptiveActions are the actions telling what ModSecurity does when a
+// rule matches (log isn't disruptive, but it's reported the same way)
+var disruptiveActions = map[string]bool{
+	"allow":    true,
+	"block":    true,
+	"deny":     true,
+	"drop":     true,
+	"pass":     true,
+	"proxy":    true,
+	"redirect": true,
+	"log":      true,
+}
+
+// severities are the ModSecurity severities, by number
+var severities = []string{"EMERGENCY", "ALERT", "CRITICAL", "ERROR", "WARNING", "NOTICE", "INFO", "DEBUG"}
+
+// severityConfidence is the confidence of the signatures of a rule with a
+// severity: the more severe the rule, the more likely its matches are
+// what it looks for
+var severityConfidence = map[string]float32{
+	"EMERGENCY": 10,
+	"ALERT":     10,
+	"CRITICAL":  10,
+	"ERROR":     8,
+	"WARNING":   6,
+	"NOTICE":    4,
+	"INFO":      2,
+	"DEBUG":     2,
+}
+
+// parseSeverity returns the name of a severity given by name or number
+func parseSeverity(s string) string {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n >= 0 && n < len(severities) {
+			return severities[n]
+		}
+		return ""
+	}
+	s = strings.ToUpper(s)
+	if slices.Contains(severities, s) {
+		return s
+	}
+	return ""
+}
+
+// parseSecRule builds a rule from the arguments of a SecRule directive:
+// the variables, the operator and optionally the actions
+func parseSecRule(d Directive) (*ModSecurityRule, error) {
+	if len(d.Args) < 2 || len(d.Args) > 3 {
+		return nil, fmt.Errorf("SecRule expects variables, operator and actions, got %d arguments", len(d.Args))
+	}
+	rule := &ModSecurityRule{
+		Variables: parseVariables(d.Args[0]),
+		Operator:  parseOperator(d.Args[1]),
+		Line:      d.Line,
+	}
+	if len(d.Args) == 3 {
+		rule.Actions = parseActions(d.Args[2])
+	}
+
+	for _, action := range rule.Actions {
+		switch action.Name {
+		case "id":
+			rule.ID = action.Value
+		case "phase":
+			rule.Phase = action.Value
+		case "status":
+			rule.Status = action.Value
+		case "msg":
+			rule.Message = action.Value
+		case "severity":
+			if rule.Severity = parseSeverity(action.Value); rule.Severity == "" {
+				slog.Warn("Unknown severity", "rule", rule.ID, "line", d.Line, "severity", action.Value)
+			}
+		case "ver":
+			rule.Version = action.Value
+		case "tag":
+			rule.Tags = append(rule.Tags, action.Value)
+			if level, ok := strings.CutPrefix(action.Value, "paranoia-level/"); ok {
+				rule.ParanoiaLevel, _ = strconv.Atoi(level)
+			}
+		default:
+			if disruptiveActions[action.Name] && rule.Action == "" {
+				rule.Action = action.Name
+			}
+		}
+	}
+	// The first tag is used to group the rules
+	if len(rule.Tags) > 0 {
+		rule.Tag = rule.Tags[0]
+	}
+	return rule, nil
+}
+
+// chained reports whether the rule has the chain action
+func (r *ModSecurityRule) chained() bool {
+	for _, action := range r.Actions {
+		if action.Name == "chain" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRules reads the SecRule directives of a ModSecurity configuration,
+// with their chained rules. The other directives are ignored, use
+// ParseFiles to follow the includes.
+func ParseRules(r io.Reader) ([]*ModSecurityRule, error) {
+	directives, err := readDirectives(r, failInvalid)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(directives, failInvalid)
+}
+
+// parseRules builds the rules of the SecRule directives, chaining them.
+// The invalid rules are passed to invalid, a skipped rule drops the chain
+// it's part of.
+func parseRules(directives []Directive, invalid invalidFunc) ([]*ModSecurityRule, error) {
+	var rules []*ModSecurityRule
+	var chainStart *ModSecurityRule
+	chaining := false
+	for _, d := range directives {
+		if !strings.EqualFold(d.Name, "SecRule") {
+			continue
+		}
+		rule, err := parseSecRule(d)
+		if err != nil {
+			if err := invalid(d.Line, err); err != nil {
+				return nil, err
+			}
+			if chaining {
+				rules = rules[:len(rules)-1]
+				chaining = false
+			}
+			continue
+		}
+		if chaining {
+			chainStart.Chain = append(chainStart.Chain, rule)
+		} else {
+			chainStart = rule
+			rules = append(rules, rule)
+		}
+		chaining = rule.chained()
+	}
+	if chaining {
+		slog.Warn("Rule ends with chain, but no rule follows", "rule", chainStart.ID, "line", chainStart.Line)
+	}
+	return rules, nil
+}
+
+// operatorPatterns converts an operator into regexes, any of which
+// matches, false if the operator can't be expressed with them. The phrase
+// match operators give a pattern per phrase, with the @pmFromFile files
+// resolved from dir.
+func operatorPatterns(op Operator, dir string) ([]string, bool) {
+	if op.Negated {
+		return nil, false
+	}
+	switch op.Name {
+	case "rx":
+		return []string{op.Argument}, op.Argument != ""
+	case "pm":
+		return phrasePatterns(strings.Fields(op.Argument))
+	case "pmFromFile", "pmf":
+		var phrases []string
+		for _, file := range strings.Fields(op.Argument) {
+			filePhrases, err := readPhrases(file, dir)
+			if err != nil {
+				slog.Warn("Error reading the phrases", "operator", "@"+op.Name, "error", err)
+				return nil, false
+			}
+			phrases = append(phrases, filePhrases...)
+		}
+		return phrasePatterns(phrases)
+	case "streq":
+		return []string{"^" + regexp.QuoteMeta(op.Argument) + "$"}, true
+	case "contains":
+		return []string{regexp.QuoteMeta(op.Argument)}, op.Argument != ""
+	case "beginsWith":
+		return []string{"^" + regexp.QuoteMeta(op.Argument)}, op.Argument != ""
+	case "endsWith":
+		return []string{regexp.QuoteMeta(op.Argument) + "$"}, op.Argument != ""
+	}
+	return nil, false
+}
+
+// phrasePatterns converts phrases into case insensitive regexes, as the
+// phrase match operators ignore the case
+func phrasePatterns(phrases []string) ([]string, bool) {
+	patterns := make([]string, 0, len(phrases))
+	for _, phrase := range phrases {
+		patterns = append(patterns, "(?i)"+regexp.QuoteMeta(phrase))
+	}
+	return patterns, len(patterns) > 0
+}
+
+// readPhrases reads a @pmFromFile file, a phrase per line with # comments.
+// A relative path is resolved from dir, the directory of the rules.
+func readPhrases(file, dir string) ([]string, error) {
+	if strings.HasPrefix(file, "https://") || strings.HasPrefix(file, "http://") {
+		return nil, fmt.Errorf("remote file %s is not supported", file)
+	}
+	if !filepath.IsAbs(file) && dir != "" {
+		file = filepath.Join(dir, file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var phrases []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, line)
+	}
+	return phrases, nil
+}
+
+// addSignatures adds to the detection rule the signatures of a
+// ModSecurity rule: its patterns on each of its variables that the
+// CROWler can match. The headers become header fields, the named cookies
+// cookie signatures, the URL and the query arguments URL
+// micro-signatures and the response body page content patterns. It
+// returns false if none was added.
+func addSignatures(rule *crowler.DetectionRule, modsecRule *ModSecurityRule, dir string) bool {
+	patterns, ok := operatorPatterns(modsecRule.Operator, dir)
+	if !ok {
+		return false
+	}
+
+	added := false
+	for _, v := range modsecRule.Variables {
+		if v.Exclude || v.Count {
+			continue
+		}
+		switch v.Collection {
+		case "REQUEST_HEADERS", "RESPONSE_HEADERS":
+			// A regex key selects several headers, which the CROWler
+			// can't express
+			if v.Key == "" || strings.HasPrefix(v.Key, "/") {
+				continue
+			}
+			rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, v.Key, patterns)
+		case "REQUEST_COOKIES", "REQUEST_COOKIES_NAMES":
+			// A named cookie becomes a cookie signature; without a name
+			// the whole Cookie header is matched
+			if v.Key == "" || strings.HasPrefix(v.Key, "/") || v.Collection == "REQUEST_COOKIES_NAMES" {
+				rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, "Cookie", patterns)
+				break
+			}
+			rule.Cookies = append(rule.Cookies, crowler.CookieSignature{
+				Name:       v.Key,
+				Value:      patterns,
+				Confidence: crowler.DefaultConfidence,
+			})
+		case "REQUEST_URI", "REQUEST_URI_RAW", "REQUEST_FILENAME", "REQUEST_BASENAME", "QUERY_STRING",
+			"ARGS", "ARGS_GET", "ARGS_NAMES", "ARGS_GET_NAMES":
+			// The query arguments are part of the URL the CROWler sees
+			for _, pattern := range patterns {
+				rule.URLPatterns = appendURL(rule.URLPatterns, pattern)
+			}
+		case "RESPONSE_BODY":
+			rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+				Key:        "body",
+				Signature:  patterns,
+				Confidence: crowler.DefaultConfidence,
+			})
+		default:
+			continue
+		}
+		added = true
+	}
+	return added
+}
+
+// appendHeader adds patterns to the header field key, creating it if
+// needed, skipping the patterns the field already has
+func appendHeader(fields []crowler.HTTPHeaderField, key string, patterns []string) []crowler.HTTPHeaderField {
+	i := 0
+	for i < len(fields) && !strings.EqualFold(fields[i].Key, key) {
+		i++
+	}
+	if i == len(fields) {
+		fields = append(fields, crowler.HTTPHeaderField{
+			Key:        key,
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+	for _, pattern := range patterns {
+		if !slices.Contains(fields[i].Value, pattern) {
+			fields[i].Value = append(fields[i].Value, pattern)
+		}
+	}
+	return fields
+}
+
+// appendURL adds a URL pattern, unless the rule already has it
+func appendURL(patterns []crowler.URLMicroSignature, pattern string) []crowler.URLMicroSignature {
+	for _, p := range patterns {
+		if p.Signature == pattern {
+			return patterns
+		}
+	}
+	return append(patterns, crowler.URLMicroSignature{
+		Signature:  pattern,
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// Function to create a CROWler detection rule from a ModSecurity rule and
+// its chained rules. It returns false if none of them can be converted.
+func createDetectionRuleFromModSecurity(modsecRule *ModSecurityRule, dir string) (crowler.DetectionRule, bool) {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_modsec_rule_" + slug.Make(modsecRule.ID),
+		ObjectName: fmt.Sprintf("ModSecurity Rule %s", modsecRule.ID),
+	}
+	if modsecRule.Message != "" || modsecRule.Severity != "" || len(modsecRule.Tags) > 0 ||
+		modsecRule.Version != "" || modsecRule.ParanoiaLevel > 0 {
+		rule.Metadata = &crowler.RuleMetadata{
+			Description:   modsecRule.Message,
+			Severity:      modsecRule.Severity,
+			Tags:          modsecRule.Tags,
+			SourceVersion: modsecRule.Version,
+			ParanoiaLevel: modsecRule.ParanoiaLevel,
+		}
+	}
+
+	// A chained rule only matches when all the rules of the chain match;
+	// the CROWler signatures add up instead, so the rule gets the
+	// signatures of all the rules of the chain that can be converted
+	converted := addSignatures(&rule, modsecRule, dir)
+	for _, chained := range modsecRule.Chain {
+		if addSignatures(&rule, chained, dir) {
+			converted = true
+		}
+	}
+	return rule, converted
+}
+
+// convertedFile holds the rules converted from a source file, with the
+// tags grouping them
+type convertedFile struct {
+	name  string
+	group string
+	rules []crowler.DetectionRule
+	tags  []string
+}
+
+// fileGroup returns the name of the rule group of a source file
+func fileGroup(name string) string {
+	if name == "" {
+		return "detect_modsecurity_rules"
+	}
+	name = filepath.Base(name)
+	return "detect_modsecurity_" + slug.Make(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// newRuleset returns an empty ModSecurity ruleset
+func newRuleset(name, description, fileName string, opts Options) crowler.Ruleset {
+	ruleset := crowler.NewRuleset(name, description)
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = fileName
+	ruleset.RuleGroups = []crowler.RuleGroup{}
+	return ruleset
+}
+
+// addFileGroups adds to ruleset the group of a source file, child of
+// parent if it isn't empty, with a child group for each tag of its rules
+func addFileGroups(ruleset *crowler.Ruleset, file convertedFile, parent string) {
+	groupIndex := map[string]int{"": len(ruleset.RuleGroups)}
+	ruleset.RuleGroups = append(ruleset.RuleGroups, crowler.RuleGroup{
+		GroupName:      file.group,
+		ParentGroup:    parent,
+		IsEnabled:      true,
+		DetectionRules: []crowler.DetectionRule{},
+	})
+	for j, rule := range file.rules {
+		tag := file.tags[j]
+		i, ok := groupIndex[tag]
+		if !ok {
+			i = len(ruleset.RuleGroups)
+			groupIndex[tag] = i
+			ruleset.RuleGroups = append(ruleset.RuleGroups, crowler.RuleGroup{
+				GroupName:      file.group + "_" + slug.Make(tag),
+				ParentGroup:    file.group,
+				IsEnabled:      true,
+				DetectionRules: []crowler.DetectionRule{},
+			})
+		}
+		ruleset.RuleGroups[i].DetectionRules = append(ruleset.RuleGroups[i].DetectionRules, rule)
+	}
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// ParanoiaLevel skips the rules of a higher CRS paranoia level (0
+	// converts all the rules)
+	ParanoiaLevel int
+}
+
+// Convert converts the ModSecurity rules read from r, and from the files
+// it includes, into a ruleset. The rules are grouped by file and then by
+// tag. When the rules come from several files, there's also a ruleset per
+// file next to the aggregated one.
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	sources, err := parseFiles(r, opts.FileName, opts.Dir, opts.Options)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rules: %v", err)
+	}
+
+	var files []convertedFile
+	groupNames := slug.NewNamer()
+	ruleNames := slug.NewNamer()
+	total, converted, skipped := 0, 0, 0
+	for _, source := range sources {
+		if len(source.Rules) == 0 {
+			continue
+		}
+		total += len(source.Rules)
+		file := convertedFile{name: source.Name, group: groupNames.Unique(fileGroup(source.Name))}
+		var rules []*ModSecurityRule
+		for _, modsecRule := range source.Rules {
+			if opts.ParanoiaLevel > 0 && modsecRule.ParanoiaLevel > opts.ParanoiaLevel {
+				skipped++
+				continue
+			}
+			rules = append(rules, modsecRule)
+		}
+		// Create the CROWler detection rules with the workers, then name
+		// them in the order of the file
+		detectionRules := converter.Map(opts.Workers, rules, func(modsecRule *ModSecurityRule) *crowler.DetectionRule {
+			defer opts.Processed(1)
+			detectionRule, ok := createDetectionRuleFromModSecurity(modsecRule, source.Dir)
+			if !ok {
+				return nil
+			}
+			opts.PrepareRule(&detectionRule)
+			// The severity gives the confidence, unless a confidence
+			// profile scores the signatures by their type
+			if confidence, ok := severityConfidence[modsecRule.Severity]; ok && opts.ConfidenceProfile == nil {
+				crowler.SetConfidence(&detectionRule, confidence)
+			}
+			return &detectionRule
+		})
+		for i, detectionRule := range detectionRules {
+			if detectionRule == nil {
+				continue
+			}
+			converted++
+			detectionRule.RuleName = ruleNames.Unique(detectionRule.RuleName)
+			file.rules = append(file.rules, *detectionRule)
+			file.tags = append(file.tags, rules[i].Tag)
+		}
+		files = append(files, file)
+	}
+
+	if skipped > 0 {
+		slog.Info("Skipped the rules above the paranoia level", "skipped", skipped, "paranoia_level", opts.ParanoiaLevel)
+	}
+	if converted < total-skipped {
+		slog.Info("Some rules match variables or use operators the CROWler rules can't express",
+			"converted", converted, "total", total-skipped)
+	}
+
+	// The aggregated ruleset has all the rules. With a single source file,
+	// its group is the root group, otherwise the file groups are children
+	// of the detect_modsecurity_rules group.
+	ruleset := newRuleset("detect_modsecurity_rules", "Ruleset to detect ModSecurity rules.", "detect-modsecurity-ruleset.yaml", opts)
+	switch len(files) {
+	case 0:
+		addFileGroups(&ruleset, convertedFile{group: fileGroup(opts.FileName)}, "")
+	case 1:
+		addFileGroups(&ruleset, files[0], "")
+	default:
+		rootGroup := fileGroup("")
+		ruleset.RuleGroups = append(ruleset.RuleGroups, crowler.RuleGroup{
+			GroupName:      rootGroup,
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		})
+		for _, file := range files {
+			addFileGroups(&ruleset, file, rootGroup)
+		}
+	}
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+	rulesets := []crowler.Ruleset{ruleset}
+
+	if len(files) > 1 {
+		for _, file := range files {
+			fileRuleset := newRuleset(file.group+"_ruleset",
+				fmt.Sprintf("Ruleset to detect the ModSecurity rules of %s.", filepath.Base(file.name)),
+				slug.File(file.group)+"-ruleset.yaml", opts)
+			addFileGroups(&fileRuleset, file, "")
+			crowler.ApplyNamespace(&fileRuleset, opts.Namespace)
+			rulesets = append(rulesets, fileRuleset)
+		}
+	}
+
+	return rulesets, nil
+}
+
+func init() {
+	converter.Register(&modSecurityConverter{})
+}
+
+// modSecurityConverter is the registered ModSecurity converter
+type modSecurityConverter struct {
+	paranoiaLevel int
+}
+
+func (*modSecurityConverter) Name() string { return "modsec" }
+
+func (*modSecurityConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert ModSecurity rules (e.g. the OWASP CRS)",
+		Input:          "Path to the ModSecurity rules file, or to a directory of *.conf files",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// secRuleRe matches a ModSecurity SecRule or Include directive
+var secRuleRe = regexp.MustCompile(`(?m)^\s*(SecRule|Include|IncludeOptional)\s`)
+
+// Detect recognizes a file with SecRule directives, or including other
+// files
+func (*modSecurityConverter) Detect(input []byte) bool {
+	return secRuleRe.Match(input)
+}
+
+func (c *modSecurityConverter) SetFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.paranoiaLevel, "paranoia-level", 0, "Skip the rules above this CRS paranoia level (0 converts all the rules)")
+}
+
+func (c *modSecurityConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	if c.paranoiaLevel < 0 {
+		return nil, fmt.Errorf("invalid paranoia level %d", c.paranoiaLevel)
+	}
+	return Convert(r, Options{Options: opts, ParanoiaLevel: c.paranoiaLevel})
+}
+
+func (*modSecurityConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modsecurity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Directive is a ModSecurity configuration directive, with its arguments
+// unquoted
+type Directive struct {
+	Name string
+	Args []string
+	// Line is the line where the directive starts
+	Line int
+}
+
+// Variable is a variable of a SecRule, e.g. REQUEST_HEADERS:User-Agent
+type Variable struct {
+	Collection string
+	Key        string
+	// Exclude is set for !COLLECTION:key, which removes the key from the
+	// variables
+	Exclude bool
+	// Count is set for &COLLECTION, which matches the number of items
+	Count bool
+}
+
+// Operator is the operator of a SecRule, e.g. @rx or @pm
+type Operator struct {
+	Name     string
+	Argument string
+	Negated  bool
+}
+
+// Action is an action of a SecRule, e.g. id:913100 or msg:'Found scanner'
+type Action struct {
+	Name  string
+	Value string
+}
+
+// invalidFunc handles the error of the directive at line of a
+// configuration. It returns nil to skip the directive, or the error
+// stopping the parsing.
+type invalidFunc func(line int, err error) error
+
+// failInvalid stops the parsing at the first invalid directive
+func failInvalid(line int, err error) error {
+	return fmt.Errorf("line %d: %v", line, err)
+}
+
+// readDirectives reads the directives of a ModSecurity configuration. A
+// line ending with a backslash continues on the next one, and the lines
+// starting with # are comments. The directives that can't be parsed are
+// passed to invalid.
+func readDirectives(r io.Reader, invalid invalidFunc) ([]Directive, error) {
+	var directives []Directive
+	var logical strings.Builder
+	start := 0
+
+	scanner := bufio.NewScanner(r)
+	// The CRS has rules well over the default 64KB token size
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if logical.Len() == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			start = lineNo
+		}
+
+		trimmed := strings.TrimRight(line, " \t\r")
+		if strings.HasSuffix(trimmed, `\`) {
+			logical.WriteString(strings.TrimSuffix(trimmed, `\`))
+			continue
+		}
+		logical.WriteString(line)
+
+		directive, err := parseDirective(logical.String())
+		logical.Reset()
+		if err != nil {
+			if err := invalid(start, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		directive.Line = start
+		directives = append(directives, directive)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if logical.Len() > 0 {
+		directive, err := parseDirective(logical.String())
+		if err != nil {
+			if err := invalid(start, err); err != nil {
+				return nil, err
+			}
+			return directives, nil
+		}
+		directive.Line = start
+		directives = append(directives, directive)
+	}
+	return directives, nil
+}
+
+// parseDirective splits a directive into its name and arguments. The
+// arguments are separated by spaces and can be quoted with double or
+// single quotes, a backslash escapes the quote inside them (the other
+// backslashes are kept, they belong to the regexes).
+func parseDirective(line string) (Directive, error) {
+	var words []string
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+
+		var word strings.Builder
+		if quote := line[i]; quote == '"' || quote == '\'' {
+			i++
+			closed := false
+			for i < len(line) {
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == quote {
+					word.WriteByte(quote)
+					i += 2
+					continue
+				}
+				if c == quote {
+					closed = true
+					i++
+					break
+				}
+				word.WriteByte(c)
+				i++
+			}
+			if !closed {
+				return Directive{}, fmt.Errorf("unterminated quoted argument")
+			}
+		} else {
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				word.WriteByte(line[i])
+				i++
+			}
+		}
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return Directive{}, fmt.Errorf("empty directive")
+	}
+	return Directive{Name: words[0], Args: words[1:]}, nil
+}
+
+// parseVariables parses the variables of a SecRule, separated by |
+func parseVariables(s string) []Variable {
+	var variables []Variable
+	for _, part := range strings.Split(s, "|") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var v Variable
+		switch part[0] {
+		case '!':
+			v.Exclude = true
+			part = part[1:]
+		case '&':
+			v.Count = true
+			part = part[1:]
+		}
+		collection, key, _ := strings.Cut(part, ":")
+		v.Collection = strings.ToUpper(collection)
+		v.Key = strings.Trim(key, `'"`)
+		variables = append(variables, v)
+	}
+	return variables
+}
+
+// parseOperator parses the operator of a SecRule. An operator without a
+// name is a regex (@rx).
+func parseOperator(s string) Operator {
+	var op Operator
+	s = strings.TrimLeft(s, " \t")
+	if strings.HasPrefix(s, "!") {
+		op.Negated = true
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "@") {
+		op.Name = "rx"
+		op.Argument = s
+		return op
+	}
+	name, argument, _ := strings.Cut(s[1:], " ")
+	op.Name = name
+	op.Argument = strings.TrimLeft(argument, " \t")
+	return op
+}
+
+// parseActions parses the comma separated actions of a SecRule. The
+// values can be quoted with single quotes, to include commas.
+func parseActions(s string) []Action {
+	var actions []Action
+	i := 0
+	for i < len(s) {
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+
+		var action Action
+		start := i
+		for i < len(s) && s[i] != ':' && s[i] != ',' {
+			i++
+		}
+		action.Name = strings.TrimSpace(s[start:i])
+		if i < len(s) && s[i] == ':' {
+			i++
+			var value strings.Builder
+			if i < len(s) && s[i] == '\'' {
+				i++
+				for i < len(s) && s[i] != '\'' {
+					if s[i] == '\\' && i+1 < len(s) && s[i+1] == '\'' {
+						i++
+					}
+					value.WriteByte(s[i])
+					i++
+				}
+				i++ // closing quote
+			} else {
+				for i < len(s) && s[i] != ',' {
+					value.WriteByte(s[i])
+					i++
+				}
+			}
+			action.Value = strings.TrimSpace(value.String())
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
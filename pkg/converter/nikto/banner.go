@@ -0,0 +1,254 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nikto
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// OutdatedSourceName identifies the db_outdated source in the
+	// generated rulesets
+	OutdatedSourceName = "Nikto db_outdated"
+	// ServerMsgsSourceName identifies the db_server_msgs source in the
+	// generated rulesets
+	ServerMsgsSourceName = "Nikto db_server_msgs"
+	// OutdatedCategory and ServerMsgsCategory are the taxonomy keys of the
+	// db_outdated and db_server_msgs rules
+	OutdatedCategory   = "outdated"
+	ServerMsgsCategory = "server_msgs"
+)
+
+// serverHeader is the header holding the banners Nikto matches
+const serverHeader = "Server"
+
+// versionExpr captures the version following a product name in a banner
+const versionExpr = `([0-9][\w.-]*)`
+
+// readEntries reads the entries of a Nikto database with fields fields:
+// the comments, the empty lines and the lines without a numeric ID (the
+// header) are skipped
+func readEntries(r io.Reader, fields int) ([][]string, error) {
+	var entries [][]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.LazyQuotes = true
+		entry, err := reader.Read()
+		if err != nil {
+			slog.Warn("Error reading line", "error", err)
+			continue
+		}
+		if _, err := strconv.Atoi(entry[0]); err != nil {
+			continue
+		}
+		if len(entry) != fields {
+			slog.Warn("Skipping invalid line", "line", line)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	return entries, nil
+}
+
+// productName returns the product a banner prefix (e.g. Apache/) belongs to
+func productName(prefix string) string {
+	if i := strings.IndexAny(prefix, "/ "); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return strings.TrimSpace(prefix)
+}
+
+// bannerVersion returns the signature extracting the version that follows
+// product/ in the Server header
+func bannerVersion(product string) crowler.VersionSignature {
+	return crowler.VersionSignature{
+		Section: "http_header_fields",
+		Key:     serverHeader,
+		Pattern: "(?i)" + regexp.QuoteMeta(product+"/") + versionExpr,
+		Version: `\1`,
+	}
+}
+
+// Function to create a CROWler detection rule from a db_outdated entry:
+// match is the banner prefix of the product (e.g. Apache/) and current the
+// banner of its latest version (e.g. Apache/2.4.54)
+func createOutdatedRule(match, current, message string) crowler.DetectionRule {
+	name := productName(match)
+	if name == "" {
+		name = match
+	}
+	latest := current
+	if len(current) > len(match) && strings.EqualFold(current[:len(match)], match) {
+		latest = current[len(match):]
+	}
+	message = strings.NewReplacer("@RUNNING_VER", name, "@CURRENT_VER", latest).Replace(message)
+
+	pattern := "(?i)" + regexp.QuoteMeta(match)
+	return crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+		Metadata: &crowler.RuleMetadata{
+			Description:   message,
+			LatestVersion: latest,
+		},
+		HTTPHeaderFields: []crowler.HTTPHeaderField{
+			{
+				Key:        serverHeader,
+				Value:      []string{pattern},
+				Confidence: crowler.DefaultConfidence,
+			},
+		},
+		Version: []crowler.VersionSignature{
+			{
+				Section: "http_header_fields",
+				Key:     serverHeader,
+				Pattern: pattern + versionExpr,
+				Version: `\1`,
+			},
+		},
+	}
+}
+
+// Function to create a CROWler detection rule from a db_server_msgs entry,
+// whose expr matches the Server header. It returns false if expr isn't a
+// valid regex, or has no RE2 translation.
+func createServerMsgRule(id, expr, message string) (crowler.DetectionRule, bool) {
+	pattern, err := normalize.Translate(expr)
+	if err != nil {
+		slog.Warn("Skipping entry with an invalid regex", "entry", id, "regex", expr, "error", err)
+		return crowler.DetectionRule{}, false
+	}
+	re := regexp.MustCompile(pattern)
+
+	// The product is the literal start of the regex, e.g. Apache in
+	// Apache\/2\.0\.
+	prefix, _ := re.LiteralPrefix()
+	name := productName(prefix)
+	if name == "" {
+		name = "Nikto server message " + id
+	}
+
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_nikto_server_msg_" + slug.Make(id),
+		ObjectName: name,
+		Metadata:   &crowler.RuleMetadata{Description: message},
+		HTTPHeaderFields: []crowler.HTTPHeaderField{
+			{
+				Key:        serverHeader,
+				Value:      []string{pattern},
+				Confidence: crowler.DefaultConfidence,
+			},
+		},
+	}
+	if strings.HasPrefix(prefix, name+"/") {
+		rule.Version = []crowler.VersionSignature{bannerVersion(name)}
+	}
+	return rule, true
+}
+
+// newBannerRuleset returns an empty ruleset for the rules of a Nikto
+// banner database
+func newBannerRuleset(name, description, source string, groupTags []string, opts converter.Options) crowler.Ruleset {
+	ruleset := crowler.NewRuleset(name, description)
+	ruleset.Source = source
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = slug.File(name) + "-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_server_banners",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+	return ruleset
+}
+
+// ConvertOutdated converts a db_outdated file into a ruleset identifying
+// the software from the Server banner, with its version and the latest
+// version known to Nikto
+func ConvertOutdated(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	entries, err := readEntries(r, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	groupTags := opts.Taxonomy.Tags(OutdatedCategory)
+	ruleset := newBannerRuleset("detect_outdated_servers", "Ruleset to detect server software and its latest version from the Server banner.",
+		OutdatedSourceName, groupTags, opts)
+
+	ruleNames := slug.NewNamer()
+	for _, entry := range entries {
+		rule := createOutdatedRule(entry[1], entry[2], entry[3])
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+// ConvertServerMsgs converts a db_server_msgs file into a ruleset matching
+// the Server banners Nikto reports
+func ConvertServerMsgs(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	entries, err := readEntries(r, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	groupTags := opts.Taxonomy.Tags(ServerMsgsCategory)
+	ruleset := newBannerRuleset("detect_server_messages", "Ruleset to detect server software versions Nikto reports from the Server banner.",
+		ServerMsgsSourceName, groupTags, opts)
+
+	ruleNames := slug.NewNamer()
+	for _, entry := range entries {
+		rule, ok := createServerMsgRule(entry[0], entry[1], entry[2])
+		if !ok {
+			continue
+		}
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nikto converts the Nikto databases into CROWler detection
+// rulesets: db_favicon (favicon MD5 hashes), db_outdated (latest versions
+// of the server software), db_server_msgs (server banners) and
+// db_404_strings (soft 404 pages).
+package nikto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/favicon"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Nikto db_favicon"
+	// DefaultSourceLicense is the license of the Nikto databases
+	DefaultSourceLicense = "LicenseRef-Nikto"
+	// Category is the taxonomy key of the Nikto favicons, which have a
+	// single grouping
+	Category = "favicon"
+)
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Favicons holds the hashes of the known favicons by MD5 hash, the
+	// rules of these favicons also match their SHA-256 and mmh3 hashes
+	Favicons map[string]favicon.Hashes
+}
+
+// LoadFavicons computes the hashes of the favicon files in dir, indexed
+// by MD5 hash
+func LoadFavicons(dir string) (map[string]favicon.Hashes, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	favicons := make(map[string]favicon.Hashes)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		hashes := favicon.Compute(data)
+		favicons[hashes.MD5] = hashes
+	}
+	return favicons, nil
+}
+
+// Function to create a CROWler detection rule from a favicon entry. If
+// the favicon is known, the rule also matches its SHA-256 and mmh3 hashes.
+func createFaviconRule(id, md5hash, description string, favicons map[string]favicon.Hashes) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(description),
+		ObjectName: description,
+		PageContentPatterns: []crowler.PageContentSignature{
+			{
+				MD5Hash:    []string{md5hash},
+				Confidence: crowler.DefaultConfidence,
+			},
+		},
+	}
+	if hashes, ok := favicons[strings.ToLower(md5hash)]; ok {
+		rule.PageContentPatterns[0].SHA256Hash = []string{hashes.SHA256}
+		rule.PageContentPatterns[0].MMH3Hash = []string{hashes.MMH3}
+	}
+
+	return rule
+}
+
+// Convert converts a db_favicon file into a ruleset
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	groupTags := opts.Taxonomy.Tags(Category)
+
+	// Initialize the ruleset
+	ruleset := crowler.NewRuleset("detect_favicon_hashes", "Ruleset to detect technologies using favicon MD5 hashes.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-favicon-hashes-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_favicon_technologies",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	// Read the header line
+	_ = scanner.Scan() // Skip the header line
+
+	// Process each line of the file
+	ruleNames := slug.NewNamer()
+	known := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue // Skip comments and empty lines
+		}
+
+		// Create a CSV reader for the line
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.Comma = ','
+
+		fields, err := reader.Read()
+		if err != nil {
+			slog.Warn("Error reading line", "error", err)
+			continue
+		}
+
+		if len(fields) != 3 {
+			slog.Warn("Skipping invalid line", "line", line)
+			continue // Skip lines that don't have the correct number of fields
+		}
+
+		// Trim quotes and create a rule
+		id := strings.Trim(fields[0], "\"")
+		md5hash := strings.Trim(fields[1], "\"")
+		description := strings.Trim(fields[2], "\"")
+
+		rule := createFaviconRule(id, md5hash, description, opts.Favicons)
+		if len(rule.PageContentPatterns[0].SHA256Hash) > 0 {
+			known++
+		}
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	if opts.Favicons != nil {
+		slog.Info("Added the SHA-256 and mmh3 hashes of the known favicons", "known", known, "total", len(ruleset.RuleGroups[0].DetectionRules))
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(&niktoConverter{})
+}
+
+// niktoConverter is the registered Nikto converter
+type niktoConverter struct {
+	faviconDir string
+}
+
+func (*niktoConverter) Name() string { return "nikto" }
+
+func (*niktoConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a Nikto database (db_favicon, db_outdated, db_server_msgs, db_404_strings)",
+		Input:          "Path to the db_favicon, db_outdated, db_server_msgs or db_404_strings file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+var (
+	// faviconLineRe matches a db_favicon entry: "id","md5 hash","description"
+	faviconLineRe = regexp.MustCompile(`(?m)^"[^"]*","[0-9A-Fa-f]{32}","[^"]*"\s*$`)
+	// outdatedLineRe matches a db_outdated entry: "id","banner prefix",
+	// "latest banner","message"
+	outdatedLineRe = regexp.MustCompile(`(?m)^"\d+","[^"]*","[^"]*","[^"]*"\s*$`)
+	// serverMsgLineRe matches a db_server_msgs entry: "id","regex","message"
+	serverMsgLineRe = regexp.MustCompile(`(?m)^"\d+","[^"]+","[^"]*"\s*$`)
+	// soft404LineRe matches a db_404_strings entry: "id","string"
+	soft404LineRe = regexp.MustCompile(`(?m)^"\d+","[^"]+"\s*$`)
+)
+
+// database returns the Nikto database input comes from, from the name of
+// the file (db_outdated, udb_outdated, ...) or else from its entries
+func database(input []byte, fileName string) string {
+	databases := []string{"db_favicon", "db_outdated", "db_server_msgs", "db_404"}
+	for _, db := range databases {
+		if strings.Contains(filepath.Base(fileName), db) {
+			return db
+		}
+	}
+	for i, re := range []*regexp.Regexp{faviconLineRe, outdatedLineRe, serverMsgLineRe, soft404LineRe} {
+		if re.Match(input) {
+			return databases[i]
+		}
+	}
+	return ""
+}
+
+// Detect recognizes a file with db_favicon, db_outdated, db_server_msgs or
+// db_404_strings entries
+func (*niktoConverter) Detect(input []byte) bool {
+	return database(input, "") != ""
+}
+
+func (c *niktoConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.faviconDir, "favicons", "", "Directory of favicon files, the db_favicon rules of these favicons also match their SHA-256 and mmh3 hashes")
+}
+
+func (c *niktoConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch database(input, opts.FileName) {
+	case "db_outdated":
+		return ConvertOutdated(bytes.NewReader(input), opts)
+	case "db_server_msgs":
+		return ConvertServerMsgs(bytes.NewReader(input), opts)
+	case "db_404":
+		return ConvertSoft404(bytes.NewReader(input), opts)
+	}
+
+	var favicons map[string]favicon.Hashes
+	if c.faviconDir != "" {
+		if favicons, err = LoadFavicons(c.faviconDir); err != nil {
+			return nil, fmt.Errorf("error reading favicons: %v", err)
+		}
+	}
+	return Convert(bytes.NewReader(input), Options{Options: opts, Favicons: favicons})
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nikto
+
+import (
+	"io"
+	"regexp"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+const (
+	// Soft404SourceName identifies the db_404_strings source in the
+	// generated rulesets
+	Soft404SourceName = "Nikto db_404_strings"
+	// Soft404Category is the taxonomy key of the db_404_strings rule
+	Soft404Category = "soft_404"
+)
+
+// ConvertSoft404 converts a db_404_strings file, the strings Nikto finds
+// in the error pages served with a 200 status, into a ruleset recognizing
+// these soft 404 pages, so the crawler can discard them. All the strings
+// are signatures of a single rule.
+func ConvertSoft404(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	entries, err := readEntries(r, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	groupTags := opts.Taxonomy.Tags(Soft404Category)
+	ruleset := crowler.NewRuleset("detect_soft_404_pages", "Ruleset to detect error pages served as regular pages (soft 404).")
+	ruleset.Source = Soft404SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-soft-404-pages-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_error_pages",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	// The strings are matched case insensitively, as Nikto does
+	var patterns []string
+	for _, entry := range entries {
+		if entry[1] != "" {
+			patterns = append(patterns, "(?i)"+regexp.QuoteMeta(entry[1]))
+		}
+	}
+	if len(patterns) > 0 {
+		rule := crowler.DetectionRule{
+			RuleName:   "detect_soft_404_page",
+			ObjectName: "Soft 404 page",
+			PageContentPatterns: []crowler.PageContentSignature{
+				{
+					Key:        "body",
+					Signature:  patterns,
+					Confidence: crowler.DefaultConfidence,
+				},
+			},
+		}
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
@@ -0,0 +1,515 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmap
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// Fingerprint is an entry of http-fingerprints.lua: the paths to probe
+// and the matches on the responses
+type Fingerprint struct {
+	Category string
+	Paths    []string
+	Matches  []FingerprintMatch
+}
+
+// FingerprintMatch is a match of a fingerprint. Match is a Lua pattern
+// matched on the response, Output names what the match found.
+type FingerprintMatch struct {
+	Match  string
+	Output string
+}
+
+// luaTable is a Lua table constructor, with its named fields and its
+// list items
+type luaTable struct {
+	fields map[string]any
+	items  []any
+}
+
+// luaParser parses the Lua table constructors of http-fingerprints.lua
+type luaParser struct {
+	s string
+	i int
+}
+
+func (p *luaParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip skips the spaces and the comments
+func (p *luaParser) skip() {
+	for p.i < len(p.s) {
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "--[["):
+			end := strings.Index(p.s[p.i:], "]]")
+			if end < 0 {
+				p.i = len(p.s)
+				return
+			}
+			p.i += end + 2
+		case strings.HasPrefix(p.s[p.i:], "--"):
+			end := strings.IndexByte(p.s[p.i:], '\n')
+			if end < 0 {
+				p.i = len(p.s)
+				return
+			}
+			p.i += end + 1
+		case strings.ContainsRune(" \t\r\n", rune(p.s[p.i])):
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+// str parses a quoted or long bracket string
+func (p *luaParser) str() (string, error) {
+	if strings.HasPrefix(p.s[p.i:], "[[") {
+		end := strings.Index(p.s[p.i+2:], "]]")
+		if end < 0 {
+			return "", p.errorf("unterminated string")
+		}
+		value := p.s[p.i+2 : p.i+2+end]
+		p.i += end + 4
+		return value, nil
+	}
+
+	quote := p.s[p.i]
+	p.i++
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case c == quote:
+			p.i++
+			return b.String(), nil
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		case c == '\\' && p.i+1 < len(p.s):
+			p.i++
+			switch e := p.s[p.i]; {
+			case e == 'n':
+				b.WriteByte('\n')
+			case e == 'r':
+				b.WriteByte('\r')
+			case e == 't':
+				b.WriteByte('\t')
+			case e >= '0' && e <= '9':
+				end := p.i
+				for end < len(p.s) && end < p.i+3 && p.s[end] >= '0' && p.s[end] <= '9' {
+					end++
+				}
+				n, _ := strconv.Atoi(p.s[p.i:end])
+				b.WriteByte(byte(n))
+				p.i = end - 1
+			default:
+				b.WriteByte(e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+		p.i++
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// value parses a string, a number, a name (true, false, nil or a
+// variable) or a table. Strings joined with .. are concatenated.
+func (p *luaParser) value() (any, error) {
+	p.skip()
+	if p.i >= len(p.s) {
+		return nil, p.errorf("unexpected end of file")
+	}
+	switch c := p.s[p.i]; {
+	case c == '{':
+		return p.table()
+	case c == '"' || c == '\'' || strings.HasPrefix(p.s[p.i:], "[["):
+		value, err := p.str()
+		if err != nil {
+			return nil, err
+		}
+		p.skip()
+		if strings.HasPrefix(p.s[p.i:], "..") {
+			p.i += 2
+			next, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := next.(string); ok {
+				return value + s, nil
+			}
+			return nil, p.errorf("can only concatenate strings")
+		}
+		return value, nil
+	default:
+		start := p.i
+		for p.i < len(p.s) && (isNameChar(p.s[p.i]) || p.s[p.i] == '.' || p.s[p.i] == '-') {
+			p.i++
+		}
+		if start == p.i {
+			return nil, p.errorf("unexpected %q", c)
+		}
+		switch word := p.s[start:p.i]; word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		default:
+			return word, nil
+		}
+	}
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// table parses a table constructor
+func (p *luaParser) table() (luaTable, error) {
+	t := luaTable{fields: make(map[string]any)}
+	p.i++ // {
+	for {
+		p.skip()
+		if p.i >= len(p.s) {
+			return t, p.errorf("unterminated table")
+		}
+		if p.s[p.i] == '}' {
+			p.i++
+			return t, nil
+		}
+
+		// name = value, ["name"] = value or value
+		key := ""
+		start := p.i
+		if p.s[p.i] == '[' && !strings.HasPrefix(p.s[p.i:], "[[") {
+			p.i++
+			k, err := p.value()
+			if err != nil {
+				return t, err
+			}
+			p.skip()
+			if !strings.HasPrefix(p.s[p.i:], "]") {
+				return t, p.errorf("expected ]")
+			}
+			p.i++
+			key = fmt.Sprint(k)
+		} else {
+			for p.i < len(p.s) && isNameChar(p.s[p.i]) {
+				p.i++
+			}
+			key = p.s[start:p.i]
+		}
+		p.skip()
+		if key != "" && strings.HasPrefix(p.s[p.i:], "=") && !strings.HasPrefix(p.s[p.i:], "==") {
+			p.i++
+		} else {
+			key, p.i = "", start
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return t, err
+		}
+		if key != "" {
+			t.fields[key] = value
+		} else {
+			t.items = append(t.items, value)
+		}
+
+		p.skip()
+		if p.i < len(p.s) && (p.s[p.i] == ',' || p.s[p.i] == ';') {
+			p.i++
+		}
+	}
+}
+
+// tables returns the table items of a field
+func (t luaTable) tables(field string) []luaTable {
+	list, _ := t.fields[field].(luaTable)
+	var tables []luaTable
+	for _, item := range list.items {
+		if table, ok := item.(luaTable); ok {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// str returns a string field
+func (t luaTable) str(field string) string {
+	s, _ := t.fields[field].(string)
+	return s
+}
+
+// ParseFingerprints reads the table.insert(fingerprints, {...}) entries of
+// http-fingerprints.lua. The entries that can't be parsed are skipped.
+func ParseFingerprints(r io.Reader) ([]Fingerprint, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprints []Fingerprint
+	p := &luaParser{s: string(data)}
+	for _, loc := range fingerprintRe.FindAllStringIndex(p.s, -1) {
+		p.i = loc[1]
+		p.skip()
+		if p.i >= len(p.s) || p.s[p.i] != '{' {
+			continue
+		}
+		t, err := p.table()
+		if err != nil {
+			slog.Warn("Skipping fingerprint", "error", err)
+			continue
+		}
+
+		f := Fingerprint{Category: t.str("category")}
+		for _, probe := range t.tables("probes") {
+			if path := probe.str("path"); path != "" {
+				f.Paths = append(f.Paths, path)
+			}
+		}
+		for _, match := range t.tables("matches") {
+			f.Matches = append(f.Matches, FingerprintMatch{Match: match.str("match"), Output: match.str("output")})
+		}
+		fingerprints = append(fingerprints, f)
+	}
+	return fingerprints, nil
+}
+
+// luaClasses are the Lua character classes, as regex class contents
+var luaClasses = map[byte]string{
+	'a': `A-Za-z`,
+	'c': `\x00-\x1f\x7f`,
+	'd': `0-9`,
+	'l': `a-z`,
+	'p': `!-/:-@\[-` + "`" + `{-~`,
+	's': `\s`,
+	'u': `A-Z`,
+	'w': `A-Za-z0-9`,
+	'x': `0-9A-Fa-f`,
+}
+
+// luaPattern converts a Lua pattern into a regex. It returns false for
+// the Lua pattern items without a regex equivalent (%b, %f, position
+// captures).
+func luaPattern(pattern string) (string, bool) {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '%':
+			if i+1 >= len(pattern) {
+				return "", false
+			}
+			i++
+			d := pattern[i]
+			lower := d | 0x20
+			if class, ok := luaClasses[lower]; ok && d >= 'A' && d <= 'z' {
+				switch {
+				case inClass && d == lower:
+					b.WriteString(class)
+				case inClass:
+					// A negated class inside a set has no regex equivalent
+					return "", false
+				case d == lower:
+					b.WriteString("[" + class + "]")
+				default:
+					b.WriteString("[^" + class + "]")
+				}
+				continue
+			}
+			if d == 'b' || d == 'f' || d >= '0' && d <= '9' {
+				return "", false
+			}
+			b.WriteString(regexp.QuoteMeta(string(d)))
+		case inClass:
+			if c == ']' {
+				inClass = false
+			} else if c == '\\' || c == '[' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		case c == '[':
+			inClass = true
+			b.WriteByte(c)
+			if strings.HasPrefix(pattern[i+1:], "^") {
+				b.WriteByte('^')
+				i++
+			}
+		case c == '-':
+			b.WriteString("*?")
+		case c == '^' && i > 0, c == '$' && i < len(pattern)-1:
+			b.WriteString(`\` + string(c))
+		case c == '(' && strings.HasPrefix(pattern[i+1:], ")"):
+			return "", false
+		case strings.ContainsRune(`\{}|`, rune(c)):
+			b.WriteString(`\` + string(c))
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if inClass {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// outputName returns the object name of a match output, cut before the
+// first reference to a capture (Apache Tomcat (version \1))
+func outputName(output string) string {
+	if i := strings.IndexByte(output, '\\'); i >= 0 {
+		output = output[:i]
+	}
+	output = strings.TrimRight(strings.TrimSpace(output), " ([:,;.-")
+	output = strings.TrimSuffix(output, " version")
+	return strings.TrimRight(output, " ([:,;.-")
+}
+
+// ConvertFingerprints converts http-fingerprints.lua into a ruleset with a
+// group per category (a child of the detect_nmap_http_fingerprints
+// group) and a rule per match output, merging the matches with the same
+// output. The probed paths become URL signatures, the matches header or
+// body patterns.
+func ConvertFingerprints(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	fingerprints, err := ParseFingerprints(r)
+	if err != nil {
+		return nil, err
+	}
+
+	type categoryRules struct {
+		names []string
+		rules map[string]*crowler.DetectionRule
+	}
+	categories := make(map[string]*categoryRules)
+	total, converted := 0, 0
+	for _, f := range fingerprints {
+		category := f.Category
+		if category == "" {
+			category = "general"
+		}
+		for _, m := range f.Matches {
+			total++
+			name := outputName(m.Output)
+			if name == "" {
+				continue
+			}
+			pattern, ok := luaPattern(m.Match)
+			if !ok {
+				continue
+			}
+
+			c, ok := categories[category]
+			if !ok {
+				c = &categoryRules{rules: make(map[string]*crowler.DetectionRule)}
+				categories[category] = c
+			}
+			rule, ok := c.rules[name]
+			if !ok {
+				rule = &crowler.DetectionRule{
+					RuleName:   "detect_" + slug.Make(name),
+					ObjectName: name,
+				}
+				c.rules[name] = rule
+				c.names = append(c.names, name)
+			}
+
+			// The matches are on the status line, the header lines and the
+			// body, an empty match only needs the path to exist
+			if key, value, ok := headerPattern(pattern); ok {
+				rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, key, "(?i)"+value)
+			} else if pattern != "" && !strings.HasPrefix(pattern, "^HTTP") {
+				appendBody(rule, "(?i)"+pattern)
+			}
+			for _, path := range f.Paths {
+				signature := "^" + regexp.QuoteMeta(path)
+				exists := false
+				for _, u := range rule.URLPatterns {
+					exists = exists || u.Signature == signature
+				}
+				if !exists {
+					rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+						Signature:  signature,
+						Confidence: crowler.DefaultConfidence,
+					})
+				}
+			}
+			converted++
+		}
+	}
+	if converted < total {
+		slog.Info("Some matches have no output or use Lua patterns without a regex equivalent",
+			"converted", converted, "total", total)
+	}
+
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+
+	rootGroup := "detect_nmap_http_fingerprints"
+	ruleset := crowler.NewRuleset("detect_nmap_http_fingerprints", "Ruleset to detect web applications with the Nmap http-enum fingerprints.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-nmap-http-fingerprints-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      rootGroup,
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+	ruleNames := slug.NewNamer()
+	for _, category := range names {
+		group := crowler.RuleGroup{
+			GroupName:      rootGroup + "_" + slug.Make(category),
+			ParentGroup:    rootGroup,
+			IsEnabled:      true,
+			Tags:           opts.Taxonomy.Tags(category),
+			DetectionRules: []crowler.DetectionRule{},
+			Category:       category,
+		}
+		c := categories[category]
+		for _, name := range c.names {
+			rule := *c.rules[name]
+			rule.RuleName = ruleNames.Unique(rule.RuleName)
+			opts.PrepareRule(&rule)
+			rule.Tags = group.Tags
+			group.DetectionRules = append(group.DetectionRules, rule)
+		}
+		ruleset.RuleGroups = append(ruleset.RuleGroups, group)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
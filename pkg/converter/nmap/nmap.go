@@ -0,0 +1,149 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nmap converts the Nmap HTTP fingerprints into CROWler detection
+// rules: the match and softmatch lines of nmap-service-probes on HTTP
+// responses, with their CPE, and the http-fingerprints.lua database of
+// the http-enum script.
+package nmap
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Nmap fingerprints"
+	// DefaultSourceLicense is the license of the Nmap data files
+	DefaultSourceLicense = "LicenseRef-Nmap"
+)
+
+// headerLineRe matches a header line at the start of a pattern (Server: )
+var headerLineRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*):(?: |\\s\*|\\s\+|\\x20)?`)
+
+// headerPattern splits a pattern matching a header line into the header
+// name and the value pattern. It returns false if the pattern doesn't
+// start with a header name or has no value pattern.
+func headerPattern(pattern string) (string, string, bool) {
+	m := headerLineRe.FindStringSubmatch(pattern)
+	if m == nil || len(pattern) == len(m[0]) {
+		return "", "", false
+	}
+	return m[1], pattern[len(m[0]):], true
+}
+
+// cpe23 converts a CPE 2.2 URI (cpe:/a:apache:http_server:$1) to the CPE
+// 2.3 format of the CROWler rules, the parts filled in from the match
+// (with a $) become wildcards
+func cpe23(uri string) string {
+	parts := strings.Split(strings.TrimPrefix(uri, "cpe:/"), ":")
+	fields := make([]string, 11)
+	for i := range fields {
+		fields[i] = "*"
+		if i < len(parts) && parts[i] != "" && !strings.Contains(parts[i], "$") {
+			fields[i] = parts[i]
+		}
+	}
+	return "cpe:2.3:" + strings.Join(fields, ":")
+}
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(fields []crowler.HTTPHeaderField, key, pattern string) []crowler.HTTPHeaderField {
+	for i := range fields {
+		if strings.EqualFold(fields[i].Key, key) {
+			for _, v := range fields[i].Value {
+				if v == pattern {
+					return fields
+				}
+			}
+			fields[i].Value = append(fields[i].Value, pattern)
+			return fields
+		}
+	}
+	return append(fields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// appendBody adds a pattern to the body signature of a rule
+func appendBody(rule *crowler.DetectionRule, pattern string) {
+	for i := range rule.PageContentPatterns {
+		p := &rule.PageContentPatterns[i]
+		if p.Key != "body" {
+			continue
+		}
+		for _, v := range p.Signature {
+			if v == pattern {
+				return
+			}
+		}
+		p.Signature = append(p.Signature, pattern)
+		return
+	}
+	rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+		Key:        "body",
+		Signature:  []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+func init() {
+	converter.Register(nmapConverter{})
+}
+
+// nmapConverter is the registered Nmap converter
+type nmapConverter struct{}
+
+func (nmapConverter) Name() string { return "nmap" }
+
+func (nmapConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert the Nmap nmap-service-probes or http-fingerprints.lua HTTP fingerprints",
+		Input:          "Path to the nmap-service-probes or http-fingerprints.lua file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+var (
+	// probeLineRe matches a match line of nmap-service-probes
+	probeLineRe = regexp.MustCompile(`(?m)^(match|softmatch) \S+ m\S`)
+	// fingerprintRe matches an entry of http-fingerprints.lua
+	fingerprintRe = regexp.MustCompile(`table\.insert\(\s*fingerprints\s*,`)
+)
+
+// Detect recognizes nmap-service-probes and http-fingerprints.lua
+func (nmapConverter) Detect(input []byte) bool {
+	return probeLineRe.Match(input) || fingerprintRe.Match(input)
+}
+
+func (nmapConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	input, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if fingerprintRe.Match(input) {
+		return ConvertFingerprints(bytes.NewReader(input), opts)
+	}
+	return ConvertProbes(bytes.NewReader(input), opts)
+}
@@ -0,0 +1,402 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// Match is a match or softmatch line of nmap-service-probes
+type Match struct {
+	Soft    bool
+	Service string
+	// Pattern is the PCRE matching the response, Flags its s and i
+	// options
+	Pattern string
+	Flags   string
+	// Product, Version and Info are the p/, v/ and i/ fields, they can
+	// refer to the groups of the pattern ($1)
+	Product string
+	Version string
+	Info    string
+	CPE     []string
+	Line    int
+}
+
+// parseMatch parses the arguments of a match line: the service, the
+// pattern (m|regex|si) and the version fields (p/product/ cpe:/.../a)
+func parseMatch(args string) (Match, error) {
+	var m Match
+	service, rest, ok := strings.Cut(args, " ")
+	if !ok || !strings.HasPrefix(rest, "m") || len(rest) < 2 {
+		return m, fmt.Errorf("expected service and pattern")
+	}
+	m.Service = service
+
+	delim := rest[1]
+	end := strings.IndexByte(rest[2:], delim)
+	if end < 0 {
+		return m, fmt.Errorf("unterminated pattern")
+	}
+	m.Pattern = rest[2 : 2+end]
+	rest = rest[2+end+1:]
+	for len(rest) > 0 && (rest[0] == 's' || rest[0] == 'i') {
+		m.Flags += rest[:1]
+		rest = rest[1:]
+	}
+
+	for {
+		rest = strings.TrimLeft(rest, " \t")
+		if rest == "" {
+			return m, nil
+		}
+		var name string
+		if strings.HasPrefix(rest, "cpe:") {
+			name, rest = "cpe", rest[4:]
+		} else {
+			name, rest = rest[:1], rest[1:]
+		}
+		if rest == "" {
+			return m, fmt.Errorf("missing value of field %s", name)
+		}
+		delim := rest[0]
+		end := strings.IndexByte(rest[1:], delim)
+		if end < 0 {
+			return m, fmt.Errorf("unterminated field %s", name)
+		}
+		value := rest[1 : 1+end]
+		rest = rest[1+end+1:]
+		switch name {
+		case "p":
+			m.Product = value
+		case "v":
+			m.Version = value
+		case "i":
+			m.Info = value
+		case "cpe":
+			m.CPE = append(m.CPE, "cpe:/"+value)
+			// The a flag marks the CPE as filled in from the match
+			rest = strings.TrimPrefix(rest, "a")
+		}
+	}
+}
+
+// httpServiceRe matches the services of the HTTP matches
+var httpServiceRe = regexp.MustCompile(`^(ssl/)?https?(-[a-z-]+)?$`)
+
+// ParseProbes reads the match and softmatch lines of the HTTP services
+// from an nmap-service-probes file
+func ParseProbes(r io.Reader) ([]Match, error) {
+	var matches []Match
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		directive, args, _ := strings.Cut(scanner.Text(), " ")
+		if directive != "match" && directive != "softmatch" {
+			continue
+		}
+		m, err := parseMatch(args)
+		if err != nil {
+			slog.Warn("Skipping line", "line", line, "error", err)
+			continue
+		}
+		if !httpServiceRe.MatchString(m.Service) {
+			continue
+		}
+		m.Soft = directive == "softmatch"
+		m.Line = line
+		matches = append(matches, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	return matches, nil
+}
+
+// splitLines splits a pattern at the \r\n outside of groups and classes:
+// the status line, the header lines and the body
+func splitLines(pattern string) []string {
+	var lines []string
+	start, depth, inClass := 0, 0, false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			if !inClass && depth == 0 && strings.HasPrefix(pattern[i:], `\r\n`) {
+				lines = append(lines, pattern[start:i])
+				start = i + 4
+				i += 3
+				continue
+			}
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			if strings.HasPrefix(pattern[i+1:], "]") || strings.HasPrefix(pattern[i+1:], "^]") {
+				i += strings.Index(pattern[i:], "]")
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		}
+	}
+	return append(lines, pattern[start:])
+}
+
+// statusLineEnd returns the index of the first .* outside of groups and
+// classes of the status line pattern, where what follows the status line
+// (headers or body) starts, or -1
+func statusLineEnd(line string) int {
+	depth, inClass := 0, false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			if strings.HasPrefix(line[i+1:], "]") || strings.HasPrefix(line[i+1:], "^]") {
+				i += strings.Index(line[i:], "]")
+			}
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '.' && depth == 0 && strings.HasPrefix(line[i+1:], "*"):
+			return i
+		}
+	}
+	return -1
+}
+
+// groupCount returns the number of capturing groups of a pattern
+func groupCount(pattern string) (int, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+	return re.MaxCap(), nil
+}
+
+// dollarRe matches the references to the groups of the pattern in the
+// version fields
+var dollarRe = regexp.MustCompile(`\$(\d)`)
+
+// localVersion returns the version of a CROWler version pattern, the
+// references to the groups first+1... of the match pattern numbered from
+// \1. It returns false if version refers to the groups of other parts.
+func localVersion(version string, first, count int) (string, bool) {
+	if !dollarRe.MatchString(version) {
+		return "", false
+	}
+	ok := true
+	local := dollarRe.ReplaceAllStringFunc(version, func(ref string) string {
+		n, _ := strconv.Atoi(ref[1:])
+		if n <= first || n > first+count {
+			ok = false
+		}
+		return fmt.Sprintf(`\%d`, n-first)
+	})
+	return local, ok
+}
+
+// leadingAnyRe matches the .* starting the parts of a pattern spanning
+// several lines
+var leadingAnyRe = regexp.MustCompile(`^(\.\*\??|\^)`)
+
+// addMatch adds the signatures of a match to rule: the header lines of
+// the pattern become header fields, the rest (after an empty line or a
+// .* spanning the headers) body patterns. The status line is dropped,
+// but for what follows a .* on it. It returns false if nothing is left.
+func addMatch(rule *crowler.DetectionRule, m Match) bool {
+	flags := ""
+	if m.Flags != "" {
+		flags = "(?" + m.Flags + ")"
+	}
+	if _, err := regexp.Compile(flags + m.Pattern); err != nil {
+		slog.Debug("Skipping match, its regex isn't supported", "line", m.Line, "error", err)
+		return false
+	}
+
+	// Each part of the pattern matches a line, numbering its groups from
+	// the count of the parts before it
+	type part struct {
+		pattern string
+		section string
+		key     string
+		first   int
+	}
+	var parts []part
+	lines := splitLines(m.Pattern)
+	groups := 0
+	inBody := false
+	for i, line := range lines {
+		count, err := groupCount(line)
+		if err != nil {
+			return false
+		}
+		first := groups
+		groups += count
+
+		if inBody {
+			parts[len(parts)-1].pattern += `\r\n` + line
+			continue
+		}
+		if line == "" {
+			if i+1 < len(lines) {
+				// An empty line ends the headers, the rest is the body
+				inBody = true
+				parts = append(parts, part{section: "page_content_patterns", key: "body", first: groups})
+			}
+			continue
+		}
+		if i == 0 && strings.HasPrefix(line, "^HTTP") {
+			// A .* on the status line spans the headers, e.g.
+			// ^HTTP/1\.[01] \d\d\d .*<title>Jenkins</title>
+			end := statusLineEnd(line)
+			if end < 0 {
+				continue
+			}
+			count, err := groupCount(line[:end])
+			if err != nil {
+				return false
+			}
+			first += count
+			line = line[end:]
+		}
+		trimmed := leadingAnyRe.ReplaceAllString(line, "")
+		if key, value, ok := headerPattern(trimmed); ok {
+			parts = append(parts, part{pattern: value, section: "http_header_fields", key: key, first: first})
+		} else if trimmed != line {
+			// .* spanning the headers, the rest can be in the body
+			parts = append(parts, part{pattern: trimmed, section: "page_content_patterns", key: "body", first: first})
+		}
+	}
+
+	added := false
+	for _, p := range parts {
+		p.pattern = leadingAnyRe.ReplaceAllString(p.pattern, "")
+		if p.pattern == "" {
+			continue
+		}
+		count, err := groupCount(p.pattern)
+		if err != nil {
+			continue
+		}
+		if p.section == "http_header_fields" {
+			rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, p.key, flags+p.pattern)
+		} else {
+			appendBody(rule, flags+p.pattern)
+		}
+		added = true
+		if version, ok := localVersion(m.Version, p.first, count); ok {
+			rule.Version = append(rule.Version, crowler.VersionSignature{
+				Section: p.section,
+				Key:     p.key,
+				Pattern: flags + p.pattern,
+				Version: version,
+			})
+		}
+	}
+	return added
+}
+
+// ConvertProbes converts the HTTP matches of an nmap-service-probes file
+// into a ruleset with a rule per product, merging its matches. The
+// matches without a product (most softmatches) or whose product comes
+// from the response are skipped.
+func ConvertProbes(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	matches, err := ParseProbes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make(map[string]*crowler.DetectionRule)
+	converted := 0
+	for _, m := range matches {
+		if m.Product == "" || strings.Contains(m.Product, "$") {
+			continue
+		}
+		rule, ok := rules[m.Product]
+		if !ok {
+			rule = &crowler.DetectionRule{
+				RuleName:   "detect_" + slug.Make(m.Product),
+				ObjectName: m.Product,
+			}
+		}
+		if !addMatch(rule, m) {
+			continue
+		}
+		converted++
+		rules[m.Product] = rule
+		if rule.CPE == "" {
+			for _, uri := range m.CPE {
+				if strings.HasPrefix(uri, "cpe:/a:") {
+					rule.CPE = cpe23(uri)
+					break
+				}
+			}
+		}
+	}
+	if converted < len(matches) {
+		slog.Info("Some HTTP matches have no product or only match the status line",
+			"converted", converted, "total", len(matches))
+	}
+
+	products := make([]string, 0, len(rules))
+	for product := range rules {
+		products = append(products, product)
+	}
+	sort.Strings(products)
+
+	ruleset := crowler.NewRuleset("detect_nmap_services", "Ruleset to detect HTTP servers and applications with the Nmap service probes.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-nmap-services-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_nmap_http_services",
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+	ruleNames := slug.NewNamer()
+	for _, product := range products {
+		rule := *rules[product]
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nmap
+
+import (
+	"reflect"
+	"testing"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+func TestAddMatchSingleLine(t *testing.T) {
+	var rule crowler.DetectionRule
+	m := Match{
+		Service: "http",
+		Pattern: `^HTTP/1\.[01] (\d\d\d) .*<title>Jenkins ([\d.]+)</title>`,
+		Product: "Jenkins",
+		Version: "$2",
+	}
+	if !addMatch(&rule, m) {
+		t.Fatalf("addMatch(%q) added no signature", m.Pattern)
+	}
+	var body []string
+	for _, p := range rule.PageContentPatterns {
+		body = append(body, p.Signature...)
+	}
+	if want := []string{`<title>Jenkins ([\d.]+)</title>`}; !reflect.DeepEqual(body, want) {
+		t.Errorf("body patterns = %q, want %q", body, want)
+	}
+	want := []crowler.VersionSignature{{
+		Section: "page_content_patterns",
+		Key:     "body",
+		Pattern: `<title>Jenkins ([\d.]+)</title>`,
+		Version: `\1`,
+	}}
+	if !reflect.DeepEqual(rule.Version, want) {
+		t.Errorf("version = %+v, want %+v", rule.Version, want)
+	}
+}
+
+func TestAddMatchStatusLineOnly(t *testing.T) {
+	var rule crowler.DetectionRule
+	if addMatch(&rule, Match{Service: "http", Pattern: `^HTTP/1\.[01] \d\d\d`}) {
+		t.Errorf("addMatch of a status line added %+v", rule)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nuclei
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// call is a request of a template, from its path or raw sections
+type call struct {
+	method string
+	path   string
+	body   string
+}
+
+// calls returns the requests of req, their {{name}} placeholders
+// replaced with values. The paths are relative to the site.
+func calls(req HTTPRequest, values map[string]string) []call {
+	var calls []call
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = "GET"
+	}
+	for _, path := range req.Path {
+		calls = append(calls, call{method: method, path: path, body: req.Body})
+	}
+	for _, raw := range req.Raw {
+		// The request line, the headers, then the body after an empty line
+		raw = strings.ReplaceAll(strings.TrimLeft(raw, " \t\r\n"), "\r\n", "\n")
+		head, body, _ := strings.Cut(raw, "\n\n")
+		line, _, _ := strings.Cut(head, "\n")
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			calls = append(calls, call{method: strings.ToUpper(fields[0]), path: fields[1], body: strings.TrimSpace(body)})
+		}
+	}
+	for i := range calls {
+		path := strings.TrimPrefix(strings.TrimPrefix(calls[i].path, "{{BaseURL}}"), "{{RootURL}}")
+		if path = substitute(path, values); path == "" {
+			path = "/"
+		}
+		calls[i].path = path
+	}
+	return calls
+}
+
+// placeholders returns the values of the {{name}} placeholders of req:
+// the template variables and the first value of each payload
+func placeholders(t Template, req HTTPRequest) map[string]string {
+	values := make(map[string]string)
+	for name, v := range t.Variables {
+		if s, ok := v.(string); ok {
+			values[name] = s
+		}
+	}
+	for name, v := range req.Payloads {
+		// A payload given as a string is a word list file
+		if list, ok := v.([]any); ok && len(list) > 0 {
+			values[name] = fmt.Sprint(list[0])
+		}
+	}
+	return values
+}
+
+// substitute replaces the {{name}} placeholders of s with their values
+func substitute(s string, values map[string]string) string {
+	for name, value := range values {
+		s = strings.ReplaceAll(s, "{{"+name+"}}", value)
+	}
+	return s
+}
+
+// formFields returns the fields of a form encoded body in their order.
+// It returns false if body isn't form encoded (JSON, XML...).
+func formFields(body string) ([][2]string, bool) {
+	if body == "" || strings.ContainsAny(body[:1], "{[<") {
+		return nil, false
+	}
+	var fields [][2]string
+	for _, pair := range strings.Split(body, "&") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, false
+		}
+		key, err := url.QueryUnescape(key)
+		if err != nil || key == "" {
+			return nil, false
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, false
+		}
+		fields = append(fields, [2]string{key, value})
+	}
+	return fields, true
+}
+
+// jsString returns s as a JavaScript string literal
+func jsString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// assertion returns the JavaScript expression checking the word and
+// regex matchers of req on the page, empty if it has none. The other
+// matchers (status, headers, dsl) can't be checked from the page.
+func assertion(req HTTPRequest) string {
+	var checks []string
+	for _, m := range req.Matchers {
+		if !bodyParts[strings.ToLower(m.Part)] {
+			continue
+		}
+		var tests []string
+		switch m.Type {
+		case "word":
+			for _, w := range m.Words {
+				if m.CaseInsensitive {
+					tests = append(tests, fmt.Sprintf("html.toLowerCase().includes(%s)", jsString(strings.ToLower(w))))
+				} else {
+					tests = append(tests, fmt.Sprintf("html.includes(%s)", jsString(w)))
+				}
+			}
+		case "regex":
+			for _, re := range m.Regex {
+				flags := ""
+				if p, ok := strings.CutPrefix(re, "(?i)"); ok {
+					re, flags = p, "i"
+				}
+				tests = append(tests, fmt.Sprintf("new RegExp(%s, %s).test(html)", jsString(re), jsString(flags)))
+			}
+		}
+		if len(tests) == 0 {
+			continue
+		}
+		op := " || "
+		if strings.EqualFold(m.Condition, "and") {
+			op = " && "
+		}
+		check := strings.Join(tests, op)
+		if len(tests) > 1 {
+			check = "(" + check + ")"
+		}
+		if m.Negative {
+			check = "!" + check
+		}
+		checks = append(checks, check)
+	}
+	if len(checks) == 0 {
+		return ""
+	}
+	op := " || "
+	if strings.EqualFold(req.MatchersCondition, "and") {
+		op = " && "
+	}
+	return "(() => { const html = document.documentElement.outerHTML; return " + strings.Join(checks, op) + "; })()"
+}
+
+// convertActions converts the interactions of a template into action
+// rules, in the order the CROWler performs them:
+//
+//   - a request posting a form encoded body navigates to its path, fills
+//     the fields of the form and clicks its submit button,
+//   - a request of a login panel check (a template tagged login) only
+//     navigates to its path,
+//
+// then the body matchers of the response are asserted with a wait on
+// them. The other templates have no action rules.
+func convertActions(t Template) []crowler.ActionRule {
+	login := slices.ContainsFunc(t.Info.Tags, func(tag string) bool { return strings.EqualFold(tag, "login") })
+	var actions []crowler.ActionRule
+	for _, req := range t.requests() {
+		values := placeholders(t, req)
+		assert := assertion(req)
+		for _, c := range calls(req, values) {
+			if strings.Contains(c.path, "{{") {
+				continue
+			}
+			fields, form := formFields(c.body)
+			form = form && (c.method == "POST" || c.method == "PUT")
+			if !form && (!login || c.method != "GET") {
+				continue
+			}
+
+			name := slug.Make(t.ID)
+			navigate := crowler.ActionRule{
+				RuleName:   name + "_navigate",
+				ActionType: "navigate_to_url",
+				URL:        c.path,
+			}
+			if form {
+				navigate.WaitConditions = []crowler.WaitCondition{{ConditionType: "element_presence", Selector: "form"}}
+			}
+			actions = append(actions, navigate)
+			if form {
+				for _, f := range fields {
+					// The fields without a value, such as the CSRF
+					// tokens, keep the value of the page
+					value := substitute(f[1], values)
+					if strings.Contains(value, "{{") {
+						continue
+					}
+					actions = append(actions, crowler.ActionRule{
+						RuleName:   name + "_fill_" + slug.Make(f[0]),
+						ActionType: "input_text",
+						Selectors:  []crowler.Selector{{SelectorType: "css", Selector: fmt.Sprintf("[name=%q]", f[0])}},
+						Value:      value,
+					})
+				}
+				actions = append(actions, crowler.ActionRule{
+					RuleName:   name + "_submit",
+					ActionType: "click",
+					Selectors:  []crowler.Selector{{SelectorType: "css", Selector: `form [type="submit"]`}},
+				})
+			}
+			if assert != "" {
+				actions = append(actions, crowler.ActionRule{
+					RuleName:       name + "_assert",
+					ActionType:     "wait",
+					WaitConditions: []crowler.WaitCondition{{ConditionType: "custom_js", Value: assert}},
+				})
+			}
+		}
+	}
+	return actions
+}
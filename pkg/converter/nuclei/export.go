@@ -0,0 +1,187 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nuclei
+
+import (
+	"bytes"
+	"fmt"
+	"regexp/syntax"
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severities are the template severities
+var Severities = []string{"info", "low", "medium", "high", "critical", "unknown"}
+
+// ExportOptions holds the settings of the exported templates
+type ExportOptions struct {
+	// Author of the templates
+	Author string
+	// Severity of the templates, the rule severity (if it's a template
+	// severity) or info if empty
+	Severity string
+	// MatchersCondition is or (any signature matches) or and (all the
+	// signatures match)
+	MatchersCondition string
+}
+
+// headerPart returns the matcher part of a header, its lowercase name
+// with underscores
+func headerPart(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "-", "_")
+}
+
+// literalPath returns the path a URL signature matches, if the signature
+// is a path without other regex syntax than escapes (/wp-login\.php)
+func literalPath(signature string) (string, bool) {
+	re, err := syntax.Parse(signature, syntax.Perl)
+	if err != nil || re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	path := string(re.Rune)
+	if !strings.HasPrefix(path, "/") {
+		return "", false
+	}
+	return path, true
+}
+
+// Export converts a CROWler detection rule into a template. The header
+// fields become regex matchers on the header parts, the body patterns
+// regex matchers on the body, the favicon hashes dsl matchers of a
+// request to /favicon.ico, the URL signatures matching a path requested
+// paths and the version patterns regex extractors. It returns false if
+// the rule has none of these signatures.
+func Export(rule crowler.DetectionRule, opts ExportOptions) (Template, bool) {
+	t := Template{
+		ID: slug.File(rule.RuleName),
+		Info: Info{
+			Name:     rule.ObjectName,
+			Author:   tagList{opts.Author},
+			Severity: "info",
+			Tags:     tagList{"tech"},
+		},
+	}
+	t.Info.Classification.CPE = rule.CPE
+	for _, tag := range rule.Tags {
+		if !slices.Contains(t.Info.Tags, tag) {
+			t.Info.Tags = append(t.Info.Tags, tag)
+		}
+	}
+	if rule.Metadata != nil {
+		t.Info.Description = rule.Metadata.Description
+		if severity := strings.ToLower(rule.Metadata.Severity); severity != "" && slices.Contains(Severities, severity) {
+			t.Info.Severity = severity
+		}
+		if rule.Metadata.Website != "" {
+			t.Info.Reference = tagList{rule.Metadata.Website}
+		}
+	}
+	if opts.Severity != "" {
+		t.Info.Severity = opts.Severity
+	}
+
+	page := HTTPRequest{
+		Method:            "GET",
+		Path:              []string{"{{BaseURL}}"},
+		MatchersCondition: opts.MatchersCondition,
+	}
+	for _, h := range rule.HTTPHeaderFields {
+		if len(h.Value) > 0 {
+			page.Matchers = append(page.Matchers, Matcher{Type: "regex", Part: headerPart(h.Key), Regex: h.Value})
+		}
+	}
+	// The cookies are matched in the Set-Cookie header
+	for _, c := range rule.Cookies {
+		h := crowler.CookieHeader(c)
+		page.Matchers = append(page.Matchers, Matcher{Type: "regex", Part: headerPart(h.Key), Regex: h.Value})
+	}
+	favicon := HTTPRequest{
+		Method:            "GET",
+		Path:              []string{"{{BaseURL}}/favicon.ico"},
+		MatchersCondition: "or",
+	}
+	for _, p := range rule.PageContentPatterns {
+		if patterns := append(append([]string{}, p.Signature...), p.Text...); len(patterns) > 0 && (p.Key == "" || p.Key == "body") {
+			page.Matchers = append(page.Matchers, Matcher{Type: "regex", Part: "body", Regex: patterns})
+		}
+		var dsl []string
+		for _, h := range p.MMH3Hash {
+			dsl = append(dsl, fmt.Sprintf(`"%s" == mmh3(base64_py(body))`, h))
+		}
+		for _, h := range p.MD5Hash {
+			dsl = append(dsl, fmt.Sprintf(`"%s" == md5(body)`, h))
+		}
+		for _, h := range p.SHA256Hash {
+			dsl = append(dsl, fmt.Sprintf(`"%s" == sha256(body)`, h))
+		}
+		if len(dsl) > 0 {
+			favicon.Matchers = append(favicon.Matchers, Matcher{Type: "dsl", DSL: dsl})
+		}
+	}
+	for _, u := range rule.URLPatterns {
+		if path, ok := literalPath(u.Signature); ok {
+			page.Path = append(page.Path, "{{BaseURL}}"+path)
+		}
+	}
+	for _, v := range rule.Version {
+		var group int
+		if _, err := fmt.Sscanf(v.Version, `\%d`, &group); err != nil {
+			continue
+		}
+		e := Extractor{Type: "regex", Regex: []string{v.Pattern}, Group: group}
+		switch v.Section {
+		case "http_header_fields":
+			e.Part = headerPart(v.Key)
+		case "page_content_patterns":
+			e.Part = "body"
+		default:
+			continue
+		}
+		page.Extractors = append(page.Extractors, e)
+	}
+
+	if len(page.Matchers) > 0 {
+		if len(page.Matchers) < 2 {
+			page.MatchersCondition = ""
+		}
+		t.HTTP = append(t.HTTP, page)
+	}
+	if len(favicon.Matchers) > 0 {
+		if len(favicon.Matchers) < 2 {
+			favicon.MatchersCondition = ""
+		}
+		t.HTTP = append(t.HTTP, favicon)
+	}
+	return t, len(t.HTTP) > 0
+}
+
+// MarshalTemplate encodes a template to YAML
+func MarshalTemplate(t Template) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(t); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
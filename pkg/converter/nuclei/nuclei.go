@@ -0,0 +1,486 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package nuclei converts the Nuclei technology detection templates into
+// CROWler detection rules: the http matchers on words and regexes become
+// header and page content signatures, the favicon hashes of the dsl
+// matchers favicon signatures and the regex extractors version patterns.
+// The templates posting a form or checking a login panel also become
+// action rules replaying the interaction in the browser.
+package nuclei
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Nuclei templates"
+	// DefaultSourceLicense is the license of the nuclei-templates
+	// repository
+	DefaultSourceLicense = "MIT"
+)
+
+// severityConfidence is the confidence of the signatures of a template
+// with a severity. The info templates, which are most of the technology
+// detection ones, keep the default confidence.
+var severityConfidence = map[string]float32{
+	"critical": 10,
+	"high":     10,
+	"medium":   8,
+	"low":      6,
+}
+
+// bodyParts are the matcher parts holding the response body, the other
+// parts but header and status_code name a header
+var bodyParts = map[string]bool{
+	"":         true,
+	"body":     true,
+	"all":      true,
+	"response": true,
+	"raw":      true,
+}
+
+// skippedParts are the matcher parts without a CROWler signature
+var skippedParts = map[string]bool{
+	"status_code":         true,
+	"content_length":      true,
+	"duration":            true,
+	"interactsh_protocol": true,
+	"interactsh_request":  true,
+	"request":             true,
+}
+
+var (
+	// headerLineRe matches a header line in the words and regexes of the
+	// header part (Server: Apache)
+	headerLineRe = regexp.MustCompile(`^([A-Za-z0-9-]+):\s*(.*)$`)
+	// mmh3Res and md5Res match the favicon hash comparisons of the dsl
+	// matchers, the hash on either side
+	mmh3Res = []*regexp.Regexp{
+		regexp.MustCompile(`mmh3\(base64_py\(body\)\)\s*==\s*["']?(-?\d+)`),
+		regexp.MustCompile(`["']?(-?\d+)["']?\s*==\s*mmh3\(base64_py\(body\)\)`),
+	}
+	md5Res = []*regexp.Regexp{
+		regexp.MustCompile(`md5\(body\)\s*==\s*["']([0-9A-Fa-f]{32})["']`),
+		regexp.MustCompile(`["']([0-9A-Fa-f]{32})["']\s*==\s*md5\(body\)`),
+	}
+	// detectionSuffixRe matches the suffix of the template names
+	// (Apache Detection, Jenkins - Detect)
+	detectionSuffixRe = regexp.MustCompile(`(?i)\s*-?\s*(detection|detect)$`)
+)
+
+// headerPattern splits a word or regex of the header part into the header
+// name and the value pattern. It returns false if the pattern doesn't
+// start with a header name.
+func headerPattern(pattern string, isRegex bool) (string, string, bool) {
+	flags := ""
+	if isRegex {
+		// The multiline flag only matters to the header lines
+		for _, f := range []string{"(?i)", "(?m)", "(?mi)", "(?im)"} {
+			if strings.HasPrefix(pattern, f) {
+				pattern = pattern[len(f):]
+				if strings.Contains(f, "i") {
+					flags = "(?i)"
+				}
+				break
+			}
+		}
+		pattern = strings.TrimPrefix(pattern, "^")
+	}
+	m := headerLineRe.FindStringSubmatch(pattern)
+	if m == nil || m[2] == "" {
+		return "", "", false
+	}
+	value := m[2]
+	if !isRegex {
+		value = regexp.QuoteMeta(value)
+	}
+	return m[1], flags + value, true
+}
+
+// faviconHashes returns the mmh3 and md5 hashes compared in dsl
+func faviconHashes(dsl []string) ([]string, []string) {
+	var mmh3, md5 []string
+	for _, expr := range dsl {
+		for _, re := range mmh3Res {
+			for _, m := range re.FindAllStringSubmatch(expr, -1) {
+				if !slices.Contains(mmh3, m[1]) {
+					mmh3 = append(mmh3, m[1])
+				}
+			}
+		}
+		for _, re := range md5Res {
+			for _, m := range re.FindAllStringSubmatch(expr, -1) {
+				if h := strings.ToLower(m[1]); !slices.Contains(md5, h) {
+					md5 = append(md5, h)
+				}
+			}
+		}
+	}
+	return mmh3, md5
+}
+
+// addMatcher adds the signatures of a matcher to rule. It returns false
+// if the matcher can't be expressed as CROWler signatures: negative
+// matchers, status codes, other dsl expressions than favicon hashes...
+func addMatcher(rule *crowler.DetectionRule, m Matcher) bool {
+	if m.Negative {
+		return false
+	}
+
+	part := strings.ToLower(m.Part)
+	var patterns []string
+	isRegex := false
+	switch m.Type {
+	case "word":
+		patterns = m.Words
+	case "regex":
+		patterns, isRegex = m.Regex, true
+	case "dsl":
+		mmh3, md5 := faviconHashes(m.DSL)
+		if len(mmh3) == 0 && len(md5) == 0 {
+			return false
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			MD5Hash:    md5,
+			MMH3Hash:   mmh3,
+			Confidence: crowler.DefaultConfidence,
+		})
+		return true
+	default:
+		return false
+	}
+	if len(patterns) == 0 || skippedParts[part] {
+		return false
+	}
+
+	added := false
+	switch {
+	case bodyParts[part]:
+		var values []string
+		for _, p := range patterns {
+			if !isRegex {
+				p = regexp.QuoteMeta(p)
+				if m.CaseInsensitive {
+					p = "(?i)" + p
+				}
+			}
+			values = append(values, p)
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Signature:  values,
+			Confidence: crowler.DefaultConfidence,
+		})
+		added = true
+	case part == "header":
+		// The words and regexes of the header part match the header
+		// lines, only the ones naming the header can be converted
+		for _, p := range patterns {
+			key, value, ok := headerPattern(p, isRegex)
+			if !ok {
+				continue
+			}
+			if !isRegex && m.CaseInsensitive {
+				value = "(?i)" + value
+			}
+			rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, key, value)
+			added = true
+		}
+	default:
+		// The other parts are the headers, by name (x_powered_by)
+		key := strings.ReplaceAll(part, "_", "-")
+		for _, p := range patterns {
+			if !isRegex {
+				p = regexp.QuoteMeta(p)
+				if m.CaseInsensitive {
+					p = "(?i)" + p
+				}
+			}
+			rule.HTTPHeaderFields = appendHeader(rule.HTTPHeaderFields, key, p)
+		}
+		added = true
+	}
+	return added
+}
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(fields []crowler.HTTPHeaderField, key, pattern string) []crowler.HTTPHeaderField {
+	for i := range fields {
+		if strings.EqualFold(fields[i].Key, key) {
+			if !slices.Contains(fields[i].Value, pattern) {
+				fields[i].Value = append(fields[i].Value, pattern)
+			}
+			return fields
+		}
+	}
+	return append(fields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addPaths adds the paths the template requests, but the home page and the
+// favicon, as URL signatures: the technology serves these pages
+func addPaths(rule *crowler.DetectionRule, paths []string) {
+	for _, path := range paths {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "{{BaseURL}}"), "{{RootURL}}")
+		if path == "" || path == "/" || path == "/favicon.ico" || strings.Contains(path, "{{") {
+			continue
+		}
+		pattern := regexp.QuoteMeta(path)
+		if !slices.ContainsFunc(rule.URLPatterns, func(p crowler.URLMicroSignature) bool { return p.Signature == pattern }) {
+			rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+				Signature:  pattern,
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+}
+
+// addExtractors adds the regex extractors capturing a group as version
+// patterns
+func addExtractors(rule *crowler.DetectionRule, extractors []Extractor) {
+	for _, e := range extractors {
+		if e.Type != "regex" || e.Group < 1 {
+			continue
+		}
+		part := strings.ToLower(e.Part)
+		version := fmt.Sprintf(`\%d`, e.Group)
+		for _, p := range e.Regex {
+			switch {
+			case bodyParts[part]:
+				rule.Version = append(rule.Version, crowler.VersionSignature{
+					Section: "page_content_patterns",
+					Key:     "body",
+					Pattern: p,
+					Version: version,
+				})
+			case part == "header":
+				if key, value, ok := headerPattern(p, true); ok {
+					rule.Version = append(rule.Version, crowler.VersionSignature{
+						Section: "http_header_fields",
+						Key:     key,
+						Pattern: value,
+						Version: version,
+					})
+				}
+			case !skippedParts[part]:
+				rule.Version = append(rule.Version, crowler.VersionSignature{
+					Section: "http_header_fields",
+					Key:     strings.ReplaceAll(part, "_", "-"),
+					Pattern: p,
+					Version: version,
+				})
+			}
+		}
+	}
+}
+
+// objectName returns the detected object of a template, its name without
+// the Detection suffix
+func objectName(t Template) string {
+	name := strings.TrimSpace(detectionSuffixRe.ReplaceAllString(t.Info.Name, ""))
+	if name == "" {
+		return t.ID
+	}
+	return name
+}
+
+// newRule returns a rule with the description of the template
+func newRule(name, objectName string, t Template) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: objectName,
+		CPE:        t.Info.Classification.CPE,
+	}
+	if t.Info.Description != "" || t.Info.Severity != "" || len(t.Info.Tags) > 0 {
+		rule.Metadata = &crowler.RuleMetadata{
+			Description: strings.TrimSpace(t.Info.Description),
+			Severity:    strings.ToUpper(t.Info.Severity),
+			Tags:        t.Info.Tags,
+		}
+	}
+	return rule
+}
+
+// convertTemplate converts a template into detection rules: a rule per
+// named matcher for the templates detecting several technologies with
+// any of their matchers (as the favicon detection template does),
+// otherwise a single rule with the signatures of all the matchers. The
+// matchers that must all match just add up their signatures, as the
+// CROWler signatures do.
+func convertTemplate(t Template) []crowler.DetectionRule {
+	var rules []crowler.DetectionRule
+	for _, req := range t.requests() {
+		named := !strings.EqualFold(req.MatchersCondition, "and")
+		for _, m := range req.Matchers {
+			named = named && m.Name != ""
+		}
+		if named && len(req.Matchers) > 1 {
+			for _, m := range req.Matchers {
+				rule := newRule(t.ID+"_"+m.Name, m.Name, t)
+				if addMatcher(&rule, m) {
+					rules = append(rules, rule)
+				}
+			}
+			continue
+		}
+
+		rule := newRule(t.ID, objectName(t), t)
+		converted := false
+		for _, m := range req.Matchers {
+			if addMatcher(&rule, m) {
+				converted = true
+			}
+		}
+		if !converted {
+			continue
+		}
+		addPaths(&rule, req.Path)
+		addExtractors(&rule, req.Extractors)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// templateResult are the detection and action rules of a template
+type templateResult struct {
+	rules   []crowler.DetectionRule
+	actions []crowler.ActionRule
+}
+
+// Convert converts the Nuclei templates read from r, a YAML stream with
+// one or more templates, into a ruleset
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	templates, err := ParseTemplates(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing templates: %v", err)
+	}
+
+	ruleset := crowler.NewRuleset("detect_nuclei_technologies", "Ruleset to detect technologies with the Nuclei templates.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-nuclei-technologies-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_nuclei_technologies",
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	// Convert the templates with the workers, then name the rules in the
+	// order of the templates
+	results := converter.Map(opts.Workers, templates, func(t Template) templateResult {
+		defer opts.Processed(1)
+		rules := convertTemplate(t)
+		for i := range rules {
+			opts.PrepareRule(&rules[i])
+			// The severity gives the confidence, unless a confidence
+			// profile scores the signatures by their type
+			if confidence, ok := severityConfidence[strings.ToLower(t.Info.Severity)]; ok && opts.ConfidenceProfile == nil {
+				crowler.SetConfidence(&rules[i], confidence)
+			}
+		}
+		return templateResult{rules: rules, actions: convertActions(t)}
+	})
+
+	ruleNames := slug.NewNamer()
+	converted := 0
+	for _, result := range results {
+		if len(result.rules) == 0 && len(result.actions) == 0 {
+			continue
+		}
+		converted++
+		for _, rule := range result.rules {
+			rule.RuleName = ruleNames.Unique(rule.RuleName)
+			ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+		}
+		for _, action := range result.actions {
+			action.RuleName = ruleNames.Unique(action.RuleName)
+			ruleset.RuleGroups[0].ActionRules = append(ruleset.RuleGroups[0].ActionRules, action)
+		}
+	}
+
+	if converted < len(templates) {
+		slog.Info("Some templates only have matchers the CROWler rules can't express",
+			"converted", converted, "total", len(templates))
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(nucleiConverter{})
+}
+
+// nucleiConverter is the registered Nuclei converter
+type nucleiConverter struct{}
+
+func (nucleiConverter) Name() string { return "nuclei" }
+
+func (nucleiConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert Nuclei technology detection templates",
+		Input:          "Path to a Nuclei template, or to a directory of templates",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a YAML stream with a template: an id, an info section
+// and http requests
+func (nucleiConverter) Detect(input []byte) bool {
+	id, info, requests := false, false, false
+	scanner := bufio.NewScanner(strings.NewReader(string(input)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id:"):
+			id = true
+		case strings.HasPrefix(line, "info:"):
+			info = true
+		case strings.HasPrefix(line, "http:"), strings.HasPrefix(line, "requests:"):
+			requests = true
+		}
+		if id && info && requests {
+			return true
+		}
+	}
+	return false
+}
+
+func (nucleiConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (nucleiConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
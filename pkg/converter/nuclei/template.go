@@ -0,0 +1,239 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nuclei
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is the part of a Nuclei template the converter reads, and
+// writes when exporting rules
+type Template struct {
+	ID   string        `yaml:"id"`
+	Info Info          `yaml:"info"`
+	HTTP []HTTPRequest `yaml:"http,omitempty"`
+	// Requests is the name of the http section in the older templates
+	Requests []HTTPRequest `yaml:"requests,omitempty"`
+	// Variables are the values of the {{name}} placeholders of the
+	// requests
+	Variables map[string]any `yaml:"variables,omitempty"`
+}
+
+// Info describes a template
+type Info struct {
+	Name           string  `yaml:"name"`
+	Author         tagList `yaml:"author,omitempty"`
+	Severity       string  `yaml:"severity,omitempty"`
+	Description    string  `yaml:"description,omitempty"`
+	Tags           tagList `yaml:"tags,omitempty"`
+	Reference      tagList `yaml:"reference,omitempty"`
+	Classification struct {
+		CPE string `yaml:"cpe,omitempty"`
+	} `yaml:"classification,omitempty"`
+}
+
+// HTTPRequest is an http request of a template, with the matchers and
+// extractors applied to its response
+type HTTPRequest struct {
+	Method string   `yaml:"method,omitempty"`
+	Path   []string `yaml:"path"`
+	Body   string   `yaml:"body,omitempty"`
+	// Raw are the requests written as HTTP messages, instead of Method,
+	// Path and Body
+	Raw []string `yaml:"raw,omitempty"`
+	// Payloads are the values tried for the {{name}} placeholders of the
+	// requests, e.g. the default credentials
+	Payloads map[string]any `yaml:"payloads,omitempty"`
+	// MatchersCondition tells if all the matchers (and) or any of them
+	// (or, the default) must match
+	MatchersCondition string      `yaml:"matchers-condition,omitempty"`
+	Matchers          []Matcher   `yaml:"matchers,omitempty"`
+	Extractors        []Extractor `yaml:"extractors,omitempty"`
+}
+
+// Matcher is a matcher of an http response
+type Matcher struct {
+	Type string `yaml:"type"`
+	// Name is set on the matchers of the templates detecting several
+	// technologies, such as the favicon detection template
+	Name            string   `yaml:"name,omitempty"`
+	Part            string   `yaml:"part,omitempty"`
+	Words           []string `yaml:"words,omitempty"`
+	Regex           []string `yaml:"regex,omitempty"`
+	DSL             []string `yaml:"dsl,omitempty"`
+	Status          []int    `yaml:"status,omitempty"`
+	Negative        bool     `yaml:"negative,omitempty"`
+	CaseInsensitive bool     `yaml:"case-insensitive,omitempty"`
+	// Condition tells if all the words or regexes (and) or any of them
+	// (or, the default) must match
+	Condition string `yaml:"condition,omitempty"`
+}
+
+// Extractor is an extractor of an http response
+type Extractor struct {
+	Type  string   `yaml:"type"`
+	Part  string   `yaml:"part,omitempty"`
+	Regex []string `yaml:"regex,omitempty"`
+	Group int      `yaml:"group,omitempty"`
+}
+
+// tagList is a list given either as a YAML list or as a comma separated
+// string
+type tagList []string
+
+// MarshalYAML writes the list as a comma separated string, as the
+// templates do
+func (l tagList) MarshalYAML() (any, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *tagList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = nil
+		for _, tag := range strings.Split(node.Value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				*l = append(*l, tag)
+			}
+		}
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// requests returns the http requests of the template
+func (t *Template) requests() []HTTPRequest {
+	return append(t.HTTP, t.Requests...)
+}
+
+// ParseTemplates reads the templates of a YAML stream, the documents
+// which aren't http templates are skipped. The documents that can't be
+// read are skipped with opts.Skip, so one broken template doesn't stop
+// the conversion.
+func ParseTemplates(r io.Reader, opts converter.Options) ([]Template, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var templates []Template
+	for _, doc := range splitDocuments(data) {
+		var t Template
+		err := yaml.Unmarshal(doc.data, &t)
+		// The fields of unexpected types are left empty, the rest of the
+		// template is still read
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			slog.Warn("Unexpected template fields", "template", t.ID, "error", strings.Join(typeErr.Errors, "; "))
+		} else if err != nil {
+			if err := opts.Skip(doc.name, err); err != nil {
+				return nil, fmt.Errorf("%s: %v", doc.name, err)
+			}
+			continue
+		}
+		if t.ID != "" && len(t.requests()) > 0 {
+			templates = append(templates, t)
+		}
+	}
+	return templates, nil
+}
+
+// document is a document of a YAML stream
+type document struct {
+	// name is the file the document was read from (see ReadDir), or its
+	// line in the stream
+	name string
+	data []byte
+}
+
+// splitDocuments splits a YAML stream at its --- lines. A comment on the
+// --- line names the document, as ReadDir writes it.
+func splitDocuments(data []byte) []document {
+	var docs []document
+	current := document{name: "template at line 1"}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	for i, line := range lines {
+		marker := bytes.TrimRight(line, "\r\n")
+		if !bytes.Equal(marker, []byte("---")) && !bytes.HasPrefix(marker, []byte("--- ")) {
+			current.data = append(current.data, line...)
+			continue
+		}
+		if len(bytes.TrimSpace(current.data)) > 0 {
+			docs = append(docs, current)
+		}
+		current = document{name: fmt.Sprintf("template at line %d", i+2)}
+		if _, comment, ok := bytes.Cut(marker, []byte("#")); ok {
+			current.name = "template " + string(bytes.TrimSpace(comment))
+		}
+	}
+	if len(bytes.TrimSpace(current.data)) > 0 {
+		docs = append(docs, current)
+	}
+	return docs
+}
+
+// ReadDir merges the templates in dir and its subdirectories (e.g. the
+// http/technologies directory of nuclei-templates) into a YAML stream
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// The file names the template in the errors
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+		stream.WriteString("--- # " + filepath.ToSlash(name) + "\n")
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no templates found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package converter holds what the source converters (in its
+// subpackages) have in common: the conversion options and the steps
+// applied to every generated rule and ruleset.
+package converter
+
+import (
+	"gotests/thecrowler-rules-converters/pkg/confidence"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+)
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	// SourceLicense is recorded in the rulesets (empty uses the default
+	// license of the source)
+	SourceLicense string
+	// ValidFrom and Expires are the RFC3339 validity dates of the rules
+	ValidFrom string
+	Expires   string
+	// Namespace prefixes the ruleset, group and rule names
+	Namespace string
+	// Normalize canonicalizes the header keys and patterns of the rules
+	Normalize bool
+	// Literals tells if the literal values of the source are escaped in
+	// the patterns or used as regular expressions
+	Literals LiteralMode
+	// Confidence is the confidence of the signatures when the source
+	// doesn't give one (0 uses crowler.DefaultConfidence)
+	Confidence float32
+	// ConfidenceProfile, if set, gives the confidence of the signatures
+	// by their type instead of Confidence
+	ConfidenceProfile confidence.Profile
+	// Taxonomy maps the source categories to CROWler tags
+	Taxonomy taxonomy.Taxonomy
+	// FileName is the name of the input file, for the converters naming
+	// the rulesets after it
+	FileName string
+	// Dir is the directory of the input file, the converters resolve the
+	// relative paths of the files the input references from it
+	Dir string
+	// Workers is the number of goroutines converting the technologies,
+	// templates or rules of the source (see Map), 0 or 1 converts them in
+	// turn
+	Workers int
+	// Progress, if set, is called with the number of source items
+	// processed since the last call. It must be safe for concurrent use.
+	Progress func(n int)
+	// Invalid, if set, is called with the source entries that can't be
+	// read and their error, and the converter skips them (see Skip).
+	// Without it the first invalid entry stops the conversion.
+	Invalid func(entry string, err error)
+}
+
+// License returns the license to record in the rulesets
+func (o Options) License(defaultLicense string) string {
+	if o.SourceLicense == "" {
+		return defaultLicense
+	}
+	return o.SourceLicense
+}
+
+// DefaultConfidence returns the confidence of the signatures without a
+// confidence in the source
+func (o Options) DefaultConfidence() float32 {
+	if o.Confidence == 0 {
+		return crowler.DefaultConfidence
+	}
+	return o.Confidence
+}
+
+// Processed reports n more source items processed to Progress
+func (o Options) Processed(n int) {
+	if o.Progress != nil {
+		o.Progress(n)
+	}
+}
+
+// Skip reports an invalid source entry to Invalid and returns nil, so
+// the converter skips the entry and goes on, or returns err when Invalid
+// isn't set
+func (o Options) Skip(entry string, err error) error {
+	if o.Invalid == nil {
+		return err
+	}
+	o.Invalid(entry, err)
+	return nil
+}
+
+// PrepareRule applies the validity dates, the default confidence (or the
+// confidence profile) and, if enabled, the normalization to a rule
+func (o Options) PrepareRule(rule *crowler.DetectionRule) {
+	rule.ValidFrom = o.ValidFrom
+	rule.Expires = o.Expires
+	if o.ConfidenceProfile != nil {
+		o.ConfidenceProfile.Apply(rule)
+	} else {
+		crowler.SetConfidence(rule, o.DefaultConfidence())
+	}
+	if o.Normalize {
+		crowler.NormalizeRule(rule)
+	}
+}
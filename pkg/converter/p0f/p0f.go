@@ -0,0 +1,239 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package p0f converts the HTTP response signatures of p0f (p0f.fp) into
+// CROWler detection rules identifying the server software and the
+// proxies in front of it. The CROWler can't match the order of the
+// headers, which most p0f signatures rely on: the rules match the
+// expected software in the Server header and the headers (and header
+// values) that tell the servers apart.
+package p0f
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "p0f fingerprints"
+	// DefaultSourceLicense is the license of p0f
+	DefaultSourceLicense = "LGPL-2.1-only"
+	// Category is the taxonomy key of the servers
+	Category = "server"
+)
+
+// responseSection is the section of the HTTP response signatures
+const responseSection = "http:response"
+
+// serverHeader is the header naming the server software
+const serverHeader = "Server"
+
+// commonHeaders are the headers most servers send, whose presence doesn't
+// tell them apart
+var commonHeaders = map[string]bool{
+	"accept-ranges":     true,
+	"age":               true,
+	"cache-control":     true,
+	"connection":        true,
+	"content-encoding":  true,
+	"content-length":    true,
+	"content-type":      true,
+	"date":              true,
+	"etag":              true,
+	"expires":           true,
+	"keep-alive":        true,
+	"last-modified":     true,
+	"location":          true,
+	"pragma":            true,
+	"server":            true,
+	"set-cookie":        true,
+	"transfer-encoding": true,
+	"vary":              true,
+}
+
+// versionExpr captures the version following the product/ prefix of a
+// Server banner
+const versionExpr = `([0-9][0-9a-z.\-]*)`
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			for _, v := range h.Value {
+				if v == pattern {
+					return
+				}
+			}
+			h.Value = append(h.Value, pattern)
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// convertLabel converts the signatures of a response label into a rule.
+// The signatures are alternatives, their patterns are merged. p0f matches
+// the expected software and the header values as substrings, case
+// insensitively. It returns false if no signature has a distinctive
+// header or an expected software.
+func convertLabel(label Label) (crowler.DetectionRule, bool) {
+	description := strings.TrimSpace(label.Name + " " + label.Flavor)
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(description),
+		ObjectName: label.Name,
+		Metadata:   &crowler.RuleMetadata{Description: description},
+	}
+
+	versioned := make(map[string]bool)
+	converted := false
+	for _, sig := range label.Signatures {
+		if sig.Software != "" {
+			appendHeader(&rule, serverHeader, "(?i)"+regexp.QuoteMeta(sig.Software))
+			// The version follows the software in the banners (nginx/1.25.3)
+			if !versioned[sig.Software] && !strings.ContainsAny(sig.Software, "/ ") {
+				versioned[sig.Software] = true
+				rule.Version = append(rule.Version, crowler.VersionSignature{
+					Section: "http_header_fields",
+					Key:     serverHeader,
+					Pattern: "(?i)" + regexp.QuoteMeta(sig.Software+"/") + versionExpr,
+					Version: `\1`,
+				})
+			}
+			converted = true
+		}
+		for _, h := range sig.Headers {
+			if commonHeaders[strings.ToLower(h.Name)] {
+				continue
+			}
+			switch {
+			case h.Value != "":
+				appendHeader(&rule, h.Name, "(?i)"+regexp.QuoteMeta(h.Value))
+			case !h.Optional:
+				// An empty value matches the header being there
+				appendHeader(&rule, h.Name, "")
+			default:
+				continue
+			}
+			converted = true
+		}
+	}
+	return rule, converted
+}
+
+// Convert converts the HTTP response signatures of a p0f.fp file into a
+// ruleset with a rule per label. The request signatures identify the
+// clients, not the servers the crawler visits, and are skipped like the
+// TCP and MTU ones.
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	labels, err := ParseLabels(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signatures: %v", err)
+	}
+
+	groupTags := opts.Taxonomy.Tags(Category)
+	ruleset := crowler.NewRuleset("detect_p0f_http_servers", "Ruleset to detect the HTTP servers and proxies with the p0f signatures.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-p0f-http-servers-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_http_servers",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	skipped := make(map[string]int)
+	responses, converted := 0, 0
+	for _, label := range labels {
+		if label.Section != responseSection {
+			skipped[label.Section]++
+			continue
+		}
+		responses++
+		rule, ok := convertLabel(label)
+		if !ok {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	if len(skipped) > 0 {
+		sections := make([]string, 0, len(skipped))
+		for section, n := range skipped {
+			sections = append(sections, fmt.Sprintf("%s: %d", section, n))
+		}
+		sort.Strings(sections)
+		slog.Info("Skipped the labels of the other sections", "converted_section", responseSection, "sections", strings.Join(sections, ", "))
+	}
+	if converted < responses {
+		slog.Info("Some response labels only match the order of common headers",
+			"converted", converted, "total", responses)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(p0fConverter{})
+}
+
+// p0fConverter is the registered p0f converter
+type p0fConverter struct{}
+
+func (p0fConverter) Name() string { return "p0f" }
+
+func (p0fConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert the HTTP response signatures of p0f",
+		Input:          "Path to the p0f.fp signatures file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// sectionRe matches the HTTP sections of p0f.fp
+var sectionRe = regexp.MustCompile(`(?m)^\[http:(?:request|response)\]\s*$`)
+
+// Detect recognizes a p0f.fp file with HTTP signatures
+func (p0fConverter) Detect(input []byte) bool {
+	return sectionRe.Match(input)
+}
+
+func (p0fConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
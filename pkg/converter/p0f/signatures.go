@@ -0,0 +1,181 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package p0f
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Label is a label of p0f.fp, the software its signatures identify:
+// s:!:Apache:2.x is the specific (s) or generic (g) label of the
+// application (!) Apache, flavor 2.x
+type Label struct {
+	Generic bool
+	Class   string
+	Name    string
+	Flavor  string
+	// Section is the section of the label, e.g. http:response
+	Section    string
+	Signatures []Signature
+}
+
+// Header is a header of an HTTP signature: the optional ones (?Name) may
+// be missing, Value is the value the header must have, if given
+// (Name=[value])
+type Header struct {
+	Name     string
+	Value    string
+	Optional bool
+}
+
+// Signature is an HTTP signature (ver:horder:habsent:expsw): the headers
+// in their order, the headers that must be missing and the expected
+// software, the part of the Server (or User-Agent) header naming it
+type Signature struct {
+	Version  string
+	Headers  []Header
+	Absent   []string
+	Software string
+}
+
+// splitTop splits s on sep, outside of the [values] of the headers
+func splitTop(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHeaders parses a comma separated header list of a signature
+func parseHeaders(s string) []Header {
+	var headers []Header
+	for _, field := range splitTop(s, ',') {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		var h Header
+		if strings.HasPrefix(field, "?") {
+			h.Optional, field = true, field[1:]
+		}
+		if i := strings.Index(field, "=["); i >= 0 && strings.HasSuffix(field, "]") {
+			h.Value, field = field[i+2:len(field)-1], field[:i]
+		}
+		h.Name = field
+		headers = append(headers, h)
+	}
+	return headers
+}
+
+// parseSignature parses an HTTP signature. It returns false if it
+// doesn't have the four fields.
+func parseSignature(s string) (Signature, bool) {
+	fields := splitTop(s, ':')
+	if len(fields) < 4 {
+		return Signature{}, false
+	}
+	sig := Signature{
+		Version: fields[0],
+		Headers: parseHeaders(fields[1]),
+		// The expected software can hold a colon
+		Software: strings.TrimSpace(strings.Join(fields[3:], ":")),
+	}
+	for _, h := range parseHeaders(fields[2]) {
+		sig.Absent = append(sig.Absent, h.Name)
+	}
+	return sig, true
+}
+
+// parseLabel parses a label (type:class:name:flavor)
+func parseLabel(s, section string) (Label, bool) {
+	fields := strings.SplitN(s, ":", 4)
+	if len(fields) < 3 {
+		return Label{}, false
+	}
+	label := Label{
+		Generic: fields[0] == "g",
+		Class:   fields[1],
+		Name:    fields[2],
+		Section: section,
+	}
+	if len(fields) == 4 {
+		label.Flavor = fields[3]
+	}
+	return label, label.Name != ""
+}
+
+// ParseLabels reads the labels of a p0f.fp file with the signatures
+// following them. The TCP and MTU signatures are read as well, only the
+// HTTP ones are parsed.
+func ParseLabels(r io.Reader) ([]Label, error) {
+	var labels []Label
+	section := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "label":
+			if label, ok := parseLabel(value, section); ok {
+				labels = append(labels, label)
+			}
+		case "sig":
+			if len(labels) == 0 || labels[len(labels)-1].Section != section {
+				continue
+			}
+			label := &labels[len(labels)-1]
+			if !strings.HasPrefix(section, "http:") {
+				label.Signatures = append(label.Signatures, Signature{})
+				continue
+			}
+			if sig, ok := parseSignature(value); ok {
+				label.Signatures = append(label.Signatures, sig)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error scanning file: %v", err)
+	}
+	return labels, nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import "sync"
+
+// Map calls fn on each item with up to workers goroutines and returns the
+// results in the order of the items, so the output of a conversion
+// doesn't depend on the number of workers. fn must be safe to call
+// concurrently. With less than two workers the items are processed in
+// turn.
+func Map[T, R any](workers int, items []T, fn func(T) R) []R {
+	results := make([]R, len(items))
+	if workers < 2 || len(items) < 2 {
+		for i, item := range items {
+			results[i] = fn(item)
+		}
+		return results
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = fn(items[i])
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
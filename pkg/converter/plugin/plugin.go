@@ -0,0 +1,259 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin runs the external converter plugins: executables found
+// in a plugins directory, which read a source on their stdin and write
+// the canonical intermediate JSON, CROWler rulesets, on their stdout.
+package plugin
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the converter, the rulesets record the source
+	// the plugin reports
+	SourceName = "Converter plugins"
+	// DefaultPluginsDir is the directory the plugins are looked up in
+	DefaultPluginsDir = "./plugins"
+	// DefaultTimeout is the maximum time a plugin is allowed to run
+	DefaultTimeout = 5 * time.Minute
+)
+
+// Output is the canonical intermediate JSON document a plugin writes on
+// its stdout
+type Output struct {
+	Source        string            `json:"source"`
+	SourceLicense string            `json:"source_license"`
+	Rulesets      []crowler.Ruleset `json:"rulesets"`
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// PluginsDir is the directory of the plugins (empty uses
+	// DefaultPluginsDir)
+	PluginsDir string
+	// Plugin is the name of the plugin to run
+	Plugin string
+	// Timeout is the maximum time the plugin is allowed to run (0 uses
+	// DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Discover returns the executable files found in dir indexed by plugin
+// name (the file name without extension)
+func Discover(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	plugins := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&0111 == 0 && !strings.EqualFold(filepath.Ext(entry.Name()), ".exe") {
+			continue // not executable
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		plugins[name] = filepath.Join(dir, entry.Name())
+	}
+
+	return plugins, nil
+}
+
+// Run executes a plugin feeding it the source read from r on stdin and
+// decodes the canonical intermediate JSON it writes on stdout
+func Run(path string, r io.Reader, timeout time.Duration) (*Output, error) {
+	var stdout bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = r
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("plugin failed: %v", err)
+		}
+	case <-time.After(timeout):
+		_ = cmd.Process.Kill()
+		return nil, fmt.Errorf("plugin timed out after %s", timeout)
+	}
+
+	var output Output
+	decoder := json.NewDecoder(&stdout)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&output); err != nil {
+		return nil, fmt.Errorf("invalid plugin output: %v", err)
+	}
+
+	return &output, nil
+}
+
+// Convert runs the plugin opts.Plugin on the source read from r and
+// returns the rulesets it writes, checked and with the source it reports
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	dir := cmp.Or(opts.PluginsDir, DefaultPluginsDir)
+	plugins, err := Discover(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plugins directory %s: %v", dir, err)
+	}
+	if opts.Plugin == "" {
+		return nil, errors.New("no plugin given, use -plugin")
+	}
+	path, exists := plugins[opts.Plugin]
+	if !exists {
+		return nil, fmt.Errorf("plugin %q not found in %s", opts.Plugin, dir)
+	}
+
+	output, err := Run(path, r, cmp.Or(opts.Timeout, DefaultTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("error running plugin %s: %v", opts.Plugin, err)
+	}
+
+	fileNames := slug.NewFileNamer()
+	rulesets := output.Rulesets
+	for i := range rulesets {
+		ruleset := &rulesets[i]
+		if ruleset.RulesetName == "" {
+			return nil, fmt.Errorf("plugin %s returned a ruleset without ruleset_name", opts.Plugin)
+		}
+		if err := crowler.ValidateActionRules(*ruleset); err != nil {
+			return nil, fmt.Errorf("plugin %s returned an invalid ruleset %s: %v", opts.Plugin, ruleset.RulesetName, err)
+		}
+		if err := crowler.ValidateParentGroups(*ruleset); err != nil {
+			return nil, fmt.Errorf("plugin %s returned an invalid ruleset %s: %v", opts.Plugin, ruleset.RulesetName, err)
+		}
+		opts.Processed(1)
+
+		// The plugin rules keep their confidence, only the validity
+		// dates given and the normalization are applied
+		for j := range ruleset.RuleGroups {
+			for k := range ruleset.RuleGroups[j].DetectionRules {
+				rule := &ruleset.RuleGroups[j].DetectionRules[k]
+				if opts.ValidFrom != "" {
+					rule.ValidFrom = opts.ValidFrom
+				}
+				if opts.Expires != "" {
+					rule.Expires = opts.Expires
+				}
+				if opts.Normalize {
+					crowler.NormalizeRule(rule)
+				}
+			}
+		}
+		if ruleset.Source == "" {
+			ruleset.Source = output.Source
+		}
+		if ruleset.SourceLicense == "" {
+			ruleset.SourceLicense = opts.License(output.SourceLicense)
+		}
+		if ruleset.CreatedAt == "" {
+			ruleset.CreatedAt = time.Now().Format(time.RFC3339)
+		}
+		ruleset.FileName = fileNames.Unique(slug.File(ruleset.RulesetName)) + ".yaml"
+		crowler.ApplyNamespace(ruleset, opts.Namespace)
+	}
+	return rulesets, nil
+}
+
+// List writes the plugins of dir, one per line with their path
+func List(w io.Writer, dir string) error {
+	plugins, err := Discover(dir)
+	if err != nil {
+		return fmt.Errorf("error reading plugins directory %s: %v", dir, err)
+	}
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, plugins[name])
+	}
+	return nil
+}
+
+func init() {
+	converter.Register(&pluginConverter{})
+}
+
+// pluginConverter is the registered converter running the plugins
+type pluginConverter struct {
+	pluginsDir string
+	plugin     string
+	list       bool
+	timeout    time.Duration
+}
+
+func (*pluginConverter) Name() string { return "plugin" }
+
+func (*pluginConverter) Info() converter.Info {
+	return converter.Info{
+		Summary: "Run an external converter plugin on a source file",
+		Input:   "Path to the source file to feed to the plugin",
+		Source:  SourceName,
+	}
+}
+
+// Detect never recognizes the input, the plugin formats are unknown
+func (*pluginConverter) Detect(input []byte) bool {
+	return false
+}
+
+func (c *pluginConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.pluginsDir, "plugins-dir", DefaultPluginsDir, "Directory containing the converter plugins")
+	fs.StringVar(&c.plugin, "plugin", "", "Name of the plugin to run")
+	fs.BoolVar(&c.list, "list", false, "List the available plugins and exit")
+	fs.DurationVar(&c.timeout, "timeout", DefaultTimeout, "Maximum time a plugin is allowed to run")
+}
+
+func (c *pluginConverter) List(w io.Writer) (bool, error) {
+	if !c.list {
+		return false, nil
+	}
+	return true, List(w, c.pluginsDir)
+}
+
+func (c *pluginConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, PluginsDir: c.pluginsDir, Plugin: c.plugin, Timeout: c.timeout})
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// Converter converts a source format into CROWler rulesets. The
+// converters register themselves (see Register) so the command line finds
+// them by name or by sniffing the input.
+type Converter interface {
+	// Name is the name the converter is selected by (the crowlerconv
+	// subcommand)
+	Name() string
+	// Info describes the converter and its source
+	Info() Info
+	// Detect returns true if input looks like the converter source format
+	Detect(input []byte) bool
+	// Convert converts the source read from r into rulesets
+	Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error)
+}
+
+// FlagSetter is implemented by the converters with their own command line
+// flags. SetFlags is called before the flags are parsed, the converter
+// reads them in Convert.
+type FlagSetter interface {
+	SetFlags(fs *flag.FlagSet)
+}
+
+// DirReader is implemented by the converters whose source can be split
+// in several files. ReadDir merges the files of dir into the input of
+// Convert.
+type DirReader interface {
+	ReadDir(dir string) ([]byte, error)
+}
+
+// Lister is implemented by the converters with a flag listing what they
+// can run (e.g. the plugins) instead of converting. List is called after
+// the flags are parsed, it returns false if the flag isn't set.
+type Lister interface {
+	List(w io.Writer) (bool, error)
+}
+
+// Generator is implemented by the converters which can generate their
+// rulesets from their flags alone (e.g. the schema.org types of -types).
+// Generates is called after the flags are parsed, if it returns true and
+// there is no input file Convert reads an empty input.
+type Generator interface {
+	Generates() bool
+}
+
+// Info describes a converter
+type Info struct {
+	// Summary is the one line description shown in the usage
+	Summary string
+	// Input describes the file the converter reads
+	Input string
+	// Source and DefaultLicense are the source name and license recorded
+	// in the rulesets
+	Source         string
+	DefaultLicense string
+}
+
+var registry = map[string]Converter{}
+
+// Register makes a converter available by its name. It panics if a
+// converter with the same name is already registered.
+func Register(c Converter) {
+	if _, exists := registry[c.Name()]; exists {
+		panic("converter: Register called twice for " + c.Name())
+	}
+	registry[c.Name()] = c
+}
+
+// Get returns the converter called name
+func Get(name string) (Converter, bool) {
+	c, ok := registry[name]
+	return c, ok
+}
+
+// All returns the registered converters sorted by name
+func All() []Converter {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	converters := make([]Converter, 0, len(names))
+	for _, name := range names {
+		converters = append(converters, registry[name])
+	}
+	return converters
+}
+
+// Detect returns the converter for input. It fails if no converter, or
+// more than one, recognizes the input.
+func Detect(input []byte) (Converter, error) {
+	var matches []Converter
+	for _, c := range All() {
+		if c.Detect(input) {
+			matches = append(matches, c)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("unknown input format")
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, c := range matches {
+		names[i] = c.Name()
+	}
+	return nil, fmt.Errorf("ambiguous input format, it could be %s", strings.Join(names, " or "))
+}
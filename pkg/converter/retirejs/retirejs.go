@@ -0,0 +1,296 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retirejs converts the retire.js repository (jsrepository.json)
+// into CROWler rules detecting the JavaScript libraries and their
+// versions. The known vulnerable version ranges of each library, with
+// their CVE IDs, are kept in the rule metadata.
+package retirejs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "retire.js repository"
+	// DefaultSourceLicense is the license of retire.js
+	DefaultSourceLicense = "Apache-2.0"
+)
+
+// Library is a JavaScript library of the repository
+type Library struct {
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Extractors      Extractors      `json:"extractors"`
+}
+
+// Extractors are the patterns finding a library and its version: on the
+// script URL, its file name, its content, and the JavaScript expressions
+// returning the version. §§version§§ in a pattern stands for the version.
+type Extractors struct {
+	Func        []string          `json:"func"`
+	URI         []string          `json:"uri"`
+	Filename    []string          `json:"filename"`
+	FileContent []string          `json:"filecontent"`
+	Hashes      map[string]string `json:"hashes"`
+}
+
+// Vulnerability is a vulnerable version range of a library
+type Vulnerability struct {
+	AtOrAbove   string      `json:"atOrAbove"`
+	Below       string      `json:"below"`
+	Severity    string      `json:"severity"`
+	CWE         []string    `json:"cwe"`
+	Identifiers Identifiers `json:"identifiers"`
+	Info        []string    `json:"info"`
+}
+
+// Identifiers identify a vulnerability
+type Identifiers struct {
+	CVE     []string `json:"CVE"`
+	Summary string   `json:"summary"`
+}
+
+const (
+	// versionPlaceholder stands for the version in the patterns
+	versionPlaceholder = "§§version§§"
+	// versionPattern is the pattern of a version, as in retire.js
+	versionPattern = `[0-9][0-9.a-z_\-]+`
+)
+
+// skippedLibraries are the entries of the repository which aren't
+// libraries
+var skippedLibraries = map[string]bool{
+	"retire-example": true,
+	"dont check":     true,
+}
+
+// funcPathRe matches the func extractors that are the path of a global
+// object (jQuery.fn.jquery), the others are JavaScript expressions
+var funcPathRe = regexp.MustCompile(`^(?:window\.)?([A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)*)$`)
+
+// versionedPattern replaces the version placeholder of a pattern by the
+// version pattern. It returns the pattern, the version template (\N, the
+// group of the version) and false if the pattern isn't a valid Go regex.
+func versionedPattern(pattern string) (string, string, bool) {
+	pattern, err := normalize.Translate(pattern)
+	if err != nil {
+		return "", "", false
+	}
+	if !strings.Contains(pattern, versionPlaceholder) {
+		return pattern, "", true
+	}
+
+	// Name the group of the version to find its index
+	named := strings.Replace(pattern, "("+versionPlaceholder+")", "(?P<version>"+versionPattern+")", 1)
+	if named == pattern {
+		named = strings.Replace(pattern, versionPlaceholder, "(?P<version>"+versionPattern+")", 1)
+	}
+	named = strings.ReplaceAll(named, versionPlaceholder, versionPattern)
+	re, err := regexp.Compile(named)
+	if err != nil {
+		return "", "", false
+	}
+	version := fmt.Sprintf(`\%d`, re.SubexpIndex("version"))
+	return strings.Replace(named, "(?P<version>", "(", 1), version, true
+}
+
+// addVersion records the version extracted by a pattern
+func addVersion(rule *crowler.DetectionRule, section, key, pattern, version string) {
+	if version == "" {
+		return
+	}
+	rule.Version = append(rule.Version, crowler.VersionSignature{
+		Section: section,
+		Key:     key,
+		Pattern: pattern,
+		Version: version,
+	})
+}
+
+// createRule converts the extractors of a library into a rule: the uri
+// and filename patterns match the src of the scripts, the filecontent
+// ones the content of the inline scripts and the func extractors naming
+// a global object become JavaScript patterns. The hashes of the library
+// files have no CROWler equivalent.
+func createRule(name string, library Library) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+	}
+
+	for _, p := range append(library.Extractors.URI, library.Extractors.Filename...) {
+		pattern, version, ok := versionedPattern(p)
+		if !ok {
+			continue
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "script",
+			Attribute:  "src",
+			Signature:  []string{pattern},
+			Confidence: crowler.DefaultConfidence,
+		})
+		addVersion(&rule, "page_content_patterns", "script", pattern, version)
+	}
+
+	for _, p := range library.Extractors.FileContent {
+		pattern, version, ok := versionedPattern(p)
+		if !ok {
+			continue
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "script",
+			Signature:  []string{pattern},
+			Confidence: crowler.DefaultConfidence,
+		})
+		addVersion(&rule, "page_content_patterns", "script", pattern, version)
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range library.Extractors.Func {
+		m := funcPathRe.FindStringSubmatch(strings.TrimSpace(f))
+		if m == nil || seen[m[1]] {
+			continue
+		}
+		seen[m[1]] = true
+		pattern := "^(" + versionPattern + ")$"
+		rule.JSPatterns = append(rule.JSPatterns, crowler.JSObjectSignature{
+			Name:       m[1],
+			Value:      []string{pattern},
+			Confidence: crowler.DefaultConfidence,
+		})
+		addVersion(&rule, "js_patterns", m[1], pattern, `\1`)
+	}
+
+	var vulnerabilities []crowler.Vulnerability
+	for _, v := range library.Vulnerabilities {
+		vulnerabilities = append(vulnerabilities, crowler.Vulnerability{
+			AtOrAbove:  v.AtOrAbove,
+			Below:      v.Below,
+			Severity:   strings.ToUpper(v.Severity),
+			CVE:        v.Identifiers.CVE,
+			CWE:        v.CWE,
+			Summary:    strings.TrimSpace(v.Identifiers.Summary),
+			References: v.Info,
+		})
+	}
+	if len(vulnerabilities) > 0 {
+		rule.Metadata = &crowler.RuleMetadata{Vulnerabilities: vulnerabilities}
+	}
+
+	return rule
+}
+
+// hasSignatures tells if a rule has signatures
+func hasSignatures(rule crowler.DetectionRule) bool {
+	return len(rule.PageContentPatterns) > 0 || len(rule.JSPatterns) > 0
+}
+
+// Convert converts a jsrepository.json document into a ruleset with a
+// rule per library
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	var libraries map[string]Library
+	if err := json.NewDecoder(r).Decode(&libraries); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	names := make([]string, 0, len(libraries))
+	for name := range libraries {
+		if !skippedLibraries[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	ruleset := crowler.NewRuleset("detect_js_libraries", "Ruleset to detect JavaScript libraries and their known vulnerable versions.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-js-libraries-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_js_libraries",
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	converted := 0
+	for _, name := range names {
+		rule := createRule(name, libraries[name])
+		if !hasSignatures(rule) {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	if converted < len(names) {
+		slog.Info("Some libraries only have hashes, JavaScript expressions or regexes Go can't compile",
+			"converted", converted, "total", len(names))
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(retireJSConverter{})
+}
+
+// retireJSConverter is the registered retire.js converter
+type retireJSConverter struct{}
+
+func (retireJSConverter) Name() string { return "retirejs" }
+
+func (retireJSConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert the retire.js jsrepository.json",
+		Input:          "Path to the retire.js jsrepository.json file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a document whose entries have extractors
+func (retireJSConverter) Detect(input []byte) bool {
+	var doc map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(input, &doc); err != nil {
+		return false
+	}
+	for name, library := range doc {
+		if _, ok := library["extractors"]; ok && !skippedLibraries[name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (retireJSConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// Group is a group of robots.txt rules, for the user agents it lists
+type Group struct {
+	UserAgents []string
+	Allow      []string
+	Disallow   []string
+	CrawlDelay time.Duration
+}
+
+// File is a parsed robots.txt
+type File struct {
+	Groups   []Group
+	Sitemaps []string
+}
+
+// Parse reads a robots.txt (RFC 9309). The consecutive user-agent lines
+// start a group, the rules that follow belong to it. Sitemap lines aren't
+// part of a group.
+func Parse(r io.Reader) (File, error) {
+	var file File
+	var group *Group
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if group == nil || inRules {
+				file.Groups = append(file.Groups, Group{})
+				group = &file.Groups[len(file.Groups)-1]
+				inRules = false
+			}
+			group.UserAgents = append(group.UserAgents, value)
+		case "allow", "disallow", "crawl-delay":
+			if group == nil {
+				continue
+			}
+			inRules = true
+			switch {
+			case value == "":
+				// An empty disallow allows everything
+			case key == "allow":
+				group.Allow = append(group.Allow, value)
+			case key == "disallow":
+				group.Disallow = append(group.Disallow, value)
+			default:
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					group.CrawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			if value != "" {
+				file.Sitemaps = append(file.Sitemaps, value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return File{}, fmt.Errorf("error scanning robots.txt: %v", err)
+	}
+	return file, nil
+}
+
+// group returns the group applying to userAgent: the one with the
+// longest user agent the crawler's contains (case insensitively), or
+// else the * group. It returns false if none applies.
+func (f File) group(userAgent string) (Group, bool) {
+	userAgent = strings.ToLower(userAgent)
+	best, bestLen := -1, -1
+	for i, g := range f.Groups {
+		for _, ua := range g.UserAgents {
+			ua = strings.ToLower(ua)
+			switch {
+			case ua == "*" && bestLen < 0:
+				best, bestLen = i, 0
+			case ua != "*" && ua != "" && strings.Contains(userAgent, ua) && len(ua) > bestLen:
+				best, bestLen = i, len(ua)
+			}
+		}
+	}
+	if best < 0 {
+		return Group{}, false
+	}
+	return f.Groups[best], true
+}
+
+// pathPattern converts a robots.txt path rule into a regex on the URL
+// path: * matches any sequence and a trailing $ anchors the end
+func pathPattern(rule string) string {
+	anchored := strings.HasSuffix(rule, "$")
+	rule = strings.TrimSuffix(rule, "$")
+	parts := strings.Split(rule, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := "^" + strings.Join(parts, ".*")
+	if anchored {
+		pattern += "$"
+	}
+	return pattern
+}
+
+// ParseSecurity reads a security.txt (RFC 9116), skipping its PGP
+// signature lines
+func ParseSecurity(r io.Reader) (crowler.SecurityPolicy, error) {
+	var policy crowler.SecurityPolicy
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-----") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "contact":
+			policy.Contact = append(policy.Contact, value)
+		case "policy":
+			policy.Policy = append(policy.Policy, value)
+		case "expires":
+			policy.Expires = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return crowler.SecurityPolicy{}, fmt.Errorf("error scanning security.txt: %v", err)
+	}
+	return policy, nil
+}
@@ -0,0 +1,440 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package robots converts the crawl policies of sites, their robots.txt
+// and security.txt files, into CROWler crawling rules: a ruleset per host
+// with the paths the crawler may visit, the crawl delay and the sitemaps
+// of the robots.txt group applying to it, and the security.txt contacts.
+package robots
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/fetch"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "robots.txt"
+	// DefaultSourceLicense is used when the license of the files isn't
+	// given, the sites don't license their robots.txt
+	DefaultSourceLicense = "NOASSERTION"
+	// DefaultUserAgent picks the robots.txt group applying to all the
+	// crawlers
+	DefaultUserAgent = "*"
+)
+
+// fileMarker starts the comment ReadDir writes before each file, with its
+// path
+const fileMarker = "# file: "
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Host is the host of a single robots.txt or security.txt (empty uses
+	// the name of its directory)
+	Host string
+	// UserAgent is the user agent of the crawler, it picks the robots.txt
+	// group (empty uses DefaultUserAgent)
+	UserAgent string
+	// Fetch downloads the robots.txt and security.txt of the hosts of a
+	// sitemap list which aren't next to it
+	Fetch bool
+}
+
+// hostPolicy is what is known of the policies of a host
+type hostPolicy struct {
+	robots   *File
+	security *crowler.SecurityPolicy
+	sitemaps []string
+}
+
+// policies collects the policies of the hosts
+type policies map[string]*hostPolicy
+
+func (p policies) host(host string) *hostPolicy {
+	host = strings.ToLower(host)
+	if p[host] == nil {
+		p[host] = &hostPolicy{}
+	}
+	return p[host]
+}
+
+// hostNameRe cuts the robots and security decorations of a file name
+// (robots-example.com.txt, example.com_security.txt)
+var hostNameRe = regexp.MustCompile(`(?i)^(?:robots|security)[._-]|[._-](?:robots|security)$`)
+
+// fileHost returns the host a fetched file belongs to: the directory of
+// a robots.txt or security.txt (example.com/robots.txt,
+// example.com/.well-known/security.txt), or else its name without the
+// robots or security decorations (example.com.robots.txt)
+func fileHost(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".txt")
+	if strings.EqualFold(name, "robots") || strings.EqualFold(name, "security") {
+		dir := filepath.Dir(path)
+		if filepath.Base(dir) == ".well-known" {
+			dir = filepath.Dir(dir)
+		}
+		return filepath.Base(dir)
+	}
+	return hostNameRe.ReplaceAllString(name, "")
+}
+
+// isSecurityFile tells if a fetched file is a security.txt
+func isSecurityFile(path string) bool {
+	return strings.Contains(strings.ToLower(filepath.Base(path)), "security")
+}
+
+// isPolicyFile tells if a file is a robots.txt or a security.txt, rather
+// than a list of sitemap URLs
+func isPolicyFile(path string) bool {
+	name := strings.ToLower(filepath.Base(path))
+	return strings.Contains(name, "robots") || strings.Contains(name, "security")
+}
+
+// add parses a robots.txt or security.txt of host, path tells which
+func (p policies) add(path, host string, data []byte) error {
+	if isSecurityFile(path) {
+		policy, err := ParseSecurity(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		p.host(host).security = &policy
+		return nil
+	}
+	robots, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	p.host(host).robots = &robots
+	return nil
+}
+
+// addFile reads a robots.txt or security.txt of host from disk. The
+// files that can't be read are skipped with opts.Skip.
+func (p policies) addFile(path, host string, opts converter.Options) error {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = p.add(path, host, data)
+	}
+	if err != nil {
+		if err := opts.Skip("file "+path, err); err != nil {
+			return fmt.Errorf("error reading %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// document is a file of the stream ReadDir writes
+type document struct {
+	path string
+	data []byte
+}
+
+// splitFiles splits the stream ReadDir writes at its file markers. The
+// text before the first marker is returned with an empty path.
+func splitFiles(data []byte) []document {
+	var docs []document
+	var current document
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		path, ok := bytes.CutPrefix(line, []byte(fileMarker))
+		if !ok {
+			current.data = append(current.data, line...)
+			continue
+		}
+		if current.path != "" || len(bytes.TrimSpace(current.data)) > 0 {
+			docs = append(docs, current)
+		}
+		current = document{path: string(bytes.TrimSpace(path))}
+	}
+	if current.path != "" || len(bytes.TrimSpace(current.data)) > 0 {
+		docs = append(docs, current)
+	}
+	return docs
+}
+
+// readSitemapList reads a list of sitemap URLs, one per line. The
+// robots.txt of their hosts is looked up in opts.Dir (host/robots.txt or
+// host.txt), or else downloaded with opts.Fetch.
+func (p policies) readSitemapList(r io.Reader, opts Options) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Host == "" {
+			if err := opts.Skip("sitemap "+line, errors.New("invalid URL")); err != nil {
+				return fmt.Errorf("sitemap %s: %v", line, err)
+			}
+			continue
+		}
+		policy := p.host(u.Host)
+		policy.sitemaps = append(policy.sitemaps, line)
+		if policy.robots != nil {
+			continue
+		}
+
+		found := false
+		for _, local := range []string{filepath.Join(opts.Dir, u.Host, "robots.txt"), filepath.Join(opts.Dir, u.Host+".txt")} {
+			if _, err := os.Stat(local); err == nil {
+				if err := p.addFile(local, u.Host, opts.Options); err != nil {
+					return err
+				}
+				found = true
+				break
+			}
+		}
+		if found || !opts.Fetch {
+			continue
+		}
+		robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+		local, err := fetch.URL(robotsURL)
+		if err != nil {
+			slog.Warn("Error fetching robots.txt", "url", robotsURL, "error", err)
+			continue
+		}
+		if err := p.addFile(local, u.Host, opts.Options); err != nil {
+			return err
+		}
+		securityURL := u.Scheme + "://" + u.Host + "/.well-known/security.txt"
+		if local, err := fetch.URL(securityURL); err == nil {
+			policy.security = &crowler.SecurityPolicy{}
+			if data, err := os.ReadFile(local); err == nil {
+				if s, err := ParseSecurity(bytes.NewReader(data)); err == nil {
+					policy.security = &s
+				}
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// createCrawlingRule converts the policy of a host into a crawling rule
+// for userAgent. It returns false if the host has no policy for it.
+func createCrawlingRule(host string, policy *hostPolicy, userAgent string) (crowler.CrawlingRule, bool) {
+	rule := crowler.CrawlingRule{
+		RuleName:    "crawl_" + slug.Make(host) + "_policy",
+		RequestType: "GET",
+	}
+	sitemaps := append([]string(nil), policy.sitemaps...)
+	if policy.robots != nil {
+		sitemaps = append(sitemaps, policy.robots.Sitemaps...)
+		if group, ok := policy.robots.group(userAgent); ok {
+			rule.UserAgent = userAgent
+			for _, path := range group.Allow {
+				rule.AllowedPaths = append(rule.AllowedPaths, pathPattern(path))
+			}
+			for _, path := range group.Disallow {
+				rule.DisallowedPaths = append(rule.DisallowedPaths, pathPattern(path))
+			}
+			if group.CrawlDelay > 0 {
+				rule.CrawlDelay = group.CrawlDelay.String()
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, s := range sitemaps {
+		if !seen[s] {
+			seen[s] = true
+			rule.Sitemaps = append(rule.Sitemaps, s)
+		}
+	}
+	ok := rule.UserAgent != "" || len(rule.Sitemaps) > 0
+	return rule, ok
+}
+
+// Convert converts the robots.txt and security.txt files read from r
+// (a single file, or a directory merged by ReadDir) or a list of sitemap
+// URLs into a crawling ruleset per host
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := cmp.Or(opts.UserAgent, DefaultUserAgent)
+
+	hosts := make(policies)
+	docs := splitFiles(data)
+	switch {
+	case len(docs) > 0 && docs[0].path != "":
+		for _, doc := range docs {
+			host := fileHost(doc.path)
+			if host == "" || host == "." {
+				slog.Warn("Skipping file, its host isn't known", "path", doc.path)
+				continue
+			}
+			if err := hosts.add(doc.path, host, doc.data); err != nil {
+				if err := opts.Skip("file "+doc.path, err); err != nil {
+					return nil, fmt.Errorf("error reading %s: %v", doc.path, err)
+				}
+			}
+		}
+	case isPolicyFile(opts.FileName):
+		host := cmp.Or(opts.Host, fileHost(filepath.Join(opts.Dir, opts.FileName)))
+		if err := hosts.add(opts.FileName, host, data); err != nil {
+			return nil, err
+		}
+	default:
+		if err := hosts.readSitemapList(bytes.NewReader(data), opts); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rulesets []crowler.Ruleset
+	for _, name := range names {
+		policy := hosts[name]
+		opts.Processed(1)
+		rule, ok := createCrawlingRule(name, policy, userAgent)
+		if !ok && policy.security == nil {
+			slog.Warn("Skipping site, no robots.txt group applies to the user agent", "site", name, "user_agent", userAgent)
+			continue
+		}
+
+		hostSlug := slug.Make(name)
+		ruleset := crowler.NewRuleset(fmt.Sprintf("crawl_%s_policy_ruleset", hostSlug),
+			fmt.Sprintf("Crawl scope of %s generated from its robots.txt.", name))
+		ruleset.Source = SourceName
+		ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+		ruleset.FileName = fmt.Sprintf("crawl-%s-policy-ruleset.yaml", slug.File(name))
+		ruleset.SecurityPolicy = policy.security
+		ruleset.RuleGroups = []crowler.RuleGroup{
+			{
+				GroupName:      "crawl_" + hostSlug + "_policy",
+				IsEnabled:      true,
+				DetectionRules: []crowler.DetectionRule{},
+				CrawlingRules:  []crowler.CrawlingRule{rule},
+			},
+		}
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		rulesets = append(rulesets, ruleset)
+	}
+	return rulesets, nil
+}
+
+// ReadDir merges the robots.txt and security.txt files of dir (fetched as
+// example.com/robots.txt, example.com/.well-known/security.txt or
+// robots-example.com.txt) into a single stream. Each file follows a
+// comment with its path, which gives its host.
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".txt" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// The path keeps the name of dir, the host of the robots.txt
+		// directly in it
+		name, err := filepath.Rel(filepath.Dir(dir), path)
+		if err != nil {
+			name = path
+		}
+		stream.WriteString(fileMarker + filepath.ToSlash(name) + "\n")
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no robots.txt or security.txt files found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
+
+func init() {
+	converter.Register(&robotsConverter{})
+}
+
+// robotsConverter is the registered robots.txt converter
+type robotsConverter struct {
+	host      string
+	userAgent string
+	fetch     bool
+}
+
+func (*robotsConverter) Name() string { return "robots" }
+
+func (*robotsConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert robots.txt and security.txt files to crawling rules",
+		Input:          "Path to a directory of fetched robots.txt (and security.txt) files, a robots.txt file or a list of sitemap URLs",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+var (
+	// userAgentRe and pathRuleRe match the lines of a robots.txt group
+	userAgentRe = regexp.MustCompile(`(?im)^[ \t]*user-agent[ \t]*:`)
+	pathRuleRe  = regexp.MustCompile(`(?im)^[ \t]*(?:dis)?allow[ \t]*:`)
+	// contactRe and expiresRe match the required fields of a security.txt
+	contactRe = regexp.MustCompile(`(?im)^[ \t]*contact[ \t]*:`)
+	expiresRe = regexp.MustCompile(`(?im)^[ \t]*expires[ \t]*:`)
+)
+
+// Detect recognizes a robots.txt with a group, or a security.txt. The
+// lists of sitemap URLs have to be converted with robots, they look like
+// the URL feeds.
+func (*robotsConverter) Detect(input []byte) bool {
+	return userAgentRe.Match(input) && pathRuleRe.Match(input) ||
+		contactRe.Match(input) && expiresRe.Match(input)
+}
+
+func (c *robotsConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.host, "host", "", "Host of a single robots.txt file (default the name of its directory)")
+	fs.StringVar(&c.userAgent, "user-agent", DefaultUserAgent, "User agent of the crawler, picks the robots.txt group applying to it")
+	fs.BoolVar(&c.fetch, "fetch", false, "Download the robots.txt and security.txt of the sitemap hosts not available next to the list")
+}
+
+func (*robotsConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (c *robotsConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, Host: c.host, UserAgent: c.userAgent, Fetch: c.fetch})
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// RoundTripper is implemented by the converters that can export rulesets
+// back to their source format. RoundTrip exports the rulesets converted
+// from source with opts and reports the source values lost on the way.
+type RoundTripper interface {
+	RoundTrip(source []byte, rulesets []crowler.Ruleset, opts Options) (*RoundTripReport, error)
+}
+
+// FieldStats counts the values of a source field and the ones lost
+type FieldStats struct {
+	Total int
+	Lost  int
+}
+
+// RoundTripReport tells, per source field, how many values survived a
+// round trip and which were lost
+type RoundTripReport struct {
+	// Objects is the number of objects (technologies, plugins, ...)
+	// compared
+	Objects int
+	Fields  map[string]*FieldStats
+	// Losses lists the lost values of each object, as field: value
+	Losses map[string][]string
+}
+
+// NewRoundTripReport returns an empty report
+func NewRoundTripReport() *RoundTripReport {
+	return &RoundTripReport{
+		Fields: make(map[string]*FieldStats),
+		Losses: make(map[string][]string),
+	}
+}
+
+// Compare records the values of a field of object in the source and the
+// ones found after the round trip. The values are compared as strings,
+// the caller canonicalizes them.
+func (r *RoundTripReport) Compare(object, field string, source, roundTrip []string) {
+	if len(source) == 0 {
+		return
+	}
+	stats := r.Fields[field]
+	if stats == nil {
+		stats = &FieldStats{}
+		r.Fields[field] = stats
+	}
+	found := make(map[string]bool, len(roundTrip))
+	for _, v := range roundTrip {
+		found[v] = true
+	}
+	for _, v := range source {
+		stats.Total++
+		if !found[v] {
+			stats.Lost++
+			r.Losses[object] = append(r.Losses[object], field+": "+v)
+		}
+	}
+}
+
+// Write writes the lost values by object, then the loss statistics of
+// each field
+func (r *RoundTripReport) Write(w io.Writer) error {
+	objects := make([]string, 0, len(r.Losses))
+	for object := range r.Losses {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	for _, object := range objects {
+		fmt.Fprintf(w, "%s:\n", object)
+		for _, loss := range r.Losses[object] {
+			fmt.Fprintf(w, "  lost %s\n", loss)
+		}
+	}
+
+	fields := make([]string, 0, len(r.Fields))
+	for field := range r.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	fmt.Fprintf(w, "\nRound trip of %d objects, %d with losses:\n", r.Objects, len(r.Losses))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "field\tvalues\tlost\tlost %")
+	for _, field := range fields {
+		stats := r.Fields[field]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\n", field, stats.Total, stats.Lost, float64(stats.Lost)*100/float64(stats.Total))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,368 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schemaorg generates CROWler scraping rules for schema.org
+// types: a ruleset per type with JSON-LD, microdata and RDFa selectors
+// for each of its properties, the inherited ones included.
+package schemaorg
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "schema.org"
+	// DefaultSourceLicense is the license of the schema.org vocabulary
+	DefaultSourceLicense = "CC-BY-SA-3.0"
+)
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Types are schema.org types to generate rules for, besides the ones
+	// listed in the input
+	Types []string
+	// VocabPath is the path to the schema.org JSON-LD vocabulary (empty
+	// uses a built-in subset)
+	VocabPath string
+}
+
+// Vocabulary holds the schema.org types and their properties
+type Vocabulary struct {
+	Parents    map[string][]string
+	Properties map[string][]string
+}
+
+// builtinVocabulary covers the most common schema.org types, use -vocab
+// with the official schema.org JSON-LD file for everything else.
+var builtinVocabulary = Vocabulary{
+	Parents: map[string][]string{
+		"CreativeWork":  {"Thing"},
+		"Article":       {"CreativeWork"},
+		"NewsArticle":   {"Article"},
+		"BlogPosting":   {"Article"},
+		"Review":        {"CreativeWork"},
+		"Recipe":        {"CreativeWork"},
+		"Product":       {"Thing"},
+		"Offer":         {"Thing"},
+		"JobPosting":    {"Thing"},
+		"Event":         {"Thing"},
+		"Organization":  {"Thing"},
+		"LocalBusiness": {"Organization"},
+		"Person":        {"Thing"},
+	},
+	Properties: map[string][]string{
+		"Thing":         {"name", "alternateName", "description", "url", "image", "identifier", "sameAs"},
+		"CreativeWork":  {"headline", "author", "publisher", "datePublished", "dateModified", "keywords", "inLanguage"},
+		"Article":       {"articleBody", "articleSection", "wordCount"},
+		"Review":        {"itemReviewed", "reviewRating", "reviewBody"},
+		"Recipe":        {"recipeIngredient", "recipeInstructions", "recipeYield", "recipeCategory", "recipeCuisine", "prepTime", "cookTime", "totalTime", "nutrition"},
+		"Product":       {"brand", "sku", "gtin", "mpn", "model", "color", "category", "offers", "aggregateRating", "review"},
+		"Offer":         {"price", "priceCurrency", "availability", "seller", "validFrom", "priceValidUntil"},
+		"JobPosting":    {"title", "datePosted", "validThrough", "employmentType", "hiringOrganization", "jobLocation", "baseSalary", "occupationalCategory", "qualifications", "responsibilities", "skills"},
+		"Event":         {"startDate", "endDate", "location", "organizer", "performer", "eventStatus", "eventAttendanceMode", "offers"},
+		"Organization":  {"legalName", "logo", "address", "telephone", "email", "founder", "foundingDate", "contactPoint"},
+		"LocalBusiness": {"openingHours", "priceRange", "geo"},
+		"Person":        {"givenName", "familyName", "jobTitle", "worksFor", "email", "telephone", "birthDate", "address"},
+	},
+}
+
+// multiValued lists the properties that usually appear more than once
+var multiValued = map[string]bool{
+	"image":              true,
+	"sameAs":             true,
+	"author":             true,
+	"keywords":           true,
+	"review":             true,
+	"recipeIngredient":   true,
+	"recipeInstructions": true,
+	"skills":             true,
+	"performer":          true,
+	"offers":             true,
+}
+
+// idValues returns the schema.org names from JSON-LD references such as
+// {"@id": "schema:Thing"}
+func idValues(v interface{}) []string {
+	var ids []string
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if id, ok := val["@id"].(string); ok {
+			ids = append(ids, strings.TrimPrefix(id, "schema:"))
+		}
+	case []interface{}:
+		for _, item := range val {
+			ids = append(ids, idValues(item)...)
+		}
+	}
+	return ids
+}
+
+// loadVocabulary reads the official schema.org JSON-LD vocabulary
+// (schemaorg-current-https.jsonld)
+func loadVocabulary(path string) (Vocabulary, error) {
+	vocab := Vocabulary{
+		Parents:    make(map[string][]string),
+		Properties: make(map[string][]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return vocab, err
+	}
+
+	var doc struct {
+		Graph []map[string]interface{} `json:"@graph"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return vocab, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	for _, node := range doc.Graph {
+		id, _ := node["@id"].(string)
+		name := strings.TrimPrefix(id, "schema:")
+		types := []string{}
+		switch t := node["@type"].(type) {
+		case string:
+			types = append(types, t)
+		case []interface{}:
+			for _, item := range t {
+				if s, ok := item.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		for _, t := range types {
+			switch t {
+			case "rdfs:Class":
+				vocab.Parents[name] = idValues(node["rdfs:subClassOf"])
+			case "rdf:Property":
+				for _, domain := range idValues(node["schema:domainIncludes"]) {
+					vocab.Properties[domain] = append(vocab.Properties[domain], name)
+				}
+			}
+		}
+	}
+
+	return vocab, nil
+}
+
+// typeProperties returns the properties of a type, including the
+// inherited ones, most generic first
+func (v Vocabulary) typeProperties(typeName string) []string {
+	var props []string
+	seenType := make(map[string]bool)
+	seenProp := make(map[string]bool)
+
+	var walk func(t string)
+	walk = func(t string) {
+		if seenType[t] {
+			return
+		}
+		seenType[t] = true
+		for _, parent := range v.Parents[t] {
+			walk(parent)
+		}
+		for _, p := range v.Properties[t] {
+			if !seenProp[p] {
+				seenProp[p] = true
+				props = append(props, p)
+			}
+		}
+	}
+	walk(typeName)
+
+	return props
+}
+
+// isKnown returns true if the type is defined in the vocabulary
+func (v Vocabulary) isKnown(typeName string) bool {
+	_, hasParents := v.Parents[typeName]
+	_, hasProps := v.Properties[typeName]
+	return hasParents || hasProps
+}
+
+// createElement builds the selectors for a property: JSON-LD first, then
+// microdata and RDFa markup
+func createElement(typeName, property string) crowler.Element {
+	scope := fmt.Sprintf("[itemtype$='schema.org/%s']", typeName)
+	all := multiValued[property]
+	return crowler.Element{
+		Key: property,
+		Selectors: []crowler.Selector{
+			{
+				SelectorType:          "json_ld",
+				Selector:              typeName + "." + property,
+				ExtractAllOccurrences: all,
+			},
+			{
+				SelectorType:          "css",
+				Selector:              fmt.Sprintf("%s meta[itemprop='%s']", scope, property),
+				Attribute:             "content",
+				ExtractAllOccurrences: all,
+			},
+			{
+				SelectorType:          "css",
+				Selector:              fmt.Sprintf("%s [itemprop='%s']", scope, property),
+				ExtractAllOccurrences: all,
+			},
+			{
+				SelectorType:          "css",
+				Selector:              fmt.Sprintf("[typeof='%s'] [property='%s']", typeName, property),
+				ExtractAllOccurrences: all,
+			},
+		},
+	}
+}
+
+// createScrapingRule builds a scraping rule for a schema.org type
+func createScrapingRule(vocab Vocabulary, typeName string) crowler.ScrapingRule {
+	rule := crowler.ScrapingRule{
+		RuleName: "scrape_" + toSnake(typeName),
+	}
+	for _, property := range vocab.typeProperties(typeName) {
+		rule.Elements = append(rule.Elements, createElement(typeName, property))
+	}
+	return rule
+}
+
+var snakeRe = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// toSnake converts a schema.org type name (JobPosting) to snake case
+// (job_posting)
+func toSnake(name string) string {
+	return slug.Make(snakeRe.ReplaceAllString(name, "${1}_${2}"))
+}
+
+// Convert generates a scraping ruleset for each schema.org type listed in
+// r, one per line, and in opts.Types
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	typeNames := append([]string{}, opts.Types...)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := scanner.Text(); !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			typeNames = append(typeNames, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading types: %v", err)
+	}
+
+	vocab := builtinVocabulary
+	if opts.VocabPath != "" {
+		var err error
+		vocab, err = loadVocabulary(opts.VocabPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading schema.org vocabulary: %v", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var rulesets []crowler.Ruleset
+	for _, typeName := range typeNames {
+		typeName = strings.TrimPrefix(strings.TrimSpace(typeName), "schema:")
+		if typeName == "" || seen[typeName] {
+			continue
+		}
+		seen[typeName] = true
+		opts.Processed(1)
+		if !vocab.isKnown(typeName) {
+			err := errors.New("unknown schema.org type (use -vocab with the full schema.org vocabulary)")
+			if err := opts.Skip("type "+typeName, err); err != nil {
+				return nil, fmt.Errorf("type %s: %v", typeName, err)
+			}
+			continue
+		}
+
+		rule := createScrapingRule(vocab, typeName)
+		typeSlug := toSnake(typeName)
+		ruleset := crowler.NewRuleset(fmt.Sprintf("scrape_%s_ruleset", typeSlug),
+			fmt.Sprintf("Ruleset to scrape schema.org %s data (JSON-LD, microdata and RDFa).", typeName))
+		ruleset.Source = SourceName
+		ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+		ruleset.FileName = fmt.Sprintf("scrape-%s-ruleset.yaml", strings.ReplaceAll(typeSlug, "_", "-"))
+		ruleset.RuleGroups = []crowler.RuleGroup{
+			{
+				GroupName:      "scrape_schema_org_" + typeSlug,
+				IsEnabled:      true,
+				DetectionRules: []crowler.DetectionRule{},
+				ScrapingRules:  []crowler.ScrapingRule{rule},
+			},
+		}
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		rulesets = append(rulesets, ruleset)
+	}
+
+	if len(seen) == 0 {
+		return nil, errors.New("no schema.org types given, use -types or -i")
+	}
+	return rulesets, nil
+}
+
+func init() {
+	converter.Register(&schemaOrgConverter{})
+}
+
+// schemaOrgConverter is the registered schema.org converter
+type schemaOrgConverter struct {
+	types     string
+	vocabPath string
+}
+
+func (*schemaOrgConverter) Name() string { return "schemaorg" }
+
+func (*schemaOrgConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Generate scraping rules for schema.org types",
+		Input:          "Path to a file listing schema.org types, one per line (alternative to -types)",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect never recognizes the input, a list of types has no marker
+func (*schemaOrgConverter) Detect(input []byte) bool {
+	return false
+}
+
+func (c *schemaOrgConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.types, "types", "", "Comma separated list of schema.org types (e.g. Product,JobPosting,Article)")
+	fs.StringVar(&c.vocabPath, "vocab", "", "Path to the schema.org JSON-LD vocabulary (defaults to a built-in subset)")
+}
+
+// Generates tells if -types is given, the rulesets need no input then
+func (c *schemaOrgConverter) Generates() bool {
+	return c.types != ""
+}
+
+func (c *schemaOrgConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	var types []string
+	if c.types != "" {
+		types = strings.Split(c.types, ",")
+	}
+	return Convert(r, Options{Options: opts, Types: types, VocabPath: c.vocabPath})
+}
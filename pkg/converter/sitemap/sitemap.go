@@ -0,0 +1,307 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sitemap converts the sitemaps of sites into CROWler crawling
+// rules: a ruleset per host with the seed URLs of its sitemap, their
+// priority and a recrawl hint derived from their change frequency.
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/fetch"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "sitemap"
+	// DefaultSourceLicense is used when the license of the sitemaps isn't
+	// given, the sites don't license them
+	DefaultSourceLicense = "NOASSERTION"
+)
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Fetch downloads the nested sitemaps not available next to the input
+	Fetch bool
+	// MaxURLs is the maximum number of seed URLs per host, the ones with
+	// the highest priority are kept (0 means no limit)
+	MaxURLs int
+}
+
+// Define the structure of sitemap.xml and sitemap index files
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL   `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// recrawlHints maps sitemap change frequencies to recrawl intervals.
+// "never" (archived URLs) has no recrawl hint.
+var recrawlHints = map[string]string{
+	"always":  "1h",
+	"hourly":  "1h",
+	"daily":   "24h",
+	"weekly":  "168h",
+	"monthly": "720h",
+	"yearly":  "8760h",
+}
+
+// sitemapLoader reads sitemaps from local files and, optionally, from
+// the network
+type sitemapLoader struct {
+	baseDir string
+	fetch   bool
+	seen    map[string]bool
+}
+
+// open returns the content of a sitemap, resolving remote locations to
+// local files in baseDir first
+func (l *sitemapLoader) open(loc string) ([]byte, error) {
+	u, err := url.Parse(loc)
+	switch {
+	case err != nil || u.Scheme == "":
+		if !filepath.IsAbs(loc) {
+			loc = filepath.Join(l.baseDir, loc)
+		}
+		return os.ReadFile(loc)
+	case fileExists(filepath.Join(l.baseDir, filepath.Base(u.Path))):
+		return os.ReadFile(filepath.Join(l.baseDir, filepath.Base(u.Path)))
+	case l.fetch:
+		local, err := fetch.URL(loc)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(local)
+	default:
+		return nil, fmt.Errorf("sitemap %s not found locally (use -fetch to download it)", loc)
+	}
+}
+
+// load reads a sitemap or a sitemap index and returns all the URLs found,
+// following nested sitemap indexes
+func (l *sitemapLoader) load(loc string) ([]sitemapURL, error) {
+	if l.seen[loc] {
+		return nil, nil // avoid loops between sitemap indexes
+	}
+	data, err := l.open(loc)
+	if err != nil {
+		return nil, err
+	}
+	return l.parse(loc, data)
+}
+
+// parse reads the content of the sitemap loc, following the nested
+// sitemaps of an index
+func (l *sitemapLoader) parse(loc string, data []byte) ([]sitemapURL, error) {
+	l.seen[loc] = true
+
+	// Sitemaps are often gzipped
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", loc, err)
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset":
+		return doc.URLs, nil
+	case "sitemapindex":
+		var urls []sitemapURL
+		for _, entry := range doc.Sitemaps {
+			child, err := l.load(strings.TrimSpace(entry.Loc))
+			if err != nil {
+				return nil, err
+			}
+			urls = append(urls, child...)
+		}
+		return urls, nil
+	default:
+		return nil, fmt.Errorf("%s is not a sitemap (root element %s)", loc, doc.XMLName.Local)
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// createSeedURL converts a sitemap URL entry into a seed URL
+func createSeedURL(entry sitemapURL) crowler.SeedURL {
+	seed := crowler.SeedURL{
+		URL:          strings.TrimSpace(entry.Loc),
+		Priority:     0.5, // sitemap protocol default
+		LastModified: strings.TrimSpace(entry.LastMod),
+		RecrawlAfter: recrawlHints[strings.ToLower(strings.TrimSpace(entry.ChangeFreq))],
+	}
+	if p, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 32); err == nil && p >= 0 && p <= 1 {
+		seed.Priority = float32(p)
+	}
+	return seed
+}
+
+// Convert converts the sitemap or sitemap index read from r into a
+// crawling ruleset per host. The nested sitemaps are looked up in
+// opts.Dir, or else downloaded with opts.Fetch.
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	loader := &sitemapLoader{
+		baseDir: opts.Dir,
+		fetch:   opts.Fetch,
+		seen:    make(map[string]bool),
+	}
+	urls, err := loader.parse(opts.FileName, data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sitemap: %v", err)
+	}
+
+	// Group the seed URLs by host
+	seeds := make(map[string][]crowler.SeedURL)
+	for _, entry := range urls {
+		opts.Processed(1)
+		seed := createSeedURL(entry)
+		u, err := url.Parse(seed.URL)
+		if err != nil || u.Host == "" {
+			if err := opts.Skip("url "+seed.URL, errors.New("invalid URL")); err != nil {
+				return nil, fmt.Errorf("url %s: %v", seed.URL, err)
+			}
+			continue
+		}
+		seeds[u.Host] = append(seeds[u.Host], seed)
+	}
+
+	hosts := make([]string, 0, len(seeds))
+	for host := range seeds {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	// One ruleset per host
+	var rulesets []crowler.Ruleset
+	for _, host := range hosts {
+		hostSeeds := seeds[host]
+		// Most important URLs first, so MaxURLs keeps the best seeds
+		sort.SliceStable(hostSeeds, func(i, j int) bool {
+			return hostSeeds[i].Priority > hostSeeds[j].Priority
+		})
+		if opts.MaxURLs > 0 && len(hostSeeds) > opts.MaxURLs {
+			hostSeeds = hostSeeds[:opts.MaxURLs]
+		}
+
+		hostSlug := slug.Make(host)
+		ruleset := crowler.NewRuleset(fmt.Sprintf("crawl_%s_ruleset", hostSlug),
+			fmt.Sprintf("Crawling rules for %s generated from its sitemap.", host))
+		ruleset.Source = SourceName
+		ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+		ruleset.FileName = fmt.Sprintf("crawl-%s-ruleset.yaml", slug.File(host))
+		ruleset.RuleGroups = []crowler.RuleGroup{
+			{
+				GroupName:      "crawl_" + hostSlug,
+				IsEnabled:      true,
+				DetectionRules: []crowler.DetectionRule{},
+				CrawlingRules: []crowler.CrawlingRule{
+					{
+						RuleName:    "crawl_" + hostSlug + "_sitemap",
+						RequestType: "GET",
+						SeedURLs:    hostSeeds,
+					},
+				},
+			},
+		}
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		rulesets = append(rulesets, ruleset)
+	}
+	return rulesets, nil
+}
+
+func init() {
+	converter.Register(&sitemapConverter{})
+}
+
+// sitemapConverter is the registered sitemap converter
+type sitemapConverter struct {
+	fetch   bool
+	maxURLs int
+}
+
+func (*sitemapConverter) Name() string { return "sitemap" }
+
+func (*sitemapConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert sitemaps to crawling rules with their seed URLs",
+		Input:          "Path to the sitemap.xml or sitemap index file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// rootRe matches the root element of a sitemap or a sitemap index
+var rootRe = regexp.MustCompile(`<(?:urlset|sitemapindex)[\s>]`)
+
+// Detect recognizes a sitemap or a sitemap index, the gzipped ones have to
+// be converted with sitemap
+func (*sitemapConverter) Detect(input []byte) bool {
+	return rootRe.Match(input)
+}
+
+func (c *sitemapConverter) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.fetch, "fetch", false, "Download nested sitemaps not available next to the input file")
+	fs.IntVar(&c.maxURLs, "max-urls", 0, "Maximum number of seed URLs per host (0 means no limit)")
+}
+
+func (c *sitemapConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, Fetch: c.fetch, MaxURLs: c.maxURLs})
+}
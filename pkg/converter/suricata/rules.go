@@ -0,0 +1,210 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package suricata
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+)
+
+// Rule is a Suricata (or Snort) rule: its header and its options, in
+// order
+type Rule struct {
+	Action   string
+	Protocol string
+	Options  []Option
+	// File is the rule file of the rule when it was read from a directory
+	// (see ReadDir), Line its line in the file
+	File string
+	Line int
+}
+
+// Option is a rule option, with its value unquoted (empty for the flags
+// such as nocase)
+type Option struct {
+	Name  string
+	Value string
+}
+
+// Get returns the value of the first option called name
+func (r Rule) Get(name string) string {
+	for _, o := range r.Options {
+		if o.Name == name {
+			return o.Value
+		}
+	}
+	return ""
+}
+
+// ruleRe matches a rule: action, protocol, addresses, ports and the
+// options in parentheses
+var ruleRe = regexp.MustCompile(`^(alert|drop|reject|rejectsrc|rejectdst|rejectboth|pass|log|sdrop)\s+(\S+)\s+\S+\s+\S+\s+(?:->|<>)\s+\S+\s+\S+\s*\((.*)\)\s*$`)
+
+// actionRe matches the start of a rule, the lines starting with an action
+// which ruleRe doesn't match are malformed rules
+var actionRe = regexp.MustCompile(`^(alert|drop|reject|rejectsrc|rejectdst|rejectboth|pass|log|sdrop)\s`)
+
+// fileMarker starts the comment ReadDir writes before each rule file
+const fileMarker = "# file: "
+
+// ParseRules reads the rules of a rule file. The commented out (disabled)
+// rules and the lines that aren't rules are skipped, the rules split on
+// several lines with a trailing backslash are joined. The malformed rules
+// are skipped with opts.Skip.
+func ParseRules(r io.Reader, opts converter.Options) ([]Rule, error) {
+	var rules []Rule
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var current strings.Builder
+	file := ""
+	lineNo, start := 0, 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if current.Len() == 0 {
+			if name, ok := strings.CutPrefix(line, fileMarker); ok {
+				file, lineNo = name, 0
+				continue
+			}
+			start = lineNo
+		}
+		if strings.HasSuffix(line, `\`) {
+			current.WriteString(strings.TrimSuffix(line, `\`))
+			continue
+		}
+		current.WriteString(line)
+		text := current.String()
+		current.Reset()
+
+		m := ruleRe.FindStringSubmatch(text)
+		if m == nil {
+			if actionRe.MatchString(text) {
+				entry := fmt.Sprintf("rule at line %d", start)
+				if file != "" {
+					entry = fmt.Sprintf("rule at %s:%d", file, start)
+				}
+				if err := opts.Skip(entry, errors.New("malformed rule header or options")); err != nil {
+					return nil, fmt.Errorf("%s: %v", entry, err)
+				}
+			}
+			continue
+		}
+		rules = append(rules, Rule{
+			Action:   m[1],
+			Protocol: strings.ToLower(m[2]),
+			Options:  parseOptions(m[3]),
+			File:     file,
+			Line:     start,
+		})
+	}
+	return rules, scanner.Err()
+}
+
+// parseOptions splits the options of a rule on the semicolons outside the
+// quoted values
+func parseOptions(s string) []Option {
+	var options []Option
+	var b strings.Builder
+	quoted := false
+	flush := func() {
+		text := strings.TrimSpace(b.String())
+		b.Reset()
+		if text == "" {
+			return
+		}
+		name, value, _ := strings.Cut(text, ":")
+		options = append(options, Option{Name: strings.TrimSpace(name), Value: unquote(strings.TrimSpace(value))})
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			b.WriteByte(c)
+			b.WriteByte(s[i+1])
+			i++
+		case c == '"':
+			quoted = !quoted
+			b.WriteByte(c)
+		case c == ';' && !quoted:
+			flush()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return options
+}
+
+// unquote removes the quotes around a value and resolves the escaped
+// quotes, semicolons and backslashes. The negation of a content
+// (!"...") is kept.
+func unquote(value string) string {
+	negated := strings.HasPrefix(value, "!")
+	v := strings.TrimSpace(strings.TrimPrefix(value, "!"))
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return value
+	}
+	v = v[1 : len(v)-1]
+	var b strings.Builder
+	if negated {
+		b.WriteByte('!')
+	}
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) && strings.IndexByte(`";\`, v[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+// decodeContent decodes the hex bytes of a content (Server|3a 20|nginx).
+// It returns false if the content has invalid hex bytes.
+func decodeContent(content string) (string, bool) {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(content, '|')
+		if start < 0 {
+			b.WriteString(content)
+			return b.String(), true
+		}
+		end := strings.IndexByte(content[start+1:], '|')
+		if end < 0 {
+			return "", false
+		}
+		b.WriteString(content[:start])
+		for _, h := range strings.Fields(content[start+1 : start+1+end]) {
+			for len(h) >= 2 {
+				n, err := strconv.ParseUint(h[:2], 16, 8)
+				if err != nil {
+					return "", false
+				}
+				b.WriteByte(byte(n))
+				h = h[2:]
+			}
+			if h != "" {
+				return "", false
+			}
+		}
+		content = content[start+1+end+1:]
+	}
+}
@@ -0,0 +1,530 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package suricata converts the HTTP rules of Suricata (and Snort) rule
+// files into CROWler detection rules. The content and pcre matches on the
+// HTTP buffers the crawler sees (the requested URL, the response headers
+// and body) become URL, header and page content signatures; the rule msg
+// and classtype are kept in the rule metadata. The rules on other
+// protocols are skipped and reported.
+package suricata
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Suricata/Snort rules"
+	// DefaultSourceLicense is used when the license of the rules isn't
+	// given, the rule sets come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+)
+
+// The HTTP buffers with a CROWler signature
+const (
+	bufferURI         = "uri"
+	bufferHeader      = "header"
+	bufferCookie      = "cookie"
+	bufferBody        = "body"
+	bufferServer      = "server"
+	bufferLocation    = "location"
+	bufferContentType = "content_type"
+)
+
+// buffers maps the Suricata sticky buffers and the Snort content
+// modifiers to the HTTP buffers. The request buffers but the URI (the
+// method, the user agent, the request body...) are mapped to "", the
+// crawler sends them.
+var buffers = map[string]string{
+	"http.uri":             bufferURI,
+	"http.uri.raw":         bufferURI,
+	"http_uri":             bufferURI,
+	"http_raw_uri":         bufferURI,
+	"http.header":          bufferHeader,
+	"http.header.raw":      bufferHeader,
+	"http_header":          bufferHeader,
+	"http_raw_header":      bufferHeader,
+	"http.cookie":          bufferCookie,
+	"http_cookie":          bufferCookie,
+	"http_raw_cookie":      bufferCookie,
+	"http.response_body":   bufferBody,
+	"http_server_body":     bufferBody,
+	"file.data":            bufferBody,
+	"file_data":            bufferBody,
+	"http.server":          bufferServer,
+	"http.location":        bufferLocation,
+	"http.content_type":    bufferContentType,
+	"http.method":          "",
+	"http_method":          "",
+	"http.user_agent":      "",
+	"http_user_agent":      "",
+	"http.host":            "",
+	"http.host.raw":        "",
+	"http_host":            "",
+	"http_raw_host":        "",
+	"http.request_body":    "",
+	"http_client_body":     "",
+	"http.request_line":    "",
+	"http.request_header":  "",
+	"http.response_line":   "",
+	"http.response_header": "",
+	"http.stat_code":       "",
+	"http_stat_code":       "",
+	"http.stat_msg":        "",
+	"http_stat_msg":        "",
+	"http.header_names":    "",
+	"http.accept":          "",
+	"http.accept_enc":      "",
+	"http.accept_lang":     "",
+	"http.connection":      "",
+	"http.referer":         "",
+	"http.protocol":        "",
+	"http.start":           "",
+	"http.content_len":     "",
+	"pkt_data":             "",
+}
+
+// pcreBuffers maps the Snort pcre buffer flags to the HTTP buffers
+var pcreBuffers = map[byte]string{
+	'U': bufferURI,
+	'I': bufferURI,
+	'H': bufferHeader,
+	'D': bufferHeader,
+	'C': bufferCookie,
+	'K': bufferCookie,
+	'P': "",
+	'M': "",
+	'S': "",
+	'Y': "",
+	'V': "",
+	'W': "",
+}
+
+// match is a content or pcre match of a rule, as a regex on its buffer
+type match struct {
+	buffer  string
+	pattern string
+	// sticky tells if buffer was given (otherwise the match is on the
+	// raw payload)
+	sticky bool
+}
+
+// headerRe matches the header name at the start of a header buffer
+// pattern (Server: , Server\x3a\x20)
+var headerRe = regexp.MustCompile(`^\^?([A-Za-z][A-Za-z0-9-]*)(?::|\\x3[aA])(?: |\\x20|\\s\*|\\s\+|\\s)?`)
+
+// pcrePattern converts a pcre option (/regex/flags) into a Go regex and
+// its buffer flag. It returns false for the regexes Go can't compile and
+// the extended mode.
+func pcrePattern(value string) (string, byte, bool) {
+	negated := strings.HasPrefix(value, "!")
+	end := strings.LastIndexByte(value, '/')
+	if negated || !strings.HasPrefix(value, "/") || end <= 0 {
+		return "", 0, false
+	}
+	pattern, flags := value[1:end], value[end+1:]
+	goFlags := ""
+	var buffer byte
+	for i := 0; i < len(flags); i++ {
+		switch f := flags[i]; f {
+		case 'i', 's', 'm':
+			goFlags += string(f)
+		case 'x':
+			return "", 0, false
+		default:
+			if _, ok := pcreBuffers[f]; ok {
+				buffer = f
+			}
+		}
+	}
+	if goFlags != "" {
+		pattern = "(?" + goFlags + ")" + pattern
+	}
+	pattern, err := normalize.Translate(pattern)
+	if err != nil {
+		return "", 0, false
+	}
+	return pattern, buffer, true
+}
+
+// parseMatches reads the content and pcre matches of a rule, with the
+// buffer they apply to. The negated matches are skipped.
+func parseMatches(rule Rule) []match {
+	var matches []match
+	sticky, hasSticky := "", false
+	var content *match
+	var nocase, startsWith, endsWith bool
+	flush := func() {
+		if content == nil {
+			return
+		}
+		if startsWith {
+			content.pattern = "^" + content.pattern
+		}
+		if endsWith {
+			content.pattern += "$"
+		}
+		if nocase {
+			content.pattern = "(?i)" + content.pattern
+		}
+		matches = append(matches, *content)
+		content = nil
+	}
+
+	for _, o := range rule.Options {
+		buffer, isBuffer := buffers[o.Name]
+		switch {
+		case o.Name == "content":
+			flush()
+			nocase, startsWith, endsWith = false, false, false
+			if strings.HasPrefix(o.Value, "!") {
+				continue
+			}
+			value, ok := decodeContent(o.Value)
+			if !ok {
+				continue
+			}
+			content = &match{buffer: sticky, pattern: regexp.QuoteMeta(value), sticky: hasSticky}
+		case o.Name == "nocase":
+			nocase = true
+		case o.Name == "startswith":
+			startsWith = true
+		case o.Name == "endswith":
+			endsWith = true
+		case o.Name == "pcre":
+			flush()
+			pattern, flag, ok := pcrePattern(o.Value)
+			if !ok {
+				continue
+			}
+			m := match{buffer: sticky, pattern: pattern, sticky: hasSticky}
+			if flag != 0 {
+				m.buffer, m.sticky = pcreBuffers[flag], true
+			}
+			matches = append(matches, m)
+		case isBuffer && content != nil && !strings.Contains(o.Name, "."):
+			// A Snort content modifier, after its content
+			content.buffer, content.sticky = buffer, true
+		case isBuffer:
+			flush()
+			sticky, hasSticky = buffer, o.Name != "pkt_data"
+		}
+	}
+	flush()
+	return matches
+}
+
+// direction returns the direction of the flow of a rule: to_client,
+// to_server or "" if the rule doesn't tell
+func direction(rule Rule) string {
+	for _, f := range strings.Split(rule.Get("flow"), ",") {
+		switch strings.TrimSpace(f) {
+		case "to_client", "from_server":
+			return "to_client"
+		case "to_server", "from_client":
+			return "to_server"
+		}
+	}
+	return ""
+}
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			h.Value = append(h.Value, pattern)
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// headerPattern splits a pattern on the header lines into the header name
+// and the value pattern, keeping the flags of the pattern
+func headerPattern(pattern string) (string, string, bool) {
+	flags := ""
+	if strings.HasPrefix(pattern, "(?") {
+		end := strings.IndexByte(pattern, ')')
+		flags, pattern = pattern[:end+1], pattern[end+1:]
+	}
+	// The content patterns are quoted
+	unquoted := strings.ReplaceAll(pattern, `\-`, "-")
+	loc := headerRe.FindStringSubmatchIndex(unquoted)
+	if loc == nil {
+		return "", "", false
+	}
+	// An empty value matches the header being there, as in Wappalyzer
+	value := unquoted[loc[1]:]
+	if value == "" {
+		return unquoted[loc[2]:loc[3]], "", true
+	}
+	return unquoted[loc[2]:loc[3]], flags + value, true
+}
+
+// addMatch adds the signature of a match to rule. It returns false if the
+// match is on a buffer the crawler doesn't see, or on the raw payload.
+func addMatch(rule *crowler.DetectionRule, m match, flow string) bool {
+	if !m.sticky {
+		return false
+	}
+	switch m.buffer {
+	case bufferURI:
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  m.pattern,
+			Confidence: crowler.DefaultConfidence,
+		})
+	case bufferBody:
+		if flow == "to_server" {
+			return false
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Signature:  []string{m.pattern},
+			Confidence: crowler.DefaultConfidence,
+		})
+	case bufferServer:
+		appendHeader(rule, "Server", m.pattern)
+	case bufferLocation:
+		appendHeader(rule, "Location", m.pattern)
+	case bufferContentType:
+		appendHeader(rule, "Content-Type", m.pattern)
+	case bufferCookie:
+		// The cookies of the responses are in Set-Cookie
+		if flow != "to_client" {
+			return false
+		}
+		appendHeader(rule, "Set-Cookie", m.pattern)
+	case bufferHeader:
+		// The header buffer of the requests holds the crawler headers
+		if flow != "to_client" {
+			return false
+		}
+		key, value, ok := headerPattern(m.pattern)
+		if !ok {
+			return false
+		}
+		appendHeader(rule, key, value)
+	default:
+		return false
+	}
+	return true
+}
+
+// isHTTP tells if a rule is on HTTP: its protocol, or the Snort tcp rules
+// using HTTP buffers
+func isHTTP(rule Rule) bool {
+	if strings.HasPrefix(rule.Protocol, "http") {
+		return true
+	}
+	if rule.Protocol != "tcp" && rule.Protocol != "ip" {
+		return false
+	}
+	for _, o := range rule.Options {
+		if _, ok := buffers[o.Name]; ok && o.Name != "pkt_data" {
+			return true
+		}
+		if o.Name == "pcre" {
+			if _, flag, ok := pcrePattern(o.Value); ok && flag != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// convertRule converts a rule into a detection rule. It returns false if
+// none of its matches has a CROWler signature. The matches of a rule must
+// all match, so do the CROWler signatures.
+func convertRule(r Rule) (crowler.DetectionRule, bool) {
+	msg := r.Get("msg")
+	sid := r.Get("sid")
+	name := msg
+	if name == "" {
+		name = "Suricata rule " + sid
+	}
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_suricata_" + slug.Make(sid),
+		ObjectName: name,
+		Metadata: &crowler.RuleMetadata{
+			Description:   msg,
+			ClassType:     r.Get("classtype"),
+			SourceVersion: r.Get("rev"),
+		},
+	}
+	if sid == "" {
+		rule.RuleName = "detect_" + slug.Make(name)
+	}
+
+	flow := direction(r)
+	converted := false
+	for _, m := range parseMatches(r) {
+		if addMatch(&rule, m, flow) {
+			converted = true
+		}
+	}
+	return rule, converted
+}
+
+// Convert converts the HTTP rules of a Suricata or Snort rule file into a
+// ruleset with a rule per Suricata rule. The rules on other protocols,
+// and the ones only matching what the crawler sends, are reported.
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	rules, err := ParseRules(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules: %v", err)
+	}
+
+	ruleset := crowler.NewRuleset("detect_suricata_http_rules", "Ruleset to detect web applications with the Suricata HTTP rules.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-suricata-http-rules-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_suricata_http_rules",
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	skipped := make(map[string]int)
+	httpRules, converted := 0, 0
+	for _, r := range rules {
+		if !isHTTP(r) {
+			skipped[r.Protocol]++
+			continue
+		}
+		httpRules++
+		rule, ok := convertRule(r)
+		if !ok {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		// The classtype is the category of a Suricata rule
+		rule.Tags = opts.Taxonomy.Tags(rule.Metadata.ClassType)
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	if len(skipped) > 0 {
+		protocols := make([]string, 0, len(skipped))
+		total := 0
+		for protocol, n := range skipped {
+			protocols = append(protocols, fmt.Sprintf("%s: %d", protocol, n))
+			total += n
+		}
+		sort.Strings(protocols)
+		slog.Info("Skipped the rules on other protocols than HTTP", "skipped", total, "protocols", strings.Join(protocols, ", "))
+	}
+	if converted < httpRules {
+		slog.Info("Some HTTP rules only match what the crawler sends or the raw payload",
+			"converted", converted, "total", httpRules)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+// ReadDir merges the rule files in dir (e.g. the rules directory of a
+// ruleset download) into a single stream
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".rules" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// The file names the malformed rules in the errors
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			name = path
+		}
+		stream.WriteString(fileMarker + filepath.ToSlash(name) + "\n")
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no rule files found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
+
+func init() {
+	converter.Register(suricataConverter{})
+}
+
+// suricataConverter is the registered Suricata converter
+type suricataConverter struct{}
+
+func (suricataConverter) Name() string { return "suricata" }
+
+func (suricataConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert the HTTP rules of a Suricata or Snort rule file",
+		Input:          "Path to the Suricata or Snort rules file, or a directory of .rules files",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// detectRe matches a rule line
+var detectRe = regexp.MustCompile(`(?m)^(?:alert|drop|reject|pass)\s+\S+\s+\S+\s+\S+\s+(?:->|<>)\s+\S+\s+\S+\s*\(`)
+
+// Detect recognizes a rule file with at least one rule
+func (suricataConverter) Detect(input []byte) bool {
+	return detectRe.Match(input)
+}
+
+func (suricataConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (suricataConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package techjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+)
+
+// The schemas derived from Wappalyzer's read in compatibility mode
+const (
+	// SchemaTechnologies is the technologies.json schema
+	SchemaTechnologies = "technologies.json"
+	// SchemaApps is the apps.json schema of webanalyze (and of the older
+	// Wappalyzer releases), and of the fingerprints_data.json of httpx
+	// (wappalyzergo): the technologies are under "apps", with numeric
+	// categories, "script" for "scriptSrc", "env" for the global
+	// variables and single strings for the lists
+	SchemaApps = "apps.json"
+)
+
+// appsDocument is an apps.json document, its technologies and
+// categories kept raw to be rewritten
+type appsDocument struct {
+	Apps       map[string]map[string]json.RawMessage `json:"apps"`
+	Categories map[string]json.RawMessage            `json:"categories,omitempty"`
+	Groups     json.RawMessage                       `json:"groups,omitempty"`
+}
+
+// Schema returns the schema of a Wappalyzer derived document, or an
+// empty string if data is neither a technologies.json nor an apps.json
+// document
+func Schema(data []byte) string {
+	var doc struct {
+		Technologies map[string]json.RawMessage `json:"technologies"`
+		Apps         map[string]json.RawMessage `json:"apps"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return ""
+	}
+	switch {
+	case len(doc.Technologies) > 0:
+		return SchemaTechnologies
+	case len(doc.Apps) > 0:
+		return SchemaApps
+	}
+	return ""
+}
+
+// normalizeCategories rewrites the categories written as their name
+// ("1": "CMS", in the older apps.json) as category objects
+func normalizeCategories(categories map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	for id, raw := range categories {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			continue
+		}
+		data, err := json.Marshal(Category{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		categories[id] = data
+	}
+	return categories, nil
+}
+
+// normalizeApp rewrites the fields of an apps.json technology with their
+// technologies.json names and types. It returns false if the technology
+// had global variable patterns ("env"), which have no CROWler signature.
+func normalizeApp(app map[string]json.RawMessage) (bool, error) {
+	if raw, ok := app["cats"]; ok {
+		var cats idList
+		if err := json.Unmarshal(raw, &cats); err != nil {
+			return false, fmt.Errorf("invalid cats: %v", err)
+		}
+		data, err := json.Marshal([]string(cats))
+		if err != nil {
+			return false, err
+		}
+		app["cats"] = data
+	}
+	if raw, ok := app["implies"]; ok {
+		var implies stringList
+		if err := json.Unmarshal(raw, &implies); err != nil {
+			return false, fmt.Errorf("invalid implies: %v", err)
+		}
+		data, err := json.Marshal([]string(implies))
+		if err != nil {
+			return false, err
+		}
+		app["implies"] = data
+	}
+	if raw, ok := app["script"]; ok {
+		var scripts, scriptSrc stringList
+		if err := json.Unmarshal(raw, &scripts); err != nil {
+			return false, fmt.Errorf("invalid script: %v", err)
+		}
+		if raw, ok := app["scriptSrc"]; ok {
+			if err := json.Unmarshal(raw, &scriptSrc); err != nil {
+				return false, fmt.Errorf("invalid scriptSrc: %v", err)
+			}
+		}
+		data, err := json.Marshal(append(scriptSrc, scripts...))
+		if err != nil {
+			return false, err
+		}
+		app["scriptSrc"] = data
+		delete(app, "script")
+	}
+	_, env := app["env"]
+	delete(app, "env")
+	return !env, nil
+}
+
+// normalizeSchema rewrites an apps.json document as a technologies.json
+// one, skipping the technologies that can't be read with opts.Skip. The
+// other documents are returned unchanged.
+func normalizeSchema(data []byte, opts converter.Options) ([]byte, error) {
+	if Schema(data) != SchemaApps {
+		return data, nil
+	}
+	var apps appsDocument
+	if err := json.Unmarshal(data, &apps); err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	names := make([]string, 0, len(apps.Apps))
+	for name := range apps.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	envs := 0
+	for _, name := range names {
+		ok, err := normalizeApp(apps.Apps[name])
+		if err != nil {
+			if err := opts.Skip("technology "+name, err); err != nil {
+				return nil, fmt.Errorf("error reading technology %s: %v", name, err)
+			}
+			delete(apps.Apps, name)
+			continue
+		}
+		if !ok {
+			envs++
+		}
+	}
+	if envs > 0 {
+		slog.Info("Skipped the global variable patterns (env)", "technologies", envs)
+	}
+	categories, err := normalizeCategories(apps.Categories)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := struct {
+		Technologies map[string]map[string]json.RawMessage `json:"technologies"`
+		Categories   map[string]json.RawMessage            `json:"categories,omitempty"`
+		Groups       json.RawMessage                       `json:"groups,omitempty"`
+	}{apps.Apps, categories, apps.Groups}
+	return json.Marshal(doc)
+}
+
+// LoadCategories reads a Wappalyzer categories.json file (or the
+// categories_data.json of httpx)
+func LoadCategories(path string) (map[string]Category, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading categories: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error unmarshalling categories JSON: %v", err)
+	}
+	if raw, err = normalizeCategories(raw); err != nil {
+		return nil, err
+	}
+	categories := make(map[string]Category, len(raw))
+	for id, data := range raw {
+		var category Category
+		if err := json.Unmarshal(data, &category); err != nil {
+			return nil, fmt.Errorf("error unmarshalling category %s: %v", id, err)
+		}
+		categories[id] = category
+	}
+	return categories, nil
+}
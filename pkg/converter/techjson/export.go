@@ -0,0 +1,404 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package techjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/implies"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// groupPrefix is the prefix of the rule groups generated for the
+// categories
+const groupPrefix = "detect_web_technologies_"
+
+// descriptionRe matches the description of the rulesets generated by
+// Convert
+var descriptionRe = regexp.MustCompile(`^Ruleset to detect (.+) technologies\.$`)
+
+// exportedTechnology is a technology of an exported technologies.json,
+// written without its empty fields
+type exportedTechnology struct {
+	Cats             []int                            `json:"cats"`
+	Headers          map[string]string                `json:"headers,omitempty"`
+	Cookies          map[string]string                `json:"cookies,omitempty"`
+	Meta             map[string][]string              `json:"meta,omitempty"`
+	Html             []string                         `json:"html,omitempty"`
+	Text             []string                         `json:"text,omitempty"`
+	CSS              []string                         `json:"css,omitempty"`
+	XHR              []string                         `json:"xhr,omitempty"`
+	Scripts          []string                         `json:"scripts,omitempty"`
+	ScriptSrc        []string                         `json:"scriptSrc,omitempty"`
+	Dom              map[string]*exportedDomCondition `json:"dom,omitempty"`
+	JS               map[string]string                `json:"js,omitempty"`
+	DNS              map[string][]string              `json:"dns,omitempty"`
+	CertIssuer       string                           `json:"certIssuer,omitempty"`
+	URL              []string                         `json:"url,omitempty"`
+	Website          string                           `json:"website,omitempty"`
+	Description      string                           `json:"description,omitempty"`
+	Icon             string                           `json:"icon,omitempty"`
+	Pricing          []string                         `json:"pricing,omitempty"`
+	SaaS             bool                             `json:"saas,omitempty"`
+	OSS              bool                             `json:"oss,omitempty"`
+	CPE              string                           `json:"cpe,omitempty"`
+	Implies          []string                         `json:"implies,omitempty"`
+	Requires         []string                         `json:"requires,omitempty"`
+	RequiresCategory []int                            `json:"requiresCategory,omitempty"`
+	Excludes         []string                         `json:"excludes,omitempty"`
+}
+
+type exportedDomCondition struct {
+	Exists     *string           `json:"exists,omitempty"`
+	Text       string            `json:"text,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ExportOptions holds the settings of an exported technologies.json
+type ExportOptions struct {
+	// Categories are the Wappalyzer categories, matched by name to the
+	// rule groups to keep their IDs. The other rule groups get a new
+	// category.
+	Categories map[string]Category
+}
+
+// Exporter collects CROWler detection rules into a technologies.json
+// document, the reverse of Convert: the signatures go back to their
+// technologies.json fields, with the version and confidence tags, and
+// the rule groups become the categories.
+type Exporter struct {
+	technologies map[string]*exportedTechnology
+	categories   map[string]Category
+	// categoryIDs indexes the category IDs by the slug of their name
+	categoryIDs map[string]int
+	nextID      int
+}
+
+// NewExporter returns an empty exporter
+func NewExporter(opts ExportOptions) *Exporter {
+	e := &Exporter{
+		technologies: make(map[string]*exportedTechnology),
+		categories:   make(map[string]Category),
+		categoryIDs:  make(map[string]int),
+		nextID:       1,
+	}
+	for id, category := range opts.Categories {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			slog.Warn("Skipping category, its ID isn't a number", "category", id)
+			continue
+		}
+		e.categories[id] = category
+		e.categoryIDs[slug.Make(category.Name)] = n
+		e.nextID = max(e.nextID, n+1)
+	}
+	return e
+}
+
+// category returns the ID of the category called name, adding it if
+// it's unknown
+func (e *Exporter) category(name string) int {
+	key := slug.Make(name)
+	if id, ok := e.categoryIDs[key]; ok {
+		return id
+	}
+	id := e.nextID
+	e.nextID++
+	e.categoryIDs[key] = id
+	e.categories[strconv.Itoa(id)] = Category{Name: strings.ReplaceAll(name, "_", " "), Groups: []int{}}
+	return id
+}
+
+// groupCategory returns the category name of a rule group, its name
+// without the namespace and the detect prefix
+func groupCategory(name string) string {
+	if i := strings.Index(name, groupPrefix); i >= 0 {
+		return name[i+len(groupPrefix):]
+	}
+	if i := strings.Index(name, "detect_"); i >= 0 {
+		return name[i+len("detect_"):]
+	}
+	return name
+}
+
+// Add exports the detection rules of a ruleset, in the category of their
+// rule group. The rules of the same object in several groups are merged
+// in one technology with their categories. The signatures
+// technologies.json can't hold (e.g. favicon hashes) are dropped, a rule
+// left without any is kept as a technology only detected by the ones
+// implying it. It returns the number of technologies added.
+func (e *Exporter) Add(ruleset crowler.Ruleset) int {
+	added := 0
+	for _, group := range ruleset.RuleGroups {
+		if len(group.DetectionRules) == 0 {
+			continue
+		}
+		name := groupCategory(group.GroupName)
+		// The rule group name is a slug, the ruleset of a single category
+		// has its name in the description
+		if m := descriptionRe.FindStringSubmatch(ruleset.Description); m != nil && len(ruleset.RuleGroups) == 1 {
+			name = m[1]
+		}
+		cat := e.category(name)
+		for _, rule := range group.DetectionRules {
+			name := rule.ObjectName
+			if name == "" {
+				name = rule.RuleName
+			}
+			if t, ok := e.technologies[name]; ok {
+				if !slices.Contains(t.Cats, cat) {
+					t.Cats = append(t.Cats, cat)
+				}
+				continue
+			}
+			t := e.exportRule(rule)
+			t.Cats = []int{cat}
+			e.technologies[name] = t
+			added++
+		}
+	}
+	return added
+}
+
+// Marshal encodes the exported technologies and their categories
+func (e *Exporter) Marshal() ([]byte, error) {
+	for _, t := range e.technologies {
+		sort.Ints(t.Cats)
+	}
+	doc := struct {
+		Technologies map[string]*exportedTechnology `json:"technologies"`
+		Categories   map[string]Category            `json:"categories"`
+	}{e.technologies, e.categories}
+	// Keep the < and > of the patterns readable
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// versionKey locates the pattern a version signature applies to
+type versionKey struct {
+	section, key, pattern string
+}
+
+// exportRule converts a detection rule into a technology
+func (e *Exporter) exportRule(rule crowler.DetectionRule) *exportedTechnology {
+	t := &exportedTechnology{
+		CPE:      rule.CPE,
+		Implies:  exportImplies(rule),
+		Requires: rule.Requires,
+		Excludes: rule.Excludes,
+	}
+	for _, name := range rule.RequiresCategory {
+		t.RequiresCategory = append(t.RequiresCategory, e.category(name))
+	}
+	if m := rule.Metadata; m != nil {
+		t.Website = m.Website
+		t.Description = m.Description
+		t.Icon = m.Icon
+		t.Pricing = m.Pricing
+		t.SaaS = m.SaaS
+		t.OSS = m.OSS
+	}
+
+	versions := make(map[versionKey]string)
+	for _, v := range rule.Version {
+		versions[versionKey{v.Section, v.Key, v.Pattern}] = v.Version
+	}
+	// tag puts the version and confidence tags back on a pattern
+	tag := func(section, key, pattern string, confidence float32) string {
+		tags := patterntag.Tags{Version: versions[versionKey{section, key, pattern}], Confidence: -1}
+		if confidence < crowler.MaxConfidence {
+			tags.Confidence = patterntag.SourceConfidence(confidence)
+		}
+		return patterntag.Format(pattern, tags)
+	}
+	tagAll := func(section, key string, patterns []string, confidence float32) []string {
+		out := make([]string, 0, len(patterns))
+		for _, p := range patterns {
+			out = append(out, tag(section, key, p, confidence))
+		}
+		return out
+	}
+
+	// The headers, cookies and js objects have a single pattern, the alternatives
+	// are joined without their version
+	for _, h := range rule.HTTPHeaderFields {
+		if t.Headers == nil {
+			t.Headers = make(map[string]string)
+		}
+		t.Headers[h.Key] = ""
+		if len(h.Value) > 0 {
+			t.Headers[h.Key] = singlePattern(tagAll("http_header_fields", h.Key, h.Value, float32(h.Confidence)))
+		}
+	}
+
+	for _, c := range rule.Cookies {
+		if t.Cookies == nil {
+			t.Cookies = make(map[string]string)
+		}
+		t.Cookies[c.Name] = ""
+		if len(c.Value) > 0 {
+			t.Cookies[c.Name] = singlePattern(tagAll("cookies", c.Name, c.Value, c.Confidence))
+		}
+	}
+
+	for _, m := range rule.MetaTags {
+		if t.Meta == nil {
+			t.Meta = make(map[string][]string)
+		}
+		for i, p := range m.Content {
+			confidence := m.Confidence
+			if i < len(m.ContentConfidence) {
+				confidence = m.ContentConfidence[i]
+			}
+			key := metaKey(m)
+			t.Meta[key] = append(t.Meta[key], tag("meta_tags", m.Name, p, float32(confidence)))
+		}
+	}
+
+	for _, p := range rule.PageContentPatterns {
+		signatures := tagAll("page_content_patterns", p.Key, p.Signature, p.Confidence)
+		texts := tagAll("page_content_patterns", p.Key, p.Text, p.Confidence)
+		switch {
+		case len(p.MD5Hash) > 0 || len(p.SHA256Hash) > 0 || len(p.MMH3Hash) > 0:
+			// Hashes have no technologies.json equivalent
+		case (p.Key == "html" || p.Key == "body") && p.Attribute == "":
+			t.Html = append(t.Html, signatures...)
+			t.Text = append(t.Text, texts...)
+		case p.Key == "script" && p.Attribute == "":
+			t.Scripts = append(t.Scripts, signatures...)
+		case (p.Attribute == "href" || p.Attribute == "src") && isWebsite(p.Signature, t.Website):
+			// The links to the website added by Convert
+		case p.Key == "script" && p.Attribute == "src":
+			t.ScriptSrc = append(t.ScriptSrc, signatures...)
+		default:
+			// Any other key is a CSS selector of a dom entry
+			if t.Dom == nil {
+				t.Dom = make(map[string]*exportedDomCondition)
+			}
+			cond := t.Dom[p.Key]
+			if cond == nil {
+				cond = &exportedDomCondition{}
+				t.Dom[p.Key] = cond
+			}
+			switch {
+			case p.Attribute != "" && len(signatures) > 0:
+				if cond.Attributes == nil {
+					cond.Attributes = make(map[string]string)
+				}
+				cond.Attributes[p.Attribute] = singlePattern(signatures)
+			case len(texts) > 0:
+				cond.Text = singlePattern(texts)
+			default:
+				exists := ""
+				cond.Exists = &exists
+			}
+		}
+	}
+
+	for _, j := range rule.JSPatterns {
+		if t.JS == nil {
+			t.JS = make(map[string]string)
+		}
+		t.JS[j.Name] = singlePattern(tagAll("js_patterns", j.Name, j.Value, j.Confidence))
+	}
+
+	for _, c := range rule.CSSPatterns {
+		t.CSS = append(t.CSS, tagAll("css_patterns", "", c.Value, c.Confidence)...)
+	}
+
+	for _, n := range rule.NetworkPatterns {
+		if n.Key == "xhr" {
+			t.XHR = append(t.XHR, tagAll("network_patterns", n.Key, n.Value, n.Confidence)...)
+		}
+	}
+
+	for _, s := range rule.SSLSignatures {
+		if s.Key == "issuer" && len(s.Value) > 0 {
+			t.CertIssuer = s.Value[0]
+		}
+	}
+
+	for _, d := range rule.DNSSignatures {
+		if t.DNS == nil {
+			t.DNS = make(map[string][]string)
+		}
+		t.DNS[d.Key] = append(t.DNS[d.Key], tagAll("dns_patterns", d.Key, d.Value, d.Confidence)...)
+	}
+
+	for _, u := range rule.URLPatterns {
+		if !isWebsite([]string{u.Signature}, t.Website) {
+			t.URL = append(t.URL, tag("url_micro_signatures", "", u.Signature, u.Confidence))
+		}
+	}
+
+	return t
+}
+
+// exportImplies returns the implies entries of rule, with the tags of
+// the direct implications listed in the metadata (see implies.Resolve)
+func exportImplies(rule crowler.DetectionRule) []string {
+	if rule.Metadata == nil || len(rule.Metadata.Implied) == 0 {
+		return rule.Implies
+	}
+	entries := make([]string, len(rule.Implies))
+	for i, object := range rule.Implies {
+		entries[i] = object
+		for _, implied := range rule.Metadata.Implied {
+			if implied.Object == object && len(implied.Via) == 0 {
+				entries[i] = implies.Format(implied)
+				break
+			}
+		}
+	}
+	return entries
+}
+
+// singlePattern joins alternative patterns in one, technologies.json
+// having a single pattern for a header, a js object or a dom condition.
+// The version tags of joined patterns are dropped, their groups being
+// renumbered.
+func singlePattern(patterns []string) string {
+	if len(patterns) == 1 {
+		return patterns[0]
+	}
+	alternatives := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		expr, _ := patterntag.Parse(p)
+		alternatives = append(alternatives, "(?:"+expr+")")
+	}
+	return strings.Join(alternatives, "|")
+}
+
+// isWebsite tells if patterns is the website of the technology, escaped
+// or not
+func isWebsite(patterns []string, website string) bool {
+	return website != "" && len(patterns) == 1 &&
+		(patterns[0] == website || patterns[0] == regexp.QuoteMeta(website))
+}
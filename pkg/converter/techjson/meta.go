@@ -0,0 +1,72 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package techjson
+
+import (
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// httpEquivPrefix marks the http-equiv meta keys whose name isn't one of
+// httpEquivNames, e.g. http-equiv:x-powered-by
+const httpEquivPrefix = "http-equiv:"
+
+// httpEquivNames are the http-equiv meta tag names, matched by their
+// http-equiv attribute when a technologies.json file lists them as meta
+// names
+var httpEquivNames = map[string]bool{
+	"accept-ch":               true,
+	"cache-control":           true,
+	"content-language":        true,
+	"content-security-policy": true,
+	"content-type":            true,
+	"default-style":           true,
+	"expires":                 true,
+	"origin-trial":            true,
+	"pragma":                  true,
+	"refresh":                 true,
+	"set-cookie":              true,
+	"x-dns-prefetch-control":  true,
+	"x-ua-compatible":         true,
+}
+
+// metaTag returns the meta tag, without patterns, of a technologies.json
+// meta key. Its name is lowercase, as the meta names are case
+// insensitive. charset matches the <meta charset> tags, http-equiv:<name>
+// and the httpEquivNames the http-equiv tags, the other keys the name
+// attribute.
+func metaTag(key string) crowler.MetaTag {
+	name := strings.ToLower(strings.TrimSpace(key))
+	switch {
+	case name == crowler.MetaCharset:
+		return crowler.MetaTag{Name: name, Attribute: crowler.MetaCharset}
+	case strings.HasPrefix(name, httpEquivPrefix):
+		return crowler.MetaTag{Name: strings.TrimPrefix(name, httpEquivPrefix), Attribute: crowler.MetaHTTPEquiv}
+	case httpEquivNames[name]:
+		return crowler.MetaTag{Name: name, Attribute: crowler.MetaHTTPEquiv}
+	}
+	return crowler.MetaTag{Name: name}
+}
+
+// metaKey returns the technologies.json meta key of m, the reverse of
+// metaTag
+func metaKey(m crowler.MetaTag) string {
+	name := strings.ToLower(m.Name)
+	if m.Attribute == crowler.MetaHTTPEquiv && !httpEquivNames[name] {
+		return httpEquivPrefix + name
+	}
+	return name
+}
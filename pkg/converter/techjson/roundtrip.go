@@ -0,0 +1,172 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package techjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+)
+
+// readTechnologies reads a technologies.json document, or an apps.json
+// one in compatibility mode
+func readTechnologies(data []byte) (Technologies, error) {
+	data, err := normalizeSchema(data, converter.Options{})
+	if err != nil {
+		return Technologies{}, err
+	}
+	technologies, err := unmarshalTechnologies(data, converter.Options{})
+	if err != nil {
+		return technologies, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+	return technologies, nil
+}
+
+// RoundTrip exports rulesets converted from source with opts back to a
+// technologies.json and compares each technology with its source, field
+// by field. categories are used when the source has none.
+func RoundTrip(source []byte, rulesets []crowler.Ruleset, opts converter.Options, categories map[string]Category) (*converter.RoundTripReport, error) {
+	technologies, err := readTechnologies(source)
+	if err != nil {
+		return nil, err
+	}
+	if len(technologies.Categories) > 0 {
+		categories = technologies.Categories
+	}
+
+	exporter := NewExporter(ExportOptions{Categories: categories})
+	for _, ruleset := range rulesets {
+		exporter.Add(ruleset)
+	}
+	data, err := exporter.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	exported, err := readTechnologies(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the exported technologies: %v", err)
+	}
+
+	// The patterns are compared as the converter writes them: normalized,
+	// with their version tag and a confidence tag unless it's the default
+	// confidence
+	defaultConfidence := patterntag.SourceConfidence(opts.DefaultConfidence())
+	pattern := func(p string) string {
+		if opts.Normalize {
+			p = normalize.Pattern(p)
+		}
+		expr, tags := patterntag.Parse(p)
+		if tags.Confidence == defaultConfidence || tags.Confidence == 100 {
+			tags.Confidence = -1
+		}
+		return patterntag.Format(expr, tags)
+	}
+	patterns := func(values []string) []string {
+		out := make([]string, 0, len(values))
+		for _, v := range values {
+			out = append(out, pattern(v))
+		}
+		return out
+	}
+	headerKey := func(key string) string {
+		if opts.Normalize {
+			return normalize.HeaderKey(key)
+		}
+		return key
+	}
+	pairs := func(fields map[string]string, key func(string) string) []string {
+		var out []string
+		for k, v := range fields {
+			out = append(out, key(k)+": "+pattern(v))
+		}
+		return out
+	}
+	keyed := func(fields map[string]stringList, key func(string) string) []string {
+		var out []string
+		for k, values := range fields {
+			for _, v := range values {
+				out = append(out, key(k)+": "+pattern(v))
+			}
+		}
+		return out
+	}
+	dom := func(name string, raw json.RawMessage) []string {
+		var out []string
+		for _, s := range domSignatures(name, raw) {
+			out = append(out, fmt.Sprintf("%s[%s] %s %s", s.Key, s.Attribute,
+				strings.Join(patterns(s.Signature), " "), strings.Join(patterns(s.Text), " ")))
+		}
+		return out
+	}
+	single := func(value string) []string {
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+	flag := func(value bool) []string {
+		if !value {
+			return nil
+		}
+		return []string{"true"}
+	}
+	same := func(key string) string { return key }
+	canonicalMetaKey := func(key string) string { return metaKey(metaTag(key)) }
+
+	report := converter.NewRoundTripReport()
+	for name, src := range technologies.Technologies {
+		report.Objects++
+		dst, ok := exported.Technologies[name]
+		if !ok {
+			report.Compare(name, "technology", []string{name}, nil)
+			continue
+		}
+		report.Compare(name, "technology", []string{name}, []string{name})
+
+		report.Compare(name, "cats", src.Cats, dst.Cats)
+		report.Compare(name, "headers", pairs(src.Headers, headerKey), pairs(dst.Headers, headerKey))
+		// The cookie names are trimmed but keep their case
+		report.Compare(name, "cookies", pairs(src.Cookies, strings.TrimSpace), pairs(dst.Cookies, strings.TrimSpace))
+		report.Compare(name, "meta", keyed(src.Meta, canonicalMetaKey), keyed(dst.Meta, canonicalMetaKey))
+		report.Compare(name, "html", patterns(src.Html), patterns(dst.Html))
+		report.Compare(name, "text", patterns(src.Text), patterns(dst.Text))
+		report.Compare(name, "css", patterns(src.CSS), patterns(dst.CSS))
+		report.Compare(name, "xhr", patterns(src.XHR), patterns(dst.XHR))
+		report.Compare(name, "scripts", patterns(src.Scripts), patterns(dst.Scripts))
+		report.Compare(name, "scriptSrc", patterns(src.ScriptSrc), patterns(dst.ScriptSrc))
+		report.Compare(name, "dom", dom(name, src.Dom), dom(name, dst.Dom))
+		report.Compare(name, "js", pairs(src.JS, same), pairs(dst.JS, same))
+		report.Compare(name, "dns", keyed(src.DNS, strings.ToUpper), keyed(dst.DNS, strings.ToUpper))
+		report.Compare(name, "certIssuer", patterns(src.CertIssuer), patterns(dst.CertIssuer))
+		report.Compare(name, "url", patterns(src.URL), patterns(dst.URL))
+		report.Compare(name, "website", single(src.Website), single(dst.Website))
+		report.Compare(name, "description", single(src.Description), single(dst.Description))
+		report.Compare(name, "icon", single(src.Icon), single(dst.Icon))
+		report.Compare(name, "pricing", src.Pricing, dst.Pricing)
+		report.Compare(name, "saas", flag(src.SaaS), flag(dst.SaaS))
+		report.Compare(name, "oss", flag(src.OSS), flag(dst.OSS))
+		report.Compare(name, "cpe", single(src.CPE), single(dst.CPE))
+		report.Compare(name, "implies", src.Implies, dst.Implies)
+		report.Compare(name, "requires", technologyNames(src.Requires), dst.Requires)
+		report.Compare(name, "requiresCategory", src.RequiresCategory, dst.RequiresCategory)
+		report.Compare(name, "excludes", technologyNames(src.Excludes), dst.Excludes)
+	}
+	return report, nil
+}
@@ -0,0 +1,859 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package techjson converts the Wappalyzer technologies.json format
+// (technologies with their categories, and optionally the category
+// groups) into CROWler detection rulesets, one per category group. The
+// apps.json schema of webanalyze and httpx is read in compatibility mode.
+package techjson
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Wappalyzer technologies.json"
+	// DefaultSourceLicense is the license of the Wappalyzer sources
+	DefaultSourceLicense = "GPL-3.0-only"
+)
+
+// Define the structure of technologies.json
+type Technology struct {
+	Cats       idList                `json:"cats"`
+	Cookies    map[string]string     `json:"cookies"`
+	Headers    map[string]string     `json:"headers"`
+	Meta       map[string]stringList `json:"meta"`
+	Html       stringList            `json:"html"`
+	Text       stringList            `json:"text"`
+	CSS        stringList            `json:"css"`
+	XHR        stringList            `json:"xhr"`
+	Scripts    stringList            `json:"scripts"`
+	ScriptSrc  stringList            `json:"scriptSrc"`
+	Dom        json.RawMessage       `json:"dom"`
+	JS         map[string]string     `json:"js"`
+	DNS        map[string]stringList `json:"dns"`
+	CertIssuer stringList            `json:"certIssuer"`
+	URL        stringList            `json:"url"`
+	Website    string                `json:"website"`
+	// Description, Icon, Pricing, SaaS and OSS only describe the
+	// technology
+	Description string     `json:"description"`
+	Icon        string     `json:"icon"`
+	Pricing     stringList `json:"pricing"`
+	SaaS        bool       `json:"saas"`
+	OSS         bool       `json:"oss"`
+	CPE         string     `json:"cpe"`
+	Implies     stringList `json:"implies"`
+	Requires    stringList `json:"requires"`
+	// RequiresCategory lists category IDs
+	RequiresCategory idList     `json:"requiresCategory"`
+	Excludes         stringList `json:"excludes"`
+}
+
+type Category struct {
+	Name   string `json:"name"`
+	Groups []int  `json:"groups"`
+	// Priority orders the categories, the lower the more relevant
+	Priority int `json:"priority"`
+}
+
+// Group is a Wappalyzer group of categories (groups.json)
+type Group struct {
+	Name string `json:"name"`
+}
+
+type Technologies struct {
+	Technologies map[string]Technology `json:"technologies"`
+	Categories   map[string]Category   `json:"categories"`
+	Groups       map[string]Group      `json:"groups"`
+}
+
+// stringList is a list of patterns, which technologies.json also writes
+// as a single string when there's only one
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*l = nil
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+// idList is a list of IDs, which technologies.json writes as numbers or
+// strings, and as a single value when there's only one
+type idList []string
+
+func (l *idList) UnmarshalJSON(data []byte) error {
+	var values []json.Number
+	if err := json.Unmarshal(data, &values); err != nil {
+		var single json.Number
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		values = []json.Number{single}
+	}
+	*l = nil
+	for _, v := range values {
+		*l = append(*l, v.String())
+	}
+	return nil
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Groups are the Wappalyzer groups, used when the source doesn't
+	// include them
+	Groups map[string]Group
+	// Categories are the Wappalyzer categories, used when the source
+	// doesn't include them (as the httpx fingerprints)
+	Categories map[string]Category
+	// Unmapped tells what to do with the technologies without a known
+	// category
+	Unmapped converter.UnmappedPolicy
+	// WebsiteSignatures tells if the rules match the links to the
+	// website of their technology
+	WebsiteSignatures WebsiteSignatures
+}
+
+// createRule returns the rule of the technology name. The website is a
+// literal address, written to the patterns after opts.Literals, and its
+// links are matched after opts.WebsiteSignatures.
+func createRule(name string, details Technology, opts Options) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+		CPE:        details.CPE,
+		Implies:    details.Implies,
+		Requires:   technologyNames(details.Requires),
+		Excludes:   technologyNames(details.Excludes),
+	}
+
+	if details.Description != "" || details.Website != "" || details.Icon != "" ||
+		len(details.Pricing) > 0 || details.SaaS || details.OSS {
+		rule.Metadata = &crowler.RuleMetadata{
+			Description: details.Description,
+			Website:     details.Website,
+			Icon:        details.Icon,
+			Pricing:     details.Pricing,
+			SaaS:        details.SaaS,
+			OSS:         details.OSS,
+		}
+	}
+
+	if details.Headers != nil {
+		for k, v := range details.Headers {
+			rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+				Key:        k,
+				Value:      []string{v},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	if details.Cookies != nil {
+		for k, v := range details.Cookies {
+			rule.Cookies = append(rule.Cookies, crowler.CookieSignature{
+				Name:       k,
+				Value:      []string{v},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	// A meta tag can list several alternative patterns, each with its own
+	// tags. Meta names are case insensitive, so the spellings of a name are
+	// merged in one MetaTag, named in lowercase.
+	metaNames := make([]string, 0, len(details.Meta))
+	for k := range details.Meta {
+		metaNames = append(metaNames, k)
+	}
+	sort.Strings(metaNames)
+	metaIndex := make(map[string]int)
+	for _, k := range metaNames {
+		tag := metaTag(k)
+		if i, ok := metaIndex[metaKey(tag)]; ok {
+			rule.MetaTags[i].Content = append(rule.MetaTags[i].Content, details.Meta[k]...)
+			continue
+		}
+		metaIndex[metaKey(tag)] = len(rule.MetaTags)
+		tag.Content = append([]string(nil), details.Meta[k]...)
+		tag.Confidence = crowler.DefaultConfidence
+		rule.MetaTags = append(rule.MetaTags, tag)
+	}
+
+	if details.Html != nil {
+		for _, v := range details.Html {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+				Key:        "html",
+				Signature:  []string{v},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	// text patterns match the visible text of the page
+	for _, v := range details.Text {
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Text:       []string{v},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	if details.Scripts != nil {
+		for _, v := range details.Scripts {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+				Key:        "script",
+				Signature:  []string{v},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	for _, v := range details.ScriptSrc {
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "script",
+			Attribute:  "src",
+			Signature:  []string{v},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	rule.PageContentPatterns = append(rule.PageContentPatterns, domSignatures(name, details.Dom)...)
+
+	// The js entries map a global object to the pattern of its value, an
+	// empty pattern only requires the object to exist
+	jsNames := make([]string, 0, len(details.JS))
+	for k := range details.JS {
+		jsNames = append(jsNames, k)
+	}
+	sort.Strings(jsNames)
+	for _, k := range jsNames {
+		signature := crowler.JSObjectSignature{
+			Name:       k,
+			Confidence: crowler.DefaultConfidence,
+		}
+		if v := details.JS[k]; v != "" {
+			signature.Value = []string{v}
+		}
+		rule.JSPatterns = append(rule.JSPatterns, signature)
+	}
+
+	for _, v := range details.CSS {
+		rule.CSSPatterns = append(rule.CSSPatterns, crowler.CSSSignature{
+			Value:      []string{v},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	// xhr patterns match the hostnames of the XHR and fetch requests
+	for _, v := range details.XHR {
+		rule.NetworkPatterns = append(rule.NetworkPatterns, crowler.NetworkSignature{
+			Key:        "xhr",
+			Value:      []string{v},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	if len(details.CertIssuer) > 0 {
+		rule.SSLSignatures = append(rule.SSLSignatures, crowler.SSLSignature{
+			Key:        "issuer",
+			Value:      details.CertIssuer,
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	// The dns entries map a record type (MX, TXT, NS, CNAME, ...) to the
+	// patterns of its values
+	recordTypes := make([]string, 0, len(details.DNS))
+	for k := range details.DNS {
+		recordTypes = append(recordTypes, k)
+	}
+	sort.Slice(recordTypes, func(i, j int) bool {
+		return strings.ToUpper(recordTypes[i]) < strings.ToUpper(recordTypes[j])
+	})
+	for _, k := range recordTypes {
+		rule.DNSSignatures = append(rule.DNSSignatures, crowler.DNSSignature{
+			Key:        strings.ToUpper(k),
+			Value:      details.DNS[k],
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	if details.URL != nil {
+		for _, v := range details.URL {
+			rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+				Signature:  v,
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	if details.Website != "" {
+		website := opts.Literals.Literal(details.Website)
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  website,
+			Confidence: crowler.DefaultConfidence,
+		})
+
+		if opts.WebsiteSignatures != WebsiteOff && opts.WebsiteSignatures != "" {
+			rule.PageContentPatterns = append(rule.PageContentPatterns, websiteLinks(website)...)
+		}
+	}
+
+	return rule
+}
+
+// DomCondition is what a Wappalyzer dom entry checks on the elements
+// matching its selector
+type DomCondition struct {
+	Exists     *string           `json:"exists"`
+	Text       string            `json:"text"`
+	Attributes map[string]string `json:"attributes"`
+	Properties map[string]string `json:"properties"`
+}
+
+// domSignatures converts the dom field of a technology into page content
+// signatures keyed by the CSS selector. The field can be a selector, a
+// list of selectors (the elements must exist) or an object mapping the
+// selectors to their conditions. JavaScript properties have no CROWler
+// equivalent and are skipped.
+func domSignatures(name string, raw json.RawMessage) []crowler.PageContentSignature {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	var selectors []string
+	var selector string
+	if err := json.Unmarshal(raw, &selector); err == nil {
+		selectors = []string{selector}
+	} else if err := json.Unmarshal(raw, &selectors); err != nil {
+		var conditions map[string]DomCondition
+		if err := json.Unmarshal(raw, &conditions); err != nil {
+			slog.Warn("Unexpected dom field", "technology", name, "error", err)
+			return nil
+		}
+		return domConditionSignatures(conditions)
+	}
+
+	var signatures []crowler.PageContentSignature
+	for _, selector := range selectors {
+		signatures = append(signatures, crowler.PageContentSignature{
+			Key:        selector,
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+	return signatures
+}
+
+func domConditionSignatures(conditions map[string]DomCondition) []crowler.PageContentSignature {
+	selectors := make([]string, 0, len(conditions))
+	for selector := range conditions {
+		selectors = append(selectors, selector)
+	}
+	sort.Strings(selectors)
+
+	var signatures []crowler.PageContentSignature
+	for _, selector := range selectors {
+		cond := conditions[selector]
+		matched := false
+		if cond.Text != "" {
+			signatures = append(signatures, crowler.PageContentSignature{
+				Key:        selector,
+				Text:       []string{cond.Text},
+				Confidence: crowler.DefaultConfidence,
+			})
+			matched = true
+		}
+		attributes := make([]string, 0, len(cond.Attributes))
+		for attribute := range cond.Attributes {
+			attributes = append(attributes, attribute)
+		}
+		sort.Strings(attributes)
+		for _, attribute := range attributes {
+			signatures = append(signatures, crowler.PageContentSignature{
+				Key:        selector,
+				Attribute:  attribute,
+				Signature:  []string{cond.Attributes[attribute]},
+				Confidence: crowler.DefaultConfidence,
+			})
+			matched = true
+		}
+		// An element that must only exist is matched by the selector alone
+		if !matched && cond.Exists != nil {
+			signatures = append(signatures, crowler.PageContentSignature{
+				Key:        selector,
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+	return signatures
+}
+
+// unmarshalTechnologies reads a technologies.json document. The
+// technologies that can't be read are skipped with opts.Skip.
+func unmarshalTechnologies(data []byte, opts converter.Options) (Technologies, error) {
+	var doc struct {
+		Technologies map[string]json.RawMessage `json:"technologies"`
+		Categories   map[string]Category        `json:"categories"`
+		Groups       map[string]Group           `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return Technologies{}, err
+	}
+
+	technologies := Technologies{
+		Technologies: make(map[string]Technology, len(doc.Technologies)),
+		Categories:   doc.Categories,
+		Groups:       doc.Groups,
+	}
+	names := make([]string, 0, len(doc.Technologies))
+	for name := range doc.Technologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var technology Technology
+		if err := json.Unmarshal(doc.Technologies[name], &technology); err != nil {
+			if err := opts.Skip("technology "+name, err); err != nil {
+				return Technologies{}, fmt.Errorf("technology %s: %v", name, err)
+			}
+			continue
+		}
+		technologies.Technologies[name] = technology
+	}
+	return technologies, nil
+}
+
+// Convert converts a technologies.json document into a ruleset per
+// category group (or per category without a group), sorted by file name
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JSON: %v", err)
+	}
+	if Schema(data) == SchemaApps {
+		slog.Info("Reading the schema in compatibility mode", "schema", SchemaApps)
+		if data, err = normalizeSchema(data, opts.Options); err != nil {
+			return nil, err
+		}
+	}
+	technologies, err := unmarshalTechnologies(data, opts.Options)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	if len(technologies.Categories) == 0 {
+		technologies.Categories = opts.Categories
+	}
+	if len(technologies.Categories) == 0 {
+		slog.Warn("The input has no categories, use -categories to read them from a categories.json file")
+	}
+
+	groups := technologies.Groups
+	if len(groups) == 0 {
+		groups = opts.Groups
+	}
+
+	// Initialize the rulesets, one per Wappalyzer group (or per category
+	// when the category has no group), indexed by their file slug
+	rulesets := make(map[string]crowler.Ruleset)
+	groupRulesets := make(map[string]string)
+	categoryGroups := make(map[string]categoryGroup)
+	categoryKeys := slug.NewFileNamer()
+	fileNames := slug.NewFileNamer()
+	groupNames := slug.NewNamer()
+	ruleNames := slug.NewNamer()
+	skipped := make(converter.Skipped)
+
+	newRuleset := func(key, name string) crowler.Ruleset {
+		ruleSlug := strings.ReplaceAll(key, "-", "_")
+		ruleset := crowler.NewRuleset(fmt.Sprintf("detect_%s_ruleset", ruleSlug),
+			fmt.Sprintf("Ruleset to detect %s technologies.", strings.ReplaceAll(name, "_", " ")))
+		ruleset.Source = SourceName
+		ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+		ruleset.FileName = fmt.Sprintf("detect-%s-ruleset.yaml", key)
+		return ruleset
+	}
+
+	// Process the technologies in a stable order, so the suffixes added to
+	// colliding names don't change between runs
+	names := make([]string, 0, len(technologies.Technologies))
+	for name := range technologies.Technologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Create the rules with the workers, then name and categorize them in
+	// the order of the names
+	rules := converter.Map(opts.Workers, names, func(name string) crowler.DetectionRule {
+		defer opts.Processed(1)
+		rule := createRule(name, technologies.Technologies[name], opts)
+		opts.PrepareRule(&rule)
+		if opts.WebsiteSignatures == WebsiteLowConfidence && opts.ConfidenceProfile == nil {
+			lowerWebsiteConfidence(&rule)
+		}
+		// Move the Wappalyzer tags out of the patterns
+		patterntag.StripRule(&rule)
+		if opts.Normalize {
+			crowler.DedupeSignatures(&rule)
+		}
+		return rule
+	})
+
+	// Process each technology and categorize
+	for i, name := range names {
+		details := technologies.Technologies[name]
+
+		var cats []string
+		for _, cat := range details.Cats {
+			if _, exists := technologies.Categories[cat]; exists {
+				cats = append(cats, cat)
+			}
+		}
+		categories := technologies.Categories
+		if len(cats) == 0 {
+			reason := "with unknown categories"
+			if len(details.Cats) == 0 {
+				reason = "without categories"
+			}
+			uncategorized, err := skipped.Unmapped(opts.Unmapped, name, reason)
+			if err != nil {
+				return nil, err
+			}
+			if !uncategorized {
+				continue
+			}
+			cats = []string{converter.UncategorizedCategory}
+			categories = map[string]Category{converter.UncategorizedCategory: {Name: converter.UncategorizedCategory}}
+		}
+
+		rule := rules[i]
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		for _, cat := range details.RequiresCategory {
+			if category, exists := technologies.Categories[cat]; exists {
+				rule.RequiresCategory = append(rule.RequiresCategory, category.Name)
+			} else {
+				slog.Warn("Unknown category", "category", cat, "technology", name)
+			}
+		}
+		for _, cat := range cats {
+			rule.Tags = taxonomy.Merge(rule.Tags, opts.Taxonomy.Tags(cat, categories[cat].Name)...)
+		}
+		for _, cat := range cats {
+			category := categories[cat]
+
+			cg, ok := categoryGroups[category.Name]
+			if !ok {
+				categoryKey := categoryKeys.Unique(slug.File(category.Name))
+				categoryRuleGroup := crowler.RuleGroup{
+					IsEnabled:      true,
+					Category:       category.Name,
+					Tags:           opts.Taxonomy.Tags(cat, category.Name),
+					DetectionRules: []crowler.DetectionRule{},
+				}
+				// The categories of a Wappalyzer group share its ruleset,
+				// as children of a rule group named after it
+				if parent := parentGroup(category, groups); parent != "" {
+					cg.ruleset, ok = groupRulesets[parent]
+					if !ok {
+						cg.ruleset = fileNames.Unique(slug.File(parent))
+						groupRulesets[parent] = cg.ruleset
+						ruleset := newRuleset(cg.ruleset, parent)
+						ruleset.RuleGroups = []crowler.RuleGroup{{
+							GroupName:      groupNames.Unique("detect_web_technologies_" + slug.Make(parent)),
+							IsEnabled:      true,
+							Category:       parent,
+							DetectionRules: []crowler.DetectionRule{},
+						}}
+						rulesets[cg.ruleset] = ruleset
+					}
+					categoryRuleGroup.ParentGroup = rulesets[cg.ruleset].RuleGroups[0].GroupName
+				} else {
+					cg.ruleset = fileNames.Unique(categoryKey)
+					rulesets[cg.ruleset] = newRuleset(cg.ruleset, category.Name)
+				}
+				categoryRuleGroup.GroupName = groupNames.Unique("detect_web_technologies_" + strings.ReplaceAll(categoryKey, "-", "_"))
+
+				ruleset := rulesets[cg.ruleset]
+				cg.index = len(ruleset.RuleGroups)
+				cg.priority = category.Priority
+				ruleset.RuleGroups = append(ruleset.RuleGroups, categoryRuleGroup)
+				rulesets[cg.ruleset] = ruleset
+				categoryGroups[category.Name] = cg
+			}
+
+			group := &rulesets[cg.ruleset].RuleGroups[cg.index]
+			group.DetectionRules = append(group.DetectionRules, rule)
+		}
+	}
+
+	skipped.Report()
+
+	// Sort the category groups of each ruleset by priority, after the
+	// parent group
+	priorities := make(map[string]int)
+	for _, cg := range categoryGroups {
+		priorities[rulesets[cg.ruleset].RuleGroups[cg.index].GroupName] = cg.priority
+	}
+	for _, ruleset := range rulesets {
+		children := ruleset.RuleGroups
+		if len(children) > 1 {
+			children = children[1:]
+		}
+		sort.SliceStable(children, func(i, j int) bool {
+			pi, pj := priorities[children[i].GroupName], priorities[children[j].GroupName]
+			if pi != pj {
+				return pi < pj
+			}
+			return children[i].GroupName < children[j].GroupName
+		})
+	}
+
+	keys := make([]string, 0, len(rulesets))
+	for key := range rulesets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]crowler.Ruleset, 0, len(keys))
+	for _, key := range keys {
+		ruleset := rulesets[key]
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		out = append(out, ruleset)
+	}
+	return out, nil
+}
+
+// technologyNames returns the technology names of a requires or excludes
+// list, without the Wappalyzer tags
+func technologyNames(names []string) []string {
+	var out []string
+	for _, name := range names {
+		name, _ = patterntag.Parse(name)
+		out = append(out, name)
+	}
+	return out
+}
+
+// categoryGroup locates the rule group of a category: the ruleset and
+// the index of the group in it, and the priority of the category
+type categoryGroup struct {
+	ruleset  string
+	index    int
+	priority int
+}
+
+// parentGroup returns the name of the first Wappalyzer group of category,
+// or an empty string
+func parentGroup(category Category, groups map[string]Group) string {
+	for _, id := range category.Groups {
+		if group, ok := groups[strconv.Itoa(id)]; ok && group.Name != "" {
+			return group.Name
+		}
+	}
+	return ""
+}
+
+// LoadGroups reads a Wappalyzer groups.json file
+func LoadGroups(path string) (map[string]Group, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading groups: %v", err)
+	}
+	var groups map[string]Group
+	if err := json.Unmarshal(data, &groups); err != nil {
+		return nil, fmt.Errorf("error unmarshalling groups JSON: %v", err)
+	}
+	return groups, nil
+}
+
+// ReadDir merges a technologies.json split in several files, as in the
+// webappanalyzer repository: the technologies in technologies/*.json
+// (a.json ... z.json) with categories.json and groups.json next to that
+// directory. dir can be the repository, its src directory or the
+// technologies directory.
+func ReadDir(dir string) ([]byte, error) {
+	techDir := dir
+	for _, d := range []string{filepath.Join(dir, "src", "technologies"), filepath.Join(dir, "technologies")} {
+		if info, err := os.Stat(d); err == nil && info.IsDir() {
+			techDir = d
+			break
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(techDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	doc := struct {
+		Technologies map[string]json.RawMessage `json:"technologies"`
+		Categories   json.RawMessage            `json:"categories,omitempty"`
+		Groups       json.RawMessage            `json:"groups,omitempty"`
+	}{Technologies: make(map[string]json.RawMessage)}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		switch filepath.Base(file) {
+		case "categories.json":
+			doc.Categories = data
+			continue
+		case "groups.json":
+			doc.Groups = data
+			continue
+		}
+		var technologies map[string]json.RawMessage
+		if err := json.Unmarshal(data, &technologies); err != nil {
+			return nil, fmt.Errorf("error unmarshalling %s: %v", file, err)
+		}
+		for name, technology := range technologies {
+			if _, exists := doc.Technologies[name]; exists {
+				slog.Warn("Technology redefined", "technology", name, "file", file)
+			}
+			doc.Technologies[name] = technology
+		}
+	}
+	if len(doc.Technologies) == 0 {
+		return nil, fmt.Errorf("no technologies found in %s", techDir)
+	}
+
+	// categories.json and groups.json are next to the technologies
+	// directory, or in the directory itself
+	for _, d := range []string{filepath.Dir(techDir), dir} {
+		if doc.Categories == nil {
+			if data, err := os.ReadFile(filepath.Join(d, "categories.json")); err == nil {
+				doc.Categories = data
+			}
+		}
+		if doc.Groups == nil {
+			if data, err := os.ReadFile(filepath.Join(d, "groups.json")); err == nil {
+				doc.Groups = data
+			}
+		}
+	}
+	if doc.Categories == nil {
+		return nil, fmt.Errorf("categories.json not found for %s", techDir)
+	}
+
+	return json.Marshal(doc)
+}
+
+func init() {
+	converter.Register(&techJSONConverter{})
+}
+
+// techJSONConverter is the registered technologies.json converter
+type techJSONConverter struct {
+	groupsPath     string
+	categoriesPath string
+	unmapped       converter.UnmappedPolicy
+	website        WebsiteSignatures
+}
+
+func (*techJSONConverter) Name() string { return "techjson" }
+
+func (*techJSONConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a technologies.json file with its categories (and groups)",
+		Input:          "Path to the technologies.json file, a webanalyze or httpx apps.json file (or a directory of split webappanalyzer files)",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+func (c *techJSONConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.groupsPath, "groups", "", "Path to the Wappalyzer groups.json file (used when the input has no groups)")
+	fs.StringVar(&c.categoriesPath, "categories", "", "Path to the Wappalyzer categories.json file (used when the input has no categories)")
+	fs.Var(&c.unmapped, "unmapped-policy", converter.UnmappedPolicyUsage)
+	fs.Var(&c.website, "website-signatures", WebsiteSignaturesUsage)
+}
+
+func (*techJSONConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+// Detect recognizes a document with both technologies and categories, or
+// an apps.json document (whose categories may be in a separate file)
+func (*techJSONConverter) Detect(input []byte) bool {
+	var doc struct {
+		Technologies map[string]json.RawMessage `json:"technologies"`
+		Apps         map[string]json.RawMessage `json:"apps"`
+		Categories   map[string]json.RawMessage `json:"categories"`
+	}
+	if err := json.Unmarshal(input, &doc); err != nil {
+		return false
+	}
+	return (len(doc.Technologies) > 0 && len(doc.Categories) > 0) || len(doc.Apps) > 0
+}
+
+func (c *techJSONConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	var groups map[string]Group
+	var categories map[string]Category
+	var err error
+	if c.groupsPath != "" {
+		if groups, err = LoadGroups(c.groupsPath); err != nil {
+			return nil, err
+		}
+	}
+	if c.categoriesPath != "" {
+		if categories, err = LoadCategories(c.categoriesPath); err != nil {
+			return nil, err
+		}
+	}
+	return Convert(r, Options{Options: opts, Groups: groups, Categories: categories, Unmapped: c.unmapped, WebsiteSignatures: c.website})
+}
+
+func (c *techJSONConverter) RoundTrip(source []byte, rulesets []crowler.Ruleset, opts converter.Options) (*converter.RoundTripReport, error) {
+	var categories map[string]Category
+	if c.categoriesPath != "" {
+		var err error
+		if categories, err = LoadCategories(c.categoriesPath); err != nil {
+			return nil, err
+		}
+	}
+	return RoundTrip(source, rulesets, opts, categories)
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package techjson
+
+import (
+	"fmt"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/confidence"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// WebsiteSignatures tells if the rules match the links to the website of
+// their technology (a and link href, script src). A page linking to the
+// vendor site rarely uses the technology (a blog linking to vuejs.org
+// isn't built with Vue), so they are off by default. It's a flag.Value,
+// the zero value is WebsiteOff.
+type WebsiteSignatures string
+
+const (
+	// WebsiteOff doesn't match the links to the website
+	WebsiteOff WebsiteSignatures = "off"
+	// WebsiteLowConfidence matches them with the website confidence of
+	// the heuristic profile
+	WebsiteLowConfidence WebsiteSignatures = "low-confidence"
+	// WebsiteOn matches them with the confidence of the other signatures
+	WebsiteOn WebsiteSignatures = "on"
+)
+
+// WebsiteSignaturesUsage is the usage of the -website-signatures flag
+const WebsiteSignaturesUsage = "Match the links to the website of the technologies (a, link and script addresses), which many pages have without using it: off, low-confidence or on (default off)"
+
+func (w *WebsiteSignatures) String() string {
+	if w == nil || *w == "" {
+		return string(WebsiteOff)
+	}
+	return string(*w)
+}
+
+func (w *WebsiteSignatures) Set(value string) error {
+	switch mode := WebsiteSignatures(strings.ToLower(strings.TrimSpace(value))); mode {
+	case WebsiteOff, WebsiteLowConfidence, WebsiteOn:
+		*w = mode
+		return nil
+	}
+	return fmt.Errorf("invalid value %q, expected off, low-confidence or on", value)
+}
+
+// websiteLinks returns the signatures matching the links to website, the
+// address as written to the patterns
+func websiteLinks(website string) []crowler.PageContentSignature {
+	links := []crowler.PageContentSignature{
+		{Key: "a", Attribute: "href"},
+		{Key: "link", Attribute: "href"},
+		{Key: "script", Attribute: "src"},
+	}
+	for i := range links {
+		links[i].Signature = []string{website}
+		links[i].Confidence = crowler.DefaultConfidence
+	}
+	return links
+}
+
+// lowerWebsiteConfidence gives the links to the website of rule the
+// website confidence of the heuristic profile, when it's lower than
+// theirs
+func lowerWebsiteConfidence(rule *crowler.DetectionRule) {
+	if rule.Metadata == nil {
+		return
+	}
+	low := confidence.Heuristic[confidence.Website]
+	for i := range rule.PageContentPatterns {
+		p := &rule.PageContentPatterns[i]
+		if p.Confidence > low && (p.Attribute == "href" || p.Attribute == "src") && isWebsite(p.Signature, rule.Metadata.Website) {
+			p.Confidence = low
+		}
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tlsfp converts lists of TLS fingerprints (JA3, JA3S and JARM
+// hashes, e.g. ja3er dumps, the SSLBL JA3 list or JARM lists exported
+// from Shodan) into CROWler rules with ssl_patterns keyed by ja3, ja3s
+// and jarm, identifying the server (or client) behind a TLS stack.
+package tlsfp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "TLS fingerprint list"
+	// DefaultSourceLicense is used when the license of the list isn't
+	// given, the lists come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+	// Category is the taxonomy key of the TLS fingerprints
+	Category = "tls"
+)
+
+// The keys of the ssl_patterns
+const (
+	JA3  = "ja3"
+	JA3S = "ja3s"
+	JARM = "jarm"
+)
+
+// Fingerprint is an entry of a list, with at least one of its hashes
+type Fingerprint struct {
+	Name string
+	// Hashes maps the kind of the hashes (JA3, JA3S or JARM) to the hash
+	Hashes map[string]string
+}
+
+var (
+	md5Re  = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	jarmRe = regexp.MustCompile(`^[0-9a-f]{62}$`)
+	// emptyJARMRe matches the JARM of the servers without TLS
+	emptyJARMRe = regexp.MustCompile(`^0+$`)
+	// jarmLineRe matches a jarm,name line of a JARM list without a header
+	jarmLineRe = regexp.MustCompile(`^([0-9A-Fa-f]{62})\s*[:,]\s*(.+)$`)
+)
+
+// The column (or JSON field) names of the hashes and of the names
+var (
+	hashColumns = map[string][]string{
+		JA3:  {"ja3", "ja3_md5", "ja3_hash", "ja3_digest", "md5"},
+		JA3S: {"ja3s", "ja3s_md5", "ja3s_hash", "ja3s_digest"},
+		JARM: {"jarm", "jarm_hash"},
+	}
+	nameColumns = []string{"name", "product", "application", "software", "description", "listingreason", "malware", "family", "user-agent", "user_agent", "tag"}
+	// kinds lists the hash kinds in output order
+	kinds = []string{JA3, JA3S, JARM}
+)
+
+// validHash tells if hash is a valid hash of kind
+func validHash(kind, hash string) bool {
+	if kind == JARM {
+		return jarmRe.MatchString(hash) && !emptyJARMRe.MatchString(hash)
+	}
+	return md5Re.MatchString(hash)
+}
+
+// newFingerprint builds a fingerprint from the fields of a record, keyed
+// by their lowercase name. It returns false if the record has no name or
+// no valid hash.
+func newFingerprint(fields map[string]string) (Fingerprint, bool) {
+	f := Fingerprint{Hashes: make(map[string]string)}
+	for _, name := range nameColumns {
+		if v := strings.TrimSpace(fields[name]); v != "" {
+			f.Name = v
+			break
+		}
+	}
+	for _, kind := range kinds {
+		for _, column := range hashColumns[kind] {
+			if hash := strings.ToLower(strings.TrimSpace(fields[column])); validHash(kind, hash) {
+				f.Hashes[kind] = hash
+				break
+			}
+		}
+	}
+	return f, f.Name != "" && len(f.Hashes) > 0
+}
+
+// flatten collects the string fields of a JSON object and of the objects
+// nested in it (the ssl object of the Shodan banners), keyed by their
+// lowercase name. The outer fields win.
+func flatten(object map[string]any, fields map[string]string) {
+	var nested []map[string]any
+	for k, v := range object {
+		key := strings.ToLower(k)
+		switch v := v.(type) {
+		case string:
+			fields[key] = v
+		case map[string]any:
+			nested = append(nested, v)
+		}
+	}
+	for _, n := range nested {
+		inner := make(map[string]string)
+		flatten(n, inner)
+		for k, v := range inner {
+			if _, ok := fields[k]; !ok {
+				fields[k] = v
+			}
+		}
+	}
+}
+
+// Parse reads a list of TLS fingerprints: a JSON array of objects, a
+// stream of JSON objects (one per line, as in the Shodan exports), a CSV
+// file with a header naming its columns (the header can be a comment, as
+// in the SSLBL list) or a list of jarm,name lines. The records without a
+// name or a valid hash are skipped.
+func Parse(r io.Reader) ([]Fingerprint, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var fingerprints []Fingerprint
+	add := func(fields map[string]string) {
+		if f, ok := newFingerprint(fields); ok {
+			fingerprints = append(fingerprints, f)
+		}
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		var objects []map[string]any
+		if trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &objects); err != nil {
+				return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+			}
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(trimmed))
+			for {
+				var object map[string]any
+				err := decoder.Decode(&object)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+				}
+				objects = append(objects, object)
+			}
+		}
+		for _, object := range objects {
+			fields := make(map[string]string)
+			flatten(object, fields)
+			add(fields)
+		}
+		return fingerprints, nil
+	}
+
+	header, lines := csvHeader(data)
+	if header == nil {
+		for _, line := range lines {
+			if m := jarmLineRe.FindStringSubmatch(line); m != nil {
+				add(map[string]string{JARM: m[1], "name": m[2]})
+			}
+		}
+		return fingerprints, nil
+	}
+	reader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV: %v", err)
+		}
+		fields := make(map[string]string)
+		for i, v := range record {
+			if i < len(header) {
+				fields[header[i]] = v
+			}
+		}
+		add(fields)
+	}
+	return fingerprints, nil
+}
+
+// csvHeader returns the lowercase column names of a CSV list, nil if it
+// has no header naming a hash column, and its data lines. The header is
+// the last line (commented or not) naming a hash column before the data.
+func csvHeader(data []byte) ([]string, []string) {
+	var header []string
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		comment := strings.HasPrefix(line, "#")
+		if comment {
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		if line == "" {
+			continue
+		}
+		if len(lines) == 0 {
+			if columns := parseHeader(line); columns != nil {
+				header = columns
+				continue
+			}
+		}
+		if !comment {
+			lines = append(lines, line)
+		}
+	}
+	return header, lines
+}
+
+// parseHeader returns the lowercase column names of a CSV header naming a
+// hash column, or nil
+func parseHeader(line string) []string {
+	columns, err := csv.NewReader(strings.NewReader(line)).Read()
+	if err != nil {
+		return nil
+	}
+	for i, c := range columns {
+		columns[i] = strings.ToLower(strings.TrimSpace(c))
+	}
+	for _, kind := range kinds {
+		for _, name := range hashColumns[kind] {
+			if slices.Contains(columns, name) {
+				return columns
+			}
+		}
+	}
+	return nil
+}
+
+// Convert converts a TLS fingerprint list into a ruleset with a rule per
+// name, matching all its hashes
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	fingerprints, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(fingerprints) == 0 {
+		slog.Warn("No fingerprint with a name and a JA3, JA3S or JARM hash found")
+	}
+
+	// Merge the fingerprints of the same name
+	hashes := make(map[string]map[string][]string)
+	for _, f := range fingerprints {
+		if hashes[f.Name] == nil {
+			hashes[f.Name] = make(map[string][]string)
+		}
+		for kind, hash := range f.Hashes {
+			if !slices.Contains(hashes[f.Name][kind], hash) {
+				hashes[f.Name][kind] = append(hashes[f.Name][kind], hash)
+			}
+		}
+	}
+	names := make([]string, 0, len(hashes))
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groupTags := opts.Taxonomy.Tags(Category)
+	ruleset := crowler.NewRuleset("detect_tls_fingerprints", "Ruleset to detect servers and clients from their TLS fingerprints.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-tls-fingerprints-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_tls_fingerprints",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	for _, name := range names {
+		rule := crowler.DetectionRule{
+			RuleName:   ruleNames.Unique("detect_" + slug.Make(name)),
+			ObjectName: name,
+		}
+		for _, kind := range kinds {
+			if values := hashes[name][kind]; len(values) > 0 {
+				rule.SSLSignatures = append(rule.SSLSignatures, crowler.SSLSignature{
+					Key:        kind,
+					Value:      values,
+					Confidence: crowler.DefaultConfidence,
+				})
+			}
+		}
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(tlsfpConverter{})
+}
+
+// tlsfpConverter is the registered TLS fingerprint list converter
+type tlsfpConverter struct{}
+
+func (tlsfpConverter) Name() string { return "tlsfp" }
+
+func (tlsfpConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a JA3/JA3S or JARM fingerprint list (ja3er dump, SSLBL, JARM CSV/JSON)",
+		Input:          "Path to the TLS fingerprint list",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a list with a fingerprint: JSON records with a name and
+// a hash, a CSV header naming a ja3, ja3s or jarm column, or a jarm,name
+// line
+func (tlsfpConverter) Detect(input []byte) bool {
+	trimmed := bytes.TrimSpace(input)
+	if bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")) {
+		fingerprints, err := Parse(bytes.NewReader(trimmed))
+		return err == nil && len(fingerprints) > 0
+	}
+	header, lines := csvHeader(trimmed)
+	if header != nil {
+		// md5 alone is too generic a column name
+		return !slices.Equal(hashColumnsOf(header), []string{"md5"})
+	}
+	return len(lines) > 0 && jarmLineRe.MatchString(lines[0])
+}
+
+// hashColumnsOf returns the hash columns of a header
+func hashColumnsOf(header []string) []string {
+	var columns []string
+	for _, kind := range kinds {
+		for _, name := range hashColumns[kind] {
+			if slices.Contains(header, name) {
+				columns = append(columns, name)
+			}
+		}
+	}
+	return columns
+}
+
+func (tlsfpConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,95 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package converter
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// UncategorizedCategory is the category of the technologies without a
+// mapped category, with the UnmappedUncategorized policy
+const UncategorizedCategory = "uncategorized"
+
+// UnmappedPolicy tells what to do with the technologies without a mapped
+// category. It's a flag.Value, the zero value is UnmappedSkip.
+type UnmappedPolicy string
+
+const (
+	// UnmappedSkip drops the technologies, and reports how many
+	UnmappedSkip UnmappedPolicy = "skip"
+	// UnmappedUncategorized writes them to an uncategorized ruleset
+	UnmappedUncategorized UnmappedPolicy = "uncategorized"
+	// UnmappedFail stops the conversion
+	UnmappedFail UnmappedPolicy = "fail"
+)
+
+// UnmappedPolicyUsage is the usage of the -unmapped-policy flag
+const UnmappedPolicyUsage = "What to do with the technologies without a mapped category: skip, uncategorized or fail (default skip)"
+
+func (p *UnmappedPolicy) String() string {
+	if p == nil || *p == "" {
+		return string(UnmappedSkip)
+	}
+	return string(*p)
+}
+
+func (p *UnmappedPolicy) Set(value string) error {
+	switch policy := UnmappedPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case UnmappedSkip, UnmappedUncategorized, UnmappedFail:
+		*p = policy
+		return nil
+	}
+	return fmt.Errorf("invalid policy %q, expected skip, uncategorized or fail", value)
+}
+
+// Skipped counts the technologies dropped by a conversion, by reason
+type Skipped map[string]int
+
+// Unmapped applies policy to the technology name, which has no mapped
+// category for reason (e.g. "with unknown categories"). It returns true
+// if the technology goes to the uncategorized ruleset, false if it's
+// skipped, and an error with the UnmappedFail policy.
+func (s Skipped) Unmapped(policy UnmappedPolicy, name, reason string) (bool, error) {
+	switch policy {
+	case UnmappedUncategorized:
+		return true, nil
+	case UnmappedFail:
+		return false, fmt.Errorf("technology %s %s", name, reason)
+	}
+	s[reason]++
+	return false, nil
+}
+
+// Report logs how many technologies were skipped and why
+func (s Skipped) Report() {
+	if len(s) == 0 {
+		return
+	}
+	reasons := make([]string, 0, len(s))
+	for reason := range s {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	total := 0
+	for i, reason := range reasons {
+		total += s[reason]
+		reasons[i] = fmt.Sprintf("%d %s", s[reason], reason)
+	}
+	slog.Warn("Skipped the technologies without a mapped category, use -unmapped-policy to keep them",
+		"skipped", total, "reasons", strings.Join(reasons, ", "))
+}
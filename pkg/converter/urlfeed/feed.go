@@ -0,0 +1,307 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package urlfeed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The feeds recognized, and their defaults
+const (
+	FeedURLhaus   = "URLhaus"
+	FeedPhishTank = "PhishTank"
+	FeedOpenPhish = "OpenPhish"
+)
+
+// feedURLs are the home pages of the feeds
+var feedURLs = map[string]string{
+	FeedURLhaus:   "https://urlhaus.abuse.ch/",
+	FeedPhishTank: "https://phishtank.org/",
+	FeedOpenPhish: "https://openphish.com/",
+}
+
+// feedThreats are the threats of the entries of the feeds that don't
+// tell theirs
+var feedThreats = map[string]string{
+	FeedURLhaus:   "malware_download",
+	FeedPhishTank: "phishing",
+	FeedOpenPhish: "phishing",
+}
+
+// DefaultThreat is the threat of the entries of an unknown feed
+const DefaultThreat = "malicious"
+
+// Entry is a malicious URL of a feed
+type Entry struct {
+	URL    string
+	Threat string
+	// Tags are the tags of the URL in the feed (URLhaus tags, PhishTank
+	// target)
+	Tags  []string
+	Added time.Time
+}
+
+// Feed is a parsed feed: its name (empty if unknown), when it was last
+// updated (zero if it doesn't tell) and its entries
+type Feed struct {
+	Name      string
+	UpdatedAt time.Time
+	Entries   []Entry
+}
+
+// The column names of the CSV feeds
+var (
+	urlColumns    = []string{"url"}
+	threatColumns = []string{"threat"}
+	tagsColumns   = []string{"tags", "target", "brand"}
+	dateColumns   = []string{"dateadded", "date_added", "submission_time", "verification_time", "firstseen", "discover_time", "isotime"}
+)
+
+// column returns the index of the first of names in header, or -1
+func column(header []string, names []string) int {
+	for _, name := range names {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), name) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// dateLayouts are the layouts of the feed dates
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseDate parses a feed date, in UTC when it has no zone. It returns
+// the zero time for an invalid date.
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "(UTC)"))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
+
+// isURL tells if s is an http(s) URL
+func isURL(s string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// splitTags splits the tags of a CSV record (elf,mozi) and drops the
+// ones telling nothing
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && tag != "None" && tag != "Other" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// add adds an entry to the feed, keeping the latest date of its entries
+// as the update time if the feed doesn't tell
+func (f *Feed) add(entry Entry, latest *time.Time) {
+	if entry.Added.After(*latest) {
+		*latest = entry.Added
+	}
+	f.Entries = append(f.Entries, entry)
+}
+
+// jsonEntry is an entry of the JSON feeds (the URLhaus API, the PhishTank
+// and OpenPhish JSON feeds)
+type jsonEntry struct {
+	URL     string          `json:"url"`
+	Threat  string          `json:"threat"`
+	Tags    json.RawMessage `json:"tags"`
+	Target  string          `json:"target"`
+	Brand   string          `json:"brand"`
+	PhishID json.RawMessage `json:"phish_id"`
+	// The dates of the feeds
+	DateAdded      string `json:"date_added"`
+	SubmissionTime string `json:"submission_time"`
+	DiscoverTime   string `json:"discover_time"`
+	ISOTime        string `json:"isotime"`
+}
+
+// parseJSON reads a JSON feed: an array of entries, or the URLhaus API
+// response with its urls array
+func parseJSON(data []byte) (Feed, error) {
+	var entries []jsonEntry
+	feed := Feed{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		var doc struct {
+			URLs []jsonEntry `json:"urls"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return Feed{}, fmt.Errorf("error unmarshalling JSON: %v", err)
+		}
+		entries, feed.Name = doc.URLs, FeedURLhaus
+	}
+
+	var latest time.Time
+	for _, e := range entries {
+		if !isURL(e.URL) {
+			continue
+		}
+		entry := Entry{URL: strings.TrimSpace(e.URL), Threat: e.Threat}
+		var tags []string
+		if json.Unmarshal(e.Tags, &tags) != nil {
+			var tag string
+			if json.Unmarshal(e.Tags, &tag) == nil {
+				tags = splitTags(tag)
+			}
+		}
+		entry.Tags = append(splitTags(e.Target), splitTags(e.Brand)...)
+		entry.Tags = append(entry.Tags, tags...)
+		for _, date := range []string{e.DateAdded, e.SubmissionTime, e.DiscoverTime, e.ISOTime} {
+			if t := parseDate(date); !t.IsZero() {
+				entry.Added = t
+				break
+			}
+		}
+		if feed.Name == "" && e.PhishID != nil {
+			feed.Name = FeedPhishTank
+		}
+		feed.add(entry, &latest)
+	}
+	feed.UpdatedAt = latest
+	return feed, nil
+}
+
+var (
+	// updatedRe matches the update time in the comments of a feed
+	// (# Last updated: 2024-05-01 10:12:03 (UTC))
+	updatedRe = regexp.MustCompile(`(?i)^#\s*(?:last updated|generated|updated)\s*(?:at|on)?\s*:\s*(.+?)[\s#]*$`)
+	// commentHeaderRe matches a commented CSV header (# id,dateadded,url)
+	commentHeaderRe = regexp.MustCompile(`^#\s*([A-Za-z_][\w.-]*(?:\s*,\s*[A-Za-z_][\w .-]*)+)$`)
+)
+
+// Parse reads a feed: a JSON feed, a CSV feed with a (possibly commented)
+// header naming a url column, or a list of URLs, one per line. The
+// comments of the CSV feeds and the lists start with #, they can tell
+// the update time of the feed.
+func Parse(r io.Reader) (Feed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Feed{}, fmt.Errorf("error reading feed: %v", err)
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		return parseJSON(trimmed)
+	}
+
+	var feed Feed
+	var header, lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			if strings.Contains(strings.ToLower(line), "urlhaus") {
+				feed.Name = FeedURLhaus
+			}
+			if m := updatedRe.FindStringSubmatch(line); m != nil {
+				feed.UpdatedAt = parseDate(m[1])
+			}
+			if m := commentHeaderRe.FindStringSubmatch(line); m != nil && header == nil {
+				if h, err := csv.NewReader(strings.NewReader(m[1])).Read(); err == nil && column(h, urlColumns) >= 0 {
+					header = h
+				}
+			}
+		default:
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Feed{}, fmt.Errorf("error scanning feed: %v", err)
+	}
+	if len(lines) == 0 {
+		return Feed{}, fmt.Errorf("no URLs found")
+	}
+
+	if header == nil && !isURL(lines[0]) {
+		h, err := csv.NewReader(strings.NewReader(lines[0])).Read()
+		if err != nil || column(h, urlColumns) < 0 {
+			return Feed{}, fmt.Errorf("no url column in header %q", lines[0])
+		}
+		header, lines = h, lines[1:]
+	}
+
+	var latest time.Time
+	if header == nil {
+		for _, line := range lines {
+			if isURL(line) {
+				feed.add(Entry{URL: line}, &latest)
+			}
+		}
+	} else {
+		if column(header, []string{"phish_id"}) >= 0 {
+			feed.Name = FeedPhishTank
+		}
+		url, threat, tags, date := column(header, urlColumns), column(header, threatColumns),
+			column(header, tagsColumns), column(header, dateColumns)
+		reader := csv.NewReader(strings.NewReader(strings.Join(lines, "\n")))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return Feed{}, err
+			}
+			field := func(i int) string {
+				if i < 0 || i >= len(record) {
+					return ""
+				}
+				return strings.TrimSpace(record[i])
+			}
+			if !isURL(field(url)) {
+				continue
+			}
+			feed.add(Entry{
+				URL:    field(url),
+				Threat: field(threat),
+				Tags:   splitTags(field(tags)),
+				Added:  parseDate(field(date)),
+			}, &latest)
+		}
+	}
+	if feed.UpdatedAt.IsZero() {
+		feed.UpdatedAt = latest
+	}
+	return feed, nil
+}
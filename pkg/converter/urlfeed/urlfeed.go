@@ -0,0 +1,260 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package urlfeed converts the malicious URL feeds (URLhaus, PhishTank,
+// OpenPhish, in their CSV, JSON and plain text forms) into CROWler
+// rulesets of URL micro-signatures, to exclude the URLs from a crawl or
+// flag the pages linking to them. The feed, its URL and its update time
+// are recorded in the ruleset metadata.
+package urlfeed
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Malicious URL feed"
+	// DefaultSourceLicense is used when the license of the feed isn't
+	// given, the feeds come with different terms
+	DefaultSourceLicense = "NOASSERTION"
+	// Category is the taxonomy key of the malicious URLs, the threats
+	// (phishing, malware_download) are keys too
+	Category = "malicious_url"
+)
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// Feed is the name of the feed, when it isn't recognized (empty
+	// uses the name of the input file)
+	Feed string
+}
+
+// urlPattern returns the signature matching u over http and https. It
+// returns false if u isn't a valid URL.
+func urlPattern(u string) (string, string, bool) {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return "", "", false
+	}
+	rest := u[strings.Index(u, "://")+3:]
+	return `^https?://` + regexp.QuoteMeta(rest) + `$`, strings.ToLower(parsed.Hostname()), true
+}
+
+// hostRule is the rule of a host for a threat, with its tags
+type hostRule struct {
+	rule crowler.DetectionRule
+	tags []string
+}
+
+// Convert converts a feed into a ruleset with a group per threat, and a
+// rule per host in each group matching its malicious URLs
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	feed, err := Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the feed: %v", err)
+	}
+
+	name := opts.Feed
+	if name == "" {
+		name = feed.Name
+	}
+	if name == "" {
+		name = strings.TrimSuffix(opts.FileName, filepath.Ext(opts.FileName))
+	}
+	if name == "" {
+		name = "malicious URLs"
+	}
+
+	// Merge the URLs of the same host and threat
+	rules := make(map[string]map[string]*hostRule)
+	invalid := 0
+	for _, entry := range feed.Entries {
+		pattern, host, ok := urlPattern(entry.URL)
+		if !ok {
+			invalid++
+			continue
+		}
+		threat := entry.Threat
+		if threat == "" {
+			threat = feedThreats[feed.Name]
+		}
+		if threat == "" {
+			threat = DefaultThreat
+		}
+		if rules[threat] == nil {
+			rules[threat] = make(map[string]*hostRule)
+		}
+		hr, ok := rules[threat][host]
+		if !ok {
+			kind := strings.ReplaceAll(threat, "_", " ")
+			hr = &hostRule{rule: crowler.DetectionRule{
+				RuleName:   "detect_" + slug.Make(threat) + "_" + slug.Make(host),
+				ObjectName: host,
+				Metadata: &crowler.RuleMetadata{
+					Description: fmt.Sprintf("%s%s URLs of %s reported by %s", strings.ToUpper(kind[:1]), kind[1:], host, name),
+				},
+			}}
+			rules[threat][host] = hr
+		}
+		exists := slices.ContainsFunc(hr.rule.URLPatterns, func(u crowler.URLMicroSignature) bool { return u.Signature == pattern })
+		if !exists {
+			hr.rule.URLPatterns = append(hr.rule.URLPatterns, crowler.URLMicroSignature{
+				Signature:  pattern,
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+		for _, tag := range entry.Tags {
+			if !slices.Contains(hr.tags, tag) {
+				hr.tags = append(hr.tags, tag)
+			}
+		}
+	}
+	if invalid > 0 {
+		slog.Warn("Skipped invalid URLs", "skipped", invalid)
+	}
+
+	rulesetName := "detect_" + slug.Make(name) + "_malicious_urls"
+	ruleset := crowler.NewRuleset(rulesetName,
+		fmt.Sprintf("Ruleset to exclude from the crawl (or flag) the malicious URLs reported by %s.", name))
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = slug.File(rulesetName) + "-ruleset.yaml"
+	ruleset.Metadata = &crowler.RulesetMetadata{
+		Feed:    name,
+		FeedURL: feedURLs[name],
+	}
+	if !feed.UpdatedAt.IsZero() {
+		ruleset.Metadata.FeedUpdatedAt = feed.UpdatedAt.Format(time.RFC3339)
+	}
+
+	threats := make([]string, 0, len(rules))
+	for threat := range rules {
+		threats = append(threats, threat)
+	}
+	sort.Strings(threats)
+
+	ruleNames := slug.NewNamer()
+	for _, threat := range threats {
+		groupTags := taxonomy.Merge(opts.Taxonomy.Tags(Category), opts.Taxonomy.Tags(threat)...)
+		group := crowler.RuleGroup{
+			GroupName:      "detect_" + slug.Make(threat) + "_urls",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		}
+
+		hosts := make([]string, 0, len(rules[threat]))
+		for host := range rules[threat] {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		for _, host := range hosts {
+			hr := rules[threat][host]
+			rule := hr.rule
+			rule.Metadata.Tags = hr.tags
+			rule.RuleName = ruleNames.Unique(rule.RuleName)
+			opts.PrepareRule(&rule)
+			rule.Tags = groupTags
+			group.DetectionRules = append(group.DetectionRules, rule)
+		}
+		ruleset.RuleGroups = append(ruleset.RuleGroups, group)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(&urlFeedConverter{})
+}
+
+// urlFeedConverter is the registered malicious URL feed converter
+type urlFeedConverter struct {
+	feed string
+}
+
+func (*urlFeedConverter) Name() string { return "urlfeed" }
+
+func (*urlFeedConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a malicious URL feed (URLhaus, PhishTank, OpenPhish) to exclusion rules",
+		Input:          "Path to the feed (CSV, JSON or a list of URLs)",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a URLhaus feed (CSV or API response), a PhishTank
+// feed (CSV or JSON) or a list of URLs, as the OpenPhish feed. The other
+// CSV and JSON feeds with a url column have to be converted with urlfeed,
+// as too many formats have one.
+func (*urlFeedConverter) Detect(input []byte) bool {
+	text := string(input)
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{") {
+		if !strings.Contains(text, `"phish_id"`) && !strings.Contains(text, `"urlhaus_reference"`) {
+			return false
+		}
+		feed, err := parseJSON([]byte(trimmed))
+		return err == nil && len(feed.Entries) > 0
+	}
+
+	urls := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#"):
+			if strings.Contains(strings.ToLower(line), "urlhaus") {
+				return true
+			}
+		case urls == 0 && strings.HasPrefix(line, "phish_id,"):
+			return true
+		case isURL(line) && !strings.ContainsAny(line, " \t,"):
+			urls++
+			if urls == 10 {
+				return true
+			}
+		default:
+			return false
+		}
+	}
+	return urls > 0
+}
+
+func (c *urlFeedConverter) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.feed, "feed", "", "Name of the feed recorded in the ruleset metadata (default the detected feed, or the input file name)")
+}
+
+func (c *urlFeedConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, Feed: c.feed})
+}
@@ -0,0 +1,393 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wafw00f converts the wafw00f plugins into a CROWler ruleset
+// detecting the WAF (or CDN) protecting a site. The plugins are Python
+// code, which isn't run: the converter reads the arguments of the match
+// calls of their is_waf functions, the header values, the cookie names and
+// the content of the block pages.
+package wafw00f
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "wafw00f plugins"
+	// DefaultSourceLicense is the license of wafw00f
+	DefaultSourceLicense = "BSD-3-Clause"
+	// Category is the taxonomy key of the WAFs
+	Category = "waf"
+)
+
+// Plugin is the literal part of a wafw00f plugin: its name and the
+// arguments of its match calls
+type Plugin struct {
+	// Name is the WAF, with its vendor in parentheses
+	// (Cloudflare (Cloudflare Inc.))
+	Name    string
+	Matches []Match
+}
+
+// Match is a match call of a plugin: Method is Header, Cookie, Content,
+// Status or Reason. Header is the header name of the Header matches,
+// Pattern the regex, Attack tells if the match is on the response to an
+// attack request (a block page).
+type Match struct {
+	Method  string
+	Header  string
+	Pattern string
+	Attack  bool
+}
+
+var (
+	// nameRe matches the name of a plugin
+	nameRe = regexp.MustCompile(`(?m)^NAME\s*=\s*`)
+	// matchCallRe matches the match calls of a plugin
+	matchCallRe = regexp.MustCompile(`self\.match(Header|Cookie|Content|Status|Reason)\(\s*`)
+	// attackRe matches the attack argument of a match call
+	attackRe = regexp.MustCompile(`^\s*,\s*attack\s*=\s*True`)
+)
+
+// pyString parses the Python string literal at the start of s (with an
+// r, b or u prefix) and the literals concatenated to it. It returns the
+// string and the length of the literals, or false if s doesn't start with
+// a string literal.
+func pyString(s string) (string, int, bool) {
+	var b strings.Builder
+	i, found := 0, false
+	for {
+		j := i
+		for j < len(s) && strings.ContainsRune(" \t", rune(s[j])) {
+			j++
+		}
+		raw := false
+		for j < len(s) && strings.ContainsRune("rRbBuU", rune(s[j])) {
+			raw = raw || s[j] == 'r' || s[j] == 'R'
+			j++
+		}
+		if j >= len(s) || s[j] != '\'' && s[j] != '"' {
+			return b.String(), i, found
+		}
+		quote := s[j]
+		j++
+		closed := false
+		for ; j < len(s); j++ {
+			c := s[j]
+			if c == quote {
+				closed = true
+				j++
+				break
+			}
+			if c == '\\' && j+1 < len(s) {
+				j++
+				switch e := s[j]; {
+				case raw:
+					b.WriteByte('\\')
+					b.WriteByte(e)
+				case e == '\\' || e == '\'' || e == '"':
+					b.WriteByte(e)
+				case e == 'n':
+					b.WriteByte('\n')
+				case e == 't':
+					b.WriteByte('\t')
+				default:
+					// Python keeps the unknown escapes (\d, \s...)
+					b.WriteByte('\\')
+					b.WriteByte(e)
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		if !closed {
+			return "", 0, false
+		}
+		i, found = j, true
+	}
+}
+
+// parseMatch parses the arguments of a match call: a string, or a
+// (header, regex) tuple for matchHeader
+func parseMatch(method, args string) (Match, bool) {
+	m := Match{Method: method}
+	if strings.HasPrefix(args, "(") {
+		header, n, ok := pyString(args[1:])
+		if !ok {
+			return m, false
+		}
+		rest := strings.TrimLeft(args[1+n:], " \t\n")
+		if !strings.HasPrefix(rest, ",") {
+			return m, false
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\n")
+		pattern, n, ok := pyString(rest)
+		if !ok {
+			return m, false
+		}
+		rest = strings.TrimLeft(rest[n:], " \t\n")
+		if !strings.HasPrefix(rest, ")") {
+			return m, false
+		}
+		m.Header, m.Pattern = header, pattern
+		m.Attack = attackRe.MatchString(rest[1:])
+		return m, true
+	}
+	if method == "Status" {
+		// A status code
+		end := strings.IndexAny(args, ",)")
+		if end < 0 {
+			return m, false
+		}
+		m.Pattern = strings.TrimSpace(args[:end])
+		m.Attack = attackRe.MatchString(args[end:])
+		return m, true
+	}
+	pattern, n, ok := pyString(args)
+	if !ok {
+		return m, false
+	}
+	m.Pattern = pattern
+	m.Attack = attackRe.MatchString(args[n:])
+	return m, true
+}
+
+// ParsePlugins reads the plugins of a Python file (or of a stream of
+// plugin files). The match calls whose arguments aren't literals are
+// skipped.
+func ParsePlugins(r io.Reader) ([]Plugin, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src := string(data)
+
+	var plugins []Plugin
+	names := nameRe.FindAllStringIndex(src, -1)
+	for i, loc := range names {
+		end := len(src)
+		if i+1 < len(names) {
+			end = names[i+1][0]
+		}
+		name, _, ok := pyString(src[loc[1]:end])
+		if !ok {
+			continue
+		}
+		plugin := Plugin{Name: strings.TrimSpace(name)}
+		body := src[loc[1]:end]
+		for _, call := range matchCallRe.FindAllStringSubmatchIndex(body, -1) {
+			method := body[call[2]:call[3]]
+			if m, ok := parseMatch(method, body[call[1]:]); ok {
+				plugin.Matches = append(plugin.Matches, m)
+			}
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// ReadDir merges the plugin files in dir (the wafw00f/plugins directory)
+// into a single stream
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".py" || d.Name() == "__init__.py" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no plugins found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
+
+// vendorRe matches the vendor following the name of a WAF
+var vendorRe = regexp.MustCompile(`^(.+?)\s*\([^()]+\)$`)
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			for _, v := range h.Value {
+				if v == pattern {
+					return
+				}
+			}
+			h.Value = append(h.Value, pattern)
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// convertPlugin converts the header, cookie and content matches of a
+// plugin into a rule. wafw00f matches case insensitively. The status and
+// reason matches have no CROWler signature. It returns false if none of
+// the matches could be converted.
+func convertPlugin(plugin Plugin) (crowler.DetectionRule, bool) {
+	// The rule is named after the WAF, the full name is kept in the
+	// description
+	name := plugin.Name
+	if m := vendorRe.FindStringSubmatch(plugin.Name); m != nil {
+		name = m[1]
+	}
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+	}
+	if name != plugin.Name {
+		rule.Metadata = &crowler.RuleMetadata{Description: plugin.Name}
+	}
+
+	converted := false
+	for _, m := range plugin.Matches {
+		pattern, err := normalize.Translate("(?i)" + m.Pattern)
+		if err != nil {
+			continue
+		}
+		switch m.Method {
+		case "Header":
+			appendHeader(&rule, m.Header, pattern)
+		case "Cookie":
+			appendHeader(&rule, "Set-Cookie", pattern)
+		case "Content":
+			if len(rule.PageContentPatterns) == 0 {
+				rule.PageContentPatterns = []crowler.PageContentSignature{{Key: "body", Confidence: crowler.DefaultConfidence}}
+			}
+			body := &rule.PageContentPatterns[0]
+			body.Signature = append(body.Signature, pattern)
+		default:
+			continue
+		}
+		converted = true
+	}
+	return rule, converted
+}
+
+// Convert converts the wafw00f plugins read from r, a plugin file or the
+// plugin files of a directory, into the detect_waf ruleset
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	plugins, err := ParsePlugins(r)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing plugins: %v", err)
+	}
+	sort.SliceStable(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+
+	groupTags := opts.Taxonomy.Tags(Category)
+	ruleset := crowler.NewRuleset("detect_waf", "Ruleset to detect the WAF or CDN protecting a site.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-waf-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_waf",
+			IsEnabled:      true,
+			Tags:           groupTags,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	ruleNames := slug.NewNamer()
+	converted := 0
+	for _, plugin := range plugins {
+		rule, ok := convertPlugin(plugin)
+		if !ok {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = groupTags
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+	}
+
+	if converted < len(plugins) {
+		slog.Info("Some plugins only match status codes and reasons or use regexes Go can't compile",
+			"converted", converted, "total", len(plugins))
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(wafw00fConverter{})
+}
+
+// wafw00fConverter is the registered wafw00f converter
+type wafw00fConverter struct{}
+
+func (wafw00fConverter) Name() string { return "wafw00f" }
+
+func (wafw00fConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert wafw00f WAF detection plugins",
+		Input:          "Path to a wafw00f plugin, or to the wafw00f plugins directory",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// isWafRe matches the detection function of a plugin
+var isWafRe = regexp.MustCompile(`def is_waf\(self\)`)
+
+// Detect recognizes a wafw00f plugin: a NAME and an is_waf function
+func (wafw00fConverter) Detect(input []byte) bool {
+	return nameRe.Match(input) && isWafRe.Match(input)
+}
+
+func (wafw00fConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (wafw00fConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,317 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wappalyzer converts the simplified Wappalyzer technologies JSON
+// (numeric categories, single html/url patterns) into CROWler detection
+// rulesets, one per mapped category.
+package wappalyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "Wappalyzer technologies.json"
+	// DefaultSourceLicense is the license of the Wappalyzer sources
+	DefaultSourceLicense = "GPL-3.0-only"
+)
+
+// Define the structure for the Wappalyzer technologies JSON
+type WappalyzerTechnology struct {
+	Cats    []int             `json:"cats"`
+	URL     string            `json:"url,omitempty"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Implies []string          `json:"implies,omitempty"`
+	CPE     string            `json:"cpe,omitempty"`
+}
+
+type WappalyzerTechnologies struct {
+	Technologies map[string]WappalyzerTechnology `json:"technologies"`
+}
+
+// Define category mappings
+var categoryMappings = map[int]string{
+	1: "cms",
+	2: "web_frameworks",
+	// Add other mappings as needed
+}
+
+func createRule(name string, details WappalyzerTechnology) crowler.DetectionRule {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(name),
+		ObjectName: name,
+		CPE:        details.CPE,
+		Implies:    details.Implies,
+	}
+
+	if details.Headers != nil {
+		for k, v := range details.Headers {
+			rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+				Key:        k,
+				Value:      []string{v},
+				Confidence: crowler.DefaultConfidence,
+			})
+		}
+	}
+
+	if details.HTML != "" {
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Text:       []string{details.HTML},
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	if details.URL != "" {
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  details.URL,
+			Confidence: crowler.DefaultConfidence,
+		})
+	}
+
+	return rule
+}
+
+// technology is a decoded technology: its rule, not yet named, and its
+// categories. The technologies without a mapped category have no rule.
+type technology struct {
+	rule *crowler.DetectionRule
+	cats []int
+}
+
+// hasMappedCategory tells if one of the categories cats is mapped
+func hasMappedCategory(cats []int) bool {
+	for _, cat := range cats {
+		if _, exists := categoryMappings[cat]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert converts a technologies JSON document into a ruleset per mapped
+// category, sorted by category. The document is streamed: each
+// technology is converted to its rule as soon as it's decoded, so only
+// the rules are kept in memory.
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	technologies := make(map[string]technology)
+	err := decodeTechnologies(json.NewDecoder(r), func(name string, raw json.RawMessage) error {
+		var details WappalyzerTechnology
+		if err := json.Unmarshal(raw, &details); err != nil {
+			if err := opts.Skip("technology "+name, err); err != nil {
+				return fmt.Errorf("technology %s: %v", name, err)
+			}
+			return nil
+		}
+		tech := technology{cats: details.Cats}
+		if hasMappedCategory(details.Cats) {
+			rule := createRule(name, details)
+			tech.rule = &rule
+		}
+		technologies[name] = tech
+		opts.Processed(1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+	}
+
+	// Initialize category-based rulesets
+	rulesets := make(map[string]crowler.Ruleset)
+
+	// Process the technologies in a stable order, so the suffixes added to
+	// colliding rule names don't change between runs
+	names := make([]string, 0, len(technologies))
+	for name := range technologies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ruleNames := slug.NewNamer()
+
+	// Process each technology and categorize
+	for _, name := range names {
+		tech := technologies[name]
+		delete(technologies, name)
+		// The skipped technologies take their rule name all the same
+		ruleName := ruleNames.Unique("detect_" + slug.Make(name))
+		if tech.rule == nil {
+			continue
+		}
+		rule := *tech.rule
+		rule.RuleName = ruleName
+		opts.PrepareRule(&rule)
+		// Move the Wappalyzer tags out of the patterns
+		patterntag.StripRule(&rule)
+		if opts.Normalize {
+			crowler.DedupeSignatures(&rule)
+		}
+		for _, cat := range tech.cats {
+			if category, exists := categoryMappings[cat]; exists {
+				rule.Tags = taxonomy.Merge(rule.Tags, opts.Taxonomy.Tags(strconv.Itoa(cat), category)...)
+			}
+		}
+		for _, cat := range tech.cats {
+			category, exists := categoryMappings[cat]
+			if !exists {
+				continue
+			}
+
+			if _, ok := rulesets[category]; !ok {
+				ruleset := crowler.NewRuleset(fmt.Sprintf("detect_%s_ruleset", category),
+					fmt.Sprintf("Ruleset to detect %s technologies.", strings.ReplaceAll(category, "_", " ")))
+				ruleset.Source = SourceName
+				ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+				ruleset.FileName = fmt.Sprintf("detect-%s-ruleset.yaml", slug.File(category))
+				ruleset.RuleGroups = []crowler.RuleGroup{
+					{
+						GroupName:      "detect_web_technologies",
+						IsEnabled:      true,
+						Category:       category,
+						Tags:           opts.Taxonomy.Tags(strconv.Itoa(cat), category),
+						DetectionRules: []crowler.DetectionRule{},
+					},
+				}
+				rulesets[category] = ruleset
+			}
+
+			ruleset := rulesets[category]
+			ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, rule)
+			rulesets[category] = ruleset
+		}
+	}
+
+	categories := make([]string, 0, len(rulesets))
+	for category := range rulesets {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	out := make([]crowler.Ruleset, 0, len(categories))
+	for _, category := range categories {
+		ruleset := rulesets[category]
+		crowler.ApplyNamespace(&ruleset, opts.Namespace)
+		out = append(out, ruleset)
+	}
+	return out, nil
+}
+
+// decodeTechnologies reads the technologies of the document read by dec
+// one at a time, calling fn with the JSON of each of them, and stops at
+// the first error of fn. The other members of the document are skipped.
+func decodeTechnologies(dec *json.Decoder, fn func(name string, raw json.RawMessage) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "technologies" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '{'); err != nil {
+			return fmt.Errorf("technologies: %v", err)
+		}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			name, _ := token.(string)
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("technology %s: %v", name, err)
+			}
+			if err := fn(name, raw); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, '}'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token of dec, returning an error if it's not
+// the delimiter delim
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %v, found %v at offset %d", delim, token, dec.InputOffset())
+	}
+	return nil
+}
+
+func init() {
+	converter.Register(wappalyzerConverter{})
+}
+
+// wappalyzerConverter is the registered Wappalyzer converter
+type wappalyzerConverter struct{}
+
+func (wappalyzerConverter) Name() string { return "wappalyzer" }
+
+func (wappalyzerConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a Wappalyzer technologies.json file",
+		Input:          "Path to the Wappalyzer technologies.json file",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a technologies document without categories whose
+// technologies list their categories in "cats"
+func (wappalyzerConverter) Detect(input []byte) bool {
+	var doc struct {
+		Technologies map[string]map[string]json.RawMessage `json:"technologies"`
+		Categories   json.RawMessage                       `json:"categories"`
+	}
+	if err := json.Unmarshal(input, &doc); err != nil || doc.Categories != nil {
+		return false
+	}
+	for _, tech := range doc.Technologies {
+		if _, ok := tech["cats"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (wappalyzerConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,502 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package whatweb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+)
+
+// Plugin is the literal part of a WhatWeb plugin: its description and its
+// matches array. The passive and aggressive functions are Ruby code and
+// are ignored.
+type Plugin struct {
+	Name        string
+	Description string
+	Website     string
+	Matches     []Match
+}
+
+// Match is an entry of the matches array of a plugin
+type Match struct {
+	Name       string
+	Search     string
+	URL        string
+	Text       string
+	Regexp     *Regexp
+	Version    any // a *Regexp or a fixed version string
+	Offset     int
+	MD5        string
+	TagPattern string
+	Status     int
+	Certainty  int
+}
+
+// Regexp is a Ruby regexp literal, with its flags
+type Regexp struct {
+	Source string
+	Flags  string
+}
+
+// rubyExpr is a Ruby expression that isn't a literal
+type rubyExpr string
+
+// rubyParser parses the Ruby literals of the WhatWeb plugins: strings,
+// symbols, numbers, regexps, arrays and hashes
+type rubyParser struct {
+	s string
+	i int
+}
+
+func (p *rubyParser) errorf(format string, args ...any) error {
+	line := strings.Count(p.s[:p.i], "\n") + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skip skips the spaces, the line continuations and the comments
+func (p *rubyParser) skip() {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == '#':
+			end := strings.IndexByte(p.s[p.i:], '\n')
+			if end < 0 {
+				p.i = len(p.s)
+				return
+			}
+			p.i += end
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.i++
+		case c == '\\' && strings.HasPrefix(p.s[p.i+1:], "\n"):
+			p.i += 2
+		default:
+			return
+		}
+	}
+}
+
+// delimited reads the text up to the closing delimiter of a string or
+// regexp literal, keeping the escapes but the ones of the quote and slash
+// delimiters. The bracket delimiters nest.
+func (p *rubyParser) delimited(open byte) (string, error) {
+	closing := open
+	switch open {
+	case '(':
+		closing = ')'
+	case '[':
+		closing = ']'
+	case '{':
+		closing = '}'
+	case '<':
+		closing = '>'
+	}
+	var b strings.Builder
+	depth := 0
+	for p.i++; p.i < len(p.s); p.i++ {
+		c := p.s[p.i]
+		switch {
+		case c == '\\' && p.i+1 < len(p.s):
+			p.i++
+			if e := p.s[p.i]; e != open || !strings.ContainsRune(`"'/`, rune(e)) {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(p.s[p.i])
+			continue
+		case c == closing && depth == 0:
+			p.i++
+			return b.String(), nil
+		case c == closing:
+			depth--
+		case c == open && open != closing:
+			depth++
+		}
+		b.WriteByte(c)
+	}
+	return "", p.errorf("unterminated literal")
+}
+
+// unescape resolves the escapes of a double quoted string
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// str parses a quoted string, and the strings concatenated to it with +
+func (p *rubyParser) str() (any, error) {
+	quote := p.s[p.i]
+	value, err := p.delimited(quote)
+	if err != nil {
+		return nil, err
+	}
+	if quote == '"' {
+		if strings.Contains(value, "#{") {
+			return rubyExpr(value), nil
+		}
+		value = unescape(value)
+	} else {
+		value = strings.ReplaceAll(value, `\\`, `\`)
+	}
+
+	p.skip()
+	if p.i < len(p.s) && p.s[p.i] == '+' {
+		p.i++
+		next, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		s, ok := next.(string)
+		if !ok {
+			return rubyExpr(value), nil
+		}
+		return value + s, nil
+	}
+	return value, nil
+}
+
+// regexpFlags reads the flags following a regexp literal
+func (p *rubyParser) regexpFlags() string {
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte("imxonesu", p.s[p.i]) >= 0 {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// value parses a literal. The other expressions are skipped up to the end
+// of the array or hash item and returned as a rubyExpr.
+func (p *rubyParser) value() (any, error) {
+	p.skip()
+	if p.i >= len(p.s) {
+		return nil, p.errorf("unexpected end of file")
+	}
+	switch c := p.s[p.i]; {
+	case c == '[':
+		return p.array()
+	case c == '{':
+		return p.hash()
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '/':
+		source, err := p.delimited('/')
+		if err != nil {
+			return nil, err
+		}
+		return &Regexp{Source: source, Flags: p.regexpFlags()}, nil
+	case c == '%' && p.i+2 < len(p.s) && p.s[p.i+1] == 'r':
+		p.i += 2
+		source, err := p.delimited(p.s[p.i])
+		if err != nil {
+			return nil, err
+		}
+		return &Regexp{Source: source, Flags: p.regexpFlags()}, nil
+	case c == ':' && p.i+1 < len(p.s) && isNameChar(p.s[p.i+1]):
+		p.i++
+		return p.name(), nil
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.i
+		p.i++
+		for p.i < len(p.s) && (p.s[p.i] >= '0' && p.s[p.i] <= '9' || p.s[p.i] == '.' || p.s[p.i] == '_') {
+			p.i++
+		}
+		if n, err := strconv.Atoi(strings.ReplaceAll(p.s[start:p.i], "_", "")); err == nil {
+			return n, nil
+		}
+		return rubyExpr(p.s[start:p.i]), nil
+	default:
+		return p.expr()
+	}
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// name reads an identifier
+func (p *rubyParser) name() string {
+	start := p.i
+	for p.i < len(p.s) && isNameChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// expr skips an expression up to the next , ] or } outside brackets
+func (p *rubyParser) expr() (any, error) {
+	start := p.i
+	depth := 0
+	for ; p.i < len(p.s); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return rubyExpr(strings.TrimSpace(p.s[start:p.i])), nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return rubyExpr(strings.TrimSpace(p.s[start:p.i])), nil
+			}
+		case '"', '\'':
+			if _, err := p.delimited(c); err != nil {
+				return nil, err
+			}
+			p.i--
+		}
+	}
+	return nil, p.errorf("unexpected end of file")
+}
+
+// array parses an array literal
+func (p *rubyParser) array() ([]any, error) {
+	var items []any
+	p.i++ // [
+	for {
+		p.skip()
+		if p.i >= len(p.s) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.s[p.i] == ']' {
+			p.i++
+			return items, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		p.skip()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		}
+	}
+}
+
+// hash parses a hash literal with symbol keys (:text=>"..." or text: "...")
+func (p *rubyParser) hash() (map[string]any, error) {
+	h := make(map[string]any)
+	p.i++ // {
+	for {
+		p.skip()
+		if p.i >= len(p.s) {
+			return nil, p.errorf("unterminated hash")
+		}
+		if p.s[p.i] == '}' {
+			p.i++
+			return h, nil
+		}
+
+		// text: "..." or a key and =>
+		var key any
+		start := p.i
+		if name := p.name(); name != "" && strings.HasPrefix(p.s[p.i:], ":") && !strings.HasPrefix(p.s[p.i:], "::") {
+			key = name
+			p.i++
+		} else {
+			p.i = start
+			var err error
+			if key, err = p.value(); err != nil {
+				return nil, err
+			}
+			p.skip()
+			if !strings.HasPrefix(p.s[p.i:], "=>") {
+				return nil, p.errorf("expected => after a hash key")
+			}
+			p.i += 2
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		h[fmt.Sprint(key)] = value
+
+		p.skip()
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		}
+	}
+}
+
+var (
+	// defineRe matches the start of a plugin, with the name of the old
+	// plugins (Plugin.define "Apache" do)
+	defineRe = regexp.MustCompile(`Plugin\.define\s*(?:\(?\s*["']([^"']+)["'])?`)
+	// fieldRe matches the fields of a plugin (name "Apache", matches [,
+	// and @matches=[ in the old plugins)
+	fieldRe = regexp.MustCompile(`(?m)^[ \t]*@?(name|description|website|matches)\b[ \t]*(?:=[ \t]*)?\(?`)
+	// defRe matches the first method of a plugin, after its fields
+	defRe = regexp.MustCompile(`(?m)^[ \t]*def\s`)
+)
+
+// ParsePlugins reads the plugins of a Ruby file (or of a stream of
+// plugin files). The plugins with fields that can't be parsed are skipped
+// with opts.Skip.
+func ParsePlugins(r io.Reader, opts converter.Options) ([]Plugin, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src := string(data)
+
+	var plugins []Plugin
+	defines := defineRe.FindAllStringSubmatchIndex(src, -1)
+	for i, loc := range defines {
+		end := len(src)
+		if i+1 < len(defines) {
+			end = defines[i+1][0]
+		}
+		body := src[loc[1]:end]
+		if def := defRe.FindStringIndex(body); def != nil {
+			body = body[:def[0]]
+		}
+
+		plugin := Plugin{}
+		if loc[2] >= 0 {
+			plugin.Name = src[loc[2]:loc[3]]
+		}
+		// The fields inside the matches array (name: "...") aren't fields
+		// of the plugin
+		p := &rubyParser{s: body}
+		var fieldErr error
+		for _, field := range fieldRe.FindAllStringSubmatchIndex(body, -1) {
+			if field[0] < p.i {
+				continue
+			}
+			p.i = field[1]
+			value, err := p.value()
+			if err != nil {
+				fieldErr = fmt.Errorf("field %s: %v", body[field[2]:field[3]], err)
+				break
+			}
+			s, _ := value.(string)
+			switch body[field[2]:field[3]] {
+			case "name":
+				if s != "" {
+					plugin.Name = s
+				}
+			case "description":
+				plugin.Description = strings.TrimSpace(s)
+			case "website":
+				plugin.Website = s
+			case "matches":
+				items, _ := value.([]any)
+				for _, item := range items {
+					if h, ok := item.(map[string]any); ok {
+						plugin.Matches = append(plugin.Matches, newMatch(h))
+					}
+				}
+			}
+		}
+		if fieldErr != nil {
+			entry := "plugin " + plugin.Name
+			if plugin.Name == "" {
+				entry = fmt.Sprintf("plugin at line %d", strings.Count(src[:loc[0]], "\n")+1)
+			}
+			if err := opts.Skip(entry, fieldErr); err != nil {
+				return nil, fmt.Errorf("%s: %v", entry, err)
+			}
+			continue
+		}
+		if plugin.Name != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return plugins, nil
+}
+
+// newMatch reads a match from its hash, the values of unexpected types
+// are left empty
+func newMatch(h map[string]any) Match {
+	str := func(key string) string {
+		s, _ := h[key].(string)
+		return s
+	}
+	num := func(key string) int {
+		n, _ := h[key].(int)
+		return n
+	}
+	m := Match{
+		Name:       str("name"),
+		Search:     str("search"),
+		URL:        str("url"),
+		Text:       str("text"),
+		Offset:     num("offset"),
+		MD5:        str("md5"),
+		TagPattern: str("tagpattern"),
+		Status:     num("status"),
+		Certainty:  num("certainty"),
+	}
+	m.Regexp, _ = h["regexp"].(*Regexp)
+	switch v := h["version"].(type) {
+	case *Regexp, string:
+		m.Version = v
+	}
+	return m
+}
+
+// ReadDir merges the plugin files in dir and its subdirectories (e.g. the
+// plugins directory of WhatWeb) into a single stream
+func ReadDir(dir string) ([]byte, error) {
+	var stream bytes.Buffer
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".rb" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		stream.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			stream.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stream.Len() == 0 {
+		return nil, fmt.Errorf("no plugins found in %s", dir)
+	}
+	return stream.Bytes(), nil
+}
@@ -0,0 +1,341 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package whatweb converts the WhatWeb plugins into CROWler detection
+// rules. The literal matches arrays of the plugin files are parsed (the
+// Ruby code isn't run): their texts and regexps become header, page
+// content and URL signatures, the version regexps version patterns and
+// the favicon MD5 hashes favicon signatures.
+package whatweb
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "WhatWeb plugins"
+	// DefaultSourceLicense is the license of WhatWeb
+	DefaultSourceLicense = "GPL-2.0-only"
+)
+
+var (
+	// headerSearchRe matches the search of a single header
+	// (headers[x-powered-by])
+	headerSearchRe = regexp.MustCompile(`^headers\[([^\]]+)\]$`)
+	// headerLineRe matches a regexp on the header lines naming the header
+	// (^Server: Apache)
+	headerLineRe = regexp.MustCompile(`^\^?([A-Za-z][A-Za-z0-9-]*):(?: |\\s\*|\\s\+|\\x20)?`)
+)
+
+// rubyRegexp converts a Ruby regexp to a Go one. It returns false if the
+// regexp uses extended mode or a construct Go doesn't support
+// (lookarounds, atomic groups, backreferences...).
+func rubyRegexp(re *Regexp) (string, bool) {
+	if strings.Contains(re.Flags, "x") {
+		return "", false
+	}
+	var b strings.Builder
+	for i := 0; i < len(re.Source); i++ {
+		c := re.Source[i]
+		if c != '\\' || i+1 == len(re.Source) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch e := re.Source[i]; e {
+		case 'h':
+			b.WriteString(`[0-9A-Fa-f]`)
+		case 'H':
+			b.WriteString(`[^0-9A-Fa-f]`)
+		case 'Z':
+			b.WriteString(`\n?\z`)
+		case ';', '/', '"', '\'':
+			// Useless escapes, \; would also be taken for a pattern tag
+			b.WriteByte(e)
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(e)
+		}
+	}
+
+	flags := ""
+	if strings.Contains(re.Flags, "i") {
+		flags += "i"
+	}
+	// The Ruby multiline mode is the Go s flag
+	if strings.Contains(re.Flags, "m") {
+		flags += "s"
+	}
+	pattern := b.String()
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	pattern, err := normalize.Translate(pattern)
+	if err != nil {
+		return "", false
+	}
+	return pattern, true
+}
+
+// tagged appends the certainty and the version of a match to a pattern as
+// the Wappalyzer pattern tags, which are moved out of the patterns once
+// the rule is complete
+func tagged(pattern string, m Match, version string) string {
+	if m.Certainty > 0 && m.Certainty < 100 {
+		pattern += fmt.Sprintf(`\;confidence:%d`, m.Certainty)
+	}
+	if version != "" {
+		pattern += `\;version:` + version
+	}
+	return pattern
+}
+
+// appendHeader adds a pattern to the header field key, creating it if
+// needed
+func appendHeader(rule *crowler.DetectionRule, key, pattern string) {
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if strings.EqualFold(h.Key, key) {
+			h.Value = append(h.Value, pattern)
+			return
+		}
+	}
+	rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, crowler.HTTPHeaderField{
+		Key:        key,
+		Value:      []string{pattern},
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addURL adds the page a match is on as a URL signature, but the home page
+// and the favicon
+func addURL(rule *crowler.DetectionRule, m Match) {
+	if m.URL == "" || m.URL == "/" || m.URL == "/favicon.ico" {
+		return
+	}
+	pattern := tagged(regexp.QuoteMeta(m.URL), m, "")
+	for _, u := range rule.URLPatterns {
+		if u.Signature == pattern {
+			return
+		}
+	}
+	rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+		Signature:  pattern,
+		Confidence: crowler.DefaultConfidence,
+	})
+}
+
+// addMatch adds the signatures of a match to rule. It returns false if the
+// match can't be expressed as CROWler signatures: tag patterns, status
+// codes without a page, regexps Go can't compile...
+func addMatch(rule *crowler.DetectionRule, m Match) bool {
+	// The pattern of the match, with its version
+	pattern, version := "", ""
+	switch v := m.Version.(type) {
+	case *Regexp:
+		p, ok := rubyRegexp(v)
+		if !ok {
+			return false
+		}
+		pattern, version = p, fmt.Sprintf(`\%d`, m.Offset+1)
+	case string:
+		version = v
+	}
+	switch {
+	case pattern != "":
+	case m.Regexp != nil:
+		p, ok := rubyRegexp(m.Regexp)
+		if !ok {
+			return false
+		}
+		pattern = p
+	case m.Text != "":
+		pattern = regexp.QuoteMeta(m.Text)
+	case m.MD5 != "":
+		// Only the favicon hashes have a CROWler signature
+		if !strings.HasSuffix(m.URL, ".ico") {
+			return false
+		}
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			MD5Hash:    []string{strings.ToLower(m.MD5)},
+			Confidence: crowler.DefaultConfidence,
+		})
+		return true
+	case m.Status == 200 && m.URL != "" && m.URL != "/":
+		// The page exists
+		addURL(rule, m)
+		return true
+	default:
+		return false
+	}
+
+	search := strings.ToLower(m.Search)
+	switch {
+	case search == "" || search == "body" || search == "all":
+		rule.PageContentPatterns = append(rule.PageContentPatterns, crowler.PageContentSignature{
+			Key:        "body",
+			Signature:  []string{tagged(pattern, m, version)},
+			Confidence: crowler.DefaultConfidence,
+		})
+	case headerSearchRe.MatchString(search):
+		key := headerSearchRe.FindStringSubmatch(search)[1]
+		appendHeader(rule, key, tagged(pattern, m, version))
+	case search == "headers":
+		// The header lines, only the patterns naming the header can be
+		// converted
+		flags := ""
+		if strings.HasPrefix(pattern, "(?") {
+			end := strings.IndexByte(pattern, ')')
+			flags, pattern = pattern[:end+1], pattern[end+1:]
+		}
+		loc := headerLineRe.FindStringSubmatchIndex(pattern)
+		if loc == nil || loc[1] == len(pattern) {
+			return false
+		}
+		key := pattern[loc[2]:loc[3]]
+		appendHeader(rule, key, tagged(flags+pattern[loc[1]:], m, version))
+	case strings.HasPrefix(search, "uri"):
+		rule.URLPatterns = append(rule.URLPatterns, crowler.URLMicroSignature{
+			Signature:  tagged(pattern, m, version),
+			Confidence: crowler.DefaultConfidence,
+		})
+		return true
+	default:
+		return false
+	}
+	addURL(rule, m)
+	return true
+}
+
+// convertPlugin converts the matches of a plugin into a rule. It returns
+// false if none of them could be converted.
+func convertPlugin(plugin Plugin) (crowler.DetectionRule, bool) {
+	rule := crowler.DetectionRule{
+		RuleName:   "detect_" + slug.Make(plugin.Name),
+		ObjectName: plugin.Name,
+	}
+	if plugin.Description != "" || plugin.Website != "" {
+		rule.Metadata = &crowler.RuleMetadata{
+			Description: plugin.Description,
+			Website:     plugin.Website,
+		}
+	}
+	converted := false
+	for _, m := range plugin.Matches {
+		if addMatch(&rule, m) {
+			converted = true
+		}
+	}
+	return rule, converted
+}
+
+// Convert converts the WhatWeb plugins read from r, a plugin file or the
+// plugin files of a directory, into a ruleset
+func Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	plugins, err := ParsePlugins(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing plugins: %v", err)
+	}
+
+	ruleset := crowler.NewRuleset("detect_whatweb_technologies", "Ruleset to detect technologies with the WhatWeb plugins.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-whatweb-technologies-ruleset.yaml"
+	ruleset.RuleGroups = []crowler.RuleGroup{
+		{
+			GroupName:      "detect_whatweb_technologies",
+			IsEnabled:      true,
+			DetectionRules: []crowler.DetectionRule{},
+		},
+	}
+
+	// Convert the plugins with the workers, then name the rules in the
+	// order of the plugins
+	rules := converter.Map(opts.Workers, plugins, func(plugin Plugin) *crowler.DetectionRule {
+		defer opts.Processed(1)
+		rule, ok := convertPlugin(plugin)
+		if !ok {
+			return nil
+		}
+		opts.PrepareRule(&rule)
+		// Move the certainties and the versions out of the patterns
+		patterntag.StripRule(&rule)
+		if opts.Normalize {
+			crowler.DedupeSignatures(&rule)
+		}
+		return &rule
+	})
+
+	ruleNames := slug.NewNamer()
+	converted := 0
+	for _, rule := range rules {
+		if rule == nil {
+			continue
+		}
+		converted++
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		ruleset.RuleGroups[0].DetectionRules = append(ruleset.RuleGroups[0].DetectionRules, *rule)
+	}
+
+	if converted < len(plugins) {
+		slog.Info("Some plugins only have matches the CROWler rules can't express",
+			"converted", converted, "total", len(plugins))
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(whatwebConverter{})
+}
+
+// whatwebConverter is the registered WhatWeb converter
+type whatwebConverter struct{}
+
+func (whatwebConverter) Name() string { return "whatweb" }
+
+func (whatwebConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert WhatWeb plugins",
+		Input:          "Path to a WhatWeb plugin, or to a directory of plugins",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a WhatWeb plugin file
+func (whatwebConverter) Detect(input []byte) bool {
+	return defineRe.Match(input)
+}
+
+func (whatwebConverter) ReadDir(dir string) ([]byte, error) {
+	return ReadDir(dir)
+}
+
+func (whatwebConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, opts)
+}
@@ -0,0 +1,272 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wpscan converts lists of WordPress plugins and themes, the
+// WPScan metadata.json or a list of wp-content paths, into a WordPress
+// ecosystem ruleset. The rules detect a plugin or a theme from its
+// wp-content path, its readme.txt and, for the themes, the header of its
+// stylesheet, and all imply WordPress.
+package wpscan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+const (
+	// SourceName identifies the source in the generated rulesets
+	SourceName = "WordPress plugins and themes"
+	// DefaultSourceLicense is used when the license of the list isn't
+	// given, WPScan and the path lists come with different licenses
+	DefaultSourceLicense = "NOASSERTION"
+	// WordPress is the object all the rules imply
+	WordPress = "WordPress"
+)
+
+// Kinds of extensions, as in their wp-content path
+const (
+	Plugins = "plugins"
+	Themes  = "themes"
+)
+
+// Extension is a WordPress plugin or theme
+type Extension struct {
+	// Kind is Plugins or Themes
+	Kind          string
+	Slug          string
+	LatestVersion string
+	Popular       bool
+}
+
+// metadataEntry is an extension of the WPScan metadata.json
+type metadataEntry struct {
+	LatestVersion string `json:"latest_version"`
+	Popular       bool   `json:"popular"`
+}
+
+// pathRe matches a wp-content path of a list (wp-content/plugins/akismet/)
+var pathRe = regexp.MustCompile(`wp-content/(plugins|themes)/([A-Za-z0-9._-]+)`)
+
+// Parse reads the extensions of a WPScan metadata.json (the plugins and
+// themes objects) or of a list of wp-content paths, sorted by kind and
+// slug
+func Parse(r io.Reader) ([]Extension, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var extensions []Extension
+	add := func(e Extension) {
+		if key := e.Kind + "/" + e.Slug; !seen[key] {
+			seen[key] = true
+			extensions = append(extensions, e)
+		}
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var doc struct {
+			Plugins map[string]metadataEntry `json:"plugins"`
+			Themes  map[string]metadataEntry `json:"themes"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("error unmarshalling JSON: %v", err)
+		}
+		for kind, entries := range map[string]map[string]metadataEntry{Plugins: doc.Plugins, Themes: doc.Themes} {
+			for s, entry := range entries {
+				add(Extension{Kind: kind, Slug: s, LatestVersion: entry.LatestVersion, Popular: entry.Popular})
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if m := pathRe.FindStringSubmatch(scanner.Text()); m != nil {
+				add(Extension{Kind: m[1], Slug: m[2]})
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(extensions, func(i, j int) bool {
+		if extensions[i].Kind != extensions[j].Kind {
+			return extensions[i].Kind < extensions[j].Kind
+		}
+		return extensions[i].Slug < extensions[j].Slug
+	})
+	return extensions, nil
+}
+
+// createRule creates the rule of an extension: its wp-content directory
+// and readme.txt in the URLs, the scripts and stylesheets loaded from its
+// directory (the ver parameter WordPress adds to them is the version) and,
+// for the themes, the Text Domain of the stylesheet header
+func createRule(e Extension) crowler.DetectionRule {
+	kind := strings.TrimSuffix(e.Kind, "s")
+	dir := regexp.QuoteMeta("/wp-content/" + e.Kind + "/" + e.Slug + "/")
+	rule := crowler.DetectionRule{
+		RuleName:   fmt.Sprintf("detect_wordpress_%s_%s", kind, slug.Make(e.Slug)),
+		ObjectName: e.Slug,
+		Implies:    []string{WordPress},
+		Metadata: &crowler.RuleMetadata{
+			Website:       fmt.Sprintf("https://wordpress.org/%s/%s/", e.Kind, e.Slug),
+			LatestVersion: e.LatestVersion,
+		},
+		URLPatterns: []crowler.URLMicroSignature{
+			{Signature: dir, Confidence: crowler.DefaultConfidence},
+			{Signature: dir + `readme\.txt`, Confidence: crowler.DefaultConfidence},
+		},
+	}
+
+	// The ver parameter of the script and stylesheet URLs
+	versioned := dir + `.*[?&]ver=([\d.]+)`
+	rule.PageContentPatterns = []crowler.PageContentSignature{
+		{Key: "script", Attribute: "src", Signature: []string{dir}, Confidence: crowler.DefaultConfidence},
+		{Key: "link", Attribute: "href", Signature: []string{dir}, Confidence: crowler.DefaultConfidence},
+	}
+	rule.Version = []crowler.VersionSignature{
+		{Section: "page_content_patterns", Key: "script", Pattern: versioned, Version: `\1`},
+		{Section: "page_content_patterns", Key: "link", Pattern: versioned, Version: `\1`},
+	}
+
+	// The header of the theme stylesheet names its text domain, usually
+	// the slug
+	if e.Kind == Themes {
+		rule.CSSPatterns = []crowler.CSSSignature{
+			{Value: []string{`Text Domain:\s*` + regexp.QuoteMeta(e.Slug) + `\s`}, Confidence: crowler.DefaultConfidence},
+		}
+	}
+	return rule
+}
+
+// Options holds the settings applied to the generated rulesets
+type Options struct {
+	converter.Options
+	// PopularOnly only converts the extensions WPScan flags as popular
+	PopularOnly bool
+}
+
+// Convert converts a list of WordPress extensions into a ruleset with a
+// group for the plugins and one for the themes
+func Convert(r io.Reader, opts Options) ([]crowler.Ruleset, error) {
+	extensions, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleset := crowler.NewRuleset("detect_wordpress_ecosystem", "Ruleset to detect WordPress plugins and themes.")
+	ruleset.Source = SourceName
+	ruleset.SourceLicense = opts.License(DefaultSourceLicense)
+	ruleset.FileName = "detect-wordpress-ecosystem-ruleset.yaml"
+	groups := make(map[string]int)
+	for _, kind := range []string{Plugins, Themes} {
+		groups[kind] = len(ruleset.RuleGroups)
+		ruleset.RuleGroups = append(ruleset.RuleGroups, crowler.RuleGroup{
+			GroupName:      "detect_wordpress_" + kind,
+			IsEnabled:      true,
+			Tags:           opts.Taxonomy.Tags("wordpress_" + kind),
+			DetectionRules: []crowler.DetectionRule{},
+		})
+	}
+
+	ruleNames := slug.NewNamer()
+	for _, e := range extensions {
+		if opts.PopularOnly && !e.Popular {
+			continue
+		}
+		group := &ruleset.RuleGroups[groups[e.Kind]]
+		rule := createRule(e)
+		rule.RuleName = ruleNames.Unique(rule.RuleName)
+		opts.PrepareRule(&rule)
+		rule.Tags = group.Tags
+		group.DetectionRules = append(group.DetectionRules, rule)
+	}
+
+	crowler.ApplyNamespace(&ruleset, opts.Namespace)
+
+	return []crowler.Ruleset{ruleset}, nil
+}
+
+func init() {
+	converter.Register(&wpscanConverter{})
+}
+
+// wpscanConverter is the registered WordPress extensions converter
+type wpscanConverter struct {
+	popularOnly bool
+}
+
+func (*wpscanConverter) Name() string { return "wpscan" }
+
+func (*wpscanConverter) Info() converter.Info {
+	return converter.Info{
+		Summary:        "Convert a list of WordPress plugins and themes (WPScan metadata.json, wp-content paths)",
+		Input:          "Path to the WPScan metadata.json or to a list of wp-content paths",
+		Source:         SourceName,
+		DefaultLicense: DefaultSourceLicense,
+	}
+}
+
+// Detect recognizes a WPScan metadata.json, whose plugins or themes have
+// a latest_version, or a list whose first entry is a wp-content path
+func (*wpscanConverter) Detect(input []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(input), []byte("{")) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(input, &doc); err != nil {
+			return false
+		}
+		for _, kind := range []string{Plugins, Themes} {
+			var extensions map[string]map[string]json.RawMessage
+			if json.Unmarshal(doc[kind], &extensions) != nil {
+				continue
+			}
+			for _, e := range extensions {
+				if _, ok := e["latest_version"]; ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return pathRe.MatchString(line)
+	}
+	return false
+}
+
+func (c *wpscanConverter) SetFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&c.popularOnly, "popular", false, "Only convert the plugins and themes WPScan flags as popular")
+}
+
+func (c *wpscanConverter) Convert(r io.Reader, opts converter.Options) ([]crowler.Ruleset, error) {
+	return Convert(r, Options{Options: opts, PopularOnly: c.popularOnly})
+}
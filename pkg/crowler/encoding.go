@@ -0,0 +1,94 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Marshal returns the YAML encoding of a ruleset, indented as the
+// CROWler rulesets
+func Marshal(ruleset Ruleset) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&ruleset); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON returns the indented JSON encoding of a ruleset. The <, >
+// and & of the patterns are not escaped.
+func MarshalJSON(ruleset Ruleset) ([]byte, error) {
+	return marshalJSON(ruleset, "  ")
+}
+
+// MarshalJSONLine returns the JSON encoding of a ruleset on a single
+// line, ending with a newline
+func MarshalJSONLine(ruleset Ruleset) ([]byte, error) {
+	return marshalJSON(ruleset, "")
+}
+
+func marshalJSON(ruleset Ruleset, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+	if err := encoder.Encode(ruleset); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a YAML (or JSON, which YAML includes) ruleset
+func Unmarshal(data []byte) (Ruleset, error) {
+	var ruleset Ruleset
+	if err := yaml.Unmarshal(data, &ruleset); err != nil {
+		return Ruleset{}, err
+	}
+	return ruleset, nil
+}
+
+// ReadFile reads a ruleset file, FileName is set to path
+func ReadFile(path string) (Ruleset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ruleset{}, err
+	}
+	ruleset, err := Unmarshal(data)
+	if err != nil {
+		return Ruleset{}, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	ruleset.FileName = path
+	return ruleset, nil
+}
+
+// WriteFile writes a ruleset to path in YAML
+func WriteFile(path string, ruleset Ruleset) error {
+	data, err := Marshal(ruleset)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
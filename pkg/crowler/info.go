@@ -0,0 +1,97 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// formatVersionRe matches the valid format versions, e.g. 1.0.5
+var formatVersionRe = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// RulesetInfo holds the descriptive fields set on the generated
+// rulesets. The empty fields keep the values of the converter.
+type RulesetInfo struct {
+	Author        string
+	Description   string
+	FormatVersion string
+	// License is the license the generated rulesets are distributed
+	// under, as opposed to the license of their source
+	License string
+	// NamePrefix is prepended as is to the ruleset names
+	NamePrefix string
+	// CreatedAt replaces the creation time of the rulesets, so that
+	// converting the same source twice gives the same files. It's an
+	// RFC 3339 time or a YYYY-MM-DD date.
+	CreatedAt string
+}
+
+// Validate checks the format version, the creation time and the name
+// prefix
+func (info RulesetInfo) Validate() error {
+	if info.FormatVersion != "" && !formatVersionRe.MatchString(info.FormatVersion) {
+		return fmt.Errorf("invalid format version %q, expected MAJOR.MINOR.PATCH", info.FormatVersion)
+	}
+	if info.CreatedAt != "" && info.createdAt().IsZero() {
+		return fmt.Errorf("invalid creation time %q, expected an RFC 3339 time or a YYYY-MM-DD date", info.CreatedAt)
+	}
+	if !ValidNamespace(info.NamePrefix) {
+		return fmt.Errorf("invalid ruleset name prefix %q, only letters, digits, '-' and '_' are allowed", info.NamePrefix)
+	}
+	return nil
+}
+
+// Apply sets the info on ruleset. The default author and format version
+// don't replace the ones of the rulesets written by a plugin.
+func (info RulesetInfo) Apply(ruleset *Ruleset) {
+	if info.Author != "" && info.Author != DefaultAuthor {
+		ruleset.Author = info.Author
+	}
+	if info.Description != "" {
+		ruleset.Description = info.Description
+	}
+	if info.FormatVersion != "" && info.FormatVersion != FormatVersion {
+		ruleset.FormatVersion = info.FormatVersion
+	}
+	if info.License != "" {
+		ruleset.License = info.License
+	}
+	if info.CreatedAt != "" {
+		ruleset.CreatedAt = info.Timestamp()
+	}
+	ruleset.RulesetName = info.NamePrefix + ruleset.RulesetName
+}
+
+// Timestamp returns the creation time of the rulesets in RFC 3339 format:
+// CreatedAt if it's set, otherwise the current time
+func (info RulesetInfo) Timestamp() string {
+	if t := info.createdAt(); !t.IsZero() {
+		return t.Format(time.RFC3339)
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+// createdAt parses CreatedAt, returning the zero time if it's empty or
+// invalid
+func (info RulesetInfo) createdAt() time.Time {
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, info.CreatedAt); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,245 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"slices"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+)
+
+// NormalizeRule canonicalizes the header keys, the meta tag names, the
+// patterns and the hashes of a rule, and removes its duplicate signatures
+func NormalizeRule(rule *DetectionRule) {
+	for i := range rule.HTTPHeaderFields {
+		rule.HTTPHeaderFields[i].Key = normalize.HeaderKey(rule.HTTPHeaderFields[i].Key)
+		rule.HTTPHeaderFields[i].Value = normalize.Patterns(rule.HTTPHeaderFields[i].Value)
+	}
+	// The cookie names are case sensitive, they keep their case
+	for i := range rule.Cookies {
+		rule.Cookies[i].Name = strings.TrimSpace(rule.Cookies[i].Name)
+		rule.Cookies[i].Value = normalize.Patterns(rule.Cookies[i].Value)
+	}
+	// The meta tag names are case insensitive, the spellings of a name
+	// (generator and Generator) are merged
+	for i := range rule.MetaTags {
+		m := &rule.MetaTags[i]
+		m.Name = strings.ToLower(strings.TrimSpace(m.Name))
+		if m.Attribute = strings.ToLower(strings.TrimSpace(m.Attribute)); m.Attribute == MetaName {
+			m.Attribute = ""
+		}
+	}
+	rule.MetaTags = mergeMetaTags(rule.MetaTags)
+	for i := range rule.MetaTags {
+		normalizeMetaTag(&rule.MetaTags[i])
+	}
+	for i := range rule.PageContentPatterns {
+		p := &rule.PageContentPatterns[i]
+		p.Signature = normalize.Patterns(p.Signature)
+		p.Text = normalize.Patterns(p.Text)
+		// hashes are hex strings, canonical form is lowercase
+		lowerAll(p.MD5Hash)
+		lowerAll(p.SHA256Hash)
+	}
+	for i := range rule.SSLSignatures {
+		rule.SSLSignatures[i].Value = normalize.Patterns(rule.SSLSignatures[i].Value)
+	}
+	for i := range rule.DNSSignatures {
+		rule.DNSSignatures[i].Key = strings.ToUpper(strings.TrimSpace(rule.DNSSignatures[i].Key))
+		rule.DNSSignatures[i].Value = normalize.Patterns(rule.DNSSignatures[i].Value)
+	}
+	for i := range rule.URLPatterns {
+		rule.URLPatterns[i].Signature = normalize.Pattern(rule.URLPatterns[i].Signature)
+	}
+	for i := range rule.JSPatterns {
+		rule.JSPatterns[i].Value = normalize.Patterns(rule.JSPatterns[i].Value)
+	}
+	for i := range rule.CSSPatterns {
+		rule.CSSPatterns[i].Value = normalize.Patterns(rule.CSSPatterns[i].Value)
+	}
+	for i := range rule.NetworkPatterns {
+		rule.NetworkPatterns[i].Value = normalize.Patterns(rule.NetworkPatterns[i].Value)
+	}
+	for i := range rule.Version {
+		rule.Version[i].Pattern = normalize.Pattern(rule.Version[i].Pattern)
+		switch rule.Version[i].Section {
+		case "http_header_fields":
+			rule.Version[i].Key = normalize.HeaderKey(rule.Version[i].Key)
+		case "meta_tags":
+			rule.Version[i].Key = strings.ToLower(strings.TrimSpace(rule.Version[i].Key))
+		}
+	}
+	dedupeSignatures(rule)
+}
+
+// DedupeSignatures removes the duplicate signatures of a rule, and the
+// duplicate content patterns of its meta tags, as NormalizeRule does. The
+// converters call it again after removing the Wappalyzer tags from the
+// patterns (see patterntag.StripRule), since the signatures differing
+// only by their tags become duplicates.
+func DedupeSignatures(rule *DetectionRule) {
+	for i := range rule.MetaTags {
+		normalizeMetaTag(&rule.MetaTags[i])
+	}
+	dedupeSignatures(rule)
+}
+
+// signatureKey identifies a signature by its key and patterns
+func signatureKey(parts ...[]string) string {
+	lists := make([]string, len(parts))
+	for i, part := range parts {
+		lists[i] = strings.Join(part, "\x00")
+	}
+	return strings.Join(lists, "\x01")
+}
+
+// dedupeSignatures removes the header fields, cookies, URL signatures and
+// page content patterns identical to a previous one of the rule. The one kept
+// gets the highest confidence of its duplicates.
+func dedupeSignatures(rule *DetectionRule) {
+	if rule.HTTPHeaderFields != nil {
+		seen := make(map[string]int)
+		headers := rule.HTTPHeaderFields[:0]
+		for _, h := range rule.HTTPHeaderFields {
+			key := signatureKey([]string{h.Key}, h.Value)
+			if j, ok := seen[key]; ok {
+				headers[j].Confidence = max(headers[j].Confidence, h.Confidence)
+				continue
+			}
+			seen[key] = len(headers)
+			headers = append(headers, h)
+		}
+		rule.HTTPHeaderFields = headers
+	}
+
+	if rule.Cookies != nil {
+		seen := make(map[string]int)
+		cookies := rule.Cookies[:0]
+		for _, c := range rule.Cookies {
+			key := signatureKey([]string{c.Name}, c.Value)
+			if j, ok := seen[key]; ok {
+				cookies[j].Confidence = max(cookies[j].Confidence, c.Confidence)
+				continue
+			}
+			seen[key] = len(cookies)
+			cookies = append(cookies, c)
+		}
+		rule.Cookies = cookies
+	}
+
+	if rule.URLPatterns != nil {
+		seen := make(map[string]int)
+		urls := rule.URLPatterns[:0]
+		for _, u := range rule.URLPatterns {
+			if j, ok := seen[u.Signature]; ok {
+				urls[j].Confidence = max(urls[j].Confidence, u.Confidence)
+				continue
+			}
+			seen[u.Signature] = len(urls)
+			urls = append(urls, u)
+		}
+		rule.URLPatterns = urls
+	}
+
+	if rule.PageContentPatterns != nil {
+		seen := make(map[string]int)
+		patterns := rule.PageContentPatterns[:0]
+		for _, p := range rule.PageContentPatterns {
+			key := signatureKey([]string{p.Key, p.Attribute}, p.Signature, p.Text, p.MD5Hash, p.SHA256Hash, p.MMH3Hash)
+			if j, ok := seen[key]; ok {
+				patterns[j].Confidence = max(patterns[j].Confidence, p.Confidence)
+				continue
+			}
+			seen[key] = len(patterns)
+			patterns = append(patterns, p)
+		}
+		rule.PageContentPatterns = patterns
+	}
+}
+
+// mergeMetaTags merges the meta tags of the same attribute and name in
+// the first one, keeping the confidence of each of their patterns
+func mergeMetaTags(tags []MetaTag) []MetaTag {
+	if tags == nil {
+		return nil
+	}
+	seen := make(map[string]int)
+	merged := tags[:0]
+	for _, m := range tags {
+		key := m.Attribute + "\x00" + m.Name
+		j, ok := seen[key]
+		if !ok {
+			seen[key] = len(merged)
+			merged = append(merged, m)
+			continue
+		}
+		first := &merged[j]
+		if first.Confidence == m.Confidence && first.ContentConfidence == nil && m.ContentConfidence == nil {
+			first.Content = append(slices.Clip(first.Content), m.Content...)
+			continue
+		}
+		confidences := append(contentConfidence(*first), contentConfidence(m)...)
+		first.Content = append(slices.Clip(first.Content), m.Content...)
+		first.Confidence = max(first.Confidence, m.Confidence)
+		first.ContentConfidence = confidences
+	}
+	return merged
+}
+
+// contentConfidence returns the confidence of each content pattern of m
+func contentConfidence(m MetaTag) []int {
+	if len(m.ContentConfidence) == len(m.Content) {
+		return slices.Clone(m.ContentConfidence)
+	}
+	confidences := make([]int, len(m.Content))
+	for i := range confidences {
+		confidences[i] = m.Confidence
+	}
+	return confidences
+}
+
+// normalizeMetaTag normalizes the content patterns of a meta tag, keeping
+// the highest confidence of the patterns that normalize to the same one
+func normalizeMetaTag(m *MetaTag) {
+	if len(m.ContentConfidence) != len(m.Content) {
+		m.Content = normalize.Patterns(m.Content)
+		return
+	}
+	content := make([]string, 0, len(m.Content))
+	confidence := make([]int, 0, len(m.Content))
+	seen := make(map[string]int)
+	for i, p := range m.Content {
+		p = normalize.Pattern(p)
+		if j, ok := seen[p]; ok {
+			confidence[j] = max(confidence[j], m.ContentConfidence[i])
+			continue
+		}
+		seen[p] = len(content)
+		content = append(content, p)
+		confidence = append(confidence, m.ContentConfidence[i])
+	}
+	m.Content = content
+	m.ContentConfidence = confidence
+	if len(confidence) > 0 && slices.Min(confidence) == slices.Max(confidence) {
+		m.ContentConfidence = nil
+	}
+}
+
+func lowerAll(values []string) {
+	for i, v := range values {
+		values[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+}
@@ -0,0 +1,550 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crowler defines the CROWler ruleset format shared by all the
+// converters.
+package crowler
+
+import (
+	"math"
+	"regexp"
+	"time"
+)
+
+const (
+	// FormatVersion is the version of the ruleset format generated
+	FormatVersion = "1.0.5"
+	// DefaultAuthor is the author of the generated rulesets
+	DefaultAuthor = "Your Name"
+	// DefaultConfidence is the confidence of the generated signatures
+	DefaultConfidence = 10
+	// MaxConfidence is the confidence of a certain match
+	MaxConfidence = 10
+)
+
+// Define the structure for the CROWler ruleset
+type Ruleset struct {
+	RulesetName   string `json:"ruleset_name" yaml:"ruleset_name"`
+	FormatVersion string `json:"format_version" yaml:"format_version"`
+	Author        string `json:"author" yaml:"author"`
+	CreatedAt     string `json:"created_at" yaml:"created_at"`
+	Description   string `json:"description" yaml:"description"`
+	Source        string `json:"source,omitempty" yaml:"source,omitempty"`
+	SourceLicense string `json:"source_license,omitempty" yaml:"source_license,omitempty"`
+	// License is the license of the ruleset itself, SourceLicense the
+	// one of the rules it was converted from
+	License string `json:"license,omitempty" yaml:"license,omitempty"`
+	// Metadata describes the feed the rules come from, for the rulesets
+	// built from a feed
+	Metadata   *RulesetMetadata `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	RuleGroups []RuleGroup      `json:"rule_groups" yaml:"rule_groups"`
+	// SecurityPolicy is the security.txt of the host the crawling rules
+	// of the ruleset are for, if it has one
+	SecurityPolicy *SecurityPolicy `json:"security_policy,omitempty" yaml:"security_policy,omitempty"`
+
+	// FileName is the name of the file the converter suggests to write
+	// the ruleset to. It's not part of the ruleset.
+	FileName string `json:"-" yaml:"-"`
+}
+
+// RulesetMetadata describes the feed a ruleset was built from: its name
+// (e.g. URLhaus), its URL and when it was last updated (RFC3339)
+type RulesetMetadata struct {
+	Feed          string `json:"feed,omitempty" yaml:"feed,omitempty"`
+	FeedURL       string `json:"feed_url,omitempty" yaml:"feed_url,omitempty"`
+	FeedUpdatedAt string `json:"feed_updated_at,omitempty" yaml:"feed_updated_at,omitempty"`
+}
+
+// SecurityPolicy is the part of a security.txt (RFC 9116) recorded on
+// the rulesets: the contacts, the disclosure policies and when it expires
+type SecurityPolicy struct {
+	Contact []string `json:"contact,omitempty" yaml:"contact,omitempty"`
+	Policy  []string `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Expires string   `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+type RuleGroup struct {
+	GroupName      string          `json:"group_name" yaml:"group_name"`
+	ParentGroup    string          `json:"parent_group,omitempty" yaml:"parent_group,omitempty"`
+	IsEnabled      bool            `json:"is_enabled" yaml:"is_enabled"`
+	Tags           []string        `json:"tags,omitempty" yaml:"tags,omitempty"`
+	ActionRules    []ActionRule    `json:"action_rules,omitempty" yaml:"action_rules,omitempty"`
+	DetectionRules []DetectionRule `json:"detection_rules" yaml:"detection_rules"`
+	CrawlingRules  []CrawlingRule  `json:"crawling_rules,omitempty" yaml:"crawling_rules,omitempty"`
+	ScrapingRules  []ScrapingRule  `json:"scraping_rules,omitempty" yaml:"scraping_rules,omitempty"`
+
+	// Category is the category of the source the group holds the rules
+	// of, if any (e.g. CMS). It's not part of the ruleset.
+	Category string `json:"-" yaml:"-"`
+}
+
+// ActionRule describes an interaction the CROWler performs on a page
+// (navigate, fill a field, click, check the result)
+type ActionRule struct {
+	RuleName       string          `json:"rule_name" yaml:"rule_name"`
+	ActionType     string          `json:"action_type" yaml:"action_type"`
+	Selectors      []Selector      `json:"selectors,omitempty" yaml:"selectors,omitempty"`
+	Value          string          `json:"value,omitempty" yaml:"value,omitempty"`
+	URL            string          `json:"url,omitempty" yaml:"url,omitempty"`
+	WaitConditions []WaitCondition `json:"wait_conditions,omitempty" yaml:"wait_conditions,omitempty"`
+	ErrorHandling  *ErrorHandling  `json:"error_handling,omitempty" yaml:"error_handling,omitempty"`
+}
+
+// Selector identifies the page element an action applies to, or a value
+// a scraping rule extracts: the element text, or its Attribute
+type Selector struct {
+	SelectorType          string `json:"selector_type" yaml:"selector_type"`
+	Selector              string `json:"selector" yaml:"selector"`
+	Value                 string `json:"value,omitempty" yaml:"value,omitempty"`
+	Attribute             string `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	ExtractAllOccurrences bool   `json:"extract_all_occurrences,omitempty" yaml:"extract_all_occurrences,omitempty"`
+}
+
+// WaitCondition is a condition checked before (or after) an action,
+// use it to assert the page state
+type WaitCondition struct {
+	ConditionType string `json:"condition_type" yaml:"condition_type"`
+	Selector      string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Value         string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// ErrorHandling describes what to do when an action fails
+type ErrorHandling struct {
+	Ignore     bool `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	RetryCount int  `json:"retry_count,omitempty" yaml:"retry_count,omitempty"`
+	RetryDelay int  `json:"retry_delay,omitempty" yaml:"retry_delay,omitempty"`
+}
+
+// ActionTypes lists the action types the CROWler supports
+var ActionTypes = map[string]bool{
+	"navigate_to_url":    true,
+	"input_text":         true,
+	"click":              true,
+	"scroll":             true,
+	"wait":               true,
+	"execute_javascript": true,
+	"take_screenshot":    true,
+}
+
+// CrawlingRule tells the CROWler which URLs to crawl and how often: the
+// seed URLs to start from and, for a host, the paths it may crawl and how
+// fast. The paths are regexes on the URL path.
+type CrawlingRule struct {
+	RuleName        string    `json:"rule_name" yaml:"rule_name"`
+	RequestType     string    `json:"request_type" yaml:"request_type"`
+	UserAgent       string    `json:"user_agent,omitempty" yaml:"user_agent,omitempty"`
+	SeedURLs        []SeedURL `json:"seed_urls,omitempty" yaml:"seed_urls,omitempty"`
+	AllowedPaths    []string  `json:"allowed_paths,omitempty" yaml:"allowed_paths,omitempty"`
+	DisallowedPaths []string  `json:"disallowed_paths,omitempty" yaml:"disallowed_paths,omitempty"`
+	CrawlDelay      string    `json:"crawl_delay,omitempty" yaml:"crawl_delay,omitempty"`
+	Sitemaps        []string  `json:"sitemaps,omitempty" yaml:"sitemaps,omitempty"`
+}
+
+// SeedURL is a URL to crawl with its sitemap hints
+type SeedURL struct {
+	URL          string  `json:"url" yaml:"url"`
+	Priority     float32 `json:"priority" yaml:"priority"`
+	LastModified string  `json:"last_modified,omitempty" yaml:"last_modified,omitempty"`
+	RecrawlAfter string  `json:"recrawl_after,omitempty" yaml:"recrawl_after,omitempty"`
+}
+
+// ScrapingRule describes the elements the CROWler extracts from a page
+type ScrapingRule struct {
+	RuleName string    `json:"rule_name" yaml:"rule_name"`
+	Elements []Element `json:"elements" yaml:"elements"`
+}
+
+// Element is a single value to extract, with the selectors to try in
+// order
+type Element struct {
+	Key       string     `json:"key" yaml:"key"`
+	Selectors []Selector `json:"selectors" yaml:"selectors"`
+}
+
+type DetectionRule struct {
+	RuleName            string                 `json:"rule_name" yaml:"rule_name"`
+	ObjectName          string                 `json:"object_name" yaml:"object_name"`
+	CPE                 string                 `json:"cpe,omitempty" yaml:"cpe,omitempty"`
+	Metadata            *RuleMetadata          `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	ValidFrom           string                 `json:"valid_from,omitempty" yaml:"valid_from,omitempty"`
+	Expires             string                 `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Tags                []string               `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Implies             []string               `json:"implies,omitempty" yaml:"implies,omitempty"`
+	Requires            []string               `json:"requires,omitempty" yaml:"requires,omitempty"`
+	RequiresCategory    []string               `json:"requires_category,omitempty" yaml:"requires_category,omitempty"`
+	Excludes            []string               `json:"excludes,omitempty" yaml:"excludes,omitempty"`
+	HTTPHeaderFields    []HTTPHeaderField      `json:"http_header_fields,omitempty" yaml:"http_header_fields,omitempty"`
+	Cookies             []CookieSignature      `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+	MetaTags            []MetaTag              `json:"meta_tags,omitempty" yaml:"meta_tags,omitempty"`
+	PageContentPatterns []PageContentSignature `json:"page_content_patterns,omitempty" yaml:"page_content_patterns,omitempty"`
+	SSLSignatures       []SSLSignature         `json:"ssl_patterns,omitempty" yaml:"ssl_patterns,omitempty"`
+	DNSSignatures       []DNSSignature         `json:"dns_patterns,omitempty" yaml:"dns_patterns,omitempty"`
+	URLPatterns         []URLMicroSignature    `json:"url_micro_signatures,omitempty" yaml:"url_micro_signatures,omitempty"`
+	JSPatterns          []JSObjectSignature    `json:"js_patterns,omitempty" yaml:"js_patterns,omitempty"`
+	CSSPatterns         []CSSSignature         `json:"css_patterns,omitempty" yaml:"css_patterns,omitempty"`
+	NetworkPatterns     []NetworkSignature     `json:"network_patterns,omitempty" yaml:"network_patterns,omitempty"`
+	Version             []VersionSignature     `json:"version,omitempty" yaml:"version,omitempty"`
+	// Managed false marks a rule edited by hand: updating the rulesets
+	// (see KeepUnmanaged) keeps it instead of the generated one
+	Managed *bool `json:"managed,omitempty" yaml:"managed,omitempty"`
+}
+
+// IsManaged tells if the rule is managed by the converters, i.e. it's not
+// marked managed: false
+func (r DetectionRule) IsManaged() bool {
+	return r.Managed == nil || *r.Managed
+}
+
+// RuleMetadata describes the detected object, for the CROWler UI. It
+// doesn't take part in the detection.
+type RuleMetadata struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Website     string `json:"website,omitempty" yaml:"website,omitempty"`
+	// Icon is the file name of the icon of the object in the source
+	Icon string `json:"icon,omitempty" yaml:"icon,omitempty"`
+	// Pricing lists the pricing models, e.g. freemium, onetime, recurring
+	Pricing []string `json:"pricing,omitempty" yaml:"pricing,omitempty"`
+	SaaS    bool     `json:"saas,omitempty" yaml:"saas,omitempty"`
+	OSS     bool     `json:"oss,omitempty" yaml:"oss,omitempty"`
+	// Sources lists where the signatures of the rule come from, for the
+	// rulesets merging several sources
+	Sources []string `json:"sources,omitempty" yaml:"sources,omitempty"`
+	// LatestVersion is the latest known version of the object, the
+	// detected versions below it are outdated
+	LatestVersion string `json:"latest_version,omitempty" yaml:"latest_version,omitempty"`
+	// Severity, Tags, SourceVersion and ParanoiaLevel describe the source
+	// rule of the rules converted from a WAF rule set, e.g. CRITICAL,
+	// OWASP_CRS/WEB_ATTACK/XSS, OWASP_CRS/4.0.0 and 2
+	Severity      string   `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Tags          []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	SourceVersion string   `json:"source_version,omitempty" yaml:"source_version,omitempty"`
+	ParanoiaLevel int      `json:"paranoia_level,omitempty" yaml:"paranoia_level,omitempty"`
+	// ClassType is the class of the IDS rule a rule comes from, e.g.
+	// web-application-activity
+	ClassType string `json:"classtype,omitempty" yaml:"classtype,omitempty"`
+	// Vulnerabilities lists the known vulnerable versions of the object
+	Vulnerabilities []Vulnerability `json:"vulnerabilities,omitempty" yaml:"vulnerabilities,omitempty"`
+	// Implied lists the objects the detection of the object implies,
+	// directly (see DetectionRule.Implies) or through the objects they
+	// imply
+	Implied []ImpliedObject `json:"implied,omitempty" yaml:"implied,omitempty"`
+}
+
+// ImpliedObject is an object implied by the detection of another one
+type ImpliedObject struct {
+	Object string `json:"object" yaml:"object"`
+	// Confidence is the confidence of the implication, 0-100
+	Confidence int `json:"confidence" yaml:"confidence"`
+	// Version is the version of the implied object, if the source gives
+	// one
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Via lists the objects implying it, from the detected object on,
+	// for the indirect implications
+	Via []string `json:"via,omitempty" yaml:"via,omitempty"`
+}
+
+// Vulnerability is a vulnerability of the versions from AtOrAbove (if
+// set) to Below (excluded), with its CVE IDs
+type Vulnerability struct {
+	AtOrAbove  string   `json:"at_or_above,omitempty" yaml:"at_or_above,omitempty"`
+	Below      string   `json:"below,omitempty" yaml:"below,omitempty"`
+	Severity   string   `json:"severity,omitempty" yaml:"severity,omitempty"`
+	CVE        []string `json:"cve,omitempty" yaml:"cve,omitempty"`
+	CWE        []string `json:"cwe,omitempty" yaml:"cwe,omitempty"`
+	Summary    string   `json:"summary,omitempty" yaml:"summary,omitempty"`
+	References []string `json:"references,omitempty" yaml:"references,omitempty"`
+}
+
+type HTTPHeaderField struct {
+	Key        string   `json:"key" yaml:"key"`
+	Value      []string `json:"value" yaml:"value"`
+	Confidence int      `json:"confidence" yaml:"confidence"`
+}
+
+// CookieSignature matches the cookies the site sets (Set-Cookie) named
+// Name, and their value against the patterns of Value (an empty pattern
+// matches any value). Unlike the header names, the cookie names are case
+// sensitive.
+type CookieSignature struct {
+	Name       string   `json:"name" yaml:"name"`
+	Value      []string `json:"value" yaml:"value"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+type SSLSignature struct {
+	Key        string   `json:"key" yaml:"key"`
+	Value      []string `json:"value,omitempty" yaml:"value,omitempty"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+// DNSSignature matches the DNS records of a type (Key, e.g. MX or TXT) of
+// the site domain
+type DNSSignature struct {
+	Key        string   `json:"key" yaml:"key"`
+	Value      []string `json:"value" yaml:"value"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+// The attributes a meta tag is matched by
+const (
+	// MetaName matches <meta name="Name" content="...">, the default
+	MetaName = "name"
+	// MetaHTTPEquiv matches <meta http-equiv="Name" content="...">
+	MetaHTTPEquiv = "http-equiv"
+	// MetaCharset matches <meta charset="...">, the Content patterns
+	// matching the charset. Its Name is charset.
+	MetaCharset = "charset"
+)
+
+// MetaTag matches the content of the meta tags named Name by their
+// Attribute, MetaName when empty. The names are case insensitive.
+type MetaTag struct {
+	Name       string   `json:"name" yaml:"name"`
+	Attribute  string   `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	Content    []string `json:"content" yaml:"content"`
+	Confidence int      `json:"confidence" yaml:"confidence"`
+	// ContentConfidence is the confidence of each Content pattern, set
+	// only when the patterns don't all have the same confidence
+	ContentConfidence []int `json:"content_confidence,omitempty" yaml:"content_confidence,omitempty"`
+}
+
+type PageContentSignature struct {
+	Key        string   `json:"key" yaml:"key"`
+	Attribute  string   `json:"attribute,omitempty" yaml:"attribute,omitempty"`
+	Signature  []string `json:"value,omitempty" yaml:"value,omitempty"`
+	Text       []string `json:"text,omitempty" yaml:"text,omitempty"`
+	MD5Hash    []string `json:"md5hash,omitempty" yaml:"md5hash,omitempty"`
+	SHA256Hash []string `json:"sha256hash,omitempty" yaml:"sha256hash,omitempty"`
+	MMH3Hash   []string `json:"mmh3hash,omitempty" yaml:"mmh3hash,omitempty"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+type URLMicroSignature struct {
+	Signature  string  `json:"value" yaml:"value"`
+	Confidence float32 `json:"confidence" yaml:"confidence"`
+}
+
+// JSObjectSignature matches a global JavaScript object, given by its
+// path (e.g. jQuery.fn.jquery), and optionally its value
+type JSObjectSignature struct {
+	Name       string   `json:"name" yaml:"name"`
+	Value      []string `json:"value,omitempty" yaml:"value,omitempty"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+// CSSSignature matches the content of the stylesheets of the page
+type CSSSignature struct {
+	Value      []string `json:"value" yaml:"value"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+// NetworkSignature matches the requests the page makes at runtime. Key is
+// the kind of request (xhr for XHR and fetch calls) and Value the patterns
+// of the hostnames contacted.
+type NetworkSignature struct {
+	Key        string   `json:"key" yaml:"key"`
+	Value      []string `json:"value" yaml:"value"`
+	Confidence float32  `json:"confidence" yaml:"confidence"`
+}
+
+// VersionSignature tells how to get the version of the detected object:
+// Version is a template (e.g. \1) filled with the groups captured by
+// Pattern, one of the patterns of the Section (e.g. http_header_fields)
+// signature with the given Key
+type VersionSignature struct {
+	Section string `json:"section" yaml:"section"`
+	Key     string `json:"key,omitempty" yaml:"key,omitempty"`
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Version string `json:"version" yaml:"version"`
+}
+
+// NewRuleset returns an empty ruleset with the default format version
+// and author, created now
+func NewRuleset(name, description string) Ruleset {
+	return Ruleset{
+		RulesetName:   name,
+		FormatVersion: FormatVersion,
+		Author:        DefaultAuthor,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		Description:   description,
+		RuleGroups:    []RuleGroup{},
+	}
+}
+
+// SetConfidence sets the confidence of all the signatures of a rule
+func SetConfidence(rule *DetectionRule, confidence float32) {
+	for i := range rule.HTTPHeaderFields {
+		rule.HTTPHeaderFields[i].Confidence = roundConfidence(confidence)
+	}
+	for i := range rule.Cookies {
+		rule.Cookies[i].Confidence = confidence
+	}
+	for i := range rule.MetaTags {
+		rule.MetaTags[i].Confidence = roundConfidence(confidence)
+		rule.MetaTags[i].ContentConfidence = nil
+	}
+	for i := range rule.PageContentPatterns {
+		rule.PageContentPatterns[i].Confidence = confidence
+	}
+	for i := range rule.SSLSignatures {
+		rule.SSLSignatures[i].Confidence = confidence
+	}
+	for i := range rule.DNSSignatures {
+		rule.DNSSignatures[i].Confidence = confidence
+	}
+	for i := range rule.URLPatterns {
+		rule.URLPatterns[i].Confidence = confidence
+	}
+	for i := range rule.JSPatterns {
+		rule.JSPatterns[i].Confidence = confidence
+	}
+	for i := range rule.CSSPatterns {
+		rule.CSSPatterns[i].Confidence = confidence
+	}
+	for i := range rule.NetworkPatterns {
+		rule.NetworkPatterns[i].Confidence = confidence
+	}
+}
+
+// ScaleConfidence multiplies the confidence of all the signatures of a
+// rule by factor
+func ScaleConfidence(rule *DetectionRule, factor float32) {
+	for i := range rule.HTTPHeaderFields {
+		rule.HTTPHeaderFields[i].Confidence = roundConfidence(float32(rule.HTTPHeaderFields[i].Confidence) * factor)
+	}
+	for i := range rule.Cookies {
+		rule.Cookies[i].Confidence *= factor
+	}
+	for i := range rule.MetaTags {
+		m := &rule.MetaTags[i]
+		m.Confidence = roundConfidence(float32(m.Confidence) * factor)
+		if m.ContentConfidence != nil {
+			scaled := make([]int, len(m.ContentConfidence))
+			for j, c := range m.ContentConfidence {
+				scaled[j] = roundConfidence(float32(c) * factor)
+			}
+			m.ContentConfidence = scaled
+		}
+	}
+	for i := range rule.PageContentPatterns {
+		rule.PageContentPatterns[i].Confidence *= factor
+	}
+	for i := range rule.SSLSignatures {
+		rule.SSLSignatures[i].Confidence *= factor
+	}
+	for i := range rule.DNSSignatures {
+		rule.DNSSignatures[i].Confidence *= factor
+	}
+	for i := range rule.URLPatterns {
+		rule.URLPatterns[i].Confidence *= factor
+	}
+	for i := range rule.JSPatterns {
+		rule.JSPatterns[i].Confidence *= factor
+	}
+	for i := range rule.CSSPatterns {
+		rule.CSSPatterns[i].Confidence *= factor
+	}
+	for i := range rule.NetworkPatterns {
+		rule.NetworkPatterns[i].Confidence *= factor
+	}
+}
+
+// roundConfidence converts a confidence for the signatures with an
+// integer confidence
+func roundConfidence(confidence float32) int {
+	return int(math.Round(float64(confidence)))
+}
+
+// namespaceRe matches the valid namespaces
+var namespaceRe = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// ValidNamespace returns true if namespace only contains letters, digits,
+// '-' and '_' (an empty namespace is valid)
+func ValidNamespace(namespace string) bool {
+	return namespaceRe.MatchString(namespace)
+}
+
+// KeepUnmanaged copies to ruleset the unmanaged rules of previous, an
+// earlier version of it. They replace the rules with the same name of the
+// same group, or are added to it, creating the groups ruleset lacks. It
+// returns the number of rules kept.
+func KeepUnmanaged(ruleset *Ruleset, previous Ruleset) int {
+	kept := 0
+	for _, old := range previous.RuleGroups {
+		g := -1
+		for i := range ruleset.RuleGroups {
+			if ruleset.RuleGroups[i].GroupName == old.GroupName {
+				g = i
+				break
+			}
+		}
+		for _, rule := range old.DetectionRules {
+			if rule.IsManaged() {
+				continue
+			}
+			if g < 0 {
+				group := old
+				group.ActionRules = nil
+				group.CrawlingRules = nil
+				group.ScrapingRules = nil
+				group.DetectionRules = []DetectionRule{}
+				ruleset.RuleGroups = append(ruleset.RuleGroups, group)
+				g = len(ruleset.RuleGroups) - 1
+			}
+			group := &ruleset.RuleGroups[g]
+			replaced := false
+			for i := range group.DetectionRules {
+				if group.DetectionRules[i].RuleName == rule.RuleName {
+					group.DetectionRules[i] = rule
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				group.DetectionRules = append(group.DetectionRules, rule)
+			}
+			kept++
+		}
+	}
+	return kept
+}
+
+// ApplyNamespace prefixes the ruleset, group and rule names with namespace
+// so independently generated rulesets don't collide in the same CROWler.
+func ApplyNamespace(ruleset *Ruleset, namespace string) {
+	if namespace == "" {
+		return
+	}
+	prefix := namespace + "_"
+	ruleset.RulesetName = prefix + ruleset.RulesetName
+	for i := range ruleset.RuleGroups {
+		group := &ruleset.RuleGroups[i]
+		group.GroupName = prefix + group.GroupName
+		if group.ParentGroup != "" {
+			group.ParentGroup = prefix + group.ParentGroup
+		}
+		for j := range group.ActionRules {
+			group.ActionRules[j].RuleName = prefix + group.ActionRules[j].RuleName
+		}
+		for j := range group.DetectionRules {
+			group.DetectionRules[j].RuleName = prefix + group.DetectionRules[j].RuleName
+		}
+		for j := range group.CrawlingRules {
+			group.CrawlingRules[j].RuleName = prefix + group.CrawlingRules[j].RuleName
+		}
+		for j := range group.ScrapingRules {
+			group.ScrapingRules[j].RuleName = prefix + group.ScrapingRules[j].RuleName
+		}
+	}
+}
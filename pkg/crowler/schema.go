@@ -0,0 +1,264 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rulesetSchema is the JSON schema of the ruleset format
+//
+//go:embed schema/ruleset.schema.json
+var rulesetSchema []byte
+
+// Schema returns the JSON schema of the CROWler ruleset format
+func Schema() []byte {
+	return rulesetSchema
+}
+
+// schemaNode is the subset of JSON schema the ruleset schema uses
+type schemaNode struct {
+	Ref                  string                 `json:"$ref"`
+	Description          string                 `json:"description"`
+	Type                 schemaTypes            `json:"type"`
+	Required             []string               `json:"required"`
+	Properties           map[string]*schemaNode `json:"properties"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *schemaNode            `json:"items"`
+	Enum                 []string               `json:"enum"`
+	Pattern              string                 `json:"pattern"`
+	MinLength            int                    `json:"minLength"`
+	MinItems             int                    `json:"minItems"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	Definitions          map[string]*schemaNode `json:"definitions"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes is the type of a schema, a single type or a list
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+// compiledSchema is the parsed ruleset schema
+var compiledSchema = mustCompileSchema(rulesetSchema)
+
+func mustCompileSchema(data []byte) *schemaNode {
+	var root schemaNode
+	if err := json.Unmarshal(data, &root); err != nil {
+		panic("crowler: invalid ruleset schema: " + err.Error())
+	}
+	var compile func(s *schemaNode)
+	compile = func(s *schemaNode) {
+		if s == nil {
+			return
+		}
+		if s.Pattern != "" {
+			s.pattern = regexp.MustCompile(s.Pattern)
+		}
+		for _, p := range s.Properties {
+			compile(p)
+		}
+		for _, d := range s.Definitions {
+			compile(d)
+		}
+		compile(s.Items)
+	}
+	compile(&root)
+	return &root
+}
+
+// SchemaError is a violation of the ruleset schema, located by its path
+// in the ruleset (e.g. rule_groups[0].detection_rules[2].confidence) and
+// its line and column in the YAML document
+type SchemaError struct {
+	Path    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e SchemaError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s: %s", e.Line, e.Column, e.Path, e.Message)
+}
+
+// ValidateSchema checks a YAML (or JSON) ruleset against the ruleset
+// schema. It returns the violations found, or an error if data isn't a
+// YAML document.
+func ValidateSchema(data []byte) ([]SchemaError, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return []SchemaError{{Path: "ruleset", Line: 1, Column: 1, Message: "empty document"}}, nil
+	}
+	v := schemaValidator{root: compiledSchema}
+	v.validate(doc.Content[0], compiledSchema, "ruleset")
+	return v.errors, nil
+}
+
+type schemaValidator struct {
+	root   *schemaNode
+	errors []SchemaError
+}
+
+func (v *schemaValidator) fail(node *yaml.Node, path, format string, args ...any) {
+	v.errors = append(v.errors, SchemaError{
+		Path:    path,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// nodeType returns the JSON schema type of a YAML node
+func nodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.Tag {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	case "!!null":
+		return "null"
+	}
+	return "string"
+}
+
+func (v *schemaValidator) validate(node *yaml.Node, s *schemaNode, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/definitions/")
+		if !ok || v.root.Definitions[name] == nil {
+			v.fail(node, path, "unknown schema reference %s", s.Ref)
+			return
+		}
+		s = v.root.Definitions[name]
+	}
+
+	typ := nodeType(node)
+	if len(s.Type) > 0 {
+		ok := false
+		for _, t := range s.Type {
+			ok = ok || t == typ || (t == "number" && typ == "integer")
+		}
+		if !ok {
+			v.fail(node, path, "expected %s, found %s", strings.Join(s.Type, " or "), typ)
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		ok := false
+		for _, e := range s.Enum {
+			ok = ok || (node.Kind == yaml.ScalarNode && node.Value == e)
+		}
+		if !ok {
+			v.fail(node, path, "%q is not one of %s", node.Value, strings.Join(s.Enum, ", "))
+		}
+	}
+
+	switch typ {
+	case "object":
+		v.validateObject(node, s, path)
+	case "array":
+		if len(node.Content) < s.MinItems {
+			v.fail(node, path, "expected at least %d items, found %d", s.MinItems, len(node.Content))
+		}
+		if s.Items != nil {
+			for i, item := range node.Content {
+				v.validate(item, s.Items, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case "string":
+		if len([]rune(node.Value)) < s.MinLength {
+			v.fail(node, path, "must not be empty")
+		}
+		if s.pattern != nil && !s.pattern.MatchString(node.Value) {
+			if s.Description != "" {
+				v.fail(node, path, "%q is not %s", node.Value, s.Description)
+			} else {
+				v.fail(node, path, "%q doesn't match %s", node.Value, s.Pattern)
+			}
+		}
+	case "integer", "number":
+		n, err := strconv.ParseFloat(node.Value, 64)
+		if err != nil {
+			break
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			v.fail(node, path, "%s is below the minimum %g", node.Value, *s.Minimum)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			v.fail(node, path, "%s is above the maximum %g", node.Value, *s.Maximum)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(node *yaml.Node, s *schemaNode, path string) {
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		fieldPath := path + "." + key.Value
+		if seen[key.Value] {
+			v.fail(key, fieldPath, "duplicate field")
+			continue
+		}
+		seen[key.Value] = true
+		property, ok := s.Properties[key.Value]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				v.fail(key, fieldPath, "unknown field")
+			}
+			continue
+		}
+		v.validate(value, property, fieldPath)
+	}
+	for _, field := range s.Required {
+		if !seen[field] {
+			v.fail(node, path, "missing required field %s", field)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"slices"
+	"strings"
+)
+
+// sortBy sorts s by the key of its elements, keeping the order of the
+// elements with the same key
+func sortBy[T any](s []T, key func(T) string) {
+	slices.SortStableFunc(s, func(a, b T) int { return strings.Compare(key(a), key(b)) })
+}
+
+// join builds a sort key from key parts and pattern lists
+func join(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// SortRule sorts the signatures of a rule by their key, then patterns,
+// so the rules built from unordered sources (e.g. a JSON object of
+// headers) are written the same way on every run. The patterns of a
+// signature keep their order.
+func SortRule(rule *DetectionRule) {
+	sortBy(rule.HTTPHeaderFields, func(h HTTPHeaderField) string {
+		return join(h.Key, join(h.Value...))
+	})
+	sortBy(rule.Cookies, func(c CookieSignature) string {
+		return join(c.Name, join(c.Value...))
+	})
+	sortBy(rule.MetaTags, func(m MetaTag) string {
+		return join(m.Name, m.Attribute, join(m.Content...))
+	})
+	sortBy(rule.PageContentPatterns, func(p PageContentSignature) string {
+		return join(p.Key, p.Attribute, join(p.Signature...), join(p.Text...),
+			join(p.MD5Hash...), join(p.SHA256Hash...), join(p.MMH3Hash...))
+	})
+	sortBy(rule.SSLSignatures, func(s SSLSignature) string {
+		return join(s.Key, join(s.Value...))
+	})
+	sortBy(rule.DNSSignatures, func(d DNSSignature) string {
+		return join(d.Key, join(d.Value...))
+	})
+	sortBy(rule.URLPatterns, func(u URLMicroSignature) string {
+		return u.Signature
+	})
+	sortBy(rule.JSPatterns, func(j JSObjectSignature) string {
+		return join(j.Name, join(j.Value...))
+	})
+	sortBy(rule.CSSPatterns, func(c CSSSignature) string {
+		return join(c.Value...)
+	})
+	sortBy(rule.NetworkPatterns, func(n NetworkSignature) string {
+		return join(n.Key, join(n.Value...))
+	})
+	sortBy(rule.Version, func(v VersionSignature) string {
+		return join(v.Section, v.Key, v.Pattern)
+	})
+}
+
+// SortRuleset sorts the signatures of the detection rules of ruleset,
+// see SortRule. The groups and rules keep their order, the converters
+// decide it.
+func SortRuleset(ruleset *Ruleset) {
+	for i := range ruleset.RuleGroups {
+		for j := range ruleset.RuleGroups[i].DetectionRules {
+			SortRule(&ruleset.RuleGroups[i].DetectionRules[j])
+		}
+	}
+}
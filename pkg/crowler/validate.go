@@ -0,0 +1,60 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import "fmt"
+
+// ValidateParentGroups checks that every parent_group refers to another
+// group of the same ruleset and that the hierarchy has no cycles
+func ValidateParentGroups(ruleset Ruleset) error {
+	parents := make(map[string]string)
+	for _, group := range ruleset.RuleGroups {
+		parents[group.GroupName] = group.ParentGroup
+	}
+	for _, group := range ruleset.RuleGroups {
+		seen := map[string]bool{group.GroupName: true}
+		for parent := group.ParentGroup; parent != ""; parent = parents[parent] {
+			if _, ok := parents[parent]; !ok {
+				return fmt.Errorf("group %s: unknown parent_group %s", group.GroupName, parent)
+			}
+			if seen[parent] {
+				return fmt.Errorf("group %s: parent_group cycle through %s", group.GroupName, parent)
+			}
+			seen[parent] = true
+		}
+	}
+	return nil
+}
+
+// ValidateActionRules checks the action types and their required fields
+func ValidateActionRules(ruleset Ruleset) error {
+	for _, group := range ruleset.RuleGroups {
+		for _, action := range group.ActionRules {
+			if action.RuleName == "" {
+				return fmt.Errorf("group %s: action rule without rule_name", group.GroupName)
+			}
+			if !ActionTypes[action.ActionType] {
+				return fmt.Errorf("action rule %s: unsupported action_type %q", action.RuleName, action.ActionType)
+			}
+			if action.ActionType == "navigate_to_url" && action.URL == "" {
+				return fmt.Errorf("action rule %s: navigate_to_url requires url", action.RuleName)
+			}
+			if (action.ActionType == "input_text" || action.ActionType == "click") && len(action.Selectors) == 0 {
+				return fmt.Errorf("action rule %s: %s requires at least one selector", action.RuleName, action.ActionType)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatChange lists the fields a format version introduced: ruleset,
+// rule group, rule and signature fields, and rule sections
+type formatChange struct {
+	version string
+	fields  []string
+}
+
+// formatChanges are the changes of the format versions the converters
+// can target, oldest first. Targeting an older version removes the
+// fields introduced after it. 1.0.4 is the format of the first
+// converters (rule names, the header, meta tag, page content, SSL and
+// URL signatures and the implies), 1.0.5 the one declaring all the
+// fields added since.
+var formatChanges = []formatChange{
+	{version: "1.0.4"},
+	{version: "1.0.5", fields: []string{
+		// Ruleset fields
+		"source", "source_license", "license", "metadata", "security_policy",
+		// Rule group fields and rule types
+		"parent_group", "tags", "action_rules", "crawling_rules", "scraping_rules",
+		// Detection rule fields and sections
+		"cpe", "valid_from", "expires", "requires", "requires_category", "excludes", "managed",
+		"cookies", "dns_patterns", "js_patterns", "css_patterns", "network_patterns", "version",
+		// Signature fields
+		"attribute", "content_confidence", "sha256hash", "mmh3hash",
+	}},
+}
+
+// TargetVersions returns the format versions the converters can target.
+// The later 1.0.x versions only add fields, so they can be targeted too:
+// their rulesets keep all the fields of FormatVersion.
+func TargetVersions() []string {
+	versions := make([]string, len(formatChanges))
+	for i, change := range formatChanges {
+		versions[i] = change.version
+	}
+	return versions
+}
+
+// formatPatch returns the patch number of a 1.0.x version
+func formatPatch(version string) (int, bool) {
+	patch, ok := strings.CutPrefix(version, "1.0.")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(patch)
+	return n, err == nil && n >= 0
+}
+
+// ValidTargetVersion returns an error if version can't be targeted
+func ValidTargetVersion(version string) error {
+	patch, ok := formatPatch(version)
+	oldest, _ := formatPatch(formatChanges[0].version)
+	if !ok || patch < oldest {
+		return fmt.Errorf("unsupported format version %q, expected %s or a later 1.0.x version", version, strings.Join(TargetVersions(), ", "))
+	}
+	return nil
+}
+
+// TargetVersion rewrites ruleset for the format version: it sets the
+// format_version and removes the fields the version doesn't support. It
+// returns how many of each field were removed.
+func TargetVersion(ruleset *Ruleset, version string) (map[string]int, error) {
+	if err := ValidTargetVersion(version); err != nil {
+		return nil, err
+	}
+	target, _ := formatPatch(version)
+	unsupported := make(map[string]bool)
+	for _, change := range formatChanges {
+		if patch, _ := formatPatch(change.version); patch > target {
+			for _, field := range change.fields {
+				unsupported[field] = true
+			}
+		}
+	}
+
+	removed := make(map[string]int)
+	drop := func(field string, present bool) bool {
+		if present && unsupported[field] {
+			removed[field]++
+			return true
+		}
+		return false
+	}
+
+	ruleset.FormatVersion = version
+	if drop("source", ruleset.Source != "") {
+		ruleset.Source = ""
+	}
+	if drop("source_license", ruleset.SourceLicense != "") {
+		ruleset.SourceLicense = ""
+	}
+	if drop("license", ruleset.License != "") {
+		ruleset.License = ""
+	}
+	if drop("metadata", ruleset.Metadata != nil) {
+		ruleset.Metadata = nil
+	}
+	if drop("security_policy", ruleset.SecurityPolicy != nil) {
+		ruleset.SecurityPolicy = nil
+	}
+	for i := range ruleset.RuleGroups {
+		group := &ruleset.RuleGroups[i]
+		if drop("parent_group", group.ParentGroup != "") {
+			group.ParentGroup = ""
+		}
+		if drop("tags", len(group.Tags) > 0) {
+			group.Tags = nil
+		}
+		if drop("action_rules", len(group.ActionRules) > 0) {
+			group.ActionRules = nil
+		}
+		if drop("crawling_rules", len(group.CrawlingRules) > 0) {
+			group.CrawlingRules = nil
+		}
+		if drop("scraping_rules", len(group.ScrapingRules) > 0) {
+			group.ScrapingRules = nil
+		}
+		for j := range group.DetectionRules {
+			rule := &group.DetectionRules[j]
+			if drop("cpe", rule.CPE != "") {
+				rule.CPE = ""
+			}
+			if drop("metadata", rule.Metadata != nil) {
+				rule.Metadata = nil
+			}
+			if drop("valid_from", rule.ValidFrom != "") {
+				rule.ValidFrom = ""
+			}
+			if drop("expires", rule.Expires != "") {
+				rule.Expires = ""
+			}
+			if drop("tags", len(rule.Tags) > 0) {
+				rule.Tags = nil
+			}
+			if drop("requires", len(rule.Requires) > 0) {
+				rule.Requires = nil
+			}
+			if drop("requires_category", len(rule.RequiresCategory) > 0) {
+				rule.RequiresCategory = nil
+			}
+			if drop("excludes", len(rule.Excludes) > 0) {
+				rule.Excludes = nil
+			}
+			if drop("managed", rule.Managed != nil) {
+				rule.Managed = nil
+			}
+			// The older versions match the cookies in the Set-Cookie
+			// header instead
+			if drop("cookies", len(rule.Cookies) > 0) {
+				for _, c := range rule.Cookies {
+					rule.HTTPHeaderFields = append(rule.HTTPHeaderFields, CookieHeader(c))
+				}
+				rule.Cookies = nil
+			}
+			if drop("dns_patterns", len(rule.DNSSignatures) > 0) {
+				rule.DNSSignatures = nil
+			}
+			if drop("js_patterns", len(rule.JSPatterns) > 0) {
+				rule.JSPatterns = nil
+			}
+			if drop("css_patterns", len(rule.CSSPatterns) > 0) {
+				rule.CSSPatterns = nil
+			}
+			if drop("network_patterns", len(rule.NetworkPatterns) > 0) {
+				rule.NetworkPatterns = nil
+			}
+			if drop("version", len(rule.Version) > 0) {
+				rule.Version = nil
+			}
+			for k := range rule.PageContentPatterns {
+				p := &rule.PageContentPatterns[k]
+				if drop("sha256hash", len(p.SHA256Hash) > 0) {
+					p.SHA256Hash = nil
+				}
+				if drop("mmh3hash", len(p.MMH3Hash) > 0) {
+					p.MMH3Hash = nil
+				}
+			}
+			// The meta tag keeps its confidence, the highest of its
+			// patterns. The older versions only match the meta tags by
+			// name, the http-equiv and charset ones are removed.
+			metaTags := rule.MetaTags[:0]
+			for _, m := range rule.MetaTags {
+				if drop("attribute", m.Attribute != "" && m.Attribute != MetaName) {
+					continue
+				}
+				m.Attribute = ""
+				if drop("content_confidence", len(m.ContentConfidence) > 0) {
+					m.ContentConfidence = nil
+				}
+				metaTags = append(metaTags, m)
+			}
+			rule.MetaTags = metaTags
+		}
+	}
+	return removed, nil
+}
+
+// CookieHeader returns the Set-Cookie header field matching the cookie
+// signature c, for the formats without cookie signatures
+func CookieHeader(c CookieSignature) HTTPHeaderField {
+	values := []string{CookieHeaderPattern(c.Name, "")}
+	if len(c.Value) > 0 {
+		values = make([]string, len(c.Value))
+		for i, v := range c.Value {
+			values[i] = CookieHeaderPattern(c.Name, v)
+		}
+	}
+	return HTTPHeaderField{Key: "set-cookie", Value: values, Confidence: roundConfidence(c.Confidence)}
+}
+
+// CookieHeaderPattern returns the pattern of the Set-Cookie header
+// matching the cookie name with a value matching pattern, for the
+// formats without cookie signatures. The anchors of pattern are moved to
+// the bounds of the value, which the cookie attributes follow.
+func CookieHeaderPattern(name, pattern string) string {
+	out := "^" + regexp.QuoteMeta(name) + "="
+	end := ""
+	if anchored := strings.TrimPrefix(pattern, "^"); anchored != pattern {
+		pattern = anchored
+	} else if pattern != "" {
+		pattern = "[^;]*" + pattern
+	}
+	if strings.HasSuffix(pattern, "$") && !strings.HasSuffix(pattern, `\$`) {
+		pattern, end = strings.TrimSuffix(pattern, "$"), "(?:;|$)"
+	}
+	if pattern != "" {
+		out += "(?:" + pattern + ")" + end
+	}
+	return out
+}
+
+// FormatRemoved formats the counts returned by TargetVersion, e.g.
+// "3 js_patterns, 1 version"
+func FormatRemoved(removed map[string]int) string {
+	fields := make([]string, 0, len(removed))
+	for field := range removed {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = fmt.Sprintf("%d %s", removed[field], field)
+	}
+	return strings.Join(fields, ", ")
+}
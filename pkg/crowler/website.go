@@ -0,0 +1,35 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crowler
+
+import (
+	"net/url"
+	"strings"
+)
+
+// IsWebsitePattern tells if pattern matches the address of website, the
+// site of the detected object (e.g. https://wordpress.org). Such patterns
+// match the links to the vendor site, which the sites using the object
+// rarely have.
+func IsWebsitePattern(pattern, website string) bool {
+	u, err := url.Parse(strings.ToLower(website))
+	if err != nil || u.Hostname() == "" || pattern == "" {
+		return false
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	// The patterns escape the dots and slashes of the address
+	pattern = strings.ToLower(strings.NewReplacer(`\.`, ".", `\/`, "/").Replace(pattern))
+	return strings.Contains(pattern, host)
+}
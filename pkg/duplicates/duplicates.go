@@ -0,0 +1,144 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package duplicates reports the signatures shared by several detection
+// rules, which can't tell their objects apart and are worth reviewing
+// (e.g. a generic header pattern copied in several technologies).
+package duplicates
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the report file
+const FileName = "duplicates-report.yaml"
+
+// Signature is a signature shared by several rules
+type Signature struct {
+	// Section is the section of the rules holding the signature, e.g.
+	// http_header_fields
+	Section string `yaml:"section"`
+	// Signature is the signature, prefixed with its key
+	Signature string   `yaml:"signature"`
+	Rules     []string `yaml:"rules"`
+}
+
+// Report collects the signatures of the rules and reports the shared
+// ones
+type Report struct {
+	Source string `yaml:"source,omitempty"`
+	// Shared are the signatures found in more than one rule, sorted by
+	// section and signature
+	Shared []Signature `yaml:"shared_signatures"`
+
+	rules map[[2]string][]string
+}
+
+// NewReport returns an empty report
+func NewReport(source string) *Report {
+	return &Report{Source: source, rules: make(map[[2]string][]string)}
+}
+
+func (r *Report) add(section, signature, rule string) {
+	key := [2]string{section, signature}
+	for _, name := range r.rules[key] {
+		if name == rule {
+			return
+		}
+	}
+	r.rules[key] = append(r.rules[key], rule)
+}
+
+// Add records the header fields, URL signatures and page content
+// patterns of a rule. The same rule can be added more than once (e.g.
+// when it appears in several rule groups).
+func (r *Report) Add(rule crowler.DetectionRule) {
+	for _, h := range rule.HTTPHeaderFields {
+		for _, v := range h.Value {
+			r.add("http_header_fields", h.Key+": "+v, rule.RuleName)
+		}
+	}
+	for _, c := range rule.Cookies {
+		for _, v := range c.Value {
+			r.add("cookies", c.Name+"="+v, rule.RuleName)
+		}
+	}
+	for _, u := range rule.URLPatterns {
+		r.add("url_micro_signatures", u.Signature, rule.RuleName)
+	}
+	for _, p := range rule.PageContentPatterns {
+		key := p.Key
+		if p.Attribute != "" {
+			key += "[" + p.Attribute + "]"
+		}
+		for _, v := range p.Signature {
+			r.add("page_content_patterns", key+": "+v, rule.RuleName)
+		}
+		for _, v := range p.Text {
+			r.add("page_content_patterns", key+" text: "+v, rule.RuleName)
+		}
+		for _, hashes := range [][]string{p.MD5Hash, p.SHA256Hash, p.MMH3Hash} {
+			for _, v := range hashes {
+				r.add("page_content_patterns", key+" hash: "+v, rule.RuleName)
+			}
+		}
+	}
+}
+
+// Count builds the list of the shared signatures and returns its length
+func (r *Report) Count() int {
+	r.Shared = r.Shared[:0]
+	for key, rules := range r.rules {
+		if len(rules) < 2 {
+			continue
+		}
+		rules = append([]string(nil), rules...)
+		sort.Strings(rules)
+		r.Shared = append(r.Shared, Signature{Section: key[0], Signature: key[1], Rules: rules})
+	}
+	sort.Slice(r.Shared, func(i, j int) bool {
+		if r.Shared[i].Section != r.Shared[j].Section {
+			return r.Shared[i].Section < r.Shared[j].Section
+		}
+		return r.Shared[i].Signature < r.Shared[j].Signature
+	})
+	return len(r.Shared)
+}
+
+// Write writes the shared signatures as YAML to path
+func (r *Report) Write(path string) error {
+	r.Count()
+	if r.Shared == nil {
+		r.Shared = []Signature{}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
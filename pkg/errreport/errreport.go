@@ -0,0 +1,85 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errreport collects the source entries a conversion skipped
+// because they can't be read (a malformed technology, an unparsable
+// rule), so a single bad entry doesn't stop the conversion of the others,
+// and writes them to a report file.
+package errreport
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the report file
+const FileName = "error-report.yaml"
+
+// Entry is a skipped source entry
+type Entry struct {
+	// Entry names the entry in the source, e.g. technology WordPress or
+	// rules.conf: line 12
+	Entry string `yaml:"entry"`
+	Error string `yaml:"error"`
+}
+
+// Report collects the skipped entries. It's safe for concurrent use.
+type Report struct {
+	Source  string  `yaml:"source,omitempty"`
+	Entries []Entry `yaml:"entries"`
+
+	mu sync.Mutex
+}
+
+// NewReport returns an empty report
+func NewReport(source string) *Report {
+	return &Report{Source: source, Entries: []Entry{}}
+}
+
+// Add records a skipped entry and its error, it's the Invalid function of
+// the converter options
+func (r *Report) Add(entry string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Entries = append(r.Entries, Entry{Entry: entry, Error: err.Error()})
+}
+
+// Count returns the number of skipped entries
+func (r *Report) Count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.Entries)
+}
+
+// Write writes the report as YAML to path
+func (r *Report) Write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package favicon computes the hashes used to fingerprint favicons: MD5
+// (Nikto db_favicon), SHA-256 and the Shodan style mmh3 hash.
+package favicon
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+)
+
+// Hashes holds the hashes of a favicon
+type Hashes struct {
+	MD5    string
+	SHA256 string
+	MMH3   string
+}
+
+// Compute returns all the hashes of a favicon
+func Compute(data []byte) Hashes {
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	return Hashes{
+		MD5:    hex.EncodeToString(md5sum[:]),
+		SHA256: hex.EncodeToString(sha256sum[:]),
+		MMH3:   strconv.FormatInt(int64(MMH3(data)), 10),
+	}
+}
+
+// MMH3 returns the favicon hash used by Shodan (http.favicon.hash): the
+// signed 32-bit MurmurHash3 of the base64 encoding of the favicon, with
+// a newline every 76 characters and at the end (Python's
+// base64.encodebytes).
+func MMH3(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	buf := make([]byte, 0, len(encoded)+len(encoded)/76+1)
+	for len(encoded) > 76 {
+		buf = append(buf, encoded[:76]...)
+		buf = append(buf, '\n')
+		encoded = encoded[76:]
+	}
+	buf = append(buf, encoded...)
+	buf = append(buf, '\n')
+	return int32(Murmur3(buf, 0))
+}
+
+// Murmur3 returns the 32-bit MurmurHash3 (x86) of data
+func Murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[n*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,249 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fetch downloads the source files of the converters from a URL
+// or a GitHub repository, keeping a copy in the user cache directory
+// that is refreshed only when the remote file changes (ETag).
+package fetch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// client is the HTTP client used for the downloads
+var client = &http.Client{Timeout: 2 * time.Minute}
+
+// IsURL reports whether s is an http or https URL
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// CacheDir returns the directory where the downloaded files are kept
+// (~/.cache/crowlerconv on Linux)
+func CacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "crowlerconv"), nil
+}
+
+// URL downloads the file at rawURL in the cache and returns its local path
+func URL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %s: %v", rawURL, err)
+	}
+	cache, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = "index"
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	dest := filepath.Join(cache, "url", hex.EncodeToString(sum[:8]), name)
+	if err := download(rawURL, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// GitHub downloads a file or a directory from a GitHub repository in the
+// cache and returns its local path. spec is owner/repo@ref:path, ref
+// defaults to the default branch of the repository.
+func GitHub(spec string) (string, error) {
+	repo, filePath, ok := strings.Cut(spec, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid GitHub source %q, expected owner/repo@ref:path", spec)
+	}
+	repo, ref, _ := strings.Cut(repo, "@")
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("invalid GitHub repository %q, expected owner/repo", repo)
+	}
+	filePath = strings.Trim(filePath, "/")
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	cache, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(cache, "github", owner, name, ref, filepath.FromSlash(filePath))
+
+	// A path that is not a file on raw.githubusercontent.com can be a
+	// directory, whose files are listed by the contents API
+	rawURL := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", owner, name, ref, filePath)
+	err = download(rawURL, dest)
+	if err == nil {
+		return dest, nil
+	}
+	if !isNotFound(err) {
+		if info, statErr := os.Stat(dest); statErr == nil && info.IsDir() {
+			slog.Warn("Error downloading, using the cached copy", "source", spec, "error", err)
+			return dest, nil
+		}
+		return "", err
+	}
+	if err := githubDir(owner, name, ref, filePath, dest); err != nil {
+		if info, statErr := os.Stat(dest); statErr == nil && info.IsDir() {
+			slog.Warn("Error listing, using the cached copy", "source", spec, "error", err)
+			return dest, nil
+		}
+		return "", err
+	}
+	return dest, nil
+}
+
+// githubDir downloads the files of a repository directory, and of its
+// subdirectories, in dest
+func githubDir(owner, name, ref, dirPath, dest string) error {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/contents/%s", owner, name, dirPath)
+	if ref != "HEAD" {
+		apiURL += "?ref=" + url.QueryEscape(ref)
+	}
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{url: apiURL, code: resp.StatusCode}
+	}
+
+	var entries []struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		DownloadURL string `json:"download_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return fmt.Errorf("error reading the contents of %s/%s/%s: %v", owner, name, dirPath, err)
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Type == "dir":
+			if err := githubDir(owner, name, ref, path.Join(dirPath, entry.Name), filepath.Join(dest, entry.Name)); err != nil {
+				return err
+			}
+		case entry.Type == "file" && entry.DownloadURL != "":
+			if err := download(entry.DownloadURL, filepath.Join(dest, entry.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// statusError is returned for an unexpected HTTP status
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("error downloading %s: %s", e.url, http.StatusText(e.code))
+}
+
+func isNotFound(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.code == http.StatusNotFound
+}
+
+// download fetches rawURL into dest. The ETag of the response is kept in
+// dest.etag so the file is downloaded again only if it changed; if the
+// server can't be reached the cached copy is used.
+func download(rawURL, dest string) error {
+	etagPath := dest + ".etag"
+	info, err := os.Stat(dest)
+	cached := err == nil && info.Mode().IsRegular()
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if cached {
+		if etag, err := os.ReadFile(etagPath); err == nil {
+			req.Header.Set("If-None-Match", strings.TrimSpace(string(etag)))
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if cached {
+			slog.Warn("Error downloading, using the cached copy", "url", rawURL, "error", err)
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return &statusError{url: rawURL, code: resp.StatusCode}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so an interrupted download doesn't
+	// replace the cached copy
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error downloading %s: %v", rawURL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return err
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return os.WriteFile(etagPath, []byte(etag), 0o644)
+	}
+	if err := os.Remove(etagPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filter selects the detection rules to write, by the name of
+// the detected object and by the category of their rule group, to
+// generate a small targeted ruleset (e.g. only the CMS detection) from a
+// large source.
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// Filter selects the detection rules. The nil fields select all the
+// rules.
+type Filter struct {
+	// Include selects the rules whose object or rule name it matches
+	Include *regexp.Regexp
+	// Exclude drops the rules whose object or rule name it matches
+	Exclude *regexp.Regexp
+	// Categories selects the rule groups of these categories, and their
+	// children, as slugs
+	Categories map[string]bool
+
+	matched map[string]bool
+}
+
+// New returns the filter of the include and exclude regexes and of the
+// comma separated list of categories. Empty values select all the rules.
+func New(include, exclude, categories string) (*Filter, error) {
+	f := &Filter{}
+	var err error
+	if include != "" {
+		if f.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %v", err)
+		}
+	}
+	if exclude != "" {
+		if f.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %v", err)
+		}
+	}
+	for _, category := range strings.Split(categories, ",") {
+		if strings.TrimSpace(category) == "" {
+			continue
+		}
+		if f.Categories == nil {
+			f.Categories = make(map[string]bool)
+		}
+		f.Categories[slug.Make(category)] = true
+	}
+	return f, nil
+}
+
+// IsEmpty tells if the filter selects all the rules
+func (f *Filter) IsEmpty() bool {
+	return f.Include == nil && f.Exclude == nil && f.Categories == nil
+}
+
+// Apply returns the rulesets with the selected rules only. The groups
+// left without rules are removed, unless they are the parent of a kept
+// group, and so are the rulesets left without groups.
+func (f *Filter) Apply(rulesets []crowler.Ruleset) []crowler.Ruleset {
+	f.matched = make(map[string]bool)
+	var out []crowler.Ruleset
+	for _, ruleset := range rulesets {
+		if groups := f.groups(ruleset.RuleGroups); len(groups) > 0 {
+			ruleset.RuleGroups = groups
+			out = append(out, ruleset)
+		}
+	}
+	return out
+}
+
+// Unmatched returns the categories of the filter that no rule group had
+// in the last Apply, sorted
+func (f *Filter) Unmatched() []string {
+	var unmatched []string
+	for category := range f.Categories {
+		if !f.matched[category] {
+			unmatched = append(unmatched, category)
+		}
+	}
+	sort.Strings(unmatched)
+	return unmatched
+}
+
+// groups returns the selected rule groups of a ruleset
+func (f *Filter) groups(groups []crowler.RuleGroup) []crowler.RuleGroup {
+	byName := make(map[string]crowler.RuleGroup, len(groups))
+	for _, group := range groups {
+		byName[group.GroupName] = group
+	}
+
+	keep := make(map[string]bool)
+	selected := make([]bool, len(groups))
+	filtered := make([]crowler.RuleGroup, len(groups))
+	for i, group := range groups {
+		filtered[i] = group
+		if !f.selectsCategory(group, byName) {
+			continue
+		}
+		selected[i] = true
+		rules := make([]crowler.DetectionRule, 0, len(group.DetectionRules))
+		for _, rule := range group.DetectionRules {
+			if f.selectsRule(rule) {
+				rules = append(rules, rule)
+			}
+		}
+		filtered[i].DetectionRules = rules
+		if len(rules)+len(group.ActionRules) == 0 {
+			continue
+		}
+		// Keep the group and its parents
+		for name := group.GroupName; name != "" && !keep[name]; name = byName[name].ParentGroup {
+			keep[name] = true
+		}
+	}
+
+	var out []crowler.RuleGroup
+	for i, group := range filtered {
+		if !keep[group.GroupName] {
+			continue
+		}
+		if !selected[i] {
+			// A parent out of the categories keeps none of its rules
+			group.DetectionRules = []crowler.DetectionRule{}
+			group.ActionRules = nil
+		}
+		out = append(out, group)
+	}
+	return out
+}
+
+// selectsCategory tells if group, or one of its parents, is of one of the
+// categories of the filter
+func (f *Filter) selectsCategory(group crowler.RuleGroup, byName map[string]crowler.RuleGroup) bool {
+	if f.Categories == nil {
+		return true
+	}
+	seen := make(map[string]bool)
+	for !seen[group.GroupName] {
+		seen[group.GroupName] = true
+		if category := slug.Make(group.Category); group.Category != "" && f.Categories[category] {
+			f.matched[category] = true
+			return true
+		}
+		parent, ok := byName[group.ParentGroup]
+		if !ok {
+			break
+		}
+		group = parent
+	}
+	return false
+}
+
+// selectsRule tells if the include and exclude patterns select the object
+// or rule name of rule
+func (f *Filter) selectsRule(rule crowler.DetectionRule) bool {
+	matches := func(re *regexp.Regexp) bool {
+		return re.MatchString(rule.ObjectName) || re.MatchString(rule.RuleName)
+	}
+	if f.Include != nil && !matches(f.Include) {
+		return false
+	}
+	return f.Exclude == nil || !matches(f.Exclude)
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package implies
+
+import (
+	"slices"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+	"gotests/thecrowler-rules-converters/pkg/taxonomy"
+)
+
+// location is the rule group of a ruleset
+type location struct {
+	ruleset, group int
+}
+
+// Expand materializes the implications listed in the rule metadata (see
+// Resolve), for the CROWler deployments ignoring implies: the rules get
+// the category tags of the objects they imply (the tags of their rule
+// groups, or the slug of their category). With clone, each rule also
+// gets a copy detecting each implied object, named
+// <rule>_implies_<object>, with the confidence of its signatures
+// multiplied by the confidence of the implication. The copies have the
+// signatures of the rule only, and go to the rule group detecting the
+// object, or to the group of the rule if no rule detects it. It returns
+// the number of expanded rules and of added copies.
+func Expand(rulesets []crowler.Ruleset, clone bool) (expanded, cloned int) {
+	tags := make(map[string][]string)
+	groups := make(map[string]location)
+	for i, ruleset := range rulesets {
+		for j, group := range ruleset.RuleGroups {
+			groupTags := group.Tags
+			if len(groupTags) == 0 && group.Category != "" {
+				groupTags = []string{slug.Make(group.Category)}
+			}
+			for _, rule := range group.DetectionRules {
+				tags[rule.ObjectName] = taxonomy.Merge(tags[rule.ObjectName], groupTags...)
+				if _, ok := groups[rule.ObjectName]; !ok {
+					groups[rule.ObjectName] = location{i, j}
+				}
+			}
+		}
+	}
+
+	copies := make(map[location][]crowler.DetectionRule)
+	done := make(map[string]bool)
+	for i := range rulesets {
+		for j := range rulesets[i].RuleGroups {
+			group := &rulesets[i].RuleGroups[j]
+			for k := range group.DetectionRules {
+				rule := &group.DetectionRules[k]
+				if rule.Metadata == nil || len(rule.Metadata.Implied) == 0 {
+					continue
+				}
+				expanded++
+				for _, implied := range rule.Metadata.Implied {
+					rule.Tags = taxonomy.Merge(rule.Tags, tags[implied.Object]...)
+				}
+				if !clone || done[rule.RuleName] {
+					continue
+				}
+				done[rule.RuleName] = true
+				for _, implied := range rule.Metadata.Implied {
+					to, ok := groups[implied.Object]
+					if !ok {
+						to = location{i, j}
+					}
+					if copy, ok := impliedRule(*rule, implied, tags[implied.Object]); ok {
+						copies[to] = append(copies[to], copy)
+						cloned++
+					}
+				}
+			}
+		}
+	}
+
+	for to, rules := range copies {
+		group := &rulesets[to.ruleset].RuleGroups[to.group]
+		group.DetectionRules = append(group.DetectionRules, rules...)
+	}
+	return expanded, cloned
+}
+
+// impliedRule returns the copy of rule detecting the implied object, with
+// the tags of its category, without the signatures matching the website
+// of the object of rule (the vendor site doesn't use what it implies).
+// It returns false if no signature is left.
+func impliedRule(rule crowler.DetectionRule, implied crowler.ImpliedObject, tags []string) (crowler.DetectionRule, bool) {
+	out := crowler.DetectionRule{
+		RuleName:            rule.RuleName + "_implies_" + slug.Make(implied.Object),
+		ObjectName:          implied.Object,
+		ValidFrom:           rule.ValidFrom,
+		Expires:             rule.Expires,
+		Tags:                slices.Clone(tags),
+		HTTPHeaderFields:    slices.Clone(rule.HTTPHeaderFields),
+		Cookies:             slices.Clone(rule.Cookies),
+		MetaTags:            slices.Clone(rule.MetaTags),
+		PageContentPatterns: nil,
+		SSLSignatures:       slices.Clone(rule.SSLSignatures),
+		DNSSignatures:       slices.Clone(rule.DNSSignatures),
+		URLPatterns:         nil,
+		JSPatterns:          slices.Clone(rule.JSPatterns),
+		CSSPatterns:         slices.Clone(rule.CSSPatterns),
+		NetworkPatterns:     slices.Clone(rule.NetworkPatterns),
+	}
+	website := ""
+	if rule.Metadata != nil {
+		website = rule.Metadata.Website
+	}
+	for _, u := range rule.URLPatterns {
+		if !crowler.IsWebsitePattern(u.Signature, website) {
+			out.URLPatterns = append(out.URLPatterns, u)
+		}
+	}
+	for _, p := range rule.PageContentPatterns {
+		if !isWebsiteLink(p, website) {
+			out.PageContentPatterns = append(out.PageContentPatterns, p)
+		}
+	}
+	if !hasSignatures(out) {
+		return out, false
+	}
+	crowler.ScaleConfidence(&out, float32(implied.Confidence)/100)
+	return out, true
+}
+
+// isWebsiteLink tells if p matches the links to website
+func isWebsiteLink(p crowler.PageContentSignature, website string) bool {
+	if len(p.Signature) == 0 || (p.Attribute != "href" && p.Attribute != "src") {
+		return false
+	}
+	for _, pattern := range p.Signature {
+		if !crowler.IsWebsitePattern(pattern, website) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasSignatures tells if rule has signatures
+func hasSignatures(rule crowler.DetectionRule) bool {
+	return len(rule.HTTPHeaderFields)+len(rule.Cookies)+len(rule.MetaTags)+len(rule.PageContentPatterns)+
+		len(rule.SSLSignatures)+len(rule.DNSSignatures)+len(rule.URLPatterns)+
+		len(rule.JSPatterns)+len(rule.CSSPatterns)+len(rule.NetworkPatterns) > 0
+}
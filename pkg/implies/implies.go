@@ -0,0 +1,118 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package implies builds an index of the "implies" relations between the
+// detected objects, in both directions, so the CROWler (and whoever audits
+// the coverage of a ruleset) can reason about detection cascades.
+package implies
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the index file
+const FileName = "implies-index.yaml"
+
+// tagSeparator separates an implied object from the Wappalyzer style
+// tags (PHP\;confidence:50)
+const tagSeparator = `\;`
+
+// Entry describes an object of the index
+type Entry struct {
+	// Rules detecting the object
+	Rules []string `yaml:"rules,omitempty"`
+	// Objects implied by the object
+	Implies []string `yaml:"implies,omitempty"`
+	// Objects implying the object, and the rules detecting them
+	ImpliedBy      []string `yaml:"implied_by,omitempty"`
+	ImpliedByRules []string `yaml:"implied_by_rules,omitempty"`
+}
+
+// Index maps every object to its implies relations
+type Index struct {
+	Source  string            `yaml:"source,omitempty"`
+	Objects map[string]*Entry `yaml:"objects"`
+}
+
+// NewIndex returns an empty index
+func NewIndex(source string) *Index {
+	return &Index{Source: source, Objects: make(map[string]*Entry)}
+}
+
+func (ix *Index) entry(object string) *Entry {
+	e, ok := ix.Objects[object]
+	if !ok {
+		e = &Entry{}
+		ix.Objects[object] = e
+	}
+	return e
+}
+
+// Add records that rule detects object, and that object implies the
+// objects in implies. The same rule can be added more than once (e.g.
+// when it appears in several rulesets).
+func (ix *Index) Add(object, rule string, implies []string) {
+	e := ix.entry(object)
+	e.Rules = appendUnique(e.Rules, rule)
+	for _, implied := range implies {
+		if i := strings.Index(implied, tagSeparator); i >= 0 {
+			implied = implied[:i]
+		}
+		implied = strings.TrimSpace(implied)
+		if implied == "" {
+			continue
+		}
+		e.Implies = appendUnique(e.Implies, implied)
+
+		target := ix.entry(implied)
+		target.ImpliedBy = appendUnique(target.ImpliedBy, object)
+		target.ImpliedByRules = appendUnique(target.ImpliedByRules, rule)
+	}
+}
+
+// Write sorts the index and writes it as YAML to path
+func (ix *Index) Write(path string) error {
+	for _, e := range ix.Objects {
+		sort.Strings(e.Rules)
+		sort.Strings(e.Implies)
+		sort.Strings(e.ImpliedBy)
+		sort.Strings(e.ImpliedByRules)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(ix); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
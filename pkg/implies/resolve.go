@@ -0,0 +1,242 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package implies
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReportFileName is the default name of the report of the implies cycles
+// and missing objects
+const ReportFileName = "implies-report.yaml"
+
+// Missing is an implied object no rule of the source detects
+type Missing struct {
+	Object  string `yaml:"object"`
+	Implies string `yaml:"implies"`
+}
+
+// Report lists the implies cycles (e.g. A implies B implies A), each
+// starting with its first object by name, and the implied objects
+// missing from the source
+type Report struct {
+	Source  string     `yaml:"source,omitempty"`
+	Cycles  [][]string `yaml:"cycles"`
+	Missing []Missing  `yaml:"missing"`
+}
+
+// Parse splits an implies entry into the implied object and its tags,
+// e.g. PHP\;confidence:50. The confidence is 100 without a tag.
+func Parse(entry string) (string, patterntag.Tags) {
+	object, tags := patterntag.Parse(entry)
+	if tags.Confidence < 0 {
+		tags.Confidence = 100
+	}
+	return strings.TrimSpace(object), tags
+}
+
+// Format returns the implies entry of an implied object, the reverse of
+// Parse
+func Format(implied crowler.ImpliedObject) string {
+	tags := patterntag.Tags{Version: implied.Version, Confidence: -1}
+	if implied.Confidence < 100 {
+		tags.Confidence = implied.Confidence
+	}
+	return patterntag.Format(implied.Object, tags)
+}
+
+// Resolve moves the tags out of the implies entries of the rules of
+// rulesets, leaving the object names, and lists in the rule metadata the
+// objects each rule implies, directly or through the objects it implies,
+// with the confidence of the implication (the product of the confidences
+// along the shortest chain). It returns the report of the cycles and of
+// the implied objects no rule of rulesets detects.
+func Resolve(rulesets []crowler.Ruleset, source string) *Report {
+	// The direct implications of each detected object
+	direct := make(map[string][]crowler.ImpliedObject)
+	for i := range rulesets {
+		for j := range rulesets[i].RuleGroups {
+			group := &rulesets[i].RuleGroups[j]
+			for k := range group.DetectionRules {
+				rule := &group.DetectionRules[k]
+				implied := parseImplies(rule)
+				if _, ok := direct[rule.ObjectName]; !ok || len(implied) > 0 {
+					direct[rule.ObjectName] = implied
+				}
+			}
+		}
+	}
+
+	report := &Report{Source: source, Cycles: findCycles(direct), Missing: []Missing{}}
+	objects := make([]string, 0, len(direct))
+	for object := range direct {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	for _, object := range objects {
+		for _, implied := range direct[object] {
+			if _, ok := direct[implied.Object]; !ok {
+				report.Missing = append(report.Missing, Missing{Object: object, Implies: implied.Object})
+			}
+		}
+	}
+
+	for i := range rulesets {
+		for j := range rulesets[i].RuleGroups {
+			group := &rulesets[i].RuleGroups[j]
+			for k := range group.DetectionRules {
+				rule := &group.DetectionRules[k]
+				implied := closure(rule.ObjectName, direct)
+				if len(implied) == 0 {
+					continue
+				}
+				if rule.Metadata == nil {
+					rule.Metadata = &crowler.RuleMetadata{}
+				}
+				rule.Metadata.Implied = implied
+			}
+		}
+	}
+	return report
+}
+
+// parseImplies replaces the implies entries of rule with their objects,
+// once each, and returns the implied objects
+func parseImplies(rule *crowler.DetectionRule) []crowler.ImpliedObject {
+	var implied []crowler.ImpliedObject
+	var names []string
+	for _, entry := range rule.Implies {
+		object, tags := Parse(entry)
+		if object == "" || slices.Contains(names, object) {
+			continue
+		}
+		names = append(names, object)
+		implied = append(implied, crowler.ImpliedObject{Object: object, Confidence: tags.Confidence, Version: tags.Version})
+	}
+	rule.Implies = names
+	return implied
+}
+
+// closure returns the objects object implies, breadth first so each
+// object comes with its shortest chain
+func closure(object string, direct map[string][]crowler.ImpliedObject) []crowler.ImpliedObject {
+	var out []crowler.ImpliedObject
+	seen := map[string]bool{object: true}
+	queue := []crowler.ImpliedObject{{Object: object, Confidence: 100}}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		via := from.Via
+		if from.Object != object {
+			via = append(append([]string(nil), from.Via...), from.Object)
+		}
+		for _, to := range direct[from.Object] {
+			if seen[to.Object] {
+				continue
+			}
+			seen[to.Object] = true
+			to.Confidence = (from.Confidence*to.Confidence + 50) / 100
+			to.Via = via
+			out = append(out, to)
+			queue = append(queue, to)
+		}
+	}
+	return out
+}
+
+// findCycles returns the cycles of the implies relations, each once,
+// starting with its first object by name
+func findCycles(direct map[string][]crowler.ImpliedObject) [][]string {
+	cycles := [][]string{}
+	found := make(map[string]bool)
+	done := make(map[string]bool)
+	var path []string
+	var visit func(object string)
+	visit = func(object string) {
+		if done[object] {
+			return
+		}
+		for i, o := range path {
+			if o == object {
+				cycle := rotate(path[i:])
+				if key := strings.Join(cycle, "\x00"); !found[key] {
+					found[key] = true
+					cycles = append(cycles, cycle)
+				}
+				return
+			}
+		}
+		path = append(path, object)
+		for _, implied := range direct[object] {
+			visit(implied.Object)
+		}
+		path = path[:len(path)-1]
+		done[object] = true
+	}
+
+	objects := make([]string, 0, len(direct))
+	for object := range direct {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+	for _, object := range objects {
+		visit(object)
+	}
+	sort.Slice(cycles, func(i, j int) bool {
+		return strings.Join(cycles[i], "\x00") < strings.Join(cycles[j], "\x00")
+	})
+	return cycles
+}
+
+// rotate returns a copy of cycle starting with its first object by name
+func rotate(cycle []string) []string {
+	first := 0
+	for i, o := range cycle {
+		if o < cycle[first] {
+			first = i
+		}
+	}
+	return append(append([]string(nil), cycle[first:]...), cycle[:first]...)
+}
+
+// Count returns the number of cycles and of missing objects
+func (r *Report) Count() (cycles, missing int) {
+	return len(r.Cycles), len(r.Missing)
+}
+
+// Write writes the report as YAML to path
+func (r *Report) Write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,49 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package license provides helpers to check the license of an upstream
+// rules source against a list of licenses the user is allowed to use.
+package license
+
+import (
+	"strings"
+)
+
+// ParseList parses a comma separated list of license identifiers
+// (for example "MIT,Apache-2.0") and returns the non-empty entries.
+func ParseList(list string) []string {
+	var licenses []string
+	for _, l := range strings.Split(list, ",") {
+		l = strings.TrimSpace(l)
+		if l != "" {
+			licenses = append(licenses, l)
+		}
+	}
+	return licenses
+}
+
+// IsAllowed returns true if license is in the allowed list.
+// An empty allowed list means every license is allowed.
+// Identifiers are compared case-insensitively.
+func IsAllowed(license string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(strings.TrimSpace(license), a) {
+			return true
+		}
+	}
+	return false
+}
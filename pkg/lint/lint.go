@@ -0,0 +1,325 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint finds the detection rules that are valid but unlikely to
+// work as intended: rules without signatures, rules matching only the
+// vendor website, overly broad patterns, duplicate rule names and
+// confidences out of range.
+package lint
+
+import (
+	"fmt"
+	"reflect"
+	"regexp/syntax"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/patterntag"
+)
+
+// The checks of the linter
+const (
+	// CheckEmptyRule flags the rules without signatures
+	CheckEmptyRule = "empty-rule"
+	// CheckWebsiteOnly flags the rules whose only signatures match the
+	// website of the detected object, which the object's own site has
+	// but the sites using it don't
+	CheckWebsiteOnly = "website-only"
+	// CheckBroadPattern flags the page, URL, CSS and network patterns
+	// matching a single character or nothing at all, which match almost
+	// any site
+	CheckBroadPattern = "broad-pattern"
+	// CheckDuplicateName flags the rule names used more than once in a
+	// ruleset, or by different rules. The same rule can be in several
+	// rulesets (e.g. one per category of the object).
+	CheckDuplicateName = "duplicate-name"
+	// CheckConfidence flags the confidences out of 0..MaxConfidence
+	CheckConfidence = "confidence-range"
+)
+
+// Checks lists the checks of the linter
+var Checks = []string{CheckEmptyRule, CheckWebsiteOnly, CheckBroadPattern, CheckDuplicateName, CheckConfidence}
+
+// MinPatternLength is the shortest match of a pattern that isn't broad
+const MinPatternLength = 2
+
+// keyedSections are the sections whose patterns match the value of a
+// key (a header, a meta tag, a JavaScript object...): a broad pattern
+// there is a presence check capturing the version, not a broad rule
+var keyedSections = map[string]bool{
+	"http_header_fields": true,
+	"cookies":            true,
+	"meta_tags":          true,
+	"ssl_patterns":       true,
+	"dns_patterns":       true,
+	"js_patterns":        true,
+}
+
+// Problem is a problem found in a rule
+type Problem struct {
+	File    string
+	Rule    string
+	Check   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: rule %s: %s [%s]", p.File, p.Rule, p.Message, p.Check)
+}
+
+// Linter checks rulesets. The rule names are checked across all the
+// rulesets given to the same Linter.
+type Linter struct {
+	disabled map[string]bool
+	names    map[string]namedRule
+}
+
+// namedRule is the first rule with a name, and its file
+type namedRule struct {
+	file string
+	rule crowler.DetectionRule
+}
+
+// New returns a linter running all the checks but the disabled ones. It
+// returns an error for an unknown check.
+func New(disabled []string) (*Linter, error) {
+	l := &Linter{disabled: make(map[string]bool), names: make(map[string]namedRule)}
+	for _, check := range disabled {
+		check = strings.TrimSpace(check)
+		if check == "" {
+			continue
+		}
+		known := false
+		for _, c := range Checks {
+			known = known || c == check
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown check %q, expected one of %s", check, strings.Join(Checks, ", "))
+		}
+		l.disabled[check] = true
+	}
+	return l, nil
+}
+
+// Check returns the problems of the detection rules of ruleset, read
+// from file
+func (l *Linter) Check(file string, ruleset crowler.Ruleset) []Problem {
+	var problems []Problem
+	add := func(rule, check, format string, args ...any) {
+		if !l.disabled[check] {
+			problems = append(problems, Problem{File: file, Rule: rule, Check: check, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	for _, group := range ruleset.RuleGroups {
+		for _, rule := range group.DetectionRules {
+			if first, ok := l.names[rule.RuleName]; !ok {
+				l.names[rule.RuleName] = namedRule{file, rule}
+			} else if first.file == file || !reflect.DeepEqual(first.rule, rule) {
+				add(rule.RuleName, CheckDuplicateName, "name already used in %s", first.file)
+			}
+
+			patterns := rulePatterns(rule)
+			switch {
+			case len(patterns) == 0 && !hasHashes(rule):
+				add(rule.RuleName, CheckEmptyRule, "no signatures")
+			case rule.Metadata != nil && rule.Metadata.Website != "" && onlyWebsite(rule, patterns):
+				add(rule.RuleName, CheckWebsiteOnly, "only signature is the website %s", rule.Metadata.Website)
+			}
+
+			for _, p := range patterns {
+				if p.pattern == "" || keyedSections[p.section] {
+					continue // presence checks and version captures
+				}
+				if n, ok := minLength(p.pattern); ok && n < MinPatternLength {
+					add(rule.RuleName, CheckBroadPattern, "%s pattern %q can match %d characters", p.section, p.pattern, n)
+				}
+			}
+
+			for _, c := range confidences(rule) {
+				if c.value < 0 || c.value > crowler.MaxConfidence {
+					add(rule.RuleName, CheckConfidence, "%s confidence %g out of 0..%d", c.section, c.value, crowler.MaxConfidence)
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+// sectionPattern is a pattern of a rule with the section holding it
+type sectionPattern struct {
+	section string
+	pattern string
+}
+
+// rulePatterns returns the patterns of the signatures of rule. The
+// signatures without patterns (e.g. a header presence check) count as
+// an empty pattern.
+func rulePatterns(rule crowler.DetectionRule) []sectionPattern {
+	var out []sectionPattern
+	add := func(section string, values []string) {
+		if len(values) == 0 {
+			values = []string{""}
+		}
+		for _, v := range values {
+			out = append(out, sectionPattern{section, v})
+		}
+	}
+	for _, h := range rule.HTTPHeaderFields {
+		add("http_header_fields", h.Value)
+	}
+	for _, c := range rule.Cookies {
+		add("cookies", c.Value)
+	}
+	for _, m := range rule.MetaTags {
+		add("meta_tags", m.Content)
+	}
+	for _, p := range rule.PageContentPatterns {
+		if len(p.Signature)+len(p.Text) > 0 || len(p.MD5Hash)+len(p.SHA256Hash)+len(p.MMH3Hash) == 0 {
+			add("page_content_patterns", append(append([]string(nil), p.Signature...), p.Text...))
+		}
+	}
+	for _, s := range rule.SSLSignatures {
+		add("ssl_patterns", s.Value)
+	}
+	for _, d := range rule.DNSSignatures {
+		add("dns_patterns", d.Value)
+	}
+	for _, u := range rule.URLPatterns {
+		add("url_micro_signatures", []string{u.Signature})
+	}
+	for _, j := range rule.JSPatterns {
+		add("js_patterns", j.Value)
+	}
+	for _, c := range rule.CSSPatterns {
+		add("css_patterns", c.Value)
+	}
+	for _, n := range rule.NetworkPatterns {
+		add("network_patterns", n.Value)
+	}
+	return out
+}
+
+// hasHashes tells if rule has hash signatures (e.g. favicon hashes)
+func hasHashes(rule crowler.DetectionRule) bool {
+	for _, p := range rule.PageContentPatterns {
+		if len(p.MD5Hash)+len(p.SHA256Hash)+len(p.MMH3Hash) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// onlyWebsite tells if all the patterns of rule are URL or link patterns
+// of its website
+func onlyWebsite(rule crowler.DetectionRule, patterns []sectionPattern) bool {
+	if len(patterns) == 0 || hasHashes(rule) {
+		return false
+	}
+	for _, p := range patterns {
+		if p.section != "url_micro_signatures" && p.section != "page_content_patterns" {
+			return false
+		}
+		if !crowler.IsWebsitePattern(p.pattern, rule.Metadata.Website) {
+			return false
+		}
+	}
+	return true
+}
+
+// minLength returns the length of the shortest text matched by pattern,
+// and false if it isn't a valid regex
+func minLength(pattern string) (int, bool) {
+	expr, _ := patterntag.Parse(pattern)
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return 0, false
+	}
+	return minMatch(re.Simplify()), true
+}
+
+func minMatch(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return minMatch(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * minMatch(re.Sub[0])
+	case syntax.OpConcat:
+		n := 0
+		for _, sub := range re.Sub {
+			n += minMatch(sub)
+		}
+		return n
+	case syntax.OpAlternate:
+		n := -1
+		for _, sub := range re.Sub {
+			if m := minMatch(sub); n < 0 || m < n {
+				n = m
+			}
+		}
+		return max(n, 0)
+	}
+	// empty matches, anchors, word boundaries, * and ?
+	return 0
+}
+
+// sectionConfidence is a confidence of a rule with the section holding it
+type sectionConfidence struct {
+	section string
+	value   float32
+}
+
+// confidences returns the confidences of the signatures of rule
+func confidences(rule crowler.DetectionRule) []sectionConfidence {
+	var out []sectionConfidence
+	for _, h := range rule.HTTPHeaderFields {
+		out = append(out, sectionConfidence{"http_header_fields", float32(h.Confidence)})
+	}
+	for _, c := range rule.Cookies {
+		out = append(out, sectionConfidence{"cookies", c.Confidence})
+	}
+	for _, m := range rule.MetaTags {
+		out = append(out, sectionConfidence{"meta_tags", float32(m.Confidence)})
+		for _, c := range m.ContentConfidence {
+			out = append(out, sectionConfidence{"meta_tags", float32(c)})
+		}
+	}
+	for _, p := range rule.PageContentPatterns {
+		out = append(out, sectionConfidence{"page_content_patterns", p.Confidence})
+	}
+	for _, s := range rule.SSLSignatures {
+		out = append(out, sectionConfidence{"ssl_patterns", s.Confidence})
+	}
+	for _, d := range rule.DNSSignatures {
+		out = append(out, sectionConfidence{"dns_patterns", d.Confidence})
+	}
+	for _, u := range rule.URLPatterns {
+		out = append(out, sectionConfidence{"url_micro_signatures", u.Confidence})
+	}
+	for _, j := range rule.JSPatterns {
+		out = append(out, sectionConfidence{"js_patterns", j.Confidence})
+	}
+	for _, c := range rule.CSSPatterns {
+		out = append(out, sectionConfidence{"css_patterns", c.Confidence})
+	}
+	for _, n := range rule.NetworkPatterns {
+		out = append(out, sectionConfidence{"network_patterns", n.Confidence})
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging sets up the leveled logging of the commands: the
+// -quiet, -verbose and -log-format flags, and the fatal errors ending a
+// command with a non-zero exit code.
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// ExitError is the exit code of the commands stopped by an error
+const ExitError = 1
+
+// Flags are the logging flags of a command
+type Flags struct {
+	Quiet   bool
+	Verbose bool
+	// Format is text or json
+	Format string
+}
+
+// AddFlags adds -quiet, -verbose and -log-format to fs. Call Setup once
+// fs is parsed.
+func AddFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	fs.BoolVar(&f.Quiet, "quiet", false, "Only log the warnings and the errors, and no progress (e.g. in CI)")
+	fs.BoolVar(&f.Verbose, "verbose", false, "Also log the debug messages, e.g. how each pattern is converted")
+	fs.StringVar(&f.Format, "log-format", "text", "Format of the log on the standard error: text or json (one JSON object per line)")
+	return f
+}
+
+// Setup makes the logger of the flags the default slog (and log) logger
+func (f *Flags) Setup() error {
+	if f.Quiet && f.Verbose {
+		return fmt.Errorf("-quiet and -verbose can't be used together")
+	}
+	level := slog.LevelInfo
+	switch {
+	case f.Quiet:
+		level = slog.LevelWarn
+	case f.Verbose:
+		level = slog.LevelDebug
+	}
+
+	var handler slog.Handler
+	switch f.Format {
+	case "text", "":
+		handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level, ReplaceAttr: dropTime})
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", f.Format)
+	}
+	slog.SetDefault(slog.New(countingHandler{handler}))
+	return nil
+}
+
+// Status returns w, the writer of the progress messages, or io.Discard
+// with -quiet
+func (f *Flags) Status(w io.Writer) io.Writer {
+	if f.Quiet {
+		return io.Discard
+	}
+	return w
+}
+
+// Fatalf logs an error and exits with ExitError. The error record has
+// the number of warnings logged before it, for the tools parsing the
+// JSON log.
+func Fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...), "exit_code", ExitError, "warnings", warnings.Load())
+	os.Exit(ExitError)
+}
+
+// dropTime removes the time from the text log, the messages of a command
+// are read as it runs
+func dropTime(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.TimeKey && len(groups) == 0 {
+		return slog.Attr{}
+	}
+	return a
+}
+
+// warnings counts the warnings logged
+var warnings atomic.Int64
+
+// countingHandler counts the warnings logged through it
+type countingHandler struct {
+	slog.Handler
+}
+
+func (h countingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelWarn {
+		warnings.Add(1)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h countingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return countingHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h countingHandler) WithGroup(name string) slog.Handler {
+	return countingHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,167 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package manifest describes a conversion: the source the rulesets come
+// from, with its checksum, the converter and the checksum of every file
+// written, so the deployments can verify the rulesets and trace their
+// rules back to their origin.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the manifest file
+const FileName = "manifest.yaml"
+
+// Source is the source of the conversion
+type Source struct {
+	Name string `yaml:"name"`
+	// Path is the local file or directory read. URL or GitHub (as
+	// owner/repo@ref:path) tell where it was downloaded from, if it was.
+	Path    string `yaml:"path"`
+	URL     string `yaml:"url,omitempty"`
+	GitHub  string `yaml:"github,omitempty"`
+	License string `yaml:"license,omitempty"`
+	// SHA256 is the checksum of the source content, for a directory the
+	// checksum of its files as the converter reads them
+	SHA256 string `yaml:"sha256"`
+}
+
+// Converter is the converter that generated the files
+type Converter struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+}
+
+// File is a file written by the conversion, its path relative to the
+// output directory
+type File struct {
+	Path    string `yaml:"path"`
+	SHA256  string `yaml:"sha256"`
+	Ruleset string `yaml:"ruleset,omitempty"`
+}
+
+// Manifest describes a conversion
+type Manifest struct {
+	Source    Source    `yaml:"source"`
+	Converter Converter `yaml:"converter"`
+	CreatedAt string    `yaml:"created_at"`
+	Files     []File    `yaml:"files"`
+}
+
+// New returns a manifest without files for the source converted by the
+// converter called name. The SHA256 of the source is set by the caller,
+// reading it.
+func New(name string, source Source, createdAt string) *Manifest {
+	return &Manifest{
+		Source:    source,
+		Converter: Converter{Name: name, Version: Version()},
+		CreatedAt: createdAt,
+		Files:     []File{},
+	}
+}
+
+// Add records the file written to path (relative to the output
+// directory) with content data, and the name of the ruleset it holds if
+// any
+func (m *Manifest) Add(path string, data []byte, ruleset string) {
+	m.Files = append(m.Files, File{Path: filepath.ToSlash(path), SHA256: Checksum(data), Ruleset: ruleset})
+}
+
+// AddFile records the file at filepath.Join(dir, path), reading it
+func (m *Manifest) AddFile(dir, path string) error {
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return err
+	}
+	m.Add(path, data, "")
+	return nil
+}
+
+// Write writes the manifest as YAML to path, the files sorted by path
+func (m *Manifest) Write(path string) error {
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(m); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
+
+// Read reads the manifest file at path
+func Read(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// Checksum returns the hex encoded SHA-256 of data
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Version returns the version of the converters: the module version,
+// otherwise the VCS revision they were built from, or "devel"
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,286 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package normalize canonicalizes the keys and patterns of the generated
+// rules, so equivalent patterns coming from different sources (or written
+// differently in the same source) can be deduplicated and diffed.
+package normalize
+
+import (
+	"regexp"
+	"strings"
+)
+
+// tagSeparator separates a pattern from the Wappalyzer style tags
+// (\;version:\1, \;confidence:50), which are preserved as-is.
+const tagSeparator = `\;`
+
+// equivalentClasses maps character classes to their shorthand
+var equivalentClasses = map[string]string{
+	`[0-9]`:         `\d`,
+	`[^0-9]`:        `\D`,
+	`[a-zA-Z0-9_]`:  `\w`,
+	`[A-Za-z0-9_]`:  `\w`,
+	`[^a-zA-Z0-9_]`: `\W`,
+	`[^A-Za-z0-9_]`: `\W`,
+}
+
+// equivalentQuantifiers maps counted quantifiers to their shorthand
+var equivalentQuantifiers = map[string]string{
+	`{0,}`:  `*`,
+	`{1,}`:  `+`,
+	`{0,1}`: `?`,
+}
+
+// groupPrefixRe matches the special prefix of a group, e.g. (?: (?i: (?P<n>
+var groupPrefixRe = regexp.MustCompile(`^\?(?:[:=!]|<[=!]|P?<[A-Za-z_][A-Za-z0-9_]*>|[a-zA-Z-]+:)`)
+
+// HeaderKey returns the canonical form of an HTTP header or cookie name.
+// Header names are case-insensitive, so they are lowercased.
+func HeaderKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// Pattern returns the canonical form of a regex pattern:
+//   - redundant leading ^.* and trailing .*$ are removed (patterns are
+//     searched, not fully matched)
+//   - duplicate alternatives such as (a|b|a) are collapsed
+//   - equivalent constructs are rewritten in a single form ([0-9] -> \d,
+//     {1,} -> +, ...)
+//
+// Wappalyzer style tags after \; are kept unchanged. If the normalized
+// pattern no longer compiles while the original did, the original is
+// returned.
+func Pattern(pattern string) string {
+	expr, tags := pattern, ""
+	if i := strings.Index(pattern, tagSeparator); i >= 0 {
+		expr, tags = pattern[:i], pattern[i:]
+	}
+
+	normalized := stripAnchors(strings.TrimSpace(expr))
+	normalized = canonicalize(normalized)
+	normalized = dedupeAlternatives(normalized)
+
+	if _, err := regexp.Compile(normalized); err != nil {
+		if _, origErr := regexp.Compile(expr); origErr == nil {
+			return pattern
+		}
+	}
+
+	return normalized + tags
+}
+
+// Patterns normalizes a list of patterns and removes the duplicates,
+// preserving the order of first appearance.
+func Patterns(patterns []string) []string {
+	if patterns == nil {
+		return nil
+	}
+	out := make([]string, 0, len(patterns))
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		p = Pattern(p)
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// isEscaped returns true if the character at index i is escaped by an
+// odd number of backslashes.
+func isEscaped(s string, i int) bool {
+	n := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// stripAnchors removes the "match anything" prefixes and suffixes that
+// don't change the result of an unanchored search.
+func stripAnchors(p string) string {
+	for _, prefix := range []string{"^.*?", "^.*", ".*?", ".*"} {
+		if strings.HasPrefix(p, prefix) {
+			p = p[len(prefix):]
+			break
+		}
+	}
+	for _, suffix := range []string{".*?$", ".*$", ".*?", ".*"} {
+		if strings.HasSuffix(p, suffix) && !isEscaped(p, len(p)-len(suffix)) {
+			p = p[:len(p)-len(suffix)]
+			break
+		}
+	}
+	if p == "^" || p == "$" {
+		return "" // matches anything, same as an empty pattern
+	}
+	return p
+}
+
+// classEnd returns the index of the ] closing the character class that
+// starts at index i, or -1.
+func classEnd(p string, i int) int {
+	j := i + 1
+	if j < len(p) && p[j] == '^' {
+		j++
+	}
+	if j < len(p) && p[j] == ']' {
+		j++ // a leading ] is a literal
+	}
+	for ; j < len(p); j++ {
+		switch p[j] {
+		case '\\':
+			j++
+		case ']':
+			return j
+		}
+	}
+	return -1
+}
+
+// groupEnd returns the index of the ) closing the group that starts at
+// index i, or -1.
+func groupEnd(p string, i int) int {
+	depth := 0
+	for j := i; j < len(p); j++ {
+		switch p[j] {
+		case '\\':
+			j++
+		case '[':
+			if end := classEnd(p, j); end >= 0 {
+				j = end
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// canonicalize rewrites equivalent character classes and quantifiers
+func canonicalize(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			b.WriteByte(p[i])
+			if i+1 < len(p) {
+				i++
+				b.WriteByte(p[i])
+			}
+			continue
+		case '[':
+			if end := classEnd(p, i); end >= 0 {
+				class := p[i : end+1]
+				if short, ok := equivalentClasses[class]; ok {
+					class = short
+				}
+				b.WriteString(class)
+				i = end
+				continue
+			}
+		case '{':
+			if end := strings.IndexByte(p[i:], '}'); end >= 0 {
+				if short, ok := equivalentQuantifiers[p[i:i+end+1]]; ok {
+					b.WriteString(short)
+					i += end
+					continue
+				}
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// splitAlternatives splits p on the top level | operators
+func splitAlternatives(p string) []string {
+	var alts []string
+	start := 0
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '[':
+			if end := classEnd(p, i); end >= 0 {
+				i = end
+			}
+		case '(':
+			if end := groupEnd(p, i); end >= 0 {
+				i = end
+			}
+		case '|':
+			alts = append(alts, p[start:i])
+			start = i + 1
+		}
+	}
+	return append(alts, p[start:])
+}
+
+// dedupeAlternatives removes duplicate alternatives at every nesting level
+func dedupeAlternatives(p string) string {
+	alts := splitAlternatives(p)
+	out := make([]string, 0, len(alts))
+	seen := make(map[string]bool)
+	for _, alt := range alts {
+		alt = dedupeGroups(alt)
+		if !seen[alt] {
+			seen[alt] = true
+			out = append(out, alt)
+		}
+	}
+	return strings.Join(out, "|")
+}
+
+// dedupeGroups applies dedupeAlternatives to the content of each group
+func dedupeGroups(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			b.WriteByte(p[i])
+			if i+1 < len(p) {
+				i++
+				b.WriteByte(p[i])
+			}
+			continue
+		case '[':
+			if end := classEnd(p, i); end >= 0 {
+				b.WriteString(p[i : end+1])
+				i = end
+				continue
+			}
+		case '(':
+			if end := groupEnd(p, i); end >= 0 {
+				inner := p[i+1 : end]
+				prefix := groupPrefixRe.FindString(inner)
+				b.WriteByte('(')
+				b.WriteString(prefix)
+				b.WriteString(dedupeAlternatives(inner[len(prefix):]))
+				b.WriteByte(')')
+				i = end
+				continue
+			}
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// countedQuantifierRe matches a counted quantifier, e.g. {2} {1,} {1,3}
+var countedQuantifierRe = regexp.MustCompile(`^\{\d+(?:,\d*)?\}`)
+
+const (
+	// pcreFlags are the inline flags PCRE supports
+	pcreFlags = "imsxnJUXu-^"
+	// re2Flags are the inline flags RE2 supports
+	re2Flags = "imsU-"
+)
+
+// Translate returns pattern if it compiles with Go's regexp (RE2
+// syntax), otherwise its translation of the PCRE constructs RE2 lacks:
+//   - possessive quantifiers (a++) and atomic groups ((?>a)) become the
+//     plain ones, they only differ in how the pattern backtracks
+//   - a positive lookahead ending the pattern, or a positive lookbehind
+//     starting it, becomes a plain group: patterns are searched, so the
+//     match is found all the same
+//   - \Z, \h and (?'name'...) are written in RE2 syntax, comments are
+//     removed and the x (free spacing) flag is applied
+//
+// Wappalyzer style tags after \; are kept unchanged. Backreferences,
+// negative and inner lookarounds, \G, \K, conditionals and recursion
+// have no RE2 equivalent: Translate returns an error for them, and for
+// the patterns that still don't compile.
+func Translate(pattern string) (string, error) {
+	expr, tags := pattern, ""
+	if i := strings.Index(pattern, tagSeparator); i >= 0 {
+		expr, tags = pattern[:i], pattern[i:]
+	}
+	if _, err := regexp.Compile(expr); err == nil {
+		return pattern, nil
+	}
+
+	translated, err := translate(expr)
+	if err != nil {
+		return "", err
+	}
+	if _, err := regexp.Compile(translated); err != nil {
+		return "", err
+	}
+	return translated + tags, nil
+}
+
+// translate rewrites the PCRE constructs of p, see Translate
+func translate(p string) (string, error) {
+	var b strings.Builder
+	extended := false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case extended && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			continue
+		case extended && c == '#':
+			for i < len(p) && p[i] != '\n' {
+				i++
+			}
+			continue
+
+		case c == '\\':
+			if i+1 >= len(p) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			switch e := p[i]; {
+			case e >= '1' && e <= '9', e == 'k', e == 'g':
+				return "", fmt.Errorf("backreference \\%c has no RE2 equivalent", e)
+			case e == 'G', e == 'K':
+				return "", fmt.Errorf("\\%c has no RE2 equivalent", e)
+			case e == 'Z':
+				b.WriteString(`(?:\n?\z)`)
+			case e == 'h':
+				b.WriteString(`[\t \x{A0}]`)
+			case e == 'Q':
+				// quoted text is copied up to \E
+				end := strings.Index(p[i:], `\E`)
+				if end < 0 {
+					end = len(p) - i
+				}
+				b.WriteString(p[i-1 : i+end])
+				i += end - 1
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+			continue
+
+		case c == '[':
+			end := classEnd(p, i)
+			if end < 0 {
+				return "", fmt.Errorf("missing closing ]")
+			}
+			b.WriteString(strings.ReplaceAll(p[i:end+1], `\h`, `\t \x{A0}`))
+			i = end
+			continue
+
+		case c == '{':
+			if q := countedQuantifierRe.FindString(p[i:]); q != "" {
+				b.WriteString(q)
+				i += len(q) - 1
+				if i+1 < len(p) && p[i+1] == '+' {
+					i++ // possessive
+				}
+				continue
+			}
+
+		case c == '*' || c == '+' || c == '?':
+			b.WriteByte(c)
+			if i+1 < len(p) && p[i+1] == '+' {
+				i++ // possessive
+			}
+			continue
+
+		case c == '(' && i+1 < len(p) && p[i+1] == '?':
+			rest := p[i+2:]
+			switch {
+			case strings.HasPrefix(rest, ">"):
+				b.WriteString("(?:")
+				i += 2
+			case strings.HasPrefix(rest, "#"):
+				end := strings.IndexByte(rest, ')')
+				if end < 0 {
+					return "", fmt.Errorf("missing closing ) of comment")
+				}
+				i += 2 + end
+			case strings.HasPrefix(rest, "="):
+				if groupEnd(p, i) != len(p)-1 {
+					return "", fmt.Errorf("lookahead has no RE2 equivalent")
+				}
+				b.WriteString("(?:")
+				i += 2
+			case strings.HasPrefix(rest, "<="):
+				if i != 0 {
+					return "", fmt.Errorf("lookbehind has no RE2 equivalent")
+				}
+				b.WriteString("(?:")
+				i += 3
+			case strings.HasPrefix(rest, "!"), strings.HasPrefix(rest, "<!"):
+				return "", fmt.Errorf("negative lookaround has no RE2 equivalent")
+			case strings.HasPrefix(rest, "'"):
+				end := strings.IndexByte(rest[1:], '\'')
+				if end < 0 {
+					return "", fmt.Errorf("missing closing ' of group name")
+				}
+				b.WriteString("(?P<" + rest[1:1+end] + ">")
+				i += 2 + end + 1
+			case strings.HasPrefix(rest, "<"), strings.HasPrefix(rest, "P<"), strings.HasPrefix(rest, ":"):
+				b.WriteString("(?")
+				i++
+			case strings.HasPrefix(rest, "("):
+				return "", fmt.Errorf("conditional has no RE2 equivalent")
+			default:
+				flags := rest
+				if end := strings.IndexAny(rest, ":)"); end >= 0 {
+					flags = rest[:end]
+				}
+				if flags == "" || strings.Trim(flags, pcreFlags) != "" {
+					return "", fmt.Errorf("group (?%s has no RE2 equivalent", flags)
+				}
+				if strings.Contains(flags, "x") && !strings.Contains(flags, "-") {
+					extended = true
+				}
+				kept := strings.Map(func(r rune) rune {
+					if strings.ContainsRune(re2Flags, r) {
+						return r
+					}
+					return -1
+				}, flags)
+				kept = strings.TrimSuffix(kept, "-")
+				i += 2 + len(flags)
+				if i < len(p) && p[i] == ':' {
+					b.WriteString("(?" + kept + ":")
+				} else if kept != "" {
+					b.WriteString("(?" + kept + ")")
+				}
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package patterntag parses the tags Wappalyzer appends to its patterns,
+// e.g. jquery-([\d.]+)\.js\;version:\1, and moves them out of the
+// patterns of the generated rules, which must be plain regexes. Format
+// puts them back when the rules are exported to Wappalyzer.
+package patterntag
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// separator separates a pattern from its tags and the tags from each other
+const separator = `\;`
+
+// Tags are the tags of a pattern
+type Tags struct {
+	// Version is the template of the version, e.g. \1 or \1?4:3
+	Version string
+	// Confidence is the confidence of the pattern (0-100), -1 if the
+	// pattern has no confidence tag
+	Confidence int
+}
+
+// Parse splits a pattern into the regex and its tags. Unknown tags are
+// dropped.
+func Parse(pattern string) (string, Tags) {
+	parts := strings.Split(pattern, separator)
+	tags := Tags{Confidence: -1}
+	for _, tag := range parts[1:] {
+		name, value, _ := strings.Cut(tag, ":")
+		switch strings.TrimSpace(name) {
+		case "version":
+			tags.Version = value
+		case "confidence":
+			if c, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && c >= 0 && c <= 100 {
+				tags.Confidence = c
+			}
+		}
+	}
+	return parts[0], tags
+}
+
+// Format appends tags to a pattern, the reverse of Parse. A negative
+// confidence isn't written.
+func Format(expr string, tags Tags) string {
+	if tags.Version != "" {
+		expr += separator + "version:" + tags.Version
+	}
+	if tags.Confidence >= 0 {
+		expr += separator + "confidence:" + strconv.Itoa(tags.Confidence)
+	}
+	return expr
+}
+
+// Confidence converts a Wappalyzer confidence (0-100) to the CROWler
+// scale
+func Confidence(confidence int) float32 {
+	return float32(confidence) * crowler.MaxConfidence / 100
+}
+
+// SourceConfidence converts a CROWler confidence to the Wappalyzer
+// scale (0-100)
+func SourceConfidence(confidence float32) int {
+	return int(math.Round(float64(confidence) * 100 / crowler.MaxConfidence))
+}
+
+// roundConfidence converts a Wappalyzer confidence for the signatures
+// with an integer confidence
+func roundConfidence(confidence int) int {
+	return int(math.Round(float64(Confidence(confidence))))
+}
+
+// StripRule removes the tags from the patterns of a rule, records the
+// version tags in the rule Version list and sets the confidence of the
+// signatures with a confidence tag (the highest one if a signature has
+// several tagged patterns, the meta tags also keep the confidence of each
+// pattern). The other signatures keep their confidence.
+func StripRule(rule *crowler.DetectionRule) {
+	// strip returns the highest confidence tag of patterns, or -1
+	strip := func(section, key string, patterns []string) int {
+		confidence := -1
+		for i, p := range patterns {
+			expr, tags := Parse(p)
+			patterns[i] = expr
+			if tags.Confidence > confidence {
+				confidence = tags.Confidence
+			}
+			if tags.Version != "" {
+				rule.Version = append(rule.Version, crowler.VersionSignature{
+					Section: section,
+					Key:     key,
+					Pattern: expr,
+					Version: tags.Version,
+				})
+			}
+		}
+		return confidence
+	}
+
+	for i := range rule.HTTPHeaderFields {
+		h := &rule.HTTPHeaderFields[i]
+		if c := strip("http_header_fields", h.Key, h.Value); c >= 0 {
+			h.Confidence = roundConfidence(c)
+		}
+	}
+	for i := range rule.Cookies {
+		c := &rule.Cookies[i]
+		if conf := strip("cookies", c.Name, c.Value); conf >= 0 {
+			c.Confidence = Confidence(conf)
+		}
+	}
+	// The alternatives of a meta tag can have different confidences, the
+	// tag gets the highest one and keeps them all in ContentConfidence
+	for i := range rule.MetaTags {
+		m := &rule.MetaTags[i]
+		confidences := make([]int, len(m.Content))
+		tagged, same := false, true
+		for j := range m.Content {
+			confidences[j] = m.Confidence
+			if c := strip("meta_tags", m.Name, m.Content[j:j+1]); c >= 0 {
+				confidences[j] = roundConfidence(c)
+				tagged = true
+			}
+			same = same && confidences[j] == confidences[0]
+		}
+		if !tagged {
+			continue
+		}
+		m.Confidence = confidences[0]
+		for _, c := range confidences {
+			m.Confidence = max(m.Confidence, c)
+		}
+		if !same {
+			m.ContentConfidence = confidences
+		}
+	}
+	for i := range rule.PageContentPatterns {
+		p := &rule.PageContentPatterns[i]
+		c := strip("page_content_patterns", p.Key, p.Signature)
+		if t := strip("page_content_patterns", p.Key, p.Text); t > c {
+			c = t
+		}
+		if c >= 0 {
+			p.Confidence = Confidence(c)
+		}
+	}
+	for i := range rule.SSLSignatures {
+		s := &rule.SSLSignatures[i]
+		if c := strip("ssl_patterns", s.Key, s.Value); c >= 0 {
+			s.Confidence = Confidence(c)
+		}
+	}
+	for i := range rule.DNSSignatures {
+		d := &rule.DNSSignatures[i]
+		if c := strip("dns_patterns", d.Key, d.Value); c >= 0 {
+			d.Confidence = Confidence(c)
+		}
+	}
+	for i := range rule.URLPatterns {
+		u := &rule.URLPatterns[i]
+		urls := []string{u.Signature}
+		if c := strip("url_micro_signatures", "", urls); c >= 0 {
+			u.Confidence = Confidence(c)
+		}
+		u.Signature = urls[0]
+	}
+	for i := range rule.JSPatterns {
+		j := &rule.JSPatterns[i]
+		if c := strip("js_patterns", j.Name, j.Value); c >= 0 {
+			j.Confidence = Confidence(c)
+		}
+	}
+	for i := range rule.CSSPatterns {
+		c := &rule.CSSPatterns[i]
+		if conf := strip("css_patterns", "", c.Value); conf >= 0 {
+			c.Confidence = Confidence(conf)
+		}
+	}
+	for i := range rule.NetworkPatterns {
+		n := &rule.NetworkPatterns[i]
+		if c := strip("network_patterns", n.Key, n.Value); c >= 0 {
+			n.Confidence = Confidence(c)
+		}
+	}
+}
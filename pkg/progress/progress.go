@@ -0,0 +1,202 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress makes the conversions of large sources observable: a
+// periodic log of the items processed by the running step, and a summary
+// of the generated rules per category.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// Reporter logs the progress of the running step at regular intervals. A
+// nil Reporter reports nothing.
+type Reporter struct {
+	w        io.Writer
+	interval time.Duration
+
+	step  string
+	total int
+	start time.Time
+	done  atomic.Int64
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// New returns a reporter writing to w every interval, or nil if interval
+// isn't positive
+func New(w io.Writer, interval time.Duration) *Reporter {
+	if interval <= 0 {
+		return nil
+	}
+	return &Reporter{w: w, interval: interval}
+}
+
+// Start stops the running step and starts step, with total items (0 if
+// unknown). Nothing is logged for the steps shorter than the interval.
+func (r *Reporter) Start(step string, total int) {
+	if r == nil {
+		return
+	}
+	r.Stop()
+	r.step, r.total, r.start = step, total, time.Now()
+	r.done.Store(0)
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go r.run(r.stop)
+}
+
+// Add counts n more items processed by the step. It's safe for
+// concurrent use.
+func (r *Reporter) Add(n int) {
+	if r != nil {
+		r.done.Add(int64(n))
+	}
+}
+
+// Stop stops the running step
+func (r *Reporter) Stop() {
+	if r == nil || r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.wg.Wait()
+	r.stop = nil
+}
+
+func (r *Reporter) run(stop chan struct{}) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			done := r.done.Load()
+			elapsed := time.Since(r.start).Round(time.Second)
+			if r.total > 0 {
+				fmt.Fprintf(r.w, "%s: %d/%d (%.0f%%), %s elapsed\n", r.step, done, r.total, float64(done)*100/float64(r.total), elapsed)
+			} else {
+				fmt.Fprintf(r.w, "%s: %d processed, %s elapsed\n", r.step, done, elapsed)
+			}
+		}
+	}
+}
+
+// Stats are the rules and signatures of a category
+type Stats struct {
+	Rules      int
+	Signatures int
+}
+
+// Summary sums up a conversion: the rules generated per category (per
+// ruleset for the sources without categories), and the totals set by the
+// caller
+type Summary struct {
+	Categories map[string]*Stats
+
+	// Processed is the number of source items (technologies, rules,
+	// templates...) converted, if the converter counts them
+	Processed int
+	Rulesets  int
+	Rules     int
+	// Translated and Dropped are the patterns translated to RE2 and the
+	// ones removed from the rules
+	Translated int
+	Dropped    int
+	// Written and Unchanged are the ruleset files written and the ones
+	// left as they were
+	Written   int
+	Unchanged int
+	// DryRun tells that nothing was written, Written are the files that
+	// would have been
+	DryRun bool
+}
+
+// NewSummary returns an empty summary
+func NewSummary() *Summary {
+	return &Summary{Categories: make(map[string]*Stats)}
+}
+
+// Add counts the rules of ruleset
+func (s *Summary) Add(ruleset crowler.Ruleset) {
+	s.Rulesets++
+	for _, group := range ruleset.RuleGroups {
+		if len(group.DetectionRules) == 0 {
+			continue
+		}
+		category := group.Category
+		if category == "" {
+			category = ruleset.RulesetName
+		}
+		stats, ok := s.Categories[category]
+		if !ok {
+			stats = &Stats{}
+			s.Categories[category] = stats
+		}
+		for _, rule := range group.DetectionRules {
+			stats.Rules++
+			stats.Signatures += signatures(rule)
+		}
+		s.Rules += len(group.DetectionRules)
+	}
+}
+
+// Write writes the summary to w, the categories sorted by name
+func (s *Summary) Write(w io.Writer) error {
+	categories := make([]string, 0, len(s.Categories))
+	for category := range s.Categories {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "category\trules\tsignatures")
+	for _, category := range categories {
+		stats := s.Categories[category]
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", category, stats.Rules, stats.Signatures)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	processed := ""
+	if s.Processed > 0 {
+		processed = fmt.Sprintf("%d source items, ", s.Processed)
+	}
+	written := "written"
+	if s.DryRun {
+		written = "to write (dry run)"
+	}
+	_, err := fmt.Fprintf(w, "\nConverted %s%d rules in %d rulesets, %d patterns translated to RE2 and %d dropped, %d files %s and %d unchanged.\n",
+		processed, s.Rules, s.Rulesets, s.Translated, s.Dropped, s.Written, written, s.Unchanged)
+	return err
+}
+
+// signatures returns the number of signatures of rule
+func signatures(rule crowler.DetectionRule) int {
+	return len(rule.HTTPHeaderFields) + len(rule.Cookies) + len(rule.MetaTags) + len(rule.PageContentPatterns) +
+		len(rule.SSLSignatures) + len(rule.DNSSignatures) + len(rule.URLPatterns) +
+		len(rule.JSPatterns) + len(rule.CSSPatterns) + len(rule.NetworkPatterns)
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push uploads the generated rulesets to the ruleset API of a
+// running CROWler engine, instead of copying the files to its rules
+// directory.
+package push
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultPath is the path of the ruleset API, used when the URL of the
+// engine has none
+const DefaultPath = "/v1/rulesets"
+
+// TokenEnv is the environment variable holding the default API token, so
+// the token isn't in the command line
+const TokenEnv = "CROWLER_API_TOKEN"
+
+// Client uploads rulesets to a CROWler engine
+type Client struct {
+	// URL is the endpoint the rulesets are posted to
+	URL   string
+	token string
+	http  *http.Client
+}
+
+// New returns the client of the engine at rawURL (e.g.
+// https://crowler-api:8080, its ruleset API then being at DefaultPath),
+// authenticated with token if not empty
+func New(rawURL, token string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q, expected http(s)://host[:port][/path]", rawURL)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = DefaultPath
+	}
+	return &Client{URL: u.String(), token: token, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+// Push posts a ruleset, encoded as data with contentType
+func (c *Client) Push(data []byte, contentType string) error {
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Preview writes the request Push would send, for a dry run
+func (c *Client) Preview(w io.Writer, name string, data []byte, contentType string) error {
+	auth := ""
+	if c.token != "" {
+		auth = ", with the token"
+	}
+	_, err := fmt.Fprintf(w, "Would POST ruleset %s to %s (%s, %d bytes%s)\n", name, c.URL, contentType, len(data), auth)
+	return err
+}
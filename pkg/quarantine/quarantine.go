@@ -0,0 +1,297 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quarantine compiles the patterns of the generated rules, as the
+// CROWler (a Go, RE2 based engine) will do. The PCRE patterns of the
+// sources (lookarounds, possessive quantifiers, ...) are translated when
+// possible, the others are removed from the rules and reported, instead
+// of writing rules the CROWler rejects.
+package quarantine
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/normalize"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the report file
+const FileName = "quarantine-report.yaml"
+
+// Policy tells what to do with the patterns that can't be translated to
+// RE2. It's a flag.Value, the zero value is PolicyQuarantine.
+type Policy string
+
+const (
+	// PolicyQuarantine removes the patterns from the rules and reports them
+	PolicyQuarantine Policy = "quarantine"
+	// PolicyKeep keeps the patterns in the rules and reports them
+	PolicyKeep Policy = "keep"
+	// PolicyFail stops the conversion
+	PolicyFail Policy = "fail"
+)
+
+// PolicyUsage is the usage of the -invalid-patterns flag
+const PolicyUsage = "What to do with the patterns that can't be translated to RE2: quarantine, keep or fail (default quarantine)"
+
+func (p *Policy) String() string {
+	if p == nil || *p == "" {
+		return string(PolicyQuarantine)
+	}
+	return string(*p)
+}
+
+func (p *Policy) Set(value string) error {
+	switch policy := Policy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case PolicyQuarantine, PolicyKeep, PolicyFail:
+		*p = policy
+		return nil
+	}
+	return fmt.Errorf("invalid policy %q, expected quarantine, keep or fail", value)
+}
+
+// Pattern is a pattern of a rule translated or quarantined
+type Pattern struct {
+	Ruleset string `yaml:"ruleset"`
+	Rule    string `yaml:"rule"`
+	// Section is the section of the rule holding the pattern, e.g.
+	// http_header_fields, and Key the key of its signature
+	Section string `yaml:"section"`
+	Key     string `yaml:"key,omitempty"`
+	Pattern string `yaml:"pattern"`
+	// Translation is the RE2 translation of the pattern, Error why it
+	// has none
+	Translation string `yaml:"translation,omitempty"`
+	Error       string `yaml:"error,omitempty"`
+}
+
+// Report collects the translated and the quarantined patterns
+type Report struct {
+	Source      string    `yaml:"source,omitempty"`
+	Translated  []Pattern `yaml:"translated"`
+	Quarantined []Pattern `yaml:"quarantined"`
+
+	policy  Policy
+	ruleset string
+	rule    string
+}
+
+// NewReport returns an empty report, applying policy to the patterns
+// that can't be translated
+func NewReport(source string, policy Policy) *Report {
+	return &Report{Source: source, Translated: []Pattern{}, Quarantined: []Pattern{}, policy: policy}
+}
+
+// Count returns the number of translated and quarantined patterns
+func (r *Report) Count() (translated, quarantined int) {
+	return len(r.Translated), len(r.Quarantined)
+}
+
+// Check translates the patterns of the detection rules of ruleset, and
+// applies the policy to those without a translation. The signatures left
+// without patterns are removed. It returns an error with PolicyFail.
+func (r *Report) Check(ruleset *crowler.Ruleset) error {
+	r.ruleset = ruleset.RulesetName
+	for i := range ruleset.RuleGroups {
+		rules := ruleset.RuleGroups[i].DetectionRules
+		for j := range rules {
+			r.rule = rules[j].RuleName
+			r.checkRule(&rules[j])
+		}
+	}
+	if r.policy == PolicyFail && len(r.Quarantined) > 0 {
+		p := r.Quarantined[0]
+		return fmt.Errorf("rule %s: %s pattern %q: %s", p.Rule, p.Section, p.Pattern, p.Error)
+	}
+	return nil
+}
+
+// pattern returns the RE2 form of the pattern p of the signature key in
+// section, and false if it's quarantined
+func (r *Report) pattern(section, key, p string) (string, bool) {
+	translated, err := normalize.Translate(p)
+	switch {
+	case err != nil:
+		slog.Debug("Quarantined pattern", "rule", r.rule, "section", section, "key", key, "pattern", p, "error", err)
+		r.Quarantined = append(r.Quarantined, Pattern{
+			Ruleset: r.ruleset, Rule: r.rule, Section: section, Key: key, Pattern: p, Error: err.Error(),
+		})
+		return p, r.policy != PolicyQuarantine
+	case translated != p:
+		slog.Debug("Translated pattern", "rule", r.rule, "section", section, "key", key, "pattern", p, "translation", translated)
+		r.Translated = append(r.Translated, Pattern{
+			Ruleset: r.ruleset, Rule: r.rule, Section: section, Key: key, Pattern: p, Translation: translated,
+		})
+	}
+	return translated, true
+}
+
+// patterns applies pattern to a list of patterns, returning the kept ones
+// and false if some were quarantined. An empty list is returned as is.
+func (r *Report) patterns(section, key string, patterns []string) ([]string, bool) {
+	if len(patterns) == 0 {
+		return patterns, true
+	}
+	out := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if translated, ok := r.pattern(section, key, p); ok {
+			out = append(out, translated)
+		}
+	}
+	return out, len(out) == len(patterns)
+}
+
+func (r *Report) checkRule(rule *crowler.DetectionRule) {
+	headers := rule.HTTPHeaderFields[:0]
+	for _, h := range rule.HTTPHeaderFields {
+		var ok bool
+		if h.Value, ok = r.patterns("http_header_fields", h.Key, h.Value); ok || len(h.Value) > 0 {
+			headers = append(headers, h)
+		}
+	}
+	rule.HTTPHeaderFields = headers
+
+	cookies := rule.Cookies[:0]
+	for _, c := range rule.Cookies {
+		var ok bool
+		if c.Value, ok = r.patterns("cookies", c.Name, c.Value); ok || len(c.Value) > 0 {
+			cookies = append(cookies, c)
+		}
+	}
+	rule.Cookies = cookies
+
+	metaTags := rule.MetaTags[:0]
+	for _, m := range rule.MetaTags {
+		if len(m.Content) == 0 {
+			metaTags = append(metaTags, m)
+			continue
+		}
+		content := make([]string, 0, len(m.Content))
+		var confidence []int
+		for i, p := range m.Content {
+			translated, ok := r.pattern("meta_tags", m.Name, p)
+			if !ok {
+				continue
+			}
+			content = append(content, translated)
+			if len(m.ContentConfidence) == len(m.Content) {
+				confidence = append(confidence, m.ContentConfidence[i])
+			}
+		}
+		if len(content) == 0 {
+			continue
+		}
+		m.Content, m.ContentConfidence = content, confidence
+		metaTags = append(metaTags, m)
+	}
+	rule.MetaTags = metaTags
+
+	pageContent := rule.PageContentPatterns[:0]
+	for _, p := range rule.PageContentPatterns {
+		signature, okSignature := r.patterns("page_content_patterns", p.Key, p.Signature)
+		text, okText := r.patterns("page_content_patterns", p.Key, p.Text)
+		p.Signature, p.Text = signature, text
+		if !okSignature || !okText {
+			if len(p.Signature)+len(p.Text)+len(p.MD5Hash)+len(p.SHA256Hash)+len(p.MMH3Hash) == 0 {
+				continue
+			}
+		}
+		pageContent = append(pageContent, p)
+	}
+	rule.PageContentPatterns = pageContent
+
+	ssl := rule.SSLSignatures[:0]
+	for _, s := range rule.SSLSignatures {
+		var ok bool
+		if s.Value, ok = r.patterns("ssl_patterns", s.Key, s.Value); ok || len(s.Value) > 0 {
+			ssl = append(ssl, s)
+		}
+	}
+	rule.SSLSignatures = ssl
+
+	dns := rule.DNSSignatures[:0]
+	for _, d := range rule.DNSSignatures {
+		var ok bool
+		if d.Value, ok = r.patterns("dns_patterns", d.Key, d.Value); ok || len(d.Value) > 0 {
+			dns = append(dns, d)
+		}
+	}
+	rule.DNSSignatures = dns
+
+	urls := rule.URLPatterns[:0]
+	for _, u := range rule.URLPatterns {
+		var ok bool
+		if u.Signature, ok = r.pattern("url_micro_signatures", "", u.Signature); ok {
+			urls = append(urls, u)
+		}
+	}
+	rule.URLPatterns = urls
+
+	js := rule.JSPatterns[:0]
+	for _, j := range rule.JSPatterns {
+		var ok bool
+		if j.Value, ok = r.patterns("js_patterns", j.Name, j.Value); ok || len(j.Value) > 0 {
+			js = append(js, j)
+		}
+	}
+	rule.JSPatterns = js
+
+	css := rule.CSSPatterns[:0]
+	for _, c := range rule.CSSPatterns {
+		var ok bool
+		if c.Value, ok = r.patterns("css_patterns", "", c.Value); ok || len(c.Value) > 0 {
+			css = append(css, c)
+		}
+	}
+	rule.CSSPatterns = css
+
+	network := rule.NetworkPatterns[:0]
+	for _, n := range rule.NetworkPatterns {
+		var ok bool
+		if n.Value, ok = r.patterns("network_patterns", n.Key, n.Value); ok || len(n.Value) > 0 {
+			network = append(network, n)
+		}
+	}
+	rule.NetworkPatterns = network
+
+	versions := rule.Version[:0]
+	for _, v := range rule.Version {
+		var ok bool
+		if v.Pattern, ok = r.pattern("version", v.Key, v.Pattern); ok {
+			versions = append(versions, v)
+		}
+	}
+	rule.Version = versions
+}
+
+// Write writes the report as YAML to path
+func (r *Report) Write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,257 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rulediff compares two sets of CROWler rulesets, e.g. the
+// rulesets deployed and a fresh conversion of an updated source, and
+// lists the detection rules added, removed and changed, field by field.
+package rulediff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+)
+
+// The kinds of change of a rule
+const (
+	Added   = "added"
+	Removed = "removed"
+	Changed = "changed"
+)
+
+// FieldChange lists the values of a rule field removed and added. The
+// values are the JSON encoding of a list item (a signature) or of the
+// whole field.
+type FieldChange struct {
+	Field   string   `json:"field"`
+	Removed []string `json:"removed,omitempty"`
+	Added   []string `json:"added,omitempty"`
+}
+
+// RuleChange is a detection rule added, removed or changed
+type RuleChange struct {
+	Kind    string `json:"kind"`
+	Ruleset string `json:"ruleset"`
+	Group   string `json:"group"`
+	Rule    string `json:"rule"`
+	Object  string `json:"object,omitempty"`
+	// Fields are the changed fields of a changed rule
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// Diff is the result of a comparison
+type Diff struct {
+	Changes   []RuleChange `json:"changes"`
+	Added     int          `json:"added"`
+	Removed   int          `json:"removed"`
+	Changed   int          `json:"changed"`
+	Unchanged int          `json:"unchanged"`
+}
+
+// ruleKey identifies a rule by its ruleset, group and name, the same rule
+// can be in several groups (e.g. one per category)
+type ruleKey struct {
+	ruleset, group, rule string
+}
+
+func index(rulesets []crowler.Ruleset) map[ruleKey]crowler.DetectionRule {
+	rules := make(map[ruleKey]crowler.DetectionRule)
+	for _, ruleset := range rulesets {
+		for _, group := range ruleset.RuleGroups {
+			for _, rule := range group.DetectionRules {
+				rules[ruleKey{ruleset.RulesetName, group.GroupName, rule.RuleName}] = rule
+			}
+		}
+	}
+	return rules
+}
+
+// Compare compares the detection rules of the rulesets before and after
+// an update. The changes are sorted by ruleset, group and rule.
+func Compare(before, after []crowler.Ruleset) (Diff, error) {
+	var d Diff
+	oldRules, newRules := index(before), index(after)
+
+	keys := make([]ruleKey, 0, len(oldRules)+len(newRules))
+	for key := range oldRules {
+		keys = append(keys, key)
+	}
+	for key := range newRules {
+		if _, ok := oldRules[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.ruleset != b.ruleset {
+			return a.ruleset < b.ruleset
+		}
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		return a.rule < b.rule
+	})
+
+	for _, key := range keys {
+		oldRule, inOld := oldRules[key]
+		newRule, inNew := newRules[key]
+		change := RuleChange{Ruleset: key.ruleset, Group: key.group, Rule: key.rule}
+		switch {
+		case !inOld:
+			change.Kind, change.Object = Added, newRule.ObjectName
+			d.Added++
+		case !inNew:
+			change.Kind, change.Object = Removed, oldRule.ObjectName
+			d.Removed++
+		default:
+			fields, err := compareRules(oldRule, newRule)
+			if err != nil {
+				return d, fmt.Errorf("error comparing rule %s: %v", key.rule, err)
+			}
+			if len(fields) == 0 {
+				d.Unchanged++
+				continue
+			}
+			change.Kind, change.Object, change.Fields = Changed, newRule.ObjectName, fields
+			d.Changed++
+		}
+		d.Changes = append(d.Changes, change)
+	}
+	return d, nil
+}
+
+// fieldValues returns the values of the fields of a rule: the items of
+// the list fields and the value of the others, JSON encoded
+func fieldValues(rule crowler.DetectionRule) (map[string][]string, error) {
+	// Keep the < and > of the patterns readable
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(rule); err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		return nil, err
+	}
+	values := make(map[string][]string, len(fields))
+	for field, raw := range fields {
+		var items []json.RawMessage
+		if err := json.Unmarshal(raw, &items); err != nil {
+			values[field] = []string{string(raw)}
+			continue
+		}
+		for _, item := range items {
+			values[field] = append(values[field], string(item))
+		}
+	}
+	return values, nil
+}
+
+// compareRules returns the fields of two versions of a rule that differ,
+// sorted by name. The list items are compared regardless of their order.
+func compareRules(before, after crowler.DetectionRule) ([]FieldChange, error) {
+	oldValues, err := fieldValues(before)
+	if err != nil {
+		return nil, err
+	}
+	newValues, err := fieldValues(after)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(oldValues)+len(newValues))
+	for field := range oldValues {
+		fields = append(fields, field)
+	}
+	for field := range newValues {
+		if _, ok := oldValues[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []FieldChange
+	for _, field := range fields {
+		change := FieldChange{
+			Field:   field,
+			Removed: missing(oldValues[field], newValues[field]),
+			Added:   missing(newValues[field], oldValues[field]),
+		}
+		if len(change.Removed) > 0 || len(change.Added) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// missing returns the values of a not in b, counting the duplicates
+func missing(a, b []string) []string {
+	count := make(map[string]int, len(b))
+	for _, v := range b {
+		count[v]++
+	}
+	var out []string
+	for _, v := range a {
+		if count[v] > 0 {
+			count[v]--
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// Write writes the changes in a readable form: a line per rule, starting
+// with + (added), - (removed) or ~ (changed), the removed and added values
+// of the changed fields, then a summary
+func (d Diff) Write(w io.Writer) error {
+	var b strings.Builder
+	for _, c := range d.Changes {
+		mark := map[string]string{Added: "+", Removed: "-", Changed: "~"}[c.Kind]
+		fmt.Fprintf(&b, "%s %s/%s/%s", mark, c.Ruleset, c.Group, c.Rule)
+		if c.Object != "" {
+			fmt.Fprintf(&b, " (%s)", c.Object)
+		}
+		b.WriteString("\n")
+		for _, f := range c.Fields {
+			fmt.Fprintf(&b, "    %s:\n", f.Field)
+			for _, v := range f.Removed {
+				fmt.Fprintf(&b, "      - %s\n", v)
+			}
+			for _, v := range f.Added {
+				fmt.Fprintf(&b, "      + %s\n", v)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "%d added, %d removed, %d changed, %d unchanged detection rules\n", d.Added, d.Removed, d.Changed, d.Unchanged)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the changes as JSON
+func (d Diff) WriteJSON(w io.Writer) error {
+	if d.Changes == nil {
+		d.Changes = []RuleChange{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
@@ -0,0 +1,200 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rulename names the detection rules after a template (e.g.
+// detect_{{.Source}}_{{.Slug}}, so the rules of different sources don't
+// collide in the same CROWler), and makes the names unique: a name
+// already used by a different rule gets a numeric suffix, and the
+// renamed rules are reported.
+package rulename
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the default name of the report file
+const FileName = "rule-name-report.yaml"
+
+// Usage is the usage of the -rule-name-template flag
+const Usage = "Template of the detection rule names, e.g. 'detect_{{.Source}}_{{.Slug}}' (fields Source, Slug, Object, Category, Group, Ruleset and Name, default the names the converter gives)"
+
+// Fields are the fields of the template of a rule. They are slugs but
+// for Object, and the names are without the namespace.
+type Fields struct {
+	// Source is the name of the source, e.g. wappalyzer_technologies_json
+	Source string
+	// Slug is the name of the detected object, e.g. nginx, Object the
+	// name as is
+	Slug   string
+	Object string
+	// Category is the category of the rule group, or uncategorized
+	Category string
+	// Group and Ruleset are the names of the rule group and the ruleset
+	Group   string
+	Ruleset string
+	// Name is the name the converter gives the rule
+	Name string
+}
+
+// Renamed is a rule whose name was already used by a different rule
+type Renamed struct {
+	Ruleset string `yaml:"ruleset"`
+	Object  string `yaml:"object"`
+	Name    string `yaml:"name"`
+	Renamed string `yaml:"renamed"`
+	// CollidesWith is the ruleset of the rule having the name first
+	CollidesWith string `yaml:"collides_with"`
+}
+
+// Report lists the renamed rules
+type Report struct {
+	Source  string    `yaml:"source,omitempty"`
+	Renamed []Renamed `yaml:"renamed"`
+}
+
+// Namer names the detection rules
+type Namer struct {
+	template  *template.Template
+	source    string
+	namespace string
+}
+
+// New returns the namer of the template text, keeping the names the
+// converter gives if it's empty. The names get the namespace prefix.
+func New(text, source, namespace string) (*Namer, error) {
+	n := &Namer{source: source, namespace: namespace}
+	if strings.TrimSpace(text) == "" {
+		return n, nil
+	}
+	var err error
+	if n.template, err = template.New("rule-name-template").Option("missingkey=error").Parse(text); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// namedRule is the first rule having a name, and its ruleset
+type namedRule struct {
+	ruleset string
+	rule    crowler.DetectionRule
+}
+
+// Apply names the detection rules of rulesets and returns the report of
+// the renamed ones. As the linter, it allows the same rule in several
+// rulesets (e.g. one per category of the object) to keep its name.
+func (n *Namer) Apply(rulesets []crowler.Ruleset) (*Report, error) {
+	report := &Report{Source: n.source, Renamed: []Renamed{}}
+	taken := make(map[string]namedRule)
+	for i := range rulesets {
+		ruleset := &rulesets[i]
+		for j := range ruleset.RuleGroups {
+			group := &ruleset.RuleGroups[j]
+			for k := range group.DetectionRules {
+				rule := &group.DetectionRules[k]
+				name, err := n.name(*ruleset, *group, *rule)
+				if err != nil {
+					return nil, err
+				}
+				rule.RuleName = name
+				first, ok := taken[name]
+				if !ok {
+					taken[name] = namedRule{ruleset.RulesetName, *rule}
+					continue
+				}
+				if first.ruleset != ruleset.RulesetName && reflect.DeepEqual(first.rule, *rule) {
+					continue
+				}
+
+				unique := name
+				for s := 2; hasName(taken, unique); s++ {
+					unique = name + "_" + strconv.Itoa(s)
+				}
+				rule.RuleName = unique
+				taken[unique] = namedRule{ruleset.RulesetName, *rule}
+				slog.Debug("Renamed rule", "ruleset", ruleset.RulesetName, "rule", name, "renamed", unique, "collides_with", first.ruleset)
+				report.Renamed = append(report.Renamed, Renamed{
+					Ruleset: ruleset.RulesetName, Object: rule.ObjectName, Name: name, Renamed: unique, CollidesWith: first.ruleset,
+				})
+			}
+		}
+	}
+	return report, nil
+}
+
+// hasName tells if name is taken
+func hasName(taken map[string]namedRule, name string) bool {
+	_, ok := taken[name]
+	return ok
+}
+
+// name returns the name of rule, of group of ruleset, after the template
+func (n *Namer) name(ruleset crowler.Ruleset, group crowler.RuleGroup, rule crowler.DetectionRule) (string, error) {
+	if n.template == nil {
+		return rule.RuleName, nil
+	}
+	prefix := ""
+	if n.namespace != "" {
+		prefix = n.namespace + "_"
+	}
+	category := "uncategorized"
+	if group.Category != "" {
+		category = slug.Make(group.Category)
+	}
+	fields := Fields{
+		Source:   slug.Make(n.source),
+		Slug:     slug.Make(rule.ObjectName),
+		Object:   rule.ObjectName,
+		Category: category,
+		Group:    strings.TrimPrefix(group.GroupName, prefix),
+		Ruleset:  strings.TrimPrefix(ruleset.RulesetName, prefix),
+		Name:     strings.TrimPrefix(rule.RuleName, prefix),
+	}
+	var b strings.Builder
+	if err := n.template.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("rule %s: %v", rule.RuleName, err)
+	}
+	return prefix + slug.Make(b.String()), nil
+}
+
+// Count returns the number of renamed rules
+func (r *Report) Count() int {
+	return len(r.Renamed)
+}
+
+// Write writes the report as YAML to path
+func (r *Report) Write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(r); err != nil {
+		return fmt.Errorf("error encoding %s: %v", path, err)
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rulesetfiles lists the ruleset files of a directory, for the
+// tools reading the output of the converters: the reports and the
+// manifest the converters write next to the rulesets are left out.
+package rulesetfiles
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/duplicates"
+	"gotests/thecrowler-rules-converters/pkg/errreport"
+	"gotests/thecrowler-rules-converters/pkg/implies"
+	"gotests/thecrowler-rules-converters/pkg/manifest"
+	"gotests/thecrowler-rules-converters/pkg/quarantine"
+	"gotests/thecrowler-rules-converters/pkg/rulename"
+)
+
+// Reports are the names of the files the converters write next to the
+// rulesets
+var Reports = map[string]bool{
+	implies.FileName:       true,
+	implies.ReportFileName: true,
+	duplicates.FileName:    true,
+	errreport.FileName:     true,
+	quarantine.FileName:    true,
+	rulename.FileName:      true,
+	manifest.FileName:      true,
+}
+
+// List returns path, or the YAML and JSON files of the directory path
+// and of its subdirectories, sorted, except the Reports
+func List(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !d.IsDir() && (ext == ".yaml" || ext == ".yml" || ext == ".json") && !Reports[d.Name()] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,814 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: convertpb/convert.proto
+
+// The conversion service runs the converters of crowlerconv for the
+// programs that regenerate rulesets continuously: the source is streamed
+// in while it's converted, the rulesets are sent back once the whole
+// source is converted.
+
+package convertpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ConvertOptions are the settings of a conversion, as the crowlerconv
+// flags of the same names. The empty fields use the defaults.
+type ConvertOptions struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// converter is the name of the converter (see ListConverters), empty
+	// detects the format of the source
+	Converter string `protobuf:"bytes,1,opt,name=converter,proto3" json:"converter,omitempty"`
+	// file_name is the name of the source file, for the converters naming
+	// the rulesets after it
+	FileName      string `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Namespace     string `protobuf:"bytes,3,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	SourceLicense string `protobuf:"bytes,4,opt,name=source_license,json=sourceLicense,proto3" json:"source_license,omitempty"`
+	// valid_from and expires are the validity dates of the rules (RFC 3339
+	// or YYYY-MM-DD)
+	ValidFrom string `protobuf:"bytes,5,opt,name=valid_from,json=validFrom,proto3" json:"valid_from,omitempty"`
+	Expires   string `protobuf:"bytes,6,opt,name=expires,proto3" json:"expires,omitempty"`
+	// normalize canonicalizes the header keys and the patterns
+	Normalize bool `protobuf:"varint,7,opt,name=normalize,proto3" json:"normalize,omitempty"`
+	// confidence is the confidence of the signatures without a confidence
+	// in the source
+	Confidence float32 `protobuf:"fixed32,8,opt,name=confidence,proto3" json:"confidence,omitempty"`
+	// target_version removes the fields the format version doesn't
+	// support
+	TargetVersion string `protobuf:"bytes,9,opt,name=target_version,json=targetVersion,proto3" json:"target_version,omitempty"`
+	// format is the encoding of the rulesets: yaml (the default) or json
+	Format string `protobuf:"bytes,10,opt,name=format,proto3" json:"format,omitempty"`
+	// strict fails the conversion at the first source entry that can't be
+	// read, instead of skipping it
+	Strict bool `protobuf:"varint,11,opt,name=strict,proto3" json:"strict,omitempty"`
+	// workers is the number of goroutines converting the source items
+	Workers       int32        `protobuf:"varint,12,opt,name=workers,proto3" json:"workers,omitempty"`
+	Info          *RulesetInfo `protobuf:"bytes,13,opt,name=info,proto3" json:"info,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertOptions) Reset() {
+	*x = ConvertOptions{}
+	mi := &file_convertpb_convert_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertOptions) ProtoMessage() {}
+
+func (x *ConvertOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertOptions.ProtoReflect.Descriptor instead.
+func (*ConvertOptions) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ConvertOptions) GetConverter() string {
+	if x != nil {
+		return x.Converter
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetSourceLicense() string {
+	if x != nil {
+		return x.SourceLicense
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetValidFrom() string {
+	if x != nil {
+		return x.ValidFrom
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetExpires() string {
+	if x != nil {
+		return x.Expires
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetNormalize() bool {
+	if x != nil {
+		return x.Normalize
+	}
+	return false
+}
+
+func (x *ConvertOptions) GetConfidence() float32 {
+	if x != nil {
+		return x.Confidence
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetTargetVersion() string {
+	if x != nil {
+		return x.TargetVersion
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *ConvertOptions) GetStrict() bool {
+	if x != nil {
+		return x.Strict
+	}
+	return false
+}
+
+func (x *ConvertOptions) GetWorkers() int32 {
+	if x != nil {
+		return x.Workers
+	}
+	return 0
+}
+
+func (x *ConvertOptions) GetInfo() *RulesetInfo {
+	if x != nil {
+		return x.Info
+	}
+	return nil
+}
+
+// RulesetInfo sets the descriptive fields of the rulesets, the empty
+// fields keep the values of the converter
+type RulesetInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Author        string                 `protobuf:"bytes,1,opt,name=author,proto3" json:"author,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	FormatVersion string                 `protobuf:"bytes,3,opt,name=format_version,json=formatVersion,proto3" json:"format_version,omitempty"`
+	License       string                 `protobuf:"bytes,4,opt,name=license,proto3" json:"license,omitempty"`
+	NamePrefix    string                 `protobuf:"bytes,5,opt,name=name_prefix,json=namePrefix,proto3" json:"name_prefix,omitempty"`
+	// created_at is an RFC 3339 time or a YYYY-MM-DD date
+	CreatedAt     string `protobuf:"bytes,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RulesetInfo) Reset() {
+	*x = RulesetInfo{}
+	mi := &file_convertpb_convert_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RulesetInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RulesetInfo) ProtoMessage() {}
+
+func (x *RulesetInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RulesetInfo.ProtoReflect.Descriptor instead.
+func (*RulesetInfo) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *RulesetInfo) GetAuthor() string {
+	if x != nil {
+		return x.Author
+	}
+	return ""
+}
+
+func (x *RulesetInfo) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *RulesetInfo) GetFormatVersion() string {
+	if x != nil {
+		return x.FormatVersion
+	}
+	return ""
+}
+
+func (x *RulesetInfo) GetLicense() string {
+	if x != nil {
+		return x.License
+	}
+	return ""
+}
+
+func (x *RulesetInfo) GetNamePrefix() string {
+	if x != nil {
+		return x.NamePrefix
+	}
+	return ""
+}
+
+func (x *RulesetInfo) GetCreatedAt() string {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return ""
+}
+
+type ConvertRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// options are read from the first request only
+	Options       *ConvertOptions `protobuf:"bytes,1,opt,name=options,proto3" json:"options,omitempty"`
+	Chunk         []byte          `protobuf:"bytes,2,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertRequest) Reset() {
+	*x = ConvertRequest{}
+	mi := &file_convertpb_convert_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertRequest) ProtoMessage() {}
+
+func (x *ConvertRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertRequest.ProtoReflect.Descriptor instead.
+func (*ConvertRequest) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ConvertRequest) GetOptions() *ConvertOptions {
+	if x != nil {
+		return x.Options
+	}
+	return nil
+}
+
+func (x *ConvertRequest) GetChunk() []byte {
+	if x != nil {
+		return x.Chunk
+	}
+	return nil
+}
+
+type ConvertResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*ConvertResponse_Ruleset
+	//	*ConvertResponse_Skipped
+	Result        isConvertResponse_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConvertResponse) Reset() {
+	*x = ConvertResponse{}
+	mi := &file_convertpb_convert_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConvertResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConvertResponse) ProtoMessage() {}
+
+func (x *ConvertResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConvertResponse.ProtoReflect.Descriptor instead.
+func (*ConvertResponse) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ConvertResponse) GetResult() isConvertResponse_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *ConvertResponse) GetRuleset() *Ruleset {
+	if x != nil {
+		if x, ok := x.Result.(*ConvertResponse_Ruleset); ok {
+			return x.Ruleset
+		}
+	}
+	return nil
+}
+
+func (x *ConvertResponse) GetSkipped() *SkippedEntry {
+	if x != nil {
+		if x, ok := x.Result.(*ConvertResponse_Skipped); ok {
+			return x.Skipped
+		}
+	}
+	return nil
+}
+
+type isConvertResponse_Result interface {
+	isConvertResponse_Result()
+}
+
+type ConvertResponse_Ruleset struct {
+	Ruleset *Ruleset `protobuf:"bytes,1,opt,name=ruleset,proto3,oneof"`
+}
+
+type ConvertResponse_Skipped struct {
+	Skipped *SkippedEntry `protobuf:"bytes,2,opt,name=skipped,proto3,oneof"`
+}
+
+func (*ConvertResponse_Ruleset) isConvertResponse_Result() {}
+
+func (*ConvertResponse_Skipped) isConvertResponse_Result() {}
+
+// Ruleset is a converted ruleset, encoded in the requested format
+type Ruleset struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// file_name is the name of the file the converter suggests to write
+	// the ruleset to
+	FileName      string `protobuf:"bytes,2,opt,name=file_name,json=fileName,proto3" json:"file_name,omitempty"`
+	Data          []byte `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ruleset) Reset() {
+	*x = Ruleset{}
+	mi := &file_convertpb_convert_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ruleset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ruleset) ProtoMessage() {}
+
+func (x *Ruleset) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ruleset.ProtoReflect.Descriptor instead.
+func (*Ruleset) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Ruleset) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Ruleset) GetFileName() string {
+	if x != nil {
+		return x.FileName
+	}
+	return ""
+}
+
+func (x *Ruleset) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// SkippedEntry is a source entry that can't be read
+type SkippedEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entry         string                 `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SkippedEntry) Reset() {
+	*x = SkippedEntry{}
+	mi := &file_convertpb_convert_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SkippedEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SkippedEntry) ProtoMessage() {}
+
+func (x *SkippedEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SkippedEntry.ProtoReflect.Descriptor instead.
+func (*SkippedEntry) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SkippedEntry) GetEntry() string {
+	if x != nil {
+		return x.Entry
+	}
+	return ""
+}
+
+func (x *SkippedEntry) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ListConvertersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConvertersRequest) Reset() {
+	*x = ListConvertersRequest{}
+	mi := &file_convertpb_convert_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConvertersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConvertersRequest) ProtoMessage() {}
+
+func (x *ListConvertersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConvertersRequest.ProtoReflect.Descriptor instead.
+func (*ListConvertersRequest) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{6}
+}
+
+type ListConvertersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Converters    []*ConverterInfo       `protobuf:"bytes,1,rep,name=converters,proto3" json:"converters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConvertersResponse) Reset() {
+	*x = ListConvertersResponse{}
+	mi := &file_convertpb_convert_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConvertersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConvertersResponse) ProtoMessage() {}
+
+func (x *ListConvertersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConvertersResponse.ProtoReflect.Descriptor instead.
+func (*ListConvertersResponse) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListConvertersResponse) GetConverters() []*ConverterInfo {
+	if x != nil {
+		return x.Converters
+	}
+	return nil
+}
+
+// ConverterInfo describes a converter
+type ConverterInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Name           string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Summary        string                 `protobuf:"bytes,2,opt,name=summary,proto3" json:"summary,omitempty"`
+	Source         string                 `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	DefaultLicense string                 `protobuf:"bytes,4,opt,name=default_license,json=defaultLicense,proto3" json:"default_license,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *ConverterInfo) Reset() {
+	*x = ConverterInfo{}
+	mi := &file_convertpb_convert_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConverterInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConverterInfo) ProtoMessage() {}
+
+func (x *ConverterInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_convertpb_convert_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConverterInfo.ProtoReflect.Descriptor instead.
+func (*ConverterInfo) Descriptor() ([]byte, []int) {
+	return file_convertpb_convert_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ConverterInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ConverterInfo) GetSummary() string {
+	if x != nil {
+		return x.Summary
+	}
+	return ""
+}
+
+func (x *ConverterInfo) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *ConverterInfo) GetDefaultLicense() string {
+	if x != nil {
+		return x.DefaultLicense
+	}
+	return ""
+}
+
+var File_convertpb_convert_proto protoreflect.FileDescriptor
+
+const file_convertpb_convert_proto_rawDesc = "" +
+	"\n" +
+	"\x17convertpb/convert.proto\x12\x14crowler.converter.v1\"\xaf\x03\n" +
+	"\x0eConvertOptions\x12\x1c\n" +
+	"\tconverter\x18\x01 \x01(\tR\tconverter\x12\x1b\n" +
+	"\tfile_name\x18\x02 \x01(\tR\bfileName\x12\x1c\n" +
+	"\tnamespace\x18\x03 \x01(\tR\tnamespace\x12%\n" +
+	"\x0esource_license\x18\x04 \x01(\tR\rsourceLicense\x12\x1d\n" +
+	"\n" +
+	"valid_from\x18\x05 \x01(\tR\tvalidFrom\x12\x18\n" +
+	"\aexpires\x18\x06 \x01(\tR\aexpires\x12\x1c\n" +
+	"\tnormalize\x18\a \x01(\bR\tnormalize\x12\x1e\n" +
+	"\n" +
+	"confidence\x18\b \x01(\x02R\n" +
+	"confidence\x12%\n" +
+	"\x0etarget_version\x18\t \x01(\tR\rtargetVersion\x12\x16\n" +
+	"\x06format\x18\n" +
+	" \x01(\tR\x06format\x12\x16\n" +
+	"\x06strict\x18\v \x01(\bR\x06strict\x12\x18\n" +
+	"\aworkers\x18\f \x01(\x05R\aworkers\x125\n" +
+	"\x04info\x18\r \x01(\v2!.crowler.converter.v1.RulesetInfoR\x04info\"\xc8\x01\n" +
+	"\vRulesetInfo\x12\x16\n" +
+	"\x06author\x18\x01 \x01(\tR\x06author\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12%\n" +
+	"\x0eformat_version\x18\x03 \x01(\tR\rformatVersion\x12\x18\n" +
+	"\alicense\x18\x04 \x01(\tR\alicense\x12\x1f\n" +
+	"\vname_prefix\x18\x05 \x01(\tR\n" +
+	"namePrefix\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x06 \x01(\tR\tcreatedAt\"f\n" +
+	"\x0eConvertRequest\x12>\n" +
+	"\aoptions\x18\x01 \x01(\v2$.crowler.converter.v1.ConvertOptionsR\aoptions\x12\x14\n" +
+	"\x05chunk\x18\x02 \x01(\fR\x05chunk\"\x96\x01\n" +
+	"\x0fConvertResponse\x129\n" +
+	"\aruleset\x18\x01 \x01(\v2\x1d.crowler.converter.v1.RulesetH\x00R\aruleset\x12>\n" +
+	"\askipped\x18\x02 \x01(\v2\".crowler.converter.v1.SkippedEntryH\x00R\askippedB\b\n" +
+	"\x06result\"N\n" +
+	"\aRuleset\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1b\n" +
+	"\tfile_name\x18\x02 \x01(\tR\bfileName\x12\x12\n" +
+	"\x04data\x18\x03 \x01(\fR\x04data\":\n" +
+	"\fSkippedEntry\x12\x14\n" +
+	"\x05entry\x18\x01 \x01(\tR\x05entry\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"\x17\n" +
+	"\x15ListConvertersRequest\"]\n" +
+	"\x16ListConvertersResponse\x12C\n" +
+	"\n" +
+	"converters\x18\x01 \x03(\v2#.crowler.converter.v1.ConverterInfoR\n" +
+	"converters\"~\n" +
+	"\rConverterInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\asummary\x18\x02 \x01(\tR\asummary\x12\x16\n" +
+	"\x06source\x18\x03 \x01(\tR\x06source\x12'\n" +
+	"\x0fdefault_license\x18\x04 \x01(\tR\x0edefaultLicense2\xd4\x01\n" +
+	"\tConverter\x12Z\n" +
+	"\aConvert\x12$.crowler.converter.v1.ConvertRequest\x1a%.crowler.converter.v1.ConvertResponse(\x010\x01\x12k\n" +
+	"\x0eListConverters\x12+.crowler.converter.v1.ListConvertersRequest\x1a,.crowler.converter.v1.ListConvertersResponseB;Z9gotests/thecrowler-rules-converters/pkg/service/convertpbb\x06proto3"
+
+var (
+	file_convertpb_convert_proto_rawDescOnce sync.Once
+	file_convertpb_convert_proto_rawDescData []byte
+)
+
+func file_convertpb_convert_proto_rawDescGZIP() []byte {
+	file_convertpb_convert_proto_rawDescOnce.Do(func() {
+		file_convertpb_convert_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_convertpb_convert_proto_rawDesc), len(file_convertpb_convert_proto_rawDesc)))
+	})
+	return file_convertpb_convert_proto_rawDescData
+}
+
+var file_convertpb_convert_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_convertpb_convert_proto_goTypes = []any{
+	(*ConvertOptions)(nil),         // 0: crowler.converter.v1.ConvertOptions
+	(*RulesetInfo)(nil),            // 1: crowler.converter.v1.RulesetInfo
+	(*ConvertRequest)(nil),         // 2: crowler.converter.v1.ConvertRequest
+	(*ConvertResponse)(nil),        // 3: crowler.converter.v1.ConvertResponse
+	(*Ruleset)(nil),                // 4: crowler.converter.v1.Ruleset
+	(*SkippedEntry)(nil),           // 5: crowler.converter.v1.SkippedEntry
+	(*ListConvertersRequest)(nil),  // 6: crowler.converter.v1.ListConvertersRequest
+	(*ListConvertersResponse)(nil), // 7: crowler.converter.v1.ListConvertersResponse
+	(*ConverterInfo)(nil),          // 8: crowler.converter.v1.ConverterInfo
+}
+var file_convertpb_convert_proto_depIdxs = []int32{
+	1, // 0: crowler.converter.v1.ConvertOptions.info:type_name -> crowler.converter.v1.RulesetInfo
+	0, // 1: crowler.converter.v1.ConvertRequest.options:type_name -> crowler.converter.v1.ConvertOptions
+	4, // 2: crowler.converter.v1.ConvertResponse.ruleset:type_name -> crowler.converter.v1.Ruleset
+	5, // 3: crowler.converter.v1.ConvertResponse.skipped:type_name -> crowler.converter.v1.SkippedEntry
+	8, // 4: crowler.converter.v1.ListConvertersResponse.converters:type_name -> crowler.converter.v1.ConverterInfo
+	2, // 5: crowler.converter.v1.Converter.Convert:input_type -> crowler.converter.v1.ConvertRequest
+	6, // 6: crowler.converter.v1.Converter.ListConverters:input_type -> crowler.converter.v1.ListConvertersRequest
+	3, // 7: crowler.converter.v1.Converter.Convert:output_type -> crowler.converter.v1.ConvertResponse
+	7, // 8: crowler.converter.v1.Converter.ListConverters:output_type -> crowler.converter.v1.ListConvertersResponse
+	7, // [7:9] is the sub-list for method output_type
+	5, // [5:7] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_convertpb_convert_proto_init() }
+func file_convertpb_convert_proto_init() {
+	if File_convertpb_convert_proto != nil {
+		return
+	}
+	file_convertpb_convert_proto_msgTypes[3].OneofWrappers = []any{
+		(*ConvertResponse_Ruleset)(nil),
+		(*ConvertResponse_Skipped)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_convertpb_convert_proto_rawDesc), len(file_convertpb_convert_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_convertpb_convert_proto_goTypes,
+		DependencyIndexes: file_convertpb_convert_proto_depIdxs,
+		MessageInfos:      file_convertpb_convert_proto_msgTypes,
+	}.Build()
+	File_convertpb_convert_proto = out.File
+	file_convertpb_convert_proto_goTypes = nil
+	file_convertpb_convert_proto_depIdxs = nil
+}
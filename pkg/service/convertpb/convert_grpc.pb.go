@@ -0,0 +1,193 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: convertpb/convert.proto
+
+// The conversion service runs the converters of crowlerconv for the
+// programs that regenerate rulesets continuously: the source is streamed
+// in while it's converted, the rulesets are sent back once the whole
+// source is converted.
+
+package convertpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Converter_Convert_FullMethodName        = "/crowler.converter.v1.Converter/Convert"
+	Converter_ListConverters_FullMethodName = "/crowler.converter.v1.Converter/ListConverters"
+)
+
+// ConverterClient is the client API for Converter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Converter converts rule sources into CROWler rulesets
+type ConverterClient interface {
+	// Convert converts a source streamed in chunks. The first request has
+	// the options, every request (the first too) can have a chunk of the
+	// source. The response is a batch: the rulesets are only complete once
+	// the whole source is converted (the implies relations, for one, span
+	// all of them), so nothing is sent before the conversion ends. Then the
+	// rulesets are sent one per response, followed by the source entries
+	// that were skipped.
+	Convert(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConvertRequest, ConvertResponse], error)
+	// ListConverters lists the converters Convert can run
+	ListConverters(ctx context.Context, in *ListConvertersRequest, opts ...grpc.CallOption) (*ListConvertersResponse, error)
+}
+
+type converterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewConverterClient(cc grpc.ClientConnInterface) ConverterClient {
+	return &converterClient{cc}
+}
+
+func (c *converterClient) Convert(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ConvertRequest, ConvertResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Converter_ServiceDesc.Streams[0], Converter_Convert_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ConvertRequest, ConvertResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Converter_ConvertClient = grpc.BidiStreamingClient[ConvertRequest, ConvertResponse]
+
+func (c *converterClient) ListConverters(ctx context.Context, in *ListConvertersRequest, opts ...grpc.CallOption) (*ListConvertersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConvertersResponse)
+	err := c.cc.Invoke(ctx, Converter_ListConverters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConverterServer is the server API for Converter service.
+// All implementations must embed UnimplementedConverterServer
+// for forward compatibility.
+//
+// Converter converts rule sources into CROWler rulesets
+type ConverterServer interface {
+	// Convert converts a source streamed in chunks. The first request has
+	// the options, every request (the first too) can have a chunk of the
+	// source. The response is a batch: the rulesets are only complete once
+	// the whole source is converted (the implies relations, for one, span
+	// all of them), so nothing is sent before the conversion ends. Then the
+	// rulesets are sent one per response, followed by the source entries
+	// that were skipped.
+	Convert(grpc.BidiStreamingServer[ConvertRequest, ConvertResponse]) error
+	// ListConverters lists the converters Convert can run
+	ListConverters(context.Context, *ListConvertersRequest) (*ListConvertersResponse, error)
+	mustEmbedUnimplementedConverterServer()
+}
+
+// UnimplementedConverterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedConverterServer struct{}
+
+func (UnimplementedConverterServer) Convert(grpc.BidiStreamingServer[ConvertRequest, ConvertResponse]) error {
+	return status.Error(codes.Unimplemented, "method Convert not implemented")
+}
+func (UnimplementedConverterServer) ListConverters(context.Context, *ListConvertersRequest) (*ListConvertersResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListConverters not implemented")
+}
+func (UnimplementedConverterServer) mustEmbedUnimplementedConverterServer() {}
+func (UnimplementedConverterServer) testEmbeddedByValue()                   {}
+
+// UnsafeConverterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ConverterServer will
+// result in compilation errors.
+type UnsafeConverterServer interface {
+	mustEmbedUnimplementedConverterServer()
+}
+
+func RegisterConverterServer(s grpc.ServiceRegistrar, srv ConverterServer) {
+	// If the following call panics, it indicates UnimplementedConverterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Converter_ServiceDesc, srv)
+}
+
+func _Converter_Convert_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ConverterServer).Convert(&grpc.GenericServerStream[ConvertRequest, ConvertResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Converter_ConvertServer = grpc.BidiStreamingServer[ConvertRequest, ConvertResponse]
+
+func _Converter_ListConverters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConvertersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ConverterServer).ListConverters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Converter_ListConverters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ConverterServer).ListConverters(ctx, req.(*ListConvertersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Converter_ServiceDesc is the grpc.ServiceDesc for Converter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Converter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "crowler.converter.v1.Converter",
+	HandlerType: (*ConverterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListConverters",
+			Handler:    _Converter_ListConverters_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Convert",
+			Handler:       _Converter_Convert_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "convertpb/convert.proto",
+}
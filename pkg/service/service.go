@@ -0,0 +1,200 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package service exposes the converters over gRPC (see
+// convertpb/convert.proto), for the pipelines regenerating rulesets
+// continuously: the Convert RPC streams the source in, running the
+// conversion of pkg/convert as it arrives, and sends the rulesets back
+// when the conversion ends.
+package service
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative convertpb/convert.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"gotests/thecrowler-rules-converters/pkg/convert"
+	"gotests/thecrowler-rules-converters/pkg/converter"
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/errreport"
+	"gotests/thecrowler-rules-converters/pkg/service/convertpb"
+	"gotests/thecrowler-rules-converters/pkg/validity"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Converter service
+type Server struct {
+	convertpb.UnimplementedConverterServer
+}
+
+// NewServer returns the Converter service
+func NewServer() *Server {
+	return &Server{}
+}
+
+// ListConverters lists the registered converters
+func (s *Server) ListConverters(ctx context.Context, _ *convertpb.ListConvertersRequest) (*convertpb.ListConvertersResponse, error) {
+	resp := &convertpb.ListConvertersResponse{}
+	for _, c := range converter.All() {
+		info := c.Info()
+		resp.Converters = append(resp.Converters, &convertpb.ConverterInfo{
+			Name:           c.Name(),
+			Summary:        info.Summary,
+			Source:         info.Source,
+			DefaultLicense: info.DefaultLicense,
+		})
+	}
+	return resp, nil
+}
+
+// Convert converts the source streamed by the client. The chunks are
+// piped to the converter as they arrive, so the streamed converters
+// (e.g. wappalyzer) convert the source in bounded memory. The rulesets
+// are a batch response though: the converters return them all at the
+// end, and the implies relations are resolved across them, so they are
+// sent once the conversion is done, one per message to stay under the
+// message size limit.
+func (s *Server) Convert(stream convertpb.Converter_ConvertServer) error {
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "no options and no source")
+	}
+	if err != nil {
+		return err
+	}
+	opts, format, err := options(first.GetOptions())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	skipped := errreport.NewReport("")
+	if !first.GetOptions().GetStrict() {
+		opts.Invalid = skipped.Add
+	}
+
+	// The chunks are written to the pipe while the converter reads it,
+	// a failed conversion stops the reads
+	source, sink := io.Pipe()
+	go func() {
+		if _, err := sink.Write(first.GetChunk()); err != nil {
+			return
+		}
+		for {
+			req, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				sink.Close()
+				return
+			}
+			if err != nil {
+				sink.CloseWithError(err)
+				return
+			}
+			if _, err := sink.Write(req.GetChunk()); err != nil {
+				return
+			}
+		}
+	}()
+	rulesets, err := convert.Convert(source, opts)
+	source.CloseWithError(err)
+	if err != nil {
+		if code := status.Code(err); code != codes.Unknown {
+			return err
+		}
+		return status.Errorf(codes.InvalidArgument, "error converting the source: %v", err)
+	}
+
+	for _, ruleset := range rulesets {
+		data, err := encode(ruleset, format)
+		if err != nil {
+			return status.Errorf(codes.Internal, "error encoding ruleset %s: %v", ruleset.RulesetName, err)
+		}
+		if err := stream.Send(&convertpb.ConvertResponse{Result: &convertpb.ConvertResponse_Ruleset{Ruleset: &convertpb.Ruleset{
+			Name:     ruleset.RulesetName,
+			FileName: ruleset.FileName,
+			Data:     data,
+		}}}); err != nil {
+			return err
+		}
+	}
+	for _, entry := range skipped.Entries {
+		if err := stream.Send(&convertpb.ConvertResponse{Result: &convertpb.ConvertResponse_Skipped{Skipped: &convertpb.SkippedEntry{
+			Entry: entry.Entry,
+			Error: entry.Error,
+		}}}); err != nil {
+			return err
+		}
+	}
+	slog.Info("Converted a source", "rulesets", len(rulesets), "skipped", len(skipped.Entries))
+	return nil
+}
+
+// options converts the options of a Convert request, it returns the
+// encoding of the rulesets too
+func options(o *convertpb.ConvertOptions) (convert.Options, string, error) {
+	opts := convert.Options{
+		Converter:     o.GetConverter(),
+		TargetVersion: o.GetTargetVersion(),
+		Info: crowler.RulesetInfo{
+			Author:        o.GetInfo().GetAuthor(),
+			Description:   o.GetInfo().GetDescription(),
+			FormatVersion: o.GetInfo().GetFormatVersion(),
+			License:       o.GetInfo().GetLicense(),
+			NamePrefix:    o.GetInfo().GetNamePrefix(),
+			CreatedAt:     o.GetInfo().GetCreatedAt(),
+		},
+	}
+	opts.SourceLicense = o.GetSourceLicense()
+	opts.FileName = o.GetFileName()
+	opts.Namespace = o.GetNamespace()
+	opts.Normalize = o.GetNormalize()
+	opts.Confidence = o.GetConfidence()
+	opts.Workers = int(o.GetWorkers())
+
+	if !crowler.ValidNamespace(opts.Namespace) {
+		return opts, "", fmt.Errorf("invalid namespace %q, only letters, digits, '-' and '_' are allowed", opts.Namespace)
+	}
+	var err error
+	if opts.ValidFrom, err = validity.Normalize(o.GetValidFrom()); err != nil {
+		return opts, "", fmt.Errorf("invalid valid_from: %v", err)
+	}
+	if opts.Expires, err = validity.Normalize(o.GetExpires()); err != nil {
+		return opts, "", fmt.Errorf("invalid expires: %v", err)
+	}
+	if opts.Workers < 0 {
+		return opts, "", fmt.Errorf("invalid workers %d", opts.Workers)
+	}
+
+	format := o.GetFormat()
+	switch format {
+	case "":
+		format = "yaml"
+	case "yaml", "json":
+	default:
+		return opts, "", fmt.Errorf("unknown format %q, expected yaml or json", format)
+	}
+	return opts, format, nil
+}
+
+// encode encodes a ruleset in format
+func encode(ruleset crowler.Ruleset, format string) ([]byte, error) {
+	if format == "json" {
+		return crowler.MarshalJSON(ruleset)
+	}
+	return crowler.Marshal(ruleset)
+}
@@ -0,0 +1,139 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slug turns technology, category and ruleset names into safe
+// rule names and file names.
+//
+// Names are transliterated to ASCII (Café -> cafe), symbols with a
+// meaning are spelled out (C++ -> c_plus_plus, C# -> c_sharp), every
+// other character is replaced by a separator and the result is
+// truncated to MaxLength. A Namer adds numeric suffixes to names that
+// would otherwise collide.
+package slug
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength is the maximum length of a generated slug. Longer names are
+// truncated and suffixed with a short hash of the full name, so two long
+// names sharing the same prefix don't collide.
+const MaxLength = 64
+
+// fallback is used when nothing is left of a name (e.g. a name made only
+// of emoji)
+const fallback = "unnamed"
+
+// transliterations maps the letters that don't decompose into an ASCII
+// base letter plus combining marks
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'ø': "o", 'Ø': "o", 'œ': "oe", 'Œ': "oe",
+	'ł': "l", 'Ł': "l", 'đ': "d", 'Đ': "d", 'ð': "d", 'Ð': "d", 'þ': "th",
+	'Þ': "th", 'ı': "i", 'ħ': "h", 'Ħ': "h",
+}
+
+// symbols maps the characters that carry meaning in technology names
+var symbols = map[rune]string{
+	'+': "plus",
+	'#': "sharp",
+	'&': "and",
+	'@': "at",
+}
+
+// Make returns a rule name friendly slug of name, made of lowercase ASCII
+// letters, digits and underscores.
+func Make(name string) string {
+	return build(name, '_')
+}
+
+// File returns a file name friendly slug of name, made of lowercase ASCII
+// letters, digits and dashes.
+func File(name string) string {
+	return build(name, '-')
+}
+
+func build(name string, sep byte) string {
+	var b strings.Builder
+	pendingSep := false
+	writeWord := func(word string) {
+		if pendingSep && b.Len() > 0 {
+			b.WriteByte(sep)
+		}
+		pendingSep = false
+		b.WriteString(word)
+	}
+
+	for _, r := range norm.NFKD.String(name) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining mark left by the decomposition (é -> e + ´)
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			writeWord(string(unicode.ToLower(r)))
+		case transliterations[r] != "":
+			writeWord(transliterations[r])
+		case symbols[r] != "":
+			// spelled out symbols are separate words: c++ -> c_plus_plus
+			pendingSep = true
+			writeWord(symbols[r])
+			pendingSep = true
+		default:
+			pendingSep = true
+		}
+	}
+
+	slug := b.String()
+	if slug == "" {
+		return fallback
+	}
+	if len(slug) > MaxLength {
+		sum := sha1.Sum([]byte(name))
+		hash := hex.EncodeToString(sum[:])[:8]
+		slug = strings.TrimRight(slug[:MaxLength-len(hash)-1], string(sep)) + string(sep) + hash
+	}
+	return slug
+}
+
+// Namer hands out unique names, adding a numeric suffix (_2, _3, ...) to
+// the names already taken. The zero value is not usable, use NewNamer.
+type Namer struct {
+	sep   string
+	taken map[string]bool
+}
+
+// NewNamer returns a Namer for rule names (underscore separated)
+func NewNamer() *Namer {
+	return &Namer{sep: "_", taken: make(map[string]bool)}
+}
+
+// NewFileNamer returns a Namer for file names (dash separated)
+func NewFileNamer() *Namer {
+	return &Namer{sep: "-", taken: make(map[string]bool)}
+}
+
+// Unique returns name, or name with the first free numeric suffix if name
+// was already returned by this Namer. name is expected to be a slug.
+func (n *Namer) Unique(name string) string {
+	unique := name
+	for i := 2; n.taken[unique]; i++ {
+		unique = name + n.sep + strconv.Itoa(i)
+	}
+	n.taken[unique] = true
+	return unique
+}
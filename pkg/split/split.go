@@ -0,0 +1,137 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package split splits the rulesets of a converter, one per category of
+// the source, into one small ruleset per detected object (technology), so
+// the detections of a CROWler deployment can be picked one by one.
+package split
+
+import (
+	"fmt"
+	"strings"
+
+	"gotests/thecrowler-rules-converters/pkg/crowler"
+	"gotests/thecrowler-rules-converters/pkg/slug"
+)
+
+// The ways of splitting the rulesets
+const (
+	// ByCategory keeps the rulesets of the converter, one per category
+	ByCategory = "category"
+	// ByTechnology writes a ruleset per detected object
+	ByTechnology = "technology"
+)
+
+// Valid returns an error if by isn't a way of splitting the rulesets
+func Valid(by string) error {
+	if by != ByCategory && by != ByTechnology {
+		return fmt.Errorf("invalid split %q, expected %s or %s", by, ByCategory, ByTechnology)
+	}
+	return nil
+}
+
+// ByObject returns a ruleset per object detected by the rules of
+// rulesets (the rule name for the rules without an object), named
+// detect_<object>_ruleset with the namespace prefix and written to
+// detect-<object>.yaml. It keeps the rule groups of the rules of the
+// object, and their parent groups, and the metadata of the first ruleset
+// detecting it. A rule in several rulesets (e.g. one per category of the
+// object) is kept once. The rulesets with action rules are kept as they
+// are.
+func ByObject(rulesets []crowler.Ruleset, namespace string) []crowler.Ruleset {
+	var out []crowler.Ruleset
+	index := make(map[string]int)
+	names := slug.NewNamer()
+	prefix := ""
+	if namespace != "" {
+		prefix = namespace + "_"
+	}
+
+	for _, ruleset := range rulesets {
+		if hasActionRules(ruleset) {
+			out = append(out, ruleset)
+			continue
+		}
+		byName := make(map[string]crowler.RuleGroup, len(ruleset.RuleGroups))
+		for _, group := range ruleset.RuleGroups {
+			byName[group.GroupName] = group
+		}
+
+		for _, group := range ruleset.RuleGroups {
+			for _, rule := range group.DetectionRules {
+				object := rule.ObjectName
+				if object == "" {
+					object = rule.RuleName
+				}
+				i, ok := index[object]
+				if !ok {
+					name := names.Unique(slug.Make(object))
+					split := ruleset
+					split.RulesetName = prefix + "detect_" + name + "_ruleset"
+					split.Description = fmt.Sprintf("Ruleset to detect %s.", object)
+					split.FileName = "detect-" + strings.ReplaceAll(name, "_", "-") + ".yaml"
+					split.RuleGroups = []crowler.RuleGroup{}
+					out = append(out, split)
+					i = len(out) - 1
+					index[object] = i
+				}
+				addRule(&out[i], group, rule, byName)
+			}
+		}
+	}
+	return out
+}
+
+// hasActionRules tells if ruleset has action rules
+func hasActionRules(ruleset crowler.Ruleset) bool {
+	for _, group := range ruleset.RuleGroups {
+		if len(group.ActionRules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// addRule adds rule, of group, to ruleset, with group and its parents
+// (found in byName) if ruleset lacks them. A rule ruleset already has
+// isn't added again.
+func addRule(ruleset *crowler.Ruleset, group crowler.RuleGroup, rule crowler.DetectionRule, byName map[string]crowler.RuleGroup) {
+	for _, g := range ruleset.RuleGroups {
+		for _, r := range g.DetectionRules {
+			if r.RuleName == rule.RuleName {
+				return
+			}
+		}
+	}
+	g := addGroup(ruleset, group, byName, make(map[string]bool))
+	ruleset.RuleGroups[g].DetectionRules = append(ruleset.RuleGroups[g].DetectionRules, rule)
+}
+
+// addGroup returns the index of group in ruleset, adding it without rules
+// after its parents if ruleset lacks it. seen breaks the parent cycles.
+func addGroup(ruleset *crowler.Ruleset, group crowler.RuleGroup, byName map[string]crowler.RuleGroup, seen map[string]bool) int {
+	for i, g := range ruleset.RuleGroups {
+		if g.GroupName == group.GroupName {
+			return i
+		}
+	}
+	seen[group.GroupName] = true
+	if parent, ok := byName[group.ParentGroup]; ok && !seen[parent.GroupName] {
+		addGroup(ruleset, parent, byName, seen)
+	}
+	group.ActionRules = nil
+	group.DetectionRules = []crowler.DetectionRule{}
+	ruleset.RuleGroups = append(ruleset.RuleGroups, group)
+	return len(ruleset.RuleGroups) - 1
+}
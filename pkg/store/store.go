@@ -0,0 +1,520 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package store keeps converted rulesets in a local SQLite database, so
+// large collections of rules can be queried, filtered and re-exported to
+// YAML without grepping files.
+//
+// Rulesets, groups and rules are stored as YAML documents, together with
+// the columns used to filter them (names, source and provenance, validity
+// and tags), so any kind of rule (detection, action, crawling, scraping)
+// is exported back exactly as it was imported.
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS rulesets (
+	id             INTEGER PRIMARY KEY,
+	name           TEXT NOT NULL,
+	format_version TEXT,
+	created_at     TEXT,
+	source         TEXT,
+	source_license TEXT,
+	file           TEXT,
+	imported_at    TEXT NOT NULL,
+	body           TEXT NOT NULL,
+	UNIQUE (name, source)
+);
+CREATE TABLE IF NOT EXISTS rule_groups (
+	id           INTEGER PRIMARY KEY,
+	ruleset_id   INTEGER NOT NULL REFERENCES rulesets (id),
+	name         TEXT NOT NULL,
+	parent_group TEXT,
+	body         TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rules (
+	id          INTEGER PRIMARY KEY,
+	group_id    INTEGER NOT NULL REFERENCES rule_groups (id),
+	kind        TEXT NOT NULL,
+	name        TEXT,
+	object_name TEXT,
+	valid_from  TEXT,
+	expires     TEXT,
+	body        TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rule_tags (
+	rule_id INTEGER NOT NULL REFERENCES rules (id),
+	tag     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS rule_groups_ruleset ON rule_groups (ruleset_id);
+CREATE INDEX IF NOT EXISTS rules_group ON rules (group_id);
+CREATE INDEX IF NOT EXISTS rules_object ON rules (object_name);
+CREATE INDEX IF NOT EXISTS rule_tags_rule ON rule_tags (rule_id);
+`
+
+// Store is a SQLite database of rulesets
+type Store struct {
+	db *sql.DB
+}
+
+// Rule is a rule stored in the database, with its provenance
+type Rule struct {
+	ID            int64
+	Ruleset       string
+	Source        string
+	SourceLicense string
+	Group         string
+	ParentGroup   string
+	Kind          string // detection_rules, action_rules, ...
+	Name          string
+	Object        string
+	ValidFrom     string
+	Expires       string
+	Body          string
+}
+
+// Filter selects the rules to query or export. Empty fields match
+// everything; the string fields are case-insensitive and accept * as a
+// wildcard.
+type Filter struct {
+	Source  string
+	Ruleset string
+	Group   string
+	Kind    string
+	Rule    string
+	Object  string
+	Tag     string
+	// ValidAt selects the rules valid at the given time (not expired and,
+	// if set, with valid_from in the past)
+	ValidAt time.Time
+}
+
+// Open opens (creating it if needed) the database at path
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1) // SQLite allows a single writer
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// mappingValue returns the value node for key in a YAML mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// scalar returns the value of a scalar field of a mapping node
+func scalar(node *yaml.Node, key string) string {
+	if v := mappingValue(node, key); v != nil && v.Kind == yaml.ScalarNode {
+		return v.Value
+	}
+	return ""
+}
+
+// splitMapping returns a copy of node without the keys for which drop
+// returns true, and the dropped key/value pairs
+func splitMapping(node *yaml.Node, drop func(key string, value *yaml.Node) bool) (*yaml.Node, []*yaml.Node) {
+	kept := *node
+	kept.Content = nil
+	var dropped []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if drop(node.Content[i].Value, node.Content[i+1]) {
+			dropped = append(dropped, node.Content[i], node.Content[i+1])
+		} else {
+			kept.Content = append(kept.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+	return &kept, dropped
+}
+
+// isRuleList returns true for the group fields holding rules
+// (detection_rules, action_rules, crawling_rules, scraping_rules, ...).
+// Empty lists are kept in the group document, so they are exported as
+// they were imported.
+func isRuleList(key string, value *yaml.Node) bool {
+	return strings.HasSuffix(key, "_rules") && value.Kind == yaml.SequenceNode && len(value.Content) > 0
+}
+
+func encode(node *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return "", err
+	}
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Import stores the ruleset in data, replacing the ruleset with the same
+// name and source if already present. file is recorded as provenance.
+// It returns the number of rules imported.
+func (s *Store) Import(data []byte, file string) (int, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("error parsing YAML: %v", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("not a ruleset")
+	}
+	root := doc.Content[0]
+	name := scalar(root, "ruleset_name")
+	if name == "" {
+		return 0, fmt.Errorf("missing ruleset_name")
+	}
+	source := scalar(root, "source")
+
+	rulesetNode, _ := splitMapping(root, func(key string, _ *yaml.Node) bool { return key == "rule_groups" })
+	rulesetBody, err := encode(rulesetNode)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := deleteRuleset(tx, name, source); err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`INSERT INTO rulesets (name, format_version, created_at, source, source_license, file, imported_at, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		name, scalar(root, "format_version"), scalar(root, "created_at"), source,
+		scalar(root, "source_license"), file, time.Now().Format(time.RFC3339), rulesetBody)
+	if err != nil {
+		return 0, err
+	}
+	rulesetID, _ := res.LastInsertId()
+
+	count := 0
+	groups := mappingValue(root, "rule_groups")
+	if groups != nil {
+		for _, group := range groups.Content {
+			groupNode, lists := splitMapping(group, isRuleList)
+			groupBody, err := encode(groupNode)
+			if err != nil {
+				return 0, err
+			}
+			res, err := tx.Exec(`INSERT INTO rule_groups (ruleset_id, name, parent_group, body) VALUES (?, ?, ?, ?)`,
+				rulesetID, scalar(group, "group_name"), scalar(group, "parent_group"), groupBody)
+			if err != nil {
+				return 0, err
+			}
+			groupID, _ := res.LastInsertId()
+
+			for i := 0; i+1 < len(lists); i += 2 {
+				kind := lists[i].Value
+				for _, rule := range lists[i+1].Content {
+					if err := insertRule(tx, groupID, kind, rule); err != nil {
+						return 0, err
+					}
+					count++
+				}
+			}
+		}
+	}
+
+	return count, tx.Commit()
+}
+
+func insertRule(tx *sql.Tx, groupID int64, kind string, rule *yaml.Node) error {
+	body, err := encode(rule)
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO rules (group_id, kind, name, object_name, valid_from, expires, body)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		groupID, kind, scalar(rule, "rule_name"), scalar(rule, "object_name"),
+		scalar(rule, "valid_from"), scalar(rule, "expires"), body)
+	if err != nil {
+		return err
+	}
+	ruleID, _ := res.LastInsertId()
+	if tags := mappingValue(rule, "tags"); tags != nil {
+		for _, tag := range tags.Content {
+			if _, err := tx.Exec(`INSERT INTO rule_tags (rule_id, tag) VALUES (?, ?)`, ruleID, tag.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteRuleset(tx *sql.Tx, name, source string) error {
+	for _, stmt := range []string{
+		`DELETE FROM rule_tags WHERE rule_id IN (SELECT r.id FROM rules r JOIN rule_groups g ON r.group_id = g.id
+			JOIN rulesets s ON g.ruleset_id = s.id WHERE s.name = ? AND s.source = ?)`,
+		`DELETE FROM rules WHERE group_id IN (SELECT g.id FROM rule_groups g
+			JOIN rulesets s ON g.ruleset_id = s.id WHERE s.name = ? AND s.source = ?)`,
+		`DELETE FROM rule_groups WHERE ruleset_id IN (SELECT id FROM rulesets WHERE name = ? AND source = ?)`,
+		`DELETE FROM rulesets WHERE name = ? AND source = ?`,
+	} {
+		if _, err := tx.Exec(stmt, name, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// likePattern converts a * wildcard pattern to a LIKE pattern
+func likePattern(p string) string {
+	p = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(p)
+	return strings.ReplaceAll(p, "*", "%")
+}
+
+// where returns the WHERE clause and the arguments for f
+func (f Filter) where() (string, []any) {
+	var conds []string
+	var args []any
+	like := func(column, value string) {
+		if value != "" {
+			conds = append(conds, column+` LIKE ? ESCAPE '\'`)
+			args = append(args, likePattern(value))
+		}
+	}
+	like("s.source", f.Source)
+	like("s.name", f.Ruleset)
+	like("g.name", f.Group)
+	like("r.kind", f.Kind)
+	like("r.name", f.Rule)
+	like("r.object_name", f.Object)
+	if f.Tag != "" {
+		conds = append(conds, `EXISTS (SELECT 1 FROM rule_tags t WHERE t.rule_id = r.id AND t.tag LIKE ? ESCAPE '\')`)
+		args = append(args, likePattern(f.Tag))
+	}
+	if !f.ValidAt.IsZero() {
+		// validity dates are stored in RFC3339, comparable as text once
+		// converted to UTC
+		at := f.ValidAt.UTC().Format(time.RFC3339)
+		conds = append(conds, `(r.expires IS NULL OR r.expires = '' OR datetime(r.expires) > datetime(?))`,
+			`(r.valid_from IS NULL OR r.valid_from = '' OR datetime(r.valid_from) <= datetime(?))`)
+		args = append(args, at, at)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+const selectRules = `SELECT r.id, s.name, COALESCE(s.source, ''), COALESCE(s.source_license, ''), g.name,
+	COALESCE(g.parent_group, ''), r.kind, COALESCE(r.name, ''), COALESCE(r.object_name, ''),
+	COALESCE(r.valid_from, ''), COALESCE(r.expires, ''), r.body
+	FROM rules r JOIN rule_groups g ON r.group_id = g.id JOIN rulesets s ON g.ruleset_id = s.id`
+
+// Query returns the rules matching f, in import order
+func (s *Store) Query(f Filter) ([]Rule, error) {
+	where, args := f.where()
+	rows, err := s.db.Query(selectRules+where+` ORDER BY s.id, g.id, r.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var r Rule
+		if err := rows.Scan(&r.ID, &r.Ruleset, &r.Source, &r.SourceLicense, &r.Group, &r.ParentGroup,
+			&r.Kind, &r.Name, &r.Object, &r.ValidFrom, &r.Expires, &r.Body); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// Document is an exported ruleset
+type Document struct {
+	Ruleset string
+	Source  string
+	Data    []byte
+}
+
+// storedRule is a matching rule read by Export
+type storedRule struct {
+	kind string
+	body string
+}
+
+// Export rebuilds the rulesets containing the rules matching f, with only
+// the matching rules, the groups containing them and their parent groups,
+// in import order.
+func (s *Store) Export(f Filter) ([]Document, error) {
+	where, args := f.where()
+	rows, err := s.db.Query(`SELECT s.id, g.id, r.kind, r.body
+		FROM rules r JOIN rule_groups g ON r.group_id = g.id JOIN rulesets s ON g.ruleset_id = s.id`+
+		where+` ORDER BY s.id, g.id, r.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var rulesetIDs []int64
+	matches := make(map[int64][]storedRule) // by group ID
+	for rows.Next() {
+		var rulesetID, groupID int64
+		var rule storedRule
+		if err := rows.Scan(&rulesetID, &groupID, &rule.kind, &rule.body); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if len(rulesetIDs) == 0 || rulesetIDs[len(rulesetIDs)-1] != rulesetID {
+			rulesetIDs = append(rulesetIDs, rulesetID)
+		}
+		matches[groupID] = append(matches[groupID], rule)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	docs := make([]Document, 0, len(rulesetIDs))
+	for _, id := range rulesetIDs {
+		doc, err := s.exportRuleset(id, matches)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// exportRuleset rebuilds a ruleset with the matching rules of its groups
+func (s *Store) exportRuleset(id int64, matches map[int64][]storedRule) (Document, error) {
+	var doc Document
+	var body string
+	err := s.db.QueryRow(`SELECT name, COALESCE(source, ''), body FROM rulesets WHERE id = ?`, id).
+		Scan(&doc.Ruleset, &doc.Source, &body)
+	if err != nil {
+		return doc, err
+	}
+	root, err := decode(body)
+	if err != nil {
+		return doc, fmt.Errorf("ruleset %s: %v", doc.Ruleset, err)
+	}
+
+	type storedGroup struct {
+		id     int64
+		name   string
+		parent string
+		body   string
+	}
+	rows, err := s.db.Query(`SELECT id, name, COALESCE(parent_group, ''), body FROM rule_groups
+		WHERE ruleset_id = ? ORDER BY id`, id)
+	if err != nil {
+		return doc, err
+	}
+	var groups []storedGroup
+	parents := make(map[string]string)
+	for rows.Next() {
+		var g storedGroup
+		if err := rows.Scan(&g.id, &g.name, &g.parent, &g.body); err != nil {
+			rows.Close()
+			return doc, err
+		}
+		groups = append(groups, g)
+		parents[g.name] = g.parent
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return doc, err
+	}
+
+	// Keep the groups with matching rules and their ancestors, so the
+	// parent_group references stay valid
+	keep := make(map[string]bool)
+	for _, g := range groups {
+		if len(matches[g.id]) == 0 {
+			continue
+		}
+		for name := g.name; name != "" && !keep[name]; name = parents[name] {
+			keep[name] = true
+		}
+	}
+
+	groupList := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, g := range groups {
+		if !keep[g.name] {
+			continue
+		}
+		group, err := decode(g.body)
+		if err != nil {
+			return doc, fmt.Errorf("ruleset %s: %v", doc.Ruleset, err)
+		}
+		for _, stored := range matches[g.id] {
+			rule, err := decode(stored.body)
+			if err != nil {
+				return doc, fmt.Errorf("ruleset %s: %v", doc.Ruleset, err)
+			}
+			list := mappingValue(group, stored.kind)
+			if list == nil {
+				list = &yaml.Node{Kind: yaml.SequenceNode}
+				group.Content = append(group.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: stored.kind}, list)
+			}
+			list.Content = append(list.Content, rule)
+		}
+		groupList.Content = append(groupList.Content, group)
+	}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "rule_groups"}, groupList)
+
+	data, err := encode(root)
+	if err != nil {
+		return doc, err
+	}
+	doc.Data = []byte(data)
+	return doc, nil
+}
+
+// decode parses a stored YAML document and returns its root node
+func decode(body string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(body), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, fmt.Errorf("empty document")
+	}
+	return doc.Content[0], nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package taxonomy maps the categories of the upstream sources (Wappalyzer
+// categories, BuiltWith groupings, etc.) to the CROWler entity/tag
+// taxonomy.
+package taxonomy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Taxonomy maps a source category (name or ID) to a list of CROWler tags.
+// A mapping file is a YAML (or JSON) object, for example:
+//
+//	CMS: [content-management, web-application]
+//	"22": [web-server]
+type Taxonomy map[string][]string
+
+// Load reads a taxonomy mapping file. Category keys are matched
+// case-insensitively.
+func Load(path string) (Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string][]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing taxonomy file %s: %v", path, err)
+	}
+
+	t := make(Taxonomy, len(raw))
+	for k, v := range raw {
+		key := strings.ToLower(strings.TrimSpace(k))
+		t[key] = append(t[key], v...)
+	}
+	return t, nil
+}
+
+// Tags returns the tags for the given category keys (for example the
+// category ID and its name), without duplicates. A nil Taxonomy returns
+// no tags.
+func (t Taxonomy) Tags(keys ...string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		for _, tag := range t[strings.ToLower(strings.TrimSpace(key))] {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// Merge appends the tags not already present in dst
+func Merge(dst []string, tags ...string) []string {
+	for _, tag := range tags {
+		found := false
+		for _, d := range dst {
+			if d == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, tag)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validity provides helpers to handle the valid_from and expires
+// fields of generated detection rules.
+package validity
+
+import (
+	"fmt"
+	"time"
+)
+
+// supported layouts for validity timestamps, the first one is the
+// canonical form used in the generated rules.
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02",
+}
+
+// Parse parses a validity timestamp in RFC3339 or YYYY-MM-DD format.
+func Parse(value string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC3339 or YYYY-MM-DD", value)
+}
+
+// Normalize validates value and returns it in RFC3339 format.
+// An empty value is returned unchanged.
+func Normalize(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	t, err := Parse(value)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.RFC3339), nil
+}
+
+// IsExpired returns true if expires is set and is before now.
+// Unparsable values are never considered expired.
+func IsExpired(expires string, now time.Time) bool {
+	if expires == "" {
+		return false
+	}
+	t, err := Parse(expires)
+	if err != nil {
+		return false
+	}
+	return t.Before(now)
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 Paolo Fabio Zaino
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Thin JS binding for the WebAssembly builds of the CROWler rules
+// converters. Go's wasm_exec.js must be loaded before this file.
+
+(function (global) {
+  "use strict";
+
+  // Available converters: WASM module and the function it registers.
+  const converters = {
+    techjson: { wasm: "convertTechJSON.wasm", fn: "crowlerConvertTechJSON" },
+    modsecurity: { wasm: "convertModSecurity.wasm", fn: "crowlerConvertModSecurity" },
+  };
+
+  // instantiate starts a WASM module with the Go runtime.
+  async function instantiate(source, go) {
+    if (typeof source === "string") {
+      const response = fetch(source);
+      if (WebAssembly.instantiateStreaming) {
+        return WebAssembly.instantiateStreaming(response, go.importObject);
+      }
+      const bytes = await (await response).arrayBuffer();
+      return WebAssembly.instantiate(bytes, go.importObject);
+    }
+    return WebAssembly.instantiate(source, go.importObject);
+  }
+
+  // load loads a converter and returns a function that converts a source
+  // string into {filename: yaml}. source can be a URL or the module bytes,
+  // by default the module is fetched from baseURL.
+  async function load(name, options = {}) {
+    const converter = converters[name];
+    if (!converter) {
+      throw new Error("unknown converter: " + name);
+    }
+    const go = new global.Go();
+    const source = options.module || (options.baseURL || "./") + converter.wasm;
+    const result = await instantiate(source, go);
+    go.run(result.instance);
+
+    return function convert(text, convertOptions) {
+      const out = global[converter.fn](text, convertOptions || {});
+      if (out.error) {
+        throw new Error(out.error);
+      }
+      return out.files;
+    };
+  }
+
+  global.crowlerconv = { converters: Object.keys(converters), load: load };
+})(typeof globalThis !== "undefined" ? globalThis : this);